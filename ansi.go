@@ -71,6 +71,35 @@ const (
 	LFlowRESTARTXON = byte(3) // Restart output only on XON
 )
 
+// AUTHENTICATION types - https://tools.ietf.org/html/rfc2941
+const (
+	AuthTypeNULL       = byte(0) // no authentication
+	AuthTypeKERBEROSV4 = byte(1) // Kerberos version 4
+	AuthTypeKERBEROSV5 = byte(2) // Kerberos version 5
+	AuthTypeSPX        = byte(3) // SPX
+	AuthTypeMINK       = byte(4) // MINK
+	AuthTypeSRP        = byte(5) // Secure Remote Password
+	AuthTypeRSA        = byte(6) // RSA
+	AuthTypeSSL        = byte(7) // SSL
+)
+
+// AUTHENTICATION modifiers, which are ORed together.
+const (
+	AuthWhoMask              = byte(1)  // AuthClientToServer or AuthServerToClient
+	AuthClientToServer       = byte(0)  // client authenticates to server
+	AuthServerToClient       = byte(1)  // server authenticates to client
+	AuthHowMask              = byte(2)  // AuthHowOneWay or AuthHowMutual
+	AuthHowOneWay            = byte(0)  // one-way authentication
+	AuthHowMutual            = byte(2)  // mutual authentication
+	AuthEncryptMask          = byte(20) // AuthEncryptOff, AuthEncryptUsingTelopt or AuthEncryptAfterExchange
+	AuthEncryptOff           = byte(0)  // no encryption
+	AuthEncryptUsingTelopt   = byte(4)  // encryption with the ENCRYPT option
+	AuthEncryptAfterExchange = byte(16) // encryption immediately after authentication
+	AuthIniCredFwdMask       = byte(8)  // AuthIniCredFwdOff or AuthIniCredFwdOn
+	AuthIniCredFwdOff        = byte(0)  // no credential forwarding
+	AuthIniCredFwdOn         = byte(8)  // forward credentials
+)
+
 // ENCRYPTion suboptions
 const (
 	EncryptIS       = byte(0) // I pick encryption type ...
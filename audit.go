@@ -0,0 +1,126 @@
+package telnet
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// AuditEventType is the kind of an AuditEvent.
+type AuditEventType string
+
+// Audit event types
+const (
+	// AuditConnect is a connection accepted by a Server.
+	AuditConnect AuditEventType = "connect"
+	// AuditDisconnect is a Connection closed by Close or by the peer.
+	AuditDisconnect AuditEventType = "disconnect"
+	// AuditForcedDisconnect is a Connection closed with CloseWithReason, as
+	// on exceeding a limit.
+	AuditForcedDisconnect AuditEventType = "forced_disconnect"
+	// AuditAuthSuccess is a user authenticating successfully.
+	AuditAuthSuccess AuditEventType = "auth_success"
+	// AuditAuthFailure is a failed attempt to authenticate.
+	AuditAuthFailure AuditEventType = "auth_failure"
+	// AuditOption is the AUTHENTICATION or ENCRYPT option being enabled or
+	// disabled on either side.
+	AuditOption AuditEventType = "option"
+	// AuditSnoop is an administrator starting to watch a Connection.
+	AuditSnoop AuditEventType = "snoop"
+)
+
+// AuditEvent is a security-relevant event on a Connection, for an Auditor.
+type AuditEvent struct {
+	Type AuditEventType
+	Time time.Time
+	// ConnID and RemoteAddr identify the Connection.
+	ConnID     uint64
+	RemoteAddr string
+	// User is the user authenticating, or the administrator snooping, if
+	// known.
+	User string
+	// Option, Local and Enabled describe an AuditOption event: the option,
+	// whether it changed on our side rather than the peer's, and whether it
+	// was enabled.
+	Option  byte
+	Local   bool
+	Enabled bool
+	// Err is why authentication failed or the Connection was closed.
+	Err error
+}
+
+// Auditor receives the AuditEvents of the Connections it is given to, so
+// that deployments with compliance requirements can retain them. It is called
+// from the goroutine on which each event occurs, so it must be safe for
+// concurrent use, and should not block.
+type Auditor interface {
+	Audit(e AuditEvent)
+}
+
+// AuditorFunc is an adapter to allow the use of an ordinary function as an
+// Auditor.
+type AuditorFunc func(e AuditEvent)
+
+// Audit calls f(e).
+func (f AuditorFunc) Audit(e AuditEvent) {
+	f(e)
+}
+
+// SlogAuditor returns an Auditor writing each event to l as a record at
+// slog.LevelInfo with the message "telnet: audit".
+func SlogAuditor(l *slog.Logger) Auditor {
+	return AuditorFunc(func(e AuditEvent) {
+		attrs := []slog.Attr{
+			slog.String("type", string(e.Type)),
+			slog.Uint64("conn", e.ConnID),
+			slog.String("remote", e.RemoteAddr),
+		}
+		if e.User != "" {
+			attrs = append(attrs, slog.String("user", e.User))
+		}
+		if e.Type == AuditOption {
+			attrs = append(attrs, slog.String("option", OptionCode(e.Option).String()),
+				slog.Bool("local", e.Local), slog.Bool("enabled", e.Enabled))
+		}
+		if e.Err != nil {
+			attrs = append(attrs, slog.String("error", e.Err.Error()))
+		}
+		l.LogAttrs(context.Background(), slog.LevelInfo, "telnet: audit", attrs...)
+	})
+}
+
+// Audit passes e to the Connection's Auditor, if it has one, filling in its
+// Time, ConnID and RemoteAddr. Applications use it to record events the
+// Connection cannot see, such as a password being checked or an
+// administrator snooping on the session:
+//
+//	conn.Audit(telnet.AuditEvent{Type: telnet.AuditAuthFailure, User: name, Err: err})
+//
+// Authentication failures, and the Connection being closed for flooding or
+// exceeding its limits, are also recorded as offenses in the BanStore of the
+// Server that accepted it.
+func (c *Connection) Audit(e AuditEvent) {
+	if c.banStore != nil && (e.Type == AuditAuthFailure || e.Type == AuditForcedDisconnect && isOffense(e.Err)) {
+		if host := remoteHost(c.RemoteAddr()); host != "" {
+			c.banStore.Offense(host, e.Err)
+		}
+	}
+	if c.Auditor == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = c.now()
+	}
+	e.ConnID = c.id
+	if addr := c.RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	c.Auditor.Audit(e)
+}
+
+// auditOption records a change to a security option.
+func (c *Connection) auditOption(option byte, local, enabled bool) {
+	if option == TeloptAUTHENTICATION || option == TeloptENCRYPT {
+		c.Audit(AuditEvent{Type: AuditOption, Option: option, Local: local, Enabled: enabled})
+	}
+}
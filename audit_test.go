@@ -0,0 +1,95 @@
+package telnet_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// auditLog is an Auditor keeping the events it receives.
+type auditLog struct {
+	mu     sync.Mutex
+	events []telnet.AuditEvent
+}
+
+func (l *auditLog) Audit(e telnet.AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *auditLog) types() []telnet.AuditEventType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var types []telnet.AuditEventType
+	for _, e := range l.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestConnection_Audit(t *testing.T) {
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	log := &auditLog{}
+	conn.Auditor = log
+
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetRemoteEnabled(telnet.TeloptENCRYPT, true)
+	conn.Audit(telnet.AuditEvent{Type: telnet.AuditSnoop, User: "admin"})
+	conn.CloseWithReason(&telnet.CloseError{Reason: "banned"})
+	conn.Close()
+
+	want := []telnet.AuditEventType{telnet.AuditOption, telnet.AuditSnoop, telnet.AuditForcedDisconnect}
+	if got := log.types(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("Expected events %v, got %v", want, got)
+	}
+	if e := log.events[0]; e.Option != telnet.TeloptENCRYPT || e.Local || !e.Enabled || e.ConnID != conn.ID() || e.Time.IsZero() {
+		t.Errorf("Unexpected option event %+v", e)
+	}
+	if e := log.events[2]; e.Err == nil || e.Err.Error() != "telnet: connection closed: banned" {
+		t.Errorf("Expected the close reason, got %v", e.Err)
+	}
+}
+
+func TestServer_Audit(t *testing.T) {
+	log := &auditLog{}
+	s := telnet.NewServer("", telnet.HandleFunc(echo))
+	s.Auditor = log
+	path := serveUnix(t, s, s.ListenAndServe)
+	conn, err := telnet.DialNetwork("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEcho(t, conn)
+	conn.Close()
+	if got := log.types(); len(got) < 2 || got[0] != telnet.AuditConnect {
+		t.Errorf("Expected connect events, got %v", got)
+	}
+}
+
+func TestSlogAuditor(t *testing.T) {
+	var buf bytes.Buffer
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.Auditor = telnet.SlogAuditor(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+	conn.SetLocalEnabled(telnet.TeloptAUTHENTICATION, true)
+	want := `msg="telnet: audit" type=option conn=` + strconv.FormatUint(conn.ID(), 10) + ` remote=telnettest.b option=AUTHENTICATION local=true enabled=true`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,197 @@
+package telnet
+
+import (
+	"errors"
+	"time"
+)
+
+// Authentication defaults
+const (
+	// DefaultAuthAttempts is the number of attempts a
+	// ConversationAuthenticator allows when its Attempts is zero.
+	DefaultAuthAttempts = 3
+	// DefaultAuthFailDelay is the pause after a first failed attempt when a
+	// ConversationAuthenticator's FailDelay is zero.
+	DefaultAuthFailDelay = time.Second
+	// DefaultAuthFailMessage is written after a failed attempt when a
+	// ConversationAuthenticator's FailMessage is empty.
+	DefaultAuthFailMessage = "Login incorrect\n"
+)
+
+// ErrAuthFailed is returned by a ConversationAuthenticator when the peer has
+// failed every attempt allowed.
+var ErrAuthFailed = errors.New("telnet: authentication failed")
+
+// Authenticator authenticates the peer of a Connection, as a Server does
+// before running its Handler.
+type Authenticator interface {
+	// Authenticate returns who the peer is, or why it failed to
+	// authenticate.
+	Authenticate(c *Connection) (*Principal, error)
+}
+
+// AuthenticatorFunc is an adapter to allow the use of an ordinary function as
+// an Authenticator.
+type AuthenticatorFunc func(c *Connection) (*Principal, error)
+
+// Authenticate calls f(c).
+func (f AuthenticatorFunc) Authenticate(c *Connection) (*Principal, error) {
+	return f(c)
+}
+
+// Conversation asks the user a question and returns the answer, as a PAM
+// conversation function does. The answer is echoed by the server only if echo
+// is set, so secrets are hidden from the screen when the server has enabled
+// ECHO, as options.EchoOption does; otherwise the client echoes what is typed
+// itself.
+type Conversation func(question string, echo bool) (string, error)
+
+// ConversationAuthenticator authenticates the peer with a callback holding a
+// conversation with the user, in the style of PAM, allowing a number of
+// attempts. Each failure is audited as an AuditAuthFailure, counting as an
+// offense in the Server's BanStore, and is followed by a pause that doubles
+// with each one, throttling password guessing.
+type ConversationAuthenticator struct {
+	// Converse makes an attempt to authenticate, asking the user what it
+	// needs to with ask. If the attempt fails, it may return a Principal
+	// along with the error, naming the user for the audit.
+	Converse func(ask Conversation) (*Principal, error)
+
+	// Attempts is the number of attempts allowed. If zero,
+	// DefaultAuthAttempts is used.
+	Attempts int
+
+	// FailDelay is the pause after the first failure. If zero,
+	// DefaultAuthFailDelay is used; if negative, there is none.
+	FailDelay time.Duration
+
+	// FailMessage is written after each failure. If empty,
+	// DefaultAuthFailMessage is used.
+	FailMessage string
+}
+
+// PasswordAuthenticator returns a ConversationAuthenticator asking for a user
+// name and password, and checking them with check.
+func PasswordAuthenticator(check func(user, password string) error) *ConversationAuthenticator {
+	return &ConversationAuthenticator{Converse: func(ask Conversation) (*Principal, error) {
+		user, err := ask("login: ", true)
+		if err != nil {
+			return nil, err
+		}
+		password, err := ask("Password: ", false)
+		if err != nil {
+			return nil, err
+		}
+		p := &Principal{Name: user, Method: "password"}
+		return p, check(user, password)
+	}}
+}
+
+// TokenAuthenticator returns a ConversationAuthenticator asking for a token,
+// such as a one-time password or an API key, with prompt, and checking it with
+// check, which returns who the token belongs to.
+func TokenAuthenticator(prompt string, check func(token string) (*Principal, error)) *ConversationAuthenticator {
+	return &ConversationAuthenticator{Converse: func(ask Conversation) (*Principal, error) {
+		token, err := ask(prompt, false)
+		if err != nil {
+			return nil, err
+		}
+		return check(token)
+	}}
+}
+
+// Authenticate implements Authenticator.
+func (a *ConversationAuthenticator) Authenticate(c *Connection) (*Principal, error) {
+	attempts := a.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAuthAttempts
+	}
+	delay := a.FailDelay
+	if delay == 0 {
+		delay = DefaultAuthFailDelay
+	}
+	message := a.FailMessage
+	if message == "" {
+		message = DefaultAuthFailMessage
+	}
+	for i := 0; i < attempts; i++ {
+		var readErr error
+		p, err := a.Converse(func(question string, echo bool) (string, error) {
+			answer, err := c.Ask(question, echo)
+			if err != nil {
+				readErr = err
+			}
+			return answer, err
+		})
+		if readErr != nil {
+			return nil, readErr
+		}
+		if err == nil {
+			return p, nil
+		}
+		event := AuditEvent{Type: AuditAuthFailure, Err: err}
+		if p != nil {
+			event.User = p.Name
+		}
+		c.Audit(event)
+		if delay > 0 {
+			select {
+			case <-c.after(delay << i):
+			case <-c.Closed():
+				return nil, ErrClosed
+			}
+		}
+		if _, err := c.Write([]byte(message)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrAuthFailed
+}
+
+// maxAnswer is the longest answer Ask reads.
+const maxAnswer = 1024
+
+// Ask writes question and reads a line in answer, as for a login prompt,
+// returning it without its newline. If the client has left echoing to the
+// server, what is typed is echoed if echo is set, and the newline ending it
+// in any case, so that the cursor leaves a hidden password's line. Backspace
+// and Delete erase the last character. An answer longer than 1024 bytes is an
+// error. Like Read, it must not be called concurrently with other reads.
+func (c *Connection) Ask(question string, echo bool) (string, error) {
+	if _, err := c.Write([]byte(question)); err != nil {
+		return "", err
+	}
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := c.Read(b); err != nil {
+			return "", err
+		}
+		// Echoing may be agreed to while the question is answered.
+		serverEcho := c.LocalEnabled(TeloptECHO)
+		echo := echo && serverEcho
+		switch ch := b[0]; ch {
+		case '\n':
+			if serverEcho {
+				c.Write([]byte("\n"))
+			}
+			return string(line), nil
+		case 0x7f, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				if echo {
+					c.Write([]byte("\b \b"))
+				}
+			}
+		case 0, '\r':
+		default:
+			if len(line) >= maxAnswer {
+				return "", errors.New("telnet: answer too long")
+			}
+			line = append(line, ch)
+			if echo {
+				c.Write(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package telnet_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+var errBadPassword = errors.New("bad password")
+
+func checkPassword(user, password string) error {
+	if user != "bob" || password != "secret" {
+		return errBadPassword
+	}
+	return nil
+}
+
+func TestPasswordAuthenticator(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	log := &auditLog{}
+	conn.Auditor = log
+	auth := telnet.PasswordAuthenticator(checkPassword)
+	auth.FailDelay = -1
+
+	b.Write([]byte("bob\r\nwrong\r\nbob\r\nsecret\r\n"))
+	p, err := auth.Authenticate(conn)
+	if err != nil || p == nil || *p != (telnet.Principal{Name: "bob", Method: "password"}) {
+		t.Errorf("Expected bob by password, got %+v, %v", p, err)
+	}
+	conn.Close()
+	got, _ := io.ReadAll(b)
+	want := "login: bob\r\nPassword: \r\nLogin incorrect\r\nlogin: bob\r\nPassword: \r\n"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if len(log.events) < 1 || log.events[0].Type != telnet.AuditAuthFailure ||
+		log.events[0].User != "bob" || log.events[0].Err != errBadPassword {
+		t.Errorf("Expected the failure audited, got %+v", log.events)
+	}
+}
+
+func TestPasswordAuthenticator_Fail(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	go io.Copy(io.Discard, b)
+	auth := telnet.PasswordAuthenticator(checkPassword)
+	auth.Attempts, auth.FailDelay = 2, time.Millisecond
+
+	b.Write([]byte("bob\r\n1\r\nbob\r\n2\r\nbob\r\nsecret\r\n"))
+	if _, err := auth.Authenticate(conn); err != telnet.ErrAuthFailed {
+		t.Errorf("Expected %v, got %v", telnet.ErrAuthFailed, err)
+	}
+}
+
+func TestServer_Authenticator(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		c.Write([]byte("hello " + c.Principal().Name))
+	}))
+	s.Authenticator = telnet.TokenAuthenticator("Token: ", func(token string) (*telnet.Principal, error) {
+		if token != "xyzzy" {
+			return nil, errors.New("unknown token")
+		}
+		return &telnet.Principal{Name: "ops", Method: "token"}, nil
+	})
+	go s.Serve(l)
+	defer s.Stop()
+
+	conn, err := telnet.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("xyzzy\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, _ := io.ReadAll(conn)
+	if want := "Token: hello ops"; string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
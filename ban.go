@@ -0,0 +1,143 @@
+package telnet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// BanStore tracks hosts that misbehave, and decides which are refused, giving
+// a Server fail2ban-like protection. It must be safe for concurrent use.
+type BanStore interface {
+	// Banned reports whether connections from host are to be refused.
+	Banned(host string) bool
+	// Offense records an offense by host, such as a failed login or a
+	// flood, with the error describing it.
+	Offense(host string, err error)
+}
+
+// MemoryBanStore is a BanStore held in memory, banning a host for a while
+// once it has committed a number of offenses within a window of time. It is
+// safe for concurrent use.
+type MemoryBanStore struct {
+	// Clock, if set, is used instead of the system clock.
+	Clock Clock
+
+	maxOffenses int
+	window      time.Duration
+	duration    time.Duration
+
+	mu        sync.Mutex
+	hosts     map[string]*banRecord
+	lastSweep time.Time
+}
+
+// banRecord is what a MemoryBanStore knows of a host.
+type banRecord struct {
+	offenses []time.Time // within the window, oldest first
+	until    time.Time   // end of the ban, if banned
+}
+
+// NewMemoryBanStore returns a MemoryBanStore banning a host for duration once
+// it has committed maxOffenses offenses within window.
+func NewMemoryBanStore(maxOffenses int, window, duration time.Duration) *MemoryBanStore {
+	return &MemoryBanStore{
+		maxOffenses: max(maxOffenses, 1),
+		window:      window,
+		duration:    duration,
+		hosts:       make(map[string]*banRecord),
+	}
+}
+
+// Banned implements BanStore.
+func (s *MemoryBanStore) Banned(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.hosts[host]
+	return r != nil && s.now().Before(r.until)
+}
+
+// Offense implements BanStore, banning host once it has committed enough
+// offenses.
+func (s *MemoryBanStore) Offense(host string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	r := s.hosts[host]
+	if r == nil {
+		r = &banRecord{}
+		s.hosts[host] = r
+	}
+	r.expire(now, s.window)
+	r.offenses = append(r.offenses, now)
+	if len(r.offenses) >= s.maxOffenses {
+		r.until = now.Add(s.duration)
+		r.offenses = nil
+	}
+}
+
+// Unban lifts any ban on host and forgets its offenses.
+func (s *MemoryBanStore) Unban(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hosts, host)
+}
+
+// sweep forgets the hosts with neither a ban nor offenses left, at most once
+// per window, so that the store does not grow without bound.
+func (s *MemoryBanStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.window {
+		return
+	}
+	s.lastSweep = now
+	for host, r := range s.hosts {
+		r.expire(now, s.window)
+		if len(r.offenses) == 0 && !now.Before(r.until) {
+			delete(s.hosts, host)
+		}
+	}
+}
+
+// expire drops the offenses older than the window.
+func (r *banRecord) expire(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(r.offenses) && now.Sub(r.offenses[i]) >= window {
+		i++
+	}
+	r.offenses = r.offenses[i:]
+}
+
+func (s *MemoryBanStore) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return time.Now()
+}
+
+// remoteHost returns the host of the peer at addr, or "" if it has none, as
+// for an unnamed Unix socket.
+func remoteHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// isOffense reports whether a Connection closed for reason counts against the
+// peer's host.
+func isOffense(reason error) bool {
+	var (
+		flood    *NegotiationFloodError
+		rate     *RateLimitError
+		sequence *SequenceTimeoutError
+		memory   *MemoryBudgetError
+	)
+	return errors.As(reason, &flood) || errors.As(reason, &rate) ||
+		errors.As(reason, &sequence) || errors.As(reason, &memory)
+}
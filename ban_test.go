@@ -0,0 +1,82 @@
+package telnet_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestMemoryBanStore(t *testing.T) {
+	clock := telnettest.NewFakeClock(time.Unix(0, 0))
+	s := telnet.NewMemoryBanStore(3, time.Minute, time.Hour)
+	s.Clock = clock
+	offense := errors.New("bad password")
+
+	s.Offense("10.0.0.1", offense)
+	s.Offense("10.0.0.1", offense)
+	clock.Advance(2 * time.Minute)
+	s.Offense("10.0.0.1", offense)
+	if s.Banned("10.0.0.1") {
+		t.Error("Expected offenses outside the window to be forgotten")
+	}
+	s.Offense("10.0.0.1", offense)
+	s.Offense("10.0.0.1", offense)
+	if !s.Banned("10.0.0.1") || s.Banned("10.0.0.2") {
+		t.Error("Expected only 10.0.0.1 to be banned")
+	}
+	clock.Advance(time.Hour)
+	if s.Banned("10.0.0.1") {
+		t.Error("Expected the ban to expire")
+	}
+	s.Offense("10.0.0.2", offense)
+	s.Offense("10.0.0.2", offense)
+	s.Offense("10.0.0.2", offense)
+	s.Unban("10.0.0.2")
+	if s.Banned("10.0.0.2") {
+		t.Error("Expected Unban to lift the ban")
+	}
+}
+
+func TestServer_BanStore(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans := telnet.NewMemoryBanStore(2, time.Minute, time.Hour)
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		c.Audit(telnet.AuditEvent{Type: telnet.AuditAuthFailure, User: "root"})
+		c.Read(make([]byte, 1))
+	}))
+	s.BanStore = bans
+	go s.Serve(l)
+	defer s.Stop()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !bans.Banned("127.0.0.1") {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the host to be banned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
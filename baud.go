@@ -0,0 +1,99 @@
+package telnet
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrOutputAborted is returned by a BaudWriter's Write once the user has
+// pressed a key to abort the output.
+var ErrOutputAborted = errors.New("telnet: output aborted by the user")
+
+// BaudWriter is a Writer that paces output to a Connection at the speed of a
+// modem - 300, 1200 or 9600 baud, say - for the authentic feel of a retro BBS.
+// Each byte takes ten bits, as over a serial line with one start and one stop
+// bit. Only the goroutine writing waits, so the rest of the server runs at
+// full speed.
+//
+// Pressing any key aborts the output at once, as on the BBSes of old: Write
+// returns ErrOutputAborted, as do later calls until Reset, and the key is
+// discarded. To notice the key, a BaudWriter reads from the Connection while
+// it writes, using read deadlines, so nothing else may read meanwhile.
+type BaudWriter struct {
+	// Baud is the speed of the output in bits per second.
+	Baud int
+
+	conn    *Connection
+	aborted bool
+}
+
+// NewBaudWriter returns a BaudWriter writing to c at baud bits per second.
+func NewBaudWriter(c *Connection, baud int) *BaudWriter {
+	return &BaudWriter{Baud: baud, conn: c}
+}
+
+// Reset allows output again after it was aborted.
+func (w *BaudWriter) Reset() {
+	w.aborted = false
+}
+
+// Write writes b at the BaudWriter's speed. If the user aborts the output, it
+// returns the number of bytes written before the key was pressed and
+// ErrOutputAborted. If Baud is not positive, b is written at once.
+func (w *BaudWriter) Write(b []byte) (n int, err error) {
+	if w.aborted {
+		return 0, ErrOutputAborted
+	}
+	cps := float64(w.Baud) / 10
+	if cps <= 0 {
+		return w.conn.Write(b)
+	}
+	// Write a fiftieth of a second's worth at a time, or a byte at a time
+	// at the slowest speeds.
+	step := max(1, int(cps/50))
+	interval := time.Duration(float64(step) / cps * float64(time.Second))
+	next := w.conn.now()
+	for len(b) > 0 {
+		chunk := b[:min(step, len(b))]
+		nn, err := w.conn.Write(chunk)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		b = b[nn:]
+		next = next.Add(interval)
+		if pressed, err := w.waitKey(next); err != nil {
+			return n, err
+		} else if pressed {
+			w.aborted = true
+			return n, ErrOutputAborted
+		}
+	}
+	return n, nil
+}
+
+// waitKey waits until t for a key to be pressed, reporting whether one was.
+func (w *BaudWriter) waitKey(t time.Time) (bool, error) {
+	c := w.conn
+	c.dmu.Lock()
+	saved := c.readDeadline
+	c.dmu.Unlock()
+	deadline := t
+	if !saved.IsZero() && saved.Before(t) {
+		deadline = saved
+	}
+	if err := c.SetReadDeadline(deadline); err != nil {
+		return false, err
+	}
+	defer c.SetReadDeadline(saved)
+	var key [1]byte
+	n, err := c.Read(key[:])
+	if n > 0 {
+		return true, nil
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && !deadline.Equal(saved) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,57 @@
+package telnet_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestBaudWriter(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	w := telnet.NewBaudWriter(conn, 2400)
+
+	// 24 bytes at 240 characters a second take a tenth of a second.
+	start := time.Now()
+	if n, err := w.Write([]byte("The quick brown fox jump")); n != 24 || err != nil {
+		t.Fatalf("Expected 24 bytes written, got %d, %v", n, err)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("Expected the write to take a tenth of a second, took %v", d)
+	}
+	buf := make([]byte, 24)
+	if _, err := io.ReadFull(b, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key aborts the output.
+	b.Write([]byte("x"))
+	n, err := w.Write([]byte("s over the lazy dog."))
+	if err != telnet.ErrOutputAborted || n >= 20 {
+		t.Errorf("Expected the output aborted, got %d, %v", n, err)
+	}
+	if _, err := w.Write([]byte("!")); err != telnet.ErrOutputAborted {
+		t.Errorf("Expected ErrOutputAborted until Reset, got %v", err)
+	}
+	w.Reset()
+	b.Write([]byte("y"))
+	buf = buf[:1]
+	if _, err := io.ReadFull(conn, buf); err != nil || buf[0] != 'y' {
+		t.Errorf("Expected the key after the one aborting the output, got %q, %v", buf, err)
+	}
+
+	// The Connection's own read deadline is kept.
+	deadline := time.Now().Add(time.Hour)
+	conn.SetReadDeadline(deadline)
+	if _, err := w.Write([]byte("ok")); err != nil {
+		t.Error(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("Expected the expired read deadline to end the write")
+	}
+}
@@ -0,0 +1,165 @@
+package telnet_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+)
+
+// benchStreamSize is the approximate size of the streams benchmarked.
+const benchStreamSize = 64 * 1024
+
+// benchText is plain text, as from a busy MUD or BBS.
+var benchText = []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\r\n", benchStreamSize/46))
+
+// benchIACDense is data full of escaped IACs, NVT newlines and single byte
+// commands, as from a binary transfer or a chatty server.
+var benchIACDense = bytes.Repeat([]byte{'a', telnet.IAC, telnet.IAC, '\r', 0, telnet.IAC, telnet.NOP,
+	'b', '\r', '\n', telnet.IAC, telnet.GA, telnet.IAC, telnet.IAC}, benchStreamSize/14)
+
+// benchSBBody is a large subnegotiation body, such as a GMCP or MSDP dump.
+var benchSBBody = bytes.Repeat([]byte(`{"name":"sword","weight":3}`), 16*1024/27)
+
+// benchSB is a stream of large subnegotiations, with a line of text after each.
+var benchSB = func() []byte {
+	var b []byte
+	for len(b) < benchStreamSize {
+		b = append(b, telnet.IAC, telnet.SB, 201)
+		b = append(b, benchSBBody...)
+		b = append(b, telnet.IAC, telnet.SE)
+		b = append(b, "> \r\n"...)
+	}
+	return b
+}()
+
+// zlibTransform is a Transform compressing the stream with zlib, as for MCCP.
+type zlibTransform struct{}
+
+func (zlibTransform) NewReader(r io.Reader) io.Reader { return &zlibReader{r: r} }
+
+// zlibReader reads the zlib header on its first Read, so a Connection that is
+// only written to never reads.
+type zlibReader struct {
+	r  io.Reader
+	zr io.Reader
+}
+
+func (z *zlibReader) Read(b []byte) (int, error) {
+	if z.zr == nil {
+		zr, err := zlib.NewReader(z.r)
+		if err != nil {
+			return 0, err
+		}
+		z.zr = zr
+	}
+	return z.zr.Read(b)
+}
+
+func (zlibTransform) NewWriter(w io.Writer) io.Writer { return zlib.NewWriter(w) }
+
+// compress returns b compressed with zlib.
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// benchmarkRead measures decoding a stream delivered in 4 KiB reads, which
+// takes a new Connection each iteration. If compressed is set, the stream is
+// decompressed by a StageCompression transform. Throughput is measured in
+// bytes of the uncompressed stream.
+func benchmarkRead(b *testing.B, stream []byte, compressed bool) {
+	wire := stream
+	if compressed {
+		wire = compress(stream)
+	}
+	buf := make([]byte, 4096)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(stream)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn := telnet.NewConnection(&chunkConn{data: wire, chunk: 4096}, nil)
+		if compressed {
+			conn.AddTransform(telnet.StageCompression, zlibTransform{})
+		}
+		for {
+			_, err := conn.Read(buf)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func BenchmarkRead_Text(b *testing.B)     { benchmarkRead(b, benchText, false) }
+func BenchmarkRead_IACDense(b *testing.B) { benchmarkRead(b, benchIACDense, false) }
+func BenchmarkRead_LargeSB(b *testing.B)  { benchmarkRead(b, benchSB, false) }
+func BenchmarkRead_MCCP(b *testing.B)     { benchmarkRead(b, benchText, true) }
+
+// benchmarkWrite measures writing data in 4 KiB writes to a Connection that
+// discards its output, optionally through a StageCompression transform.
+func benchmarkWrite(b *testing.B, data []byte, compressed bool) {
+	conn := telnet.NewConnection(&chunkConn{}, nil)
+	defer conn.Close()
+	if compressed {
+		conn.AddTransform(telnet.StageCompression, zlibTransform{})
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for p := data; len(p) > 0; {
+			n := len(p)
+			if n > 4096 {
+				n = 4096
+			}
+			if _, err := conn.Write(p[:n]); err != nil {
+				b.Fatal(err)
+			}
+			p = p[n:]
+		}
+	}
+}
+
+func BenchmarkWrite_Text(b *testing.B) { benchmarkWrite(b, benchText, false) }
+func BenchmarkWrite_IACDense(b *testing.B) {
+	benchmarkWrite(b, bytes.Repeat([]byte{'a', telnet.IAC, '\n', 'b'}, benchStreamSize/4), false)
+}
+func BenchmarkWrite_MCCP(b *testing.B) { benchmarkWrite(b, benchText, true) }
+
+func BenchmarkWriteSubnegotiation_Large(b *testing.B) {
+	conn := telnet.NewConnection(&chunkConn{}, nil)
+	defer conn.Close()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchSBBody)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.WriteSubnegotiation(201, benchSBBody); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBroadcast measures queuing a line for a thousand Connections.
+func BenchmarkBroadcast(b *testing.B) {
+	var bc telnet.Broadcaster
+	for i := 0; i < 1000; i++ {
+		c := telnet.NewConnection(&chunkConn{}, nil)
+		defer c.Close()
+		bc.Add(c)
+	}
+	msg := []byte("The quick brown fox jumps over the lazy dog.\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bc.Broadcast(msg)
+	}
+}
@@ -0,0 +1,228 @@
+package telnet
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBroadcastQueue is the number of messages a Broadcaster queues for
+// each Connection when its QueueSize is zero.
+const DefaultBroadcastQueue = 64
+
+// ErrBroadcastQueueFull is the reason a Connection is closed with by a
+// Broadcaster with CloseOnFull set when it has no room to queue a message.
+var ErrBroadcastQueueFull = errors.New("telnet: broadcast queue full")
+
+// Broadcaster writes messages to a set of Connections - the players of a
+// game, say, or the members of a chat room. Each message is encoded for the
+// wire once, rather than for each Connection, and the encoded bytes are
+// shared by all the Connections it is queued for, so that a broadcast to
+// thousands of Connections costs little more than queuing a pointer to each.
+//
+// Each Connection has a queue of its own, written out by a goroutine of its
+// own, so that a slow Connection holds up neither the others nor Broadcast:
+// when its queue is full, the message is dropped for it, and counted by
+// Dropped, or if CloseOnFull is set the Connection is closed. The bytes queued
+// count against a Connection's MemoryBudget, and a message that would take
+// them over it on their own is dropped and the Connection closed with a
+// *MemoryBudgetError. Messages are
+// written as Write would write them, each without interleaving with other
+// writes. A Connection with a StageCharset transform has them encoded for it
+// alone.
+//
+// The zero Broadcaster is ready to use, and its methods may be called from any
+// goroutine.
+type Broadcaster struct {
+	// QueueSize is the number of messages queued for each Connection. If
+	// zero, DefaultBroadcastQueue is used.
+	QueueSize int
+
+	// CloseOnFull has a Connection whose queue is full closed, with
+	// ErrBroadcastQueueFull as its CloseReason, rather than left to miss
+	// the message.
+	CloseOnFull bool
+
+	mu      sync.Mutex
+	queues  map[*Connection]*broadcastQueue
+	dropped atomic.Uint64
+}
+
+// broadcastQueue holds the messages waiting to be written to a Connection.
+type broadcastQueue struct {
+	msgs chan *broadcastMessage
+	stop chan struct{}
+}
+
+// broadcastMessage is a message being broadcast, with its encodings for the
+// wire: [0] raw, and [1] with NVT newlines. Once made, they are only read.
+type broadcastMessage struct {
+	data []byte
+	once [2]sync.Once
+	enc  [2][]byte
+	cr   [2]bool // the encoding ends in CR
+}
+
+// Add adds c to the Connections messages are broadcast to, until it is
+// removed or closed.
+func (b *Broadcaster) Add(c *Connection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.queues[c]; ok {
+		return
+	}
+	if b.queues == nil {
+		b.queues = make(map[*Connection]*broadcastQueue)
+	}
+	size := b.QueueSize
+	if size <= 0 {
+		size = DefaultBroadcastQueue
+	}
+	q := &broadcastQueue{
+		msgs: make(chan *broadcastMessage, size),
+		stop: make(chan struct{}),
+	}
+	b.queues[c] = q
+	go b.run(c, q)
+}
+
+// Remove removes c from the Connections messages are broadcast to. Messages
+// still queued for it are not written.
+func (b *Broadcaster) Remove(c *Connection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[c]; ok {
+		delete(b.queues, c)
+		close(q.stop)
+	}
+}
+
+// Len returns the number of Connections messages are broadcast to.
+func (b *Broadcaster) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues)
+}
+
+// Dropped returns the number of messages dropped because a Connection's queue
+// was full or would have exceeded its MemoryBudget.
+func (b *Broadcaster) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Broadcast queues msg to be written to each Connection but those in except,
+// returning the number it was queued for. It does not block, and msg must not
+// be modified afterwards.
+func (b *Broadcaster) Broadcast(msg []byte, except ...*Connection) int {
+	m := &broadcastMessage{data: msg}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	size := int64(len(msg))
+	for c, q := range b.queues {
+		if slices.Contains(except, c) {
+			continue
+		}
+		queued := c.broadcastBytes.Add(size)
+		if c.MemoryBudget > 0 && queued > int64(c.MemoryBudget) {
+			c.broadcastBytes.Add(-size)
+			b.dropped.Add(1)
+			go c.exceedBudget(int(queued))
+			continue
+		}
+		select {
+		case q.msgs <- m:
+			n++
+		default:
+			c.broadcastBytes.Add(-size)
+			b.dropped.Add(1)
+			if b.CloseOnFull {
+				go c.CloseWithReason(ErrBroadcastQueueFull)
+			}
+		}
+	}
+	return n
+}
+
+// run writes the messages queued for c until it is removed or closed.
+func (b *Broadcaster) run(c *Connection, q *broadcastQueue) {
+	for {
+		select {
+		case m := <-q.msgs:
+			c.writeBroadcast(m)
+			c.broadcastBytes.Add(-int64(len(m.data)))
+		case <-q.stop:
+			q.discard(c)
+			return
+		case <-c.Closed():
+			b.mu.Lock()
+			if b.queues[c] == q {
+				delete(b.queues, c)
+			}
+			b.mu.Unlock()
+			q.discard(c)
+			return
+		}
+	}
+}
+
+// discard drops the messages left in the queue once c is no longer broadcast
+// to, so they stop counting against its MemoryBudget.
+func (q *broadcastQueue) discard(c *Connection) {
+	for {
+		select {
+		case m := <-q.msgs:
+			c.broadcastBytes.Add(-int64(len(m.data)))
+		default:
+			return
+		}
+	}
+}
+
+// encoded returns the message encoded for the wire, with newlines translated
+// if translate is set, and whether the encoding ends in CR.
+func (m *broadcastMessage) encoded(translate bool) ([]byte, bool) {
+	i := 0
+	if translate {
+		i = 1
+	}
+	m.once[i].Do(func() {
+		if bytes.IndexByte(m.data, IAC) < 0 && (!translate || !hasNewline(m.data)) {
+			m.enc[i] = m.data
+			return
+		}
+		out := make([]byte, 0, len(m.data)+len(m.data)/8)
+		m.enc[i], m.cr[i] = appendData(out, m.data, translate, false)
+	})
+	return m.enc[i], m.cr[i]
+}
+
+// writeBroadcast writes a broadcast message as Write does, using its shared
+// encoding where it applies.
+func (c *Connection) writeBroadcast(m *broadcastMessage) (err error) {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.wmu.Lock()
+	translate := c.translateOutput()
+	if l := len(c.dataWriters); l > 0 {
+		_, err = c.dataWriters[l-1].w.Write(m.data)
+	} else if translate && c.wcr {
+		// The CR last written depends on what follows it.
+		_, err = c.writeData(m.data)
+	} else {
+		enc, cr := m.encoded(translate)
+		if _, err = c.writeCoalesced(enc); err == nil {
+			c.wcr = cr
+		}
+	}
+	c.wmu.Unlock()
+	if err == nil {
+		c.bytesWritten.Add(uint64(len(m.data)))
+		c.lastWrite.Store(c.now().UnixNano())
+		c.Trace.dataWritten(m.data)
+	}
+	return c.closedErr(err)
+}
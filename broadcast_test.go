@@ -0,0 +1,105 @@
+package telnet_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestBroadcaster(t *testing.T) {
+	var bc telnet.Broadcaster
+	conns := make([]*telnet.Connection, 3)
+	peers := make([]net.Conn, 3)
+	for i := range conns {
+		a, b := telnettest.Pipe()
+		conns[i], peers[i] = telnet.NewConnection(a, nil), b
+		defer conns[i].Close()
+		bc.Add(conns[i])
+	}
+	bc.Add(conns[0])
+	conns[1].SetLocalEnabled(telnet.TeloptBINARY, true)
+	if n := bc.Len(); n != 3 {
+		t.Errorf("Expected 3 connections, got %d", n)
+	}
+
+	if n := bc.Broadcast([]byte("hi\n\xff"), conns[2]); n != 2 {
+		t.Errorf("Expected the message queued for 2 connections, got %d", n)
+	}
+	bc.Broadcast([]byte("bye\n"))
+	for i, want := range []string{"hi\r\n\xff\xffbye\r\n", "hi\n\xff\xffbye\n", "bye\r\n"} {
+		peers[i].SetReadDeadline(time.Now().Add(time.Second))
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(peers[i], got); err != nil || string(got) != want {
+			t.Errorf("Connection %d: expected %q, got %q, %v", i, want, got, err)
+		}
+	}
+
+	bc.Remove(conns[0])
+	conns[1].Close()
+	for bc.Len() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := bc.Broadcast([]byte("alone")); n != 1 {
+		t.Errorf("Expected the message queued for 1 connection, got %d", n)
+	}
+}
+
+func TestBroadcaster_Full(t *testing.T) {
+	bc := &telnet.Broadcaster{QueueSize: 1}
+	a, _ := net.Pipe() // never read, so the first write blocks
+	conn := telnet.NewConnection(a, nil)
+	bc.Add(conn)
+	for i := 0; i < 10; i++ {
+		bc.Broadcast([]byte("x"))
+	}
+	if n := bc.Dropped(); n < 8 {
+		t.Errorf("Expected at least 8 messages dropped, got %d", n)
+	}
+	conn.Close()
+
+	closing := &telnet.Broadcaster{QueueSize: 1, CloseOnFull: true}
+	a, _ = net.Pipe()
+	conn = telnet.NewConnection(a, nil)
+	closing.Add(conn)
+	for i := 0; i < 3; i++ {
+		closing.Broadcast([]byte("x"))
+	}
+	select {
+	case <-conn.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the slow connection to be closed")
+	}
+	if err := conn.CloseReason(); err != telnet.ErrBroadcastQueueFull {
+		t.Errorf("Expected ErrBroadcastQueueFull, got %v", err)
+	}
+}
+
+func TestBroadcaster_MemoryBudget(t *testing.T) {
+	bc := &telnet.Broadcaster{}
+	a, _ := net.Pipe() // never read, so the first write blocks
+	conn := telnet.NewConnection(a, nil)
+	conn.MemoryBudget = 100
+	bc.Add(conn)
+	msg := bytes.Repeat([]byte{'x'}, 60)
+	if n := bc.Broadcast(msg); n != 1 {
+		t.Fatalf("Expected the first message queued, got %d", n)
+	}
+	if n := bc.Broadcast(msg); n != 0 {
+		t.Errorf("Expected the second message dropped, queued for %d", n)
+	}
+	select {
+	case <-conn.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the connection over budget to be closed")
+	}
+	var merr *telnet.MemoryBudgetError
+	if !errors.As(conn.CloseReason(), &merr) || merr.Budget != 100 || merr.Usage != 120 {
+		t.Errorf("Expected a MemoryBudgetError, got %v", conn.CloseReason())
+	}
+}
@@ -0,0 +1,99 @@
+package telnet
+
+import (
+	"bufio"
+	"io"
+)
+
+// BufferedReader returns a bufio.Reader reading from the Connection, for use
+// with bufio, textproto and the like. Wrapping a Connection in a bufio.Reader
+// of one's own reads ahead of the application: the commands in everything
+// buffered are handled at once, before the data preceding them has been
+// used, and anything buffered is lost if the Connection is then read
+// directly. The reader returned avoids both:
+//
+//   - Each read it makes from the Connection stops before the next command,
+//     so a command is only handled once the reader needs the data following
+//     it. A line read with ReadString or ReadLine is returned before the
+//     commands received after it are handled, so that negotiation changing
+//     how input is interpreted applies from the next line on.
+//   - Read on the Connection returns the data the reader holds before
+//     reading any more, so that the two may be used in turn, as when a
+//     LineEditor or Paginator reads from the Connection between lines read
+//     with the reader.
+//
+// Every call returns the same reader. Like Read, it must only be used by one
+// goroutine at a time, and it should be called from the goroutine reading
+// the Connection.
+func (c *Connection) BufferedReader() *bufio.Reader {
+	if c.bufReader == nil {
+		c.segmented = true
+		c.bufReader = bufio.NewReader(unbufferedReader{c})
+	}
+	return c.bufReader
+}
+
+// Buffered returns the number of bytes of decoded data held by the
+// BufferedReader, which Read and Peek return without reading the underlying
+// connection. It does not block.
+func (c *Connection) Buffered() int {
+	if c.bufReader == nil {
+		return 0
+	}
+	return c.bufReader.Buffered()
+}
+
+// Peek returns up to n bytes of decoded data without consuming them, so that
+// the next Read returns them again. It only reads from the underlying
+// connection when no data is buffered, waiting as Read does until some
+// arrives, and otherwise returns at most Buffered bytes without blocking. This
+// allows an application to sniff what the peer sends first - an HTTP request
+// to the telnet port, say:
+//
+//	if p, err := conn.Peek(5); err == nil && string(p) == "GET /" {
+//		conn.Write([]byte("HTTP/1.0 400 Bad Request\r\n\r\nThis is a telnet server.\r\n"))
+//		conn.Close()
+//	}
+//
+// Peek reads through the BufferedReader, and so may be mixed with Read and
+// the reader in the same way. The slice returned is only valid until the next
+// read.
+func (c *Connection) Peek(n int) ([]byte, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	br := c.BufferedReader()
+	if br.Buffered() == 0 {
+		if _, err := br.Peek(1); err != nil {
+			return nil, err
+		}
+	}
+	return br.Peek(min(n, br.Buffered()))
+}
+
+// TeeReader has the data the application reads from the Connection copied to
+// w as it is read, after commands have been removed and newlines translated,
+// so that a transcript of the session's input may be kept without wrapping
+// every Read. With a BufferedReader, data is copied as the reader takes it
+// from the Connection. Errors writing to w are ignored, and the data is read
+// all the same. A nil w stops the copying. TeeReader may be called from any
+// goroutine; w is called from the one reading.
+func (c *Connection) TeeReader(w io.Writer) {
+	if w == nil {
+		c.tee.Store(nil)
+		return
+	}
+	c.tee.Store(&w)
+}
+
+// unbufferedReader reads from a Connection, bypassing its BufferedReader.
+type unbufferedReader struct {
+	c *Connection
+}
+
+func (r unbufferedReader) Read(b []byte) (int, error) {
+	return r.c.readUnbuffered(b)
+}
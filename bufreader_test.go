@@ -0,0 +1,105 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_BufferedReader(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	ayt := false
+	conn.OnCommand = func(cmd byte) { ayt = cmd == telnet.AYT }
+	b.Write([]byte("one\r\ntwo\r\n\xff\xf6th\xff\xffree\r\n"))
+
+	r := conn.BufferedReader()
+	if r != conn.BufferedReader() {
+		t.Error("Expected the same reader from each call")
+	}
+	if line, err := r.ReadString('\n'); err != nil || line != "one\n" {
+		t.Errorf("Expected %q, got %q, %v", "one\n", line, err)
+	}
+	if ayt {
+		t.Error("Command handled before the data preceding it was read")
+	}
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "two\n" {
+		t.Errorf("Expected %q, got %q, %v", "two\n", buf[:n], err)
+	}
+	if line, err := r.ReadString('\n'); err != nil || line != "th\xffree\n" {
+		t.Errorf("Expected %q, got %q, %v", "th\xffree\n", line, err)
+	}
+	if !ayt {
+		t.Error("Command not handled")
+	}
+}
+
+func TestConnection_Peek(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	if n := conn.Buffered(); n != 0 {
+		t.Errorf("Expected nothing buffered, got %d", n)
+	}
+	b.Write([]byte("GE\xff\xf1T / HTTP/1.0\r\n"))
+
+	p, err := conn.Peek(5)
+	if err != nil || string(p) != "GE" {
+		t.Errorf("Expected %q, got %q, %v", "GE", p, err)
+	}
+	if n := conn.Buffered(); n != 2 {
+		t.Errorf("Expected 2 bytes buffered, got %d", n)
+	}
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "GE" {
+		t.Errorf("Expected %q, got %q, %v", "GE", buf[:n], err)
+	}
+	if p, err = conn.Peek(5); err != nil || string(p) != "T / H" {
+		t.Errorf("Expected %q, got %q, %v", "T / H", p, err)
+	}
+	if p, err = conn.Peek(0); err != nil || len(p) != 0 {
+		t.Errorf("Expected nothing, got %q, %v", p, err)
+	}
+	if line, err := conn.BufferedReader().ReadString('\n'); err != nil || line != "T / HTTP/1.0\n" {
+		t.Errorf("Expected %q, got %q, %v", "T / HTTP/1.0\n", line, err)
+	}
+
+	conn.Close()
+	if _, err := conn.Peek(1); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestConnection_TeeReader(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	var transcript bytes.Buffer
+	conn.TeeReader(&transcript)
+	b.Write([]byte("one\r\n\xff\xf6two\xff\xff\r\n"))
+
+	r := conn.BufferedReader()
+	for _, want := range []string{"one\n", "two\xff\n"} {
+		if line, err := r.ReadString('\n'); err != nil || line != want {
+			t.Errorf("Expected %q, got %q, %v", want, line, err)
+		}
+	}
+	if got := transcript.String(); got != "one\ntwo\xff\n" {
+		t.Errorf("Expected the data read in the transcript, got %q", got)
+	}
+
+	conn.TeeReader(nil)
+	b.Write([]byte("three"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := transcript.String(); got != "one\ntwo\xff\n" {
+		t.Errorf("Expected nothing more in the transcript, got %q", got)
+	}
+}
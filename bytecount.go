@@ -0,0 +1,60 @@
+package telnet
+
+import "sync/atomic"
+
+// ByteCounts are the numbers of bytes a Connection has transferred in each
+// direction, at each layer of its pipeline. Comparing Raw with Stream shows
+// what compression saves; Stream less Data is the overhead of telnet framing
+// and negotiation.
+type ByteCounts struct {
+	// RawRead and RawWritten count the bytes read from and written to the
+	// underlying net.Conn, as they cross the network: compressed or
+	// encrypted, if a StageCompression or StageEncryption transform is
+	// active.
+	RawRead, RawWritten uint64
+
+	// StreamRead and StreamWritten count the bytes of the telnet stream,
+	// with its commands and escaping, beneath any compression and
+	// encryption.
+	StreamRead, StreamWritten uint64
+
+	// DataRead and DataWritten count the application data returned by Read
+	// and passed to Write, above telnet framing and any StageCharset
+	// transforms.
+	DataRead, DataWritten uint64
+}
+
+// byteCounters are the counts of bytes transferred beneath application data,
+// which is counted by bytesRead and bytesWritten.
+type byteCounters struct {
+	rawRead, rawWritten       atomic.Uint64
+	streamRead, streamWritten atomic.Uint64
+}
+
+// ByteCounts returns the numbers of bytes transferred so far. It may be called
+// from any goroutine.
+func (c *Connection) ByteCounts() ByteCounts {
+	return ByteCounts{
+		RawRead:       c.counts.rawRead.Load(),
+		RawWritten:    c.counts.rawWritten.Load(),
+		StreamRead:    c.counts.streamRead.Load(),
+		StreamWritten: c.counts.streamWritten.Load(),
+		DataRead:      c.bytesRead.Load(),
+		DataWritten:   c.bytesWritten.Load(),
+	}
+}
+
+// rawIO reads and writes the underlying net.Conn, counting the bytes.
+type rawIO struct{ c *Connection }
+
+func (r rawIO) Read(b []byte) (int, error) {
+	n, err := r.c.Conn.Read(b)
+	r.c.counts.rawRead.Add(uint64(n))
+	return n, err
+}
+
+func (r rawIO) Write(b []byte) (int, error) {
+	n, err := r.c.Conn.Write(b)
+	r.c.counts.rawWritten.Add(uint64(n))
+	return n, err
+}
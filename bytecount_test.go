@@ -0,0 +1,55 @@
+package telnet_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_ByteCounts(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	peer := &telnettest.Peer{Conn: b}
+	defer peer.Close()
+
+	go conn.Write([]byte("a\xff\n"))
+	peer.Run(t, telnettest.Expect('a', telnet.IAC, telnet.IAC, '\r', '\n'),
+		telnettest.Send(telnet.IAC, telnet.NOP, 'h', 'i'))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	want := telnet.ByteCounts{
+		RawRead: 4, RawWritten: 5,
+		StreamRead: 4, StreamWritten: 5,
+		DataRead: 2, DataWritten: 3,
+	}
+	if got := conn.ByteCounts(); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Compressed output is counted before and after compression.
+	if err := conn.AddWriteTransform(telnet.StageCompression, zlibTransform{}); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, b)
+	for i := 0; i < 100; i++ {
+		if _, err := conn.Write(benchText[:1000]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := conn.ByteCounts()
+	if got.DataWritten != 100003 {
+		t.Errorf("Expected 100003 bytes of data written, got %d", got.DataWritten)
+	}
+	if got.StreamWritten != 100005 {
+		t.Errorf("Expected 100005 bytes of stream written, got %d", got.StreamWritten)
+	}
+	if got.RawWritten <= 5 || got.RawWritten >= got.StreamWritten/10 {
+		t.Errorf("Expected a fraction of the stream written compressed, got %d of %d",
+			got.RawWritten, got.StreamWritten)
+	}
+}
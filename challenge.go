@@ -0,0 +1,140 @@
+package telnet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrChallengeFailed is the error audited when a client fails the challenge
+// of a ChallengeGate.
+var ErrChallengeFailed = errors.New("telnet: challenge failed")
+
+// Challenge is a test set by a ChallengeGate.
+type Challenge interface {
+	// New returns the question to ask, and a function checking an answer.
+	New() (question string, check func(answer string) bool)
+}
+
+// ArithmeticChallenge asks the sum of two small numbers, a test people pass
+// at a glance but naive bots do not.
+type ArithmeticChallenge struct{}
+
+// New implements Challenge.
+func (ArithmeticChallenge) New() (string, func(string) bool) {
+	a, b := mathrand.Intn(10)+1, mathrand.Intn(10)+1
+	question := fmt.Sprintf("To continue, what is %d plus %d? ", a, b)
+	return question, func(answer string) bool {
+		n, err := strconv.Atoi(answer)
+		return err == nil && n == a+b
+	}
+}
+
+// DefaultProofOfWorkDifficulty is the difficulty of a ProofOfWorkChallenge
+// whose Difficulty is zero.
+const DefaultProofOfWorkDifficulty = 4
+
+// ProofOfWorkChallenge asks for a number N such that the hex SHA-256 digest
+// of a random seed followed by N begins with a number of zeros, which takes a
+// client some computing to find but is checked at once, making each attempt
+// costly for a bot. A client can find one with a script such as:
+//
+//	n=0; until printf '%s%d' "$seed" $n | sha256sum | grep -q ^0000; do n=$((n+1)); done; echo $n
+type ProofOfWorkChallenge struct {
+	// Difficulty is the number of zeros the digest must begin with; each
+	// one makes the work sixteen times harder. If zero,
+	// DefaultProofOfWorkDifficulty is used.
+	Difficulty int
+}
+
+// New implements Challenge.
+func (c ProofOfWorkChallenge) New() (string, func(string) bool) {
+	difficulty := c.Difficulty
+	if difficulty <= 0 {
+		difficulty = DefaultProofOfWorkDifficulty
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	seed := hex.EncodeToString(b[:])
+	prefix := strings.Repeat("0", difficulty)
+	question := fmt.Sprintf("To continue, enter a number N such that the SHA-256 of %q followed by N begins with %s: ", seed, prefix)
+	return question, func(answer string) bool {
+		if _, err := strconv.ParseUint(answer, 10, 64); err != nil {
+			return false
+		}
+		sum := sha256.Sum256([]byte(seed + answer))
+		return strings.HasPrefix(hex.EncodeToString(sum[:]), prefix)
+	}
+}
+
+// DefaultChallengeAttempts is the number of attempts a ChallengeGate allows
+// when its Attempts is zero.
+const DefaultChallengeAttempts = 3
+
+// ChallengeGate is a Handler setting a client a Challenge, such as a question
+// or proof of work, before handing the Connection to the next Handler, to
+// slow down bots stuffing credentials into public services:
+//
+//	s := telnet.NewServer(":23", &telnet.ChallengeGate{
+//		Challenge: telnet.ArithmeticChallenge{},
+//		Timeout:   time.Minute,
+//		Next:      login,
+//	})
+//
+// A client that fails every attempt is audited as an AuditAuthFailure with
+// ErrChallengeFailed, counting as an offense in the Server's BanStore, and
+// disconnected.
+type ChallengeGate struct {
+	// Challenge is the test set.
+	Challenge Challenge
+	// Attempts is the number of answers allowed, each to a new question.
+	// If zero, DefaultChallengeAttempts is used.
+	Attempts int
+	// Timeout, if positive, is how long the client has to answer each
+	// question.
+	Timeout time.Duration
+	// Next handles the Connection once the client has passed.
+	Next Handler
+}
+
+// HandleTelnet implements Handler.
+func (g *ChallengeGate) HandleTelnet(c *Connection) {
+	if g.pass(c) {
+		g.Next.HandleTelnet(c)
+	}
+}
+
+// pass sets the challenge, reporting whether the client passed it.
+func (g *ChallengeGate) pass(c *Connection) bool {
+	attempts := g.Attempts
+	if attempts <= 0 {
+		attempts = DefaultChallengeAttempts
+	}
+	e := NewLineEditor(c)
+	e.HistorySize = -1
+	for i := 0; i < attempts; i++ {
+		question, check := g.Challenge.New()
+		if g.Timeout > 0 {
+			c.SetReadDeadline(c.now().Add(g.Timeout))
+		}
+		answer, err := e.ReadLine(question)
+		if err != nil {
+			c.CloseWithReason(err)
+			return false
+		}
+		if check(strings.TrimSpace(answer)) {
+			c.SetReadDeadline(time.Time{})
+			return true
+		}
+		c.Write([]byte("Wrong answer.\n"))
+	}
+	c.Audit(AuditEvent{Type: AuditAuthFailure, Err: ErrChallengeFailed})
+	c.CloseWithReason(ErrChallengeFailed)
+	return false
+}
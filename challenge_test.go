@@ -0,0 +1,104 @@
+package telnet_test
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// runGate runs gate on a Connection, answering each question with answer,
+// and reports whether the next Handler was reached.
+func runGate(t *testing.T, gate *telnet.ChallengeGate, answer func(question string) string) (*telnet.Connection, bool) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	passed := false
+	gate.Next = telnet.HandleFunc(func(*telnet.Connection) { passed = true })
+	done := make(chan struct{})
+	go func() {
+		gate.HandleTelnet(conn)
+		close(done)
+	}()
+	questions := make(chan string)
+	go func() {
+		r := bufio.NewReader(b)
+		var question string
+		for {
+			s, err := r.ReadString(' ')
+			if err != nil {
+				close(questions)
+				return
+			}
+			question += s
+			if strings.HasSuffix(question, "? ") || strings.HasSuffix(question, ": ") {
+				questions <- question
+				question = ""
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			b.Close()
+			return conn, passed
+		case question, ok := <-questions:
+			if !ok {
+				questions = nil
+				continue
+			}
+			b.Write([]byte(answer(question) + "\r\n"))
+		}
+	}
+}
+
+func TestChallengeGate_Arithmetic(t *testing.T) {
+	gate := &telnet.ChallengeGate{Challenge: telnet.ArithmeticChallenge{}}
+	conn, passed := runGate(t, gate, func(question string) string {
+		var x, y int
+		i := strings.Index(question, "what is")
+		fmt.Sscanf(question[i:], "what is %d plus %d?", &x, &y)
+		return strconv.Itoa(x + y)
+	})
+	defer conn.Close()
+	if !passed {
+		t.Error("Expected the right answer to pass")
+	}
+}
+
+func TestChallengeGate_ProofOfWork(t *testing.T) {
+	gate := &telnet.ChallengeGate{Challenge: telnet.ProofOfWorkChallenge{Difficulty: 2}}
+	conn, passed := runGate(t, gate, func(question string) string {
+		seed, _ := strconv.Unquote(question[strings.Index(question, `"`) : strings.LastIndex(question, `"`)+1])
+		for n := 0; ; n++ {
+			sum := sha256.Sum256([]byte(seed + strconv.Itoa(n)))
+			if strings.HasPrefix(hex.EncodeToString(sum[:]), "00") {
+				return strconv.Itoa(n)
+			}
+		}
+	})
+	defer conn.Close()
+	if !passed {
+		t.Error("Expected the proof of work to pass")
+	}
+}
+
+func TestChallengeGate_Fail(t *testing.T) {
+	questions := 0
+	gate := &telnet.ChallengeGate{Challenge: telnet.ArithmeticChallenge{}, Attempts: 2}
+	conn, passed := runGate(t, gate, func(string) string {
+		questions++
+		return "banana"
+	})
+	if passed || questions != 2 {
+		t.Errorf("Expected two failed attempts, got passed %v after %d", passed, questions)
+	}
+	if conn.CloseReason() != telnet.ErrChallengeFailed {
+		t.Errorf("Expected %v, got %v", telnet.ErrChallengeFailed, conn.CloseReason())
+	}
+}
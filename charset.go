@@ -0,0 +1,312 @@
+package telnet
+
+import (
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// Encoding is a character set a peer may send and expect text in.
+type Encoding int
+
+const (
+	// EncodingUnknown is the encoding of a peer not yet identified.
+	EncodingUnknown Encoding = iota
+	// EncodingUTF8 is UTF-8.
+	EncodingUTF8
+	// EncodingLatin1 is ISO 8859-1, used by many older clients in the West.
+	EncodingLatin1
+	// EncodingCP437 is code page 437, the character set of the IBM PC, with
+	// its box drawing characters, as used by DOS terminal programs and BBSes.
+	EncodingCP437
+)
+
+// String returns "UTF-8", "ISO-8859-1", "CP437" or "unknown".
+func (e Encoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "UTF-8"
+	case EncodingLatin1:
+		return "ISO-8859-1"
+	case EncodingCP437:
+		return "CP437"
+	}
+	return "unknown"
+}
+
+// cp437 holds the characters of the upper half of code page 437.
+var cp437 = []rune("" +
+	"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+// cp437Bytes maps the characters of cp437 back to their bytes.
+var cp437Bytes = func() map[rune]byte {
+	m := make(map[rune]byte, len(cp437))
+	for i, r := range cp437 {
+		m[r] = byte(0x80 + i)
+	}
+	return m
+}()
+
+// encodingKey is the key under which a Connection's Encoding is stored.
+type encodingKey struct{}
+
+// Encoding returns the Encoding the peer has been found to use by a
+// Transcoder, or EncodingUnknown if none has been.
+func (c *Connection) Encoding() Encoding {
+	e, _ := c.Value(encodingKey{}).(Encoding)
+	return e
+}
+
+// EncodingDetector guesses the encoding of text from a peer that has not
+// negotiated one, from the bytes outside ASCII: UTF-8 if they form valid
+// UTF-8 sequences, and otherwise Latin-1 or CP437 by which the bytes are
+// likelier to be. Text in Latin-1 is mostly lower case accented letters, in
+// the upper quarter of the code page, while CP437 text has its accented
+// letters at the start of the upper half and its box drawing characters in
+// the middle, where Latin-1 has control codes, symbols and capitals. The zero
+// EncodingDetector is ready to use.
+type EncodingDetector struct {
+	utf8, invalid int // valid UTF-8 sequences and bytes not in one
+	latin1, cp437 int // evidence for each
+	partial       []byte
+}
+
+// Enough evidence to decide on an encoding
+const (
+	detectUTF8Sequences = 2
+	detectEightBitBytes = 8
+)
+
+// Write adds the text in b to what the encoding is guessed from.
+func (d *EncodingDetector) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(d.partial) > 0 {
+		b = append(d.partial, b...)
+		d.partial = nil
+	}
+	for len(b) > 0 {
+		if b[0] < utf8.RuneSelf {
+			b = b[1:]
+			continue
+		}
+		if !utf8.FullRune(b) {
+			d.partial = append([]byte(nil), b...)
+			break
+		}
+		if r, size := utf8.DecodeRune(b); r != utf8.RuneError || size > 1 {
+			d.utf8++
+			b = b[size:]
+			continue
+		}
+		d.invalid++
+		switch ch := b[0]; {
+		case ch < 0xa0:
+			// C1 controls in Latin-1; letters in CP437
+			d.cp437 += 2
+		case ch >= 0xb0 && ch < 0xe0:
+			// Symbols and capitals in Latin-1; box drawing in CP437
+			d.cp437++
+		case ch >= 0xe0:
+			// Lower case letters in Latin-1; Greek and maths in CP437
+			d.latin1 += 2
+		default:
+			d.latin1++
+		}
+		b = b[1:]
+	}
+	return n, nil
+}
+
+// Encoding returns the encoding guessed, or EncodingUnknown until there is
+// enough text to go on.
+func (d *EncodingDetector) Encoding() Encoding {
+	switch {
+	case d.invalid == 0 && d.utf8 >= detectUTF8Sequences:
+		return EncodingUTF8
+	case d.invalid < detectEightBitBytes:
+		return EncodingUnknown
+	case d.cp437 > d.latin1:
+		return EncodingCP437
+	}
+	return EncodingLatin1
+}
+
+// Transcoder is a Transform converting between the UTF-8 the application
+// reads and writes and the Encoding of the peer, for clients which cannot
+// negotiate one. Install it at StageCharset:
+//
+//	t := telnet.NewTranscoder(conn, telnet.EncodingUnknown)
+//	err := conn.AddTransform(telnet.StageCharset, t)
+//
+// Given EncodingUnknown, it sniffs the encoding from what the peer sends with
+// an EncodingDetector, and once it has decided, converts to and from it,
+// records it as the Connection's Encoding and calls OnDetect. Until then,
+// input that is valid UTF-8 is passed on as it is and the rest is read as
+// Latin-1, and output is written as UTF-8. Characters that cannot be written
+// in the peer's encoding are written as '?'.
+type Transcoder struct {
+	// OnDetect, if set, is called from Read once the encoding has been
+	// sniffed.
+	OnDetect func(e Encoding)
+
+	conn     *Connection
+	mu       sync.Mutex
+	encoding Encoding
+	detector EncodingDetector
+}
+
+// NewTranscoder returns a Transcoder for c, converting to and from e, or
+// sniffing the encoding if e is EncodingUnknown.
+func NewTranscoder(c *Connection, e Encoding) *Transcoder {
+	if e != EncodingUnknown {
+		c.SetValue(encodingKey{}, e)
+	}
+	return &Transcoder{conn: c, encoding: e}
+}
+
+// Encoding returns the encoding the Transcoder converts to and from.
+func (t *Transcoder) Encoding() Encoding {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.encoding
+}
+
+// SetEncoding has the Transcoder convert to and from e from now on, as when
+// the peer has named its encoding.
+func (t *Transcoder) SetEncoding(e Encoding) {
+	t.mu.Lock()
+	t.encoding = e
+	t.mu.Unlock()
+	t.conn.SetValue(encodingKey{}, e)
+}
+
+// sniff adds input to the detector, if the encoding is still unknown,
+// returning the encoding to decode it with.
+func (t *Transcoder) sniff(b []byte) Encoding {
+	t.mu.Lock()
+	e := t.encoding
+	if e == EncodingUnknown {
+		t.detector.Write(b)
+		e = t.detector.Encoding()
+		t.encoding = e
+	}
+	t.mu.Unlock()
+	if e != EncodingUnknown && t.conn.Encoding() != e {
+		t.conn.SetValue(encodingKey{}, e)
+		if t.OnDetect != nil {
+			t.OnDetect(e)
+		}
+	}
+	if e == EncodingUnknown && !utf8.Valid(b) {
+		return EncodingLatin1
+	}
+	return e
+}
+
+// NewReader implements Transform, decoding the input read from r to UTF-8.
+func (t *Transcoder) NewReader(r io.Reader) io.Reader {
+	return &transcodeReader{t: t, r: r}
+}
+
+// NewWriter implements Transform, encoding the UTF-8 output written to w.
+func (t *Transcoder) NewWriter(w io.Writer) io.Writer {
+	return &transcodeWriter{t: t, w: w}
+}
+
+// transcodeReader is the reader of a Transcoder.
+type transcodeReader struct {
+	t       *Transcoder
+	r       io.Reader
+	buf     []byte
+	pending []byte // decoded input not yet read
+}
+
+func (r *transcodeReader) Read(b []byte) (int, error) {
+	if len(r.pending) == 0 && len(b) > 0 {
+		if cap(r.buf) < len(b) {
+			r.buf = make([]byte, len(b))
+		}
+		n, err := r.r.Read(r.buf[:len(b)])
+		if n == 0 {
+			return 0, err
+		}
+		in := r.buf[:n]
+		switch e := r.t.sniff(in); e {
+		case EncodingLatin1, EncodingCP437:
+			r.pending = decodeEightBit(r.pending[:0], in, e == EncodingCP437)
+		default:
+			r.pending = append(r.pending[:0], in...)
+		}
+		if len(r.pending) <= len(b) {
+			n := copy(b, r.pending)
+			r.pending = r.pending[:0]
+			return n, err
+		}
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// decodeEightBit appends b, in Latin-1 or CP437, to dst in UTF-8.
+func decodeEightBit(dst, b []byte, isCP437 bool) []byte {
+	for _, ch := range b {
+		switch {
+		case ch < utf8.RuneSelf:
+			dst = append(dst, ch)
+		case isCP437:
+			dst = utf8.AppendRune(dst, cp437[ch-0x80])
+		default:
+			dst = utf8.AppendRune(dst, rune(ch))
+		}
+	}
+	return dst
+}
+
+// transcodeWriter is the writer of a Transcoder.
+type transcodeWriter struct {
+	t       *Transcoder
+	w       io.Writer
+	partial []byte // an incomplete UTF-8 sequence written last
+}
+
+func (w *transcodeWriter) Write(b []byte) (int, error) {
+	e := w.t.Encoding()
+	if e != EncodingLatin1 && e != EncodingCP437 {
+		w.partial = nil
+		return w.w.Write(b)
+	}
+	in := b
+	if len(w.partial) > 0 {
+		in = append(w.partial, b...)
+		w.partial = nil
+	}
+	out := make([]byte, 0, len(in))
+	for len(in) > 0 {
+		if in[0] < utf8.RuneSelf {
+			out = append(out, in[0])
+			in = in[1:]
+			continue
+		}
+		if !utf8.FullRune(in) {
+			w.partial = append([]byte(nil), in...)
+			break
+		}
+		r, size := utf8.DecodeRune(in)
+		in = in[size:]
+		ch := byte('?')
+		if e == EncodingLatin1 && r <= 0xff && r != utf8.RuneError {
+			ch = byte(r)
+		} else if b, ok := cp437Bytes[r]; ok && e == EncodingCP437 {
+			ch = b
+		}
+		out = append(out, ch)
+	}
+	if _, err := w.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,119 @@
+package telnet_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// cp437Box is a box drawn in CP437: ╔════╗, ║ Hi ║, ╚════╝.
+const cp437Box = "\xc9\xcd\xcd\xcd\xcd\xbb\r\n\xba Hi \xba\r\n\xc8\xcd\xcd\xcd\xcd\xbc\r\n"
+
+func TestEncodingDetector(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		chunks []string
+		want   telnet.Encoding
+	}{
+		{"ASCII", []string{"hello, world\r\n"}, telnet.EncodingUnknown},
+		{"UTF-8", []string{"café naïve résumé"}, telnet.EncodingUTF8},
+		{"UTF-8 split", []string{"caf\xc3", "\xa9 na\xc3", "\xafve"}, telnet.EncodingUTF8},
+		{"Latin-1", []string{"caf\xe9 na\xefve r\xe9sum\xe9 \xe0 la cr\xe8me, gar\xe7on \xe9t\xe9"}, telnet.EncodingLatin1},
+		{"CP437", []string{cp437Box}, telnet.EncodingCP437},
+		{"CP437 text", []string{"caf\x82 na\x8bve r\x82sum\x82 \x85 la cr\x8ame, gar\x87on \x82t\x82"}, telnet.EncodingCP437},
+		{"too little", []string{"caf\xe9"}, telnet.EncodingUnknown},
+	} {
+		var d telnet.EncodingDetector
+		for _, c := range tt.chunks {
+			d.Write([]byte(c))
+		}
+		if got := d.Encoding(); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestTranscoder(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	defer b.Close()
+	tc := telnet.NewTranscoder(conn, telnet.EncodingUnknown)
+	detected := make(chan telnet.Encoding, 1)
+	tc.OnDetect = func(e telnet.Encoding) { detected <- e }
+	if err := conn.AddTransform(telnet.StageCharset, tc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until the encoding is known, output is written as UTF-8.
+	go conn.Write([]byte("é\n"))
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t, telnettest.Expect(0xc3, 0xa9, '\r', '\n'))
+
+	go b.Write([]byte(cp437Box))
+	const want = "╔════╗\n║ Hi ║\n╚════╝\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	select {
+	case e := <-detected:
+		if e != telnet.EncodingCP437 {
+			t.Errorf("Expected CP437 detected, got %v", e)
+		}
+	default:
+		t.Error("Expected OnDetect to be called")
+	}
+	if e := conn.Encoding(); e != telnet.EncodingCP437 {
+		t.Errorf("Expected the connection's encoding to be CP437, got %v", e)
+	}
+
+	// Output is now encoded, with '?' for what CP437 lacks.
+	go conn.Write([]byte("░ café € ░\n"))
+	peer.Run(t, telnettest.Expect([]byte("\xb0 caf\x82 ? \xb0\r\n")...))
+
+	// As is a character split between writes.
+	go func() {
+		conn.Write([]byte{0xc3})
+		conn.Write([]byte{0xa9})
+	}()
+	peer.Run(t, telnettest.Expect(0x82))
+}
+
+func TestTranscoder_Latin1(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	defer b.Close()
+	tc := telnet.NewTranscoder(conn, telnet.EncodingLatin1)
+	if err := conn.AddTransform(telnet.StageCharset, tc); err != nil {
+		t.Fatal(err)
+	}
+	if e := conn.Encoding(); e != telnet.EncodingLatin1 {
+		t.Errorf("Expected the connection's encoding to be Latin-1, got %v", e)
+	}
+
+	go b.Write([]byte("na\xefve\r\n"))
+	const want = "naïve\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	go conn.Write([]byte("naïve ░\n"))
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t, telnettest.Expect([]byte("na\xefve ?\r\n")...))
+
+	// Named by the peer, say, the encoding changes.
+	tc.SetEncoding(telnet.EncodingUTF8)
+	go conn.Write([]byte("ï\n"))
+	peer.Run(t, telnettest.Expect(0xc3, 0xaf, '\r', '\n'))
+}
@@ -1,6 +1,7 @@
 package telnet
 
 import (
+	"crypto/tls"
 	"net"
 )
 
@@ -8,10 +9,30 @@ import (
 // in host:port format. Any specified option handlers will be applied to the
 // connection if it is successful.
 func Dial(addr string, options ...Option) (conn *Connection, err error) {
-	c, err := net.Dial("tcp", addr)
+	return DialNetwork("tcp", addr, options...)
+}
+
+// DialNetwork is like Dial, but connects over the given network, which may be
+// any supported by net.Dial - for example "unix" with the path of a Unix
+// socket as addr.
+func DialNetwork(network, addr string, options ...Option) (conn *Connection, err error) {
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		return
+	}
+	conn = NewConnectionConfig(c, &Config{Options: options, Role: RoleClient})
+	return
+}
+
+// DialTLS is like Dial, but connects over TLS, as to a telnets server on port
+// 992. A nil config uses the defaults, verifying the server's certificate
+// against the host name in addr. The handshake is complete when DialTLS
+// returns.
+func DialTLS(addr string, config *tls.Config, options ...Option) (conn *Connection, err error) {
+	c, err := tls.Dial("tcp", addr, config)
 	if err != nil {
 		return
 	}
-	conn = NewConnection(c, options)
+	conn = NewConnectionConfig(c, &Config{Options: options, Role: RoleClient})
 	return
 }
@@ -0,0 +1,30 @@
+package telnet
+
+import "time"
+
+// Clock is a source of time. A Connection, a Player and a Recorder use the
+// system clock unless given another, such as telnettest.FakeClock, to make
+// tests of timing run instantly and deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// now returns the current time from the Connection's Clock.
+func (c *Connection) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock.Now()
+	}
+	return time.Now()
+}
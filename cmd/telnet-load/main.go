@@ -0,0 +1,75 @@
+// Command telnet-load replays recorded client sessions against a telnet
+// server at a chosen concurrency, reporting the latency of connecting and of
+// the server's negotiation as percentiles.
+//
+// Usage:
+//
+//	telnet-load [flags] host:port recording...
+//
+// Recordings are pcapng captures, such as those made by telnet-proxy -record,
+// or ttyrec recordings of a client's stream; see package replay.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/tester2024/telnet/replay"
+)
+
+func main() {
+	lt := &replay.LoadTest{}
+	flag.IntVar(&lt.Concurrency, "c", 10, "number of clients running at once")
+	flag.IntVar(&lt.Count, "n", 0, "number of sessions to run in all; by default each recording once")
+	flag.Float64Var(&lt.Speed, "speed", 1, "replay speed; 2 replays sessions twice as fast")
+	flag.DurationVar(&lt.Linger, "linger", time.Second, "how long to stay connected after the last of a session")
+	duration := flag.Duration("duration", 0, "stop after `duration`, if not 0")
+	useTLS := flag.Bool("tls", false, "connect with TLS, without verifying the server's certificate")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] host:port recording...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	lt.Addr = flag.Arg(0)
+	for _, name := range flag.Args()[1:] {
+		s, err := replay.LoadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "telnet-load:", err)
+			os.Exit(1)
+		}
+		lt.Sessions = append(lt.Sessions, s)
+	}
+	if *useTLS {
+		lt.Dial = func(ctx context.Context) (net.Conn, error) {
+			d := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+			return d.DialContext(ctx, "tcp", lt.Addr)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	report, err := lt.Run(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "telnet-load:", err)
+		os.Exit(1)
+	}
+	fmt.Print(report)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
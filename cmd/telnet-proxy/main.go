@@ -0,0 +1,166 @@
+// Command telnet-proxy is a recording gateway: it relays each client's
+// session to an upstream telnet server, printing a live trace of the
+// negotiation in both directions and optionally recording the sessions, for
+// debugging which side of an interoperability problem misbehaves.
+//
+// Usage:
+//
+//	telnet-proxy [flags] upstream-host:port
+//
+// With -record, each session is saved in the directory given: the output sent
+// to the client as a ttyrec or asciicast recording for playback, and the
+// streams on both sides of the proxy as pcapng captures for Wireshark, as
+// selected with -format. Translators registered with the telnet package, such
+// as those of the mud package, can be applied with -translate.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/tester2024/telnet"
+	_ "github.com/tester2024/telnet/mud"
+)
+
+// config holds the command line flags.
+type config struct {
+	listen    string
+	certFile  string
+	keyFile   string
+	upstream  string
+	tls       bool
+	insecure  bool
+	record    string
+	formats   string
+	translate string
+	quiet     bool
+	traceFile string
+	logLevel  string
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.listen, "listen", ":2323", "`address` to listen on")
+	flag.StringVar(&cfg.certFile, "tls-cert", "", "serve clients TLS (telnets) with the certificate in PEM `file`")
+	flag.StringVar(&cfg.keyFile, "tls-key", "", "the private key for -tls-cert, in PEM `file`")
+	flag.BoolVar(&cfg.tls, "upstream-tls", false, "connect to the upstream server with TLS")
+	flag.BoolVar(&cfg.insecure, "upstream-insecure", false, "with -upstream-tls, do not verify the server's certificate")
+	flag.StringVar(&cfg.record, "record", "", "record each session in `dir`ectory")
+	flag.StringVar(&cfg.formats, "format", "ttyrec,pcapng", "comma-separated recording `formats`: ttyrec, asciicast and pcapng")
+	flag.StringVar(&cfg.translate, "translate", "", "comma-separated `translators` to apply, of: "+strings.Join(telnet.Translators(), ", "))
+	flag.BoolVar(&cfg.quiet, "q", false, "do not print the negotiation trace")
+	flag.StringVar(&cfg.traceFile, "trace-file", "", "write the negotiation trace to `file` rather than standard error")
+	flag.StringVar(&cfg.logLevel, "log-level", "info", "log `level`: debug, info, warn or error")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] upstream-host:port\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg.upstream = flag.Arg(0)
+	if err := run(&cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "telnet-proxy:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until the listener fails.
+func run(cfg *config) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.logLevel)); err != nil {
+		return err
+	}
+	g := &gateway{
+		logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})),
+		dial: func() (*telnet.Connection, error) {
+			if cfg.tls {
+				return telnet.DialTLS(cfg.upstream, &tls.Config{InsecureSkipVerify: cfg.insecure})
+			}
+			return telnet.Dial(cfg.upstream)
+		},
+		recordDir: cfg.record,
+	}
+	if cfg.translate != "" {
+		g.translators = strings.Split(cfg.translate, ",")
+	}
+	if cfg.record != "" {
+		formats, err := parseFormats(cfg.formats)
+		if err != nil {
+			return err
+		}
+		g.formats = formats
+		if err := os.MkdirAll(cfg.record, 0o755); err != nil {
+			return err
+		}
+	}
+	if !cfg.quiet {
+		var w io.Writer = os.Stderr
+		if cfg.traceFile != "" {
+			f, err := os.OpenFile(cfg.traceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		g.trace = newTracer(w)
+	}
+
+	s := telnet.NewServer(cfg.listen, g)
+	s.Logger = g.logger
+	g.logger.Info("telnet-proxy: listening", "addr", cfg.listen, "upstream", cfg.upstream)
+	if cfg.certFile != "" || cfg.keyFile != "" {
+		return s.ListenAndServeTLS(cfg.certFile, cfg.keyFile)
+	}
+	return s.ListenAndServe()
+}
+
+// gateway is the Handler relaying each client to the upstream server.
+type gateway struct {
+	logger      *slog.Logger
+	dial        func() (*telnet.Connection, error)
+	translators []string
+	recordDir   string
+	formats     []string
+	trace       *tracer
+}
+
+// HandleTelnet relays client's session.
+func (g *gateway) HandleTelnet(client *telnet.Connection) {
+	server, err := g.dial()
+	if err != nil {
+		g.logger.Warn("telnet-proxy: upstream connection failed", "conn", client.ID(), "error", err)
+		client.Write([]byte("Upstream server unavailable.\n"))
+		return
+	}
+	server.Logger = g.logger
+	p := telnet.NewProxy(client, server)
+	if g.trace != nil {
+		p.Filters = append(p.Filters, g.trace.filter(client.ID()))
+	}
+	if err := p.Translate(g.translators...); err != nil {
+		g.logger.Error("telnet-proxy: translation failed", "error", err)
+		server.Close()
+		return
+	}
+	if g.recordDir != "" {
+		closeRecording, err := record(g.recordDir, g.formats, client, server)
+		if err != nil {
+			g.logger.Error("telnet-proxy: recording failed", "conn", client.ID(), "error", err)
+			server.Close()
+			return
+		}
+		defer closeRecording()
+	}
+	if err := p.Run(); err != nil {
+		g.logger.Info("telnet-proxy: session ended", "conn", client.ID(), "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestGateway(t *testing.T) {
+	upstream := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		c.WriteCommand(telnet.WILL, telnet.TeloptECHO)
+		c.Write([]byte("hello\n"))
+		io.Copy(io.Discard, c)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	var trace syncBuffer
+	g := &gateway{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		dial:      func() (*telnet.Connection, error) { return upstream.Dial() },
+		recordDir: dir,
+		formats:   []string{"ttyrec", "pcapng"},
+		trace:     newTracer(&trace),
+	}
+	l := telnettest.NewListener()
+	done := make(chan struct{})
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		g.HandleTelnet(c)
+		close(done)
+	}))
+	go s.Serve(l)
+	defer s.Stop()
+
+	client, err := l.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 6)
+	if _, err := io.ReadFull(client, b); err != nil || string(b) != "hello\n" {
+		t.Fatalf("Expected %q, got %q, %v", "hello\n", b, err)
+	}
+	client.Close()
+	<-done
+
+	if !strings.Contains(trace.String(), "server>client IAC WILL ECHO") {
+		t.Errorf("Expected the trace to show WILL ECHO, got %q", trace.String())
+	}
+	for _, name := range []string{"session-%d.ttyrec", "session-%d-client.pcapng", "session-%d-server.pcapng"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, strings.Replace(name, "%d", "*", 1)))
+		if len(matches) != 1 {
+			t.Errorf("Expected a recording matching %s, got %v", name, matches)
+			continue
+		}
+		if fi, err := os.Stat(matches[0]); err != nil || fi.Size() == 0 {
+			t.Errorf("Expected %s to be recorded, got %v", matches[0], err)
+		}
+	}
+}
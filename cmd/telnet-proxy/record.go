@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tester2024/telnet"
+)
+
+// parseFormats parses the -format flag.
+func parseFormats(s string) ([]string, error) {
+	formats := strings.Split(s, ",")
+	for _, f := range formats {
+		switch f {
+		case "ttyrec", "asciicast", "pcapng":
+		default:
+			return nil, fmt.Errorf("unknown recording format %q", f)
+		}
+	}
+	return formats, nil
+}
+
+// record starts recording a session in dir, in the given formats, returning a
+// function closing the recordings. Files are named after the client
+// Connection's ID:
+//
+//	session-<id>.ttyrec         the output sent to the client
+//	session-<id>.cast           the same, as asciicast
+//	session-<id>-client.pcapng  the stream between client and proxy
+//	session-<id>-server.pcapng  the stream between proxy and server
+func record(dir string, formats []string, client, server *telnet.Connection) (func(), error) {
+	var files []io.Closer
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	create := func(suffix string) (*os.File, error) {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("session-%d%s", client.ID(), suffix)))
+		if err == nil {
+			files = append(files, f)
+		}
+		return f, err
+	}
+
+	var clientTraces, serverTraces []*telnet.ConnectionTrace
+	for _, format := range formats {
+		switch format {
+		case "ttyrec", "asciicast":
+			suffix, rf := ".ttyrec", telnet.Ttyrec
+			if format == "asciicast" {
+				suffix, rf = ".cast", telnet.Asciicast
+			}
+			f, err := create(suffix)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			r, err := telnet.NewRecorder(f, rf, 80, 24)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			clientTraces = append(clientTraces, r.Trace())
+		case "pcapng":
+			f, err := create("-client.pcapng")
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			clientTraces = append(clientTraces, telnet.PcapNG(f, client))
+			if f, err = create("-server.pcapng"); err != nil {
+				closeAll()
+				return nil, err
+			}
+			serverTraces = append(serverTraces, telnet.PcapNG(f, server))
+		}
+	}
+	client.Trace = telnet.MultiTrace(append(clientTraces, client.Trace)...)
+	server.Trace = telnet.MultiTrace(append(serverTraces, server.Trace)...)
+	return closeAll, nil
+}
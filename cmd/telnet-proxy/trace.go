@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// tracer prints the negotiation passing through the proxy, one line per
+// command or subnegotiation:
+//
+//	15:04:05.000 #3 client>server IAC WILL NAWS
+//	15:04:05.001 #3 client>server IAC SB NAWS 0 80 0 24 IAC SE
+type tracer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+func newTracer(w io.Writer) *tracer {
+	return &tracer{w: w, now: time.Now}
+}
+
+// filter returns a ProxyFilter tracing the session of the client Connection
+// with the given ID. It passes everything on unchanged, so put first it shows
+// the traffic as received.
+func (t *tracer) filter(id uint64) *telnet.ProxyFilter {
+	return &telnet.ProxyFilter{
+		Command: func(dir telnet.ProxyDirection, cmd, option byte) (byte, bool) {
+			switch cmd {
+			case telnet.WILL, telnet.WONT, telnet.DO, telnet.DONT:
+				t.print(id, dir, "IAC %s %s", telnet.Command(cmd), telnet.OptionCode(option))
+			default:
+				t.print(id, dir, "IAC %s", telnet.Command(cmd))
+			}
+			return cmd, true
+		},
+		Subnegotiation: func(dir telnet.ProxyDirection, option byte, body []byte) ([]byte, bool) {
+			t.print(id, dir, "IAC SB %s %s IAC SE", telnet.OptionCode(option), formatBody(body))
+			return body, true
+		},
+	}
+}
+
+// print writes a line of the trace.
+func (t *tracer) print(id uint64, dir telnet.ProxyDirection, format string, args ...any) {
+	arrow := "client>server"
+	if dir == telnet.ToClient {
+		arrow = "server>client"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s #%d %s %s\n", t.now().Format("15:04:05.000"), id, arrow, fmt.Sprintf(format, args...))
+}
+
+// formatBody formats a subnegotiation body as decimal bytes, with runs of
+// printable text quoted.
+func formatBody(body []byte) string {
+	var parts []string
+	for i := 0; i < len(body); {
+		j := i
+		for j < len(body) && body[j] >= 0x20 && body[j] < 0x7f {
+			j++
+		}
+		if j-i >= 3 {
+			parts = append(parts, strconv.Quote(string(body[i:j])))
+			i = j
+			continue
+		}
+		parts = append(parts, strconv.Itoa(int(body[i])))
+		i++
+	}
+	return strings.Join(parts, " ")
+}
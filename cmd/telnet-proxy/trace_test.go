@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tr := newTracer(&buf)
+	tr.now = func() time.Time { return time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC) }
+	f := tr.filter(3)
+	if cmd, ok := f.Command(telnet.ToServer, telnet.WILL, telnet.TeloptNAWS); cmd != telnet.WILL || !ok {
+		t.Errorf("Expected the command to pass unchanged, got %d, %v", cmd, ok)
+	}
+	f.Command(telnet.ToClient, telnet.GA, 0)
+	f.Subnegotiation(telnet.ToServer, telnet.TeloptTTYPE, []byte("\x00VT100"))
+	expected := "15:04:05.000 #3 client>server IAC WILL NAWS\n" +
+		"15:04:05.000 #3 server>client IAC GA\n" +
+		"15:04:05.000 #3 client>server IAC SB TERMINAL TYPE 0 \"VT100\" IAC SE\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
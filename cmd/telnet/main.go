@@ -0,0 +1,256 @@
+// Command telnet is a telnet client built on the telnet package.
+//
+// Usage:
+//
+//	telnet [flags] host [port]
+//
+// With a terminal it runs interactively: the terminal is put in raw mode, and
+// lines are edited and echoed locally unless the server echoes. The escape
+// character (^] by default) opens a command prompt for sending telnet
+// commands, showing the connection's status or closing it. Without a
+// terminal, standard input is sent to the server and its output written to
+// standard output.
+//
+// A script given with -script runs first, sending text and waiting for
+// output in the manner of expect(1); see the script commands in script.go.
+//
+// Flags select TLS (telnets), a SOCKS5 or HTTP CONNECT proxy, a Unix socket,
+// logging of the session and its protocol, and which options to agree to.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+)
+
+// config holds the command line flags.
+type config struct {
+	escape     string
+	tls        bool
+	insecure   bool
+	caFile     string
+	serverName string
+	proxy      string
+	unix       bool
+	script     string
+	logFile    string
+	traceFile  string
+	debug      bool
+	binary     bool
+	naws       bool
+	echo       bool
+	sga        bool
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.escape, "e", "^]", "escape `char`acter opening the command prompt, as a character, ^X or \"none\"")
+	flag.BoolVar(&cfg.tls, "tls", false, "connect with TLS (telnets, port 992 by default)")
+	flag.BoolVar(&cfg.insecure, "insecure", false, "with -tls, do not verify the server's certificate")
+	flag.StringVar(&cfg.caFile, "ca", "", "with -tls, verify the server's certificate against the PEM `file`")
+	flag.StringVar(&cfg.serverName, "servername", "", "with -tls, the `name` to verify the server's certificate against")
+	flag.StringVar(&cfg.proxy, "proxy", "", "connect through a proxy, as socks5://[user:pass@]host:port or http://[user:pass@]host:port")
+	flag.BoolVar(&cfg.unix, "unix", false, "treat host as the path of a Unix socket")
+	flag.StringVar(&cfg.script, "script", "", "run the script in `file` before handing over to the terminal")
+	flag.StringVar(&cfg.logFile, "log", "", "append the session's output to `file`")
+	flag.StringVar(&cfg.traceFile, "trace", "", "write hex dumps of the telnet stream to `file`")
+	flag.BoolVar(&cfg.debug, "debug", false, "log negotiation to standard error")
+	flag.BoolVar(&cfg.binary, "binary", false, "agree to BINARY transmission")
+	flag.BoolVar(&cfg.naws, "naws", true, "send the window size (NAWS)")
+	flag.BoolVar(&cfg.echo, "echo", true, "let the server echo (ECHO), switching to character mode")
+	flag.BoolVar(&cfg.sga, "sga", true, "agree to SUPPRESS-GO-AHEAD")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] host [port]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(&cfg, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "telnet:", err)
+		os.Exit(1)
+	}
+}
+
+// run connects and runs the session.
+func run(cfg *config, args []string) error {
+	escape, err := parseEscape(cfg.escape)
+	if err != nil {
+		return err
+	}
+	var script []step
+	if cfg.script != "" {
+		f, err := os.Open(cfg.script)
+		if err != nil {
+			return err
+		}
+		script, err = parseScript(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.script, err)
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if cfg.logFile != "" {
+		f, err := os.OpenFile(cfg.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = io.MultiWriter(out, f)
+	}
+	var trace *telnet.ConnectionTrace
+	if cfg.traceFile != "" {
+		f, err := os.Create(cfg.traceFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		trace = telnet.HexDump(f)
+	}
+
+	// The session follows the server's options from the first offer, so
+	// its hook and the logger go in the Config rather than on the
+	// Connection once it is made.
+	s := newSession(nil, out, escape)
+	tc := &telnet.Config{
+		Role:  telnet.RoleClient,
+		Trace: telnet.MultiTrace(trace, &telnet.ConnectionTrace{OptionChanged: s.optionChanged}),
+	}
+	if cfg.debug {
+		tc.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	conn, err := connect(cfg, args, tc)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s.conn = conn
+	fmt.Fprintf(os.Stderr, "Connected to %s.\r\n", conn.RemoteAddr())
+
+	if err := runScript(conn, script, out); err != nil {
+		return err
+	}
+	err = s.run(os.Stdin)
+	fmt.Fprintf(os.Stderr, "Connection closed.\r\n")
+	return err
+}
+
+// connect dials the server named by args, a host or socket path and optional
+// port, configuring the Connection with tc and the options enabled by cfg.
+func connect(cfg *config, args []string, tc *telnet.Config) (*telnet.Connection, error) {
+	tc.Options = []telnet.Option{
+		serverOption(telnet.TeloptECHO, cfg.echo),
+		serverOption(telnet.TeloptSGA, cfg.sga),
+	}
+	if cfg.naws {
+		tc.Options = append(tc.Options, options.ExposeNAWS)
+	}
+	if cfg.binary {
+		tc.Options = append(tc.Options, options.ExposeBinary)
+	}
+
+	if cfg.unix {
+		if cfg.proxy != "" || cfg.tls {
+			return nil, errors.New("-unix cannot be used with -proxy or -tls")
+		}
+		return telnet.DialConfig("unix", args[0], tc)
+	}
+	port := "23"
+	if cfg.tls {
+		port = "992"
+	}
+	if len(args) > 1 {
+		port = args[1]
+	}
+	addr := net.JoinHostPort(args[0], port)
+
+	var tlsConfig *tls.Config
+	if cfg.tls {
+		tlsConfig = &tls.Config{ServerName: args[0], InsecureSkipVerify: cfg.insecure}
+		if cfg.serverName != "" {
+			tlsConfig.ServerName = cfg.serverName
+		}
+		if cfg.caFile != "" {
+			pem, err := os.ReadFile(cfg.caFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no certificates found", cfg.caFile)
+			}
+		}
+	}
+	if cfg.proxy == "" && tlsConfig == nil {
+		return telnet.DialConfig("tcp", addr, tc)
+	}
+
+	var c net.Conn
+	var err error
+	if cfg.proxy == "" {
+		c, err = net.Dial("tcp", addr)
+	} else {
+		c, err = dialProxy(cfg.proxy, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		tlsConn := tls.Client(c, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tlsConn
+	}
+	return telnet.NewConnectionConfig(c, tc), nil
+}
+
+// serverOption returns an Option agreeing to the server enabling option if
+// accept is set, or refusing it.
+func serverOption(option byte, accept bool) telnet.Option {
+	return func(c *telnet.Connection) telnet.Negotiator {
+		return &acceptHandler{option: option, accept: accept}
+	}
+}
+
+// acceptHandler negotiates an option the server performs, such as ECHO.
+type acceptHandler struct {
+	option byte
+	accept bool
+}
+
+func (a *acceptHandler) OptionCode() byte                        { return a.option }
+func (a *acceptHandler) Offer(c *telnet.Connection)              {}
+func (a *acceptHandler) HandleSB(c *telnet.Connection, b []byte) {}
+
+// HandleWill agrees to the option, if it is accepted and not already enabled.
+func (a *acceptHandler) HandleWill(c *telnet.Connection) {
+	if !a.accept {
+		c.WriteCommand(telnet.DONT, a.option)
+		return
+	}
+	if !c.RemoteEnabled(a.option) {
+		c.WriteCommand(telnet.DO, a.option)
+		c.SetRemoteEnabled(a.option, true)
+	}
+}
+
+// HandleDo refuses to perform the option ourselves.
+func (a *acceptHandler) HandleDo(c *telnet.Connection) {
+	c.WriteCommand(telnet.WONT, a.option)
+}
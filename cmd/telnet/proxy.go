@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// dialProxy connects to addr through the proxy given by proxyURL, a SOCKS5
+// (RFC 1928) or HTTP CONNECT proxy, with the user name and password in the
+// URL if the proxy needs them.
+func dialProxy(proxyURL, addr string) (net.Conn, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	var connect func(c net.Conn, u *url.URL, addr string) (net.Conn, error)
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		connect = socks5Connect
+	case "http":
+		connect = httpConnect
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	c, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := connect(c, u, addr)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("proxy %s: %w", u.Host, err)
+	}
+	return pc, nil
+}
+
+// SOCKS5 protocol values.
+const (
+	socksVersion  = 5
+	socksNoAuth   = 0
+	socksPassword = 2
+	socksConnect  = 1
+	socksIPv4     = 1
+	socksDomain   = 3
+	socksIPv6     = 4
+)
+
+// socks5Connect asks the SOCKS5 proxy on c to connect to addr.
+func socks5Connect(c net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	if len(host) > 255 {
+		return nil, errors.New("host name too long")
+	}
+
+	methods := []byte{socksNoAuth}
+	if u.User != nil {
+		methods = append(methods, socksPassword)
+	}
+	if _, err := c.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		return nil, err
+	}
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPassword:
+		if u.User == nil {
+			return nil, errors.New("authentication required")
+		}
+		if err := socks5Authenticate(c, u.User); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no acceptable authentication method")
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(append(req, socksDomain, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, socksIPv4), ip4...)
+	} else {
+		req = append(append(req, socksIPv6), ip...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 4)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	if resp[1] != 0 {
+		return nil, fmt.Errorf("connect failed with code %d", resp[1])
+	}
+	// Skip the bound address.
+	var skip int
+	switch resp[3] {
+	case socksIPv4:
+		skip = 4
+	case socksIPv6:
+		skip = 16
+	case socksDomain:
+		if _, err := io.ReadFull(c, resp[:1]); err != nil {
+			return nil, err
+		}
+		skip = int(resp[0])
+	}
+	if _, err := io.CopyN(io.Discard, c, int64(skip+2)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// socks5Authenticate authenticates with a user name and password (RFC 1929).
+func socks5Authenticate(c net.Conn, user *url.Userinfo) error {
+	name := user.Username()
+	password, _ := user.Password()
+	if len(name) > 255 || len(password) > 255 {
+		return errors.New("user name or password too long")
+	}
+	req := append([]byte{1, byte(len(name))}, name...)
+	req = append(append(req, byte(len(password))), password...)
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return err
+	}
+	if resp[1] != 0 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+// httpConnect asks the HTTP proxy on c to connect to addr with CONNECT.
+func httpConnect(c net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	// The body of a successful response is the tunnel, so is not closed.
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+	if r.Buffered() > 0 {
+		// The server has already sent something.
+		return &bufferedConn{Conn: c, r: r}, nil
+	}
+	return c, nil
+}
+
+// bufferedConn is a net.Conn read through a bufio.Reader holding data already
+// read from it.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
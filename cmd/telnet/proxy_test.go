@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// fakeProxy accepts one connection on a loopback listener and runs serve on
+// it, returning the listener's address.
+func fakeProxy(t *testing.T, serve func(c net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		serve(c)
+	}()
+	return l.Addr().String()
+}
+
+func TestDialProxy_SOCKS5(t *testing.T) {
+	addr := fakeProxy(t, func(c net.Conn) {
+		greeting := make([]byte, 4)
+		io.ReadFull(c, greeting)
+		if !bytes.Equal(greeting, []byte{5, 2, 0, 2}) {
+			t.Errorf("Unexpected greeting %v", greeting)
+		}
+		c.Write([]byte{5, 2})
+		auth := make([]byte, 13)
+		io.ReadFull(c, auth)
+		if string(auth) != "\x01\x05alice\x05s3cr3" {
+			t.Errorf("Unexpected authentication %q", auth)
+		}
+		c.Write([]byte{1, 0})
+		req := make([]byte, 18)
+		io.ReadFull(c, req)
+		if string(req) != "\x05\x01\x00\x03\x0bexample.com\x00\x17" {
+			t.Errorf("Unexpected request %q", req)
+		}
+		c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+		c.Write([]byte("hello"))
+	})
+	c, err := dialProxy("socks5://alice:s3cr3@"+addr, "example.com:23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Errorf("Expected %q, got %q, %v", "hello", b, err)
+	}
+}
+
+func TestDialProxy_HTTP(t *testing.T) {
+	addr := fakeProxy(t, func(c net.Conn) {
+		req, err := http.ReadRequest(bufio.NewReader(c))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if req.Method != http.MethodConnect || req.Host != "example.com:23" {
+			t.Errorf("Unexpected request %s %s", req.Method, req.Host)
+		}
+		if user, password, _ := req.BasicAuth(); user != "" || password != "" {
+			t.Errorf("Unexpected credentials %q:%q", user, password)
+		}
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nhello"))
+	})
+	c, err := dialProxy("http://"+addr, "example.com:23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Errorf("Expected %q, got %q, %v", "hello", b, err)
+	}
+}
+
+func TestDialProxy_Refused(t *testing.T) {
+	addr := fakeProxy(t, func(c net.Conn) {
+		http.ReadRequest(bufio.NewReader(c))
+		c.Write([]byte("HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n"))
+	})
+	if _, err := dialProxy("http://"+addr, "example.com:23"); err == nil {
+		t.Error("Expected an error when the proxy refuses")
+	}
+	if _, err := dialProxy("ftp://"+addr, "example.com:23"); err == nil {
+		t.Error("Expected an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// A script is run before the session is handed over to the user, one command
+// per line; blank lines and lines starting with # are ignored:
+//
+//	expect TEXT      wait for the server to send TEXT
+//	send TEXT        send TEXT
+//	sendline TEXT    send TEXT and a newline
+//	sleep DURATION   pause, for example for 500ms
+//	timeout DURATION set how long expect waits, 10s to begin with
+//
+// TEXT is the rest of the line, or a double-quoted Go string for escapes such
+// as "\r" or "\x1b".
+
+// defaultTimeout is how long expect waits unless a script sets the timeout.
+const defaultTimeout = 10 * time.Second
+
+// step is a script command.
+type step struct {
+	line int
+	cmd  string
+	arg  string
+	dur  time.Duration
+}
+
+// parseScript parses a script.
+func parseScript(r io.Reader) ([]step, error) {
+	var steps []step
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		s := step{line: n, cmd: cmd}
+		switch cmd {
+		case "expect", "send", "sendline":
+			if strings.HasPrefix(arg, `"`) {
+				text, err := strconv.Unquote(arg)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid string %s", n, arg)
+				}
+				arg = text
+			}
+			if arg == "" && cmd == "expect" {
+				return nil, fmt.Errorf("line %d: expect needs text", n)
+			}
+			s.arg = arg
+		case "sleep", "timeout":
+			d, err := time.ParseDuration(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			s.dur = d
+		default:
+			return nil, fmt.Errorf("line %d: unknown command %q", n, cmd)
+		}
+		steps = append(steps, s)
+	}
+	return steps, scanner.Err()
+}
+
+// runScript runs steps on conn, writing the output read to out.
+func runScript(conn *telnet.Connection, steps []step, out io.Writer) error {
+	timeout := defaultTimeout
+	for _, s := range steps {
+		var err error
+		switch s.cmd {
+		case "expect":
+			err = expect(conn, s.arg, timeout, out)
+		case "send":
+			_, err = conn.Write([]byte(s.arg))
+		case "sendline":
+			_, err = conn.Write([]byte(s.arg + "\n"))
+		case "sleep":
+			time.Sleep(s.dur)
+		case "timeout":
+			timeout = s.dur
+		}
+		if err != nil {
+			return fmt.Errorf("script line %d: %w", s.line, err)
+		}
+	}
+	return nil
+}
+
+// expect reads from conn until text is read, writing what it reads to out.
+func expect(conn *telnet.Connection, text string, timeout time.Duration, out io.Writer) error {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	var seen []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		out.Write(buf[:n])
+		seen = append(seen, buf[:n]...)
+		if strings.Contains(string(seen), text) {
+			return nil
+		}
+		// Keep only what could begin a match.
+		if len(seen) >= len(text) {
+			seen = seen[len(seen)-len(text)+1:]
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("timed out waiting for %q", text)
+		} else if err != nil {
+			return err
+		}
+	}
+}
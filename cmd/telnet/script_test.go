@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestParseScript(t *testing.T) {
+	steps, err := parseScript(strings.NewReader(`# log in
+expect login:
+sendline "alice\x21"
+timeout 2s
+
+send  raw text
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []step{
+		{line: 2, cmd: "expect", arg: "login:"},
+		{line: 3, cmd: "sendline", arg: "alice!"},
+		{line: 4, cmd: "timeout", dur: 2 * time.Second},
+		{line: 6, cmd: "send", arg: "raw text"},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, steps)
+	}
+	for i := range steps {
+		if steps[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], steps[i])
+		}
+	}
+
+	for _, bad := range []string{"jump 3", "expect", `send "unterminated`, "sleep soon"} {
+		if _, err := parseScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	steps := []step{
+		{cmd: "timeout", dur: time.Second},
+		{cmd: "expect", arg: "login: "},
+		{cmd: "sendline", arg: "alice"},
+	}
+	b.Write([]byte("Welcome\r\nlog"))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte("in: "))
+	}()
+	var out bytes.Buffer
+	if err := runScript(conn, steps, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Welcome\nlogin: " {
+		t.Errorf("Expected %q, got %q", "Welcome\nlogin: ", out.String())
+	}
+	got := make([]byte, 7)
+	if _, err := b.Read(got); err != nil || string(got) != "alice\r\n" {
+		t.Errorf("Expected %q, got %q, %v", "alice\r\n", got, err)
+	}
+
+	steps = []step{{line: 1, cmd: "timeout", dur: 10 * time.Millisecond}, {line: 2, cmd: "expect", arg: "$ "}}
+	if err := runScript(conn, steps, &out); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected a timeout on line 2, got %v", err)
+	}
+}
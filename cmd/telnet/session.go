@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tester2024/telnet"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// noEscape disables the escape character.
+const noEscape = -1
+
+// parseEscape parses the -e flag: a single character, ^X for a control
+// character, or "none" to disable escaping.
+func parseEscape(s string) (int, error) {
+	switch {
+	case s == "none" || s == "off" || s == "":
+		return noEscape, nil
+	case len(s) == 1:
+		return int(s[0]), nil
+	case len(s) == 2 && s[0] == '^':
+		if s[1] == '?' {
+			return 0x7f, nil
+		}
+		if c := s[1] &^ 0x20; c >= '@' && c <= '_' {
+			return int(c - '@'), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid escape character %q", s)
+}
+
+// escapeName returns the escape character as the -e flag takes it.
+func escapeName(escape int) string {
+	switch {
+	case escape == noEscape:
+		return "none"
+	case escape == 0x7f:
+		return "^?"
+	case escape < 0x20:
+		return "^" + string(rune(escape+'@'))
+	}
+	return string(rune(escape))
+}
+
+// commands are the telnet commands the escape prompt's send command sends.
+var commands = map[string]byte{
+	"abort": telnet.ABORT,
+	"ao":    telnet.AO,
+	"ayt":   telnet.AYT,
+	"brk":   telnet.BRK,
+	"ec":    telnet.EC,
+	"el":    telnet.EL,
+	"eor":   telnet.EOR,
+	"ga":    telnet.GA,
+	"ip":    telnet.IP,
+	"nop":   telnet.NOP,
+	"susp":  telnet.SUSP,
+}
+
+// errClosed is returned by a command closing the connection.
+var errClosed = errors.New("closed")
+
+// session is an interactive session on a terminal.
+type session struct {
+	conn   *telnet.Connection
+	out    io.Writer // the server's output
+	term   io.Writer // messages for the user
+	escape int
+
+	// charMode is set while the server echoes, so keys are sent as they
+	// are typed. Otherwise lines are edited and echoed locally.
+	charMode atomic.Bool
+	forced   bool // the mode was set with the mode command
+
+	prompting bool
+	line      []byte // the line being edited
+	mu        sync.Mutex
+}
+
+func newSession(conn *telnet.Connection, out io.Writer, escape int) *session {
+	return &session{conn: conn, out: out, term: os.Stdout, escape: escape}
+}
+
+// optionChanged follows the server's ECHO, a ConnectionTrace hook.
+func (s *session) optionChanged(option byte, local, enabled bool) {
+	if option == telnet.TeloptECHO && !local {
+		s.mu.Lock()
+		if !s.forced {
+			s.charMode.Store(enabled)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// run copies the server's output to s.out and in's input to the server until
+// either side closes. If in is a terminal it is put in raw mode, and input is
+// handled as described in the package documentation.
+func (s *session) run(in *os.File) error {
+	output := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(s.out, s.conn)
+		output <- err
+	}()
+
+	fd := int(in.Fd())
+	input := make(chan error, 1)
+	if !terminal.IsTerminal(fd) {
+		go func() {
+			_, err := io.Copy(s.conn, in)
+			input <- err
+		}()
+		if err := <-input; err != nil {
+			return err
+		}
+		return <-output
+	}
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer terminal.Restore(fd, state)
+	s.conn.RawNewlines = true
+	fmt.Fprintf(s.term, "Escape character is '%s'.\r\n", escapeName(s.escape))
+	go func() {
+		input <- s.input(in)
+	}()
+	select {
+	case err = <-output:
+	case err = <-input:
+		if err == errClosed || err == io.EOF {
+			err = nil
+		}
+	}
+	return err
+}
+
+// input reads keys from in until it fails or the user closes the connection.
+func (s *session) input(in io.Reader) error {
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		for _, ch := range buf[:n] {
+			if err := s.key(ch); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// key handles a key typed at the terminal.
+func (s *session) key(ch byte) error {
+	switch {
+	case s.prompting:
+		if line, ok := s.edit(ch); ok {
+			s.prompting = false
+			return s.command(line)
+		}
+		return nil
+	case int(ch) == s.escape:
+		s.prompting, s.line = true, s.line[:0]
+		fmt.Fprint(s.term, "\r\ntelnet> ")
+		return nil
+	case s.charMode.Load():
+		if ch == '\r' {
+			_, err := s.conn.Write([]byte("\r\n"))
+			return err
+		}
+		_, err := s.conn.Write([]byte{ch})
+		return err
+	case ch == 0x03: // ^C interrupts the server's process
+		s.line = s.line[:0]
+		fmt.Fprint(s.term, "^C\r\n")
+		_, err := s.conn.RawWrite([]byte{telnet.IAC, telnet.IP})
+		return err
+	}
+	if line, ok := s.edit(ch); ok {
+		_, err := s.conn.Write(append([]byte(line), '\r', '\n'))
+		return err
+	}
+	return nil
+}
+
+// edit adds a key to the line being edited and echoes it, returning the line
+// once it is complete.
+func (s *session) edit(ch byte) (string, bool) {
+	switch ch {
+	case '\r', '\n':
+		line := string(s.line)
+		s.line = s.line[:0]
+		fmt.Fprint(s.term, "\r\n")
+		return line, true
+	case 0x7f, '\b':
+		if len(s.line) > 0 {
+			s.line = s.line[:len(s.line)-1]
+			fmt.Fprint(s.term, "\b \b")
+		}
+	case 0x15: // ^U kills the line
+		fmt.Fprint(s.term, strings.Repeat("\b \b", len(s.line)))
+		s.line = s.line[:0]
+	default:
+		s.line = append(s.line, ch)
+		s.term.Write([]byte{ch})
+	}
+	return "", false
+}
+
+// command runs a command entered at the escape prompt.
+func (s *session) command(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch fields[0] {
+	case "close", "quit":
+		s.conn.Close()
+		return errClosed
+	case "send":
+		if len(fields) != 2 {
+			break
+		}
+		if fields[1] == "escape" && s.escape != noEscape {
+			_, err := s.conn.Write([]byte{byte(s.escape)})
+			return err
+		}
+		if cmd, ok := commands[fields[1]]; ok {
+			_, err := s.conn.RawWrite([]byte{telnet.IAC, cmd})
+			return err
+		}
+	case "mode":
+		if len(fields) != 2 || fields[1] != "character" && fields[1] != "line" {
+			break
+		}
+		s.mu.Lock()
+		s.forced = true
+		s.charMode.Store(fields[1] == "character")
+		s.mu.Unlock()
+		return nil
+	case "status":
+		s.status()
+		return nil
+	case "help", "?":
+		fmt.Fprint(s.term, "close, quit\tclose the connection\r\n"+
+			"send CMD\tsend a telnet command: "+strings.Join(commandNames(), ", ")+", escape\r\n"+
+			"mode MODE\tswitch to character or line mode\r\n"+
+			"status\t\tshow the connection's status\r\n"+
+			"<return>\tgo back to the session\r\n")
+		return nil
+	}
+	fmt.Fprint(s.term, "?Invalid command, try help\r\n")
+	return nil
+}
+
+// status shows the connection's address, mode and options.
+func (s *session) status() {
+	mode := "line"
+	if s.charMode.Load() {
+		mode = "character"
+	}
+	var local, remote []string
+	for o := 0; o < 256; o++ {
+		if s.conn.LocalEnabled(byte(o)) {
+			local = append(local, fmt.Sprint(o))
+		}
+		if s.conn.RemoteEnabled(byte(o)) {
+			remote = append(remote, fmt.Sprint(o))
+		}
+	}
+	fmt.Fprintf(s.term, "Connected to %s.\r\n", s.conn.RemoteAddr())
+	fmt.Fprintf(s.term, "Operating in %s mode.\r\n", mode)
+	fmt.Fprintf(s.term, "Escape character is '%s'.\r\n", escapeName(s.escape))
+	fmt.Fprintf(s.term, "Options enabled locally: %s; by the server: %s.\r\n",
+		strings.Join(local, " "), strings.Join(remote, " "))
+}
+
+// commandNames returns the names the send command takes, sorted.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestParseEscape(t *testing.T) {
+	tests := []struct {
+		flag   string
+		escape int
+	}{
+		{"^]", 0x1d},
+		{"^c", 0x03},
+		{"^?", 0x7f},
+		{"~", '~'},
+		{"none", noEscape},
+	}
+	for _, test := range tests {
+		escape, err := parseEscape(test.flag)
+		if err != nil || escape != test.escape {
+			t.Errorf("Expected %q to parse as %d, got %d, %v", test.flag, test.escape, escape, err)
+		}
+		if name := escapeName(escape); name != test.flag && test.flag != "^c" {
+			t.Errorf("Expected %d to be named %q, got %q", escape, test.flag, name)
+		}
+	}
+	if _, err := parseEscape("^1"); err == nil {
+		t.Error("Expected an error for ^1")
+	}
+}
+
+func TestSession_Keys(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.RawNewlines = true
+	var term bytes.Buffer
+	s := newSession(conn, io.Discard, 0x1d)
+	s.term = &term
+
+	// Lines are edited locally, and the escape prompt sends commands.
+	for _, ch := range []byte("lx\x7fs\r\x1dsend ayt\r") {
+		if err := s.key(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []byte{'l', 's', '\r', '\n', telnet.IAC, telnet.AYT}
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(b, got); err != nil || !bytes.Equal(got, expected) {
+		t.Errorf("Expected %q, got %q, %v", expected, got, err)
+	}
+	if term.String() != "lx\b \bs\r\n\r\ntelnet> send ayt\r\n" {
+		t.Errorf("Unexpected terminal output %q", term.String())
+	}
+
+	// In character mode keys are sent as they are typed.
+	s.optionChanged(telnet.TeloptECHO, false, true)
+	for _, ch := range []byte("ab\r") {
+		s.key(ch)
+	}
+	got = make([]byte, 4)
+	if _, err := io.ReadFull(b, got); err != nil || string(got) != "ab\r\n" {
+		t.Errorf("Expected %q, got %q, %v", "ab\r\n", got, err)
+	}
+
+	for _, ch := range []byte("\x1dquit\r") {
+		if err := s.key(ch); err == errClosed {
+			return
+		}
+	}
+	t.Error("Expected quit to close the connection")
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+
+	"github.com/tester2024/telnet"
+)
+
+// attach fails, since pseudo-terminals are only supported on Unix.
+func attach(c *telnet.Connection, args []string) error {
+	c.Write([]byte("Commands are not supported on this system.\n"))
+	return errors.New("commands are only supported on Unix")
+}
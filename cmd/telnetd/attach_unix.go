@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/shell"
+)
+
+// attach runs the command args on a pseudo-terminal for c.
+func attach(c *telnet.Connection, args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(cmd.Environ(), "TERM=vt100")
+	return shell.Attach(c, cmd)
+}
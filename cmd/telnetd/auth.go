@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxAttempts is how many times a client may try to log in.
+const maxAttempts = 3
+
+// failDelay is the pause after a failed login, slowing password guessing.
+var failDelay = 2 * time.Second
+
+// loggedIn holds the user each Connection logged in as, for the chat demo.
+var loggedIn sync.Map
+
+// parseUsers parses a password file: lines of user:hash, with hashes made by
+// bcrypt, for example with htpasswd -nB. Blank lines and lines starting with
+// # are ignored.
+func parseUsers(r io.Reader) (map[string][]byte, error) {
+	users := make(map[string][]byte)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		users[user] = []byte(hash)
+	}
+	return users, scanner.Err()
+}
+
+// requireLogin returns a Handler asking for a user name and password from
+// users before passing the connection to next.
+func requireLogin(users map[string][]byte, next telnet.Handler) telnet.Handler {
+	return telnet.HandleFunc(func(c *telnet.Connection) {
+		for i := 0; i < maxAttempts; i++ {
+			user, err := c.Ask("login: ", true)
+			if err != nil {
+				return
+			}
+			password, err := c.Ask("Password: ", false)
+			if err != nil {
+				return
+			}
+			hash, ok := users[user]
+			if !ok {
+				// Take as long as checking a password would.
+				hash = dummyHash
+			}
+			if bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && ok {
+				if c.Logger != nil {
+					c.Logger.Info("telnetd: logged in", "conn", c.ID(), "user", user)
+				}
+				loggedIn.Store(c, user)
+				next.HandleTelnet(c)
+				loggedIn.Delete(c)
+				return
+			}
+			time.Sleep(failDelay)
+			c.Write([]byte("Login incorrect\n"))
+		}
+	})
+}
+
+// dummyHash is compared against for unknown users.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("telnetd"), bcrypt.DefaultCost)
+
+// userName returns the user c logged in as, or its remote address.
+func userName(c *telnet.Connection) string {
+	if user, ok := loggedIn.Load(c); ok {
+		return user.(string)
+	}
+	return c.RemoteAddr().String()
+}
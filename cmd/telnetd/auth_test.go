@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseUsers(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	users, err := parseUsers(strings.NewReader("# users\nalice:" + string(hash) + "\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || string(users["alice"]) != string(hash) {
+		t.Errorf("Expected alice's hash, got %q", users)
+	}
+	for _, bad := range []string{"alice", ":" + string(hash), "alice:s3cr3t"} {
+		if _, err := parseUsers(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestRequireLogin(t *testing.T) {
+	failDelay = 0
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cr3t"), bcrypt.MinCost)
+	users := map[string][]byte{"alice": hash}
+	var got string
+	h := requireLogin(users, telnet.HandleFunc(func(c *telnet.Connection) {
+		got = userName(c)
+	}))
+
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, []telnet.Option{willOption(telnet.TeloptECHO)})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.HandleTelnet(conn)
+	}()
+	b.Write([]byte{telnet.IAC, telnet.DO, telnet.TeloptECHO})
+	for !conn.LocalEnabled(telnet.TeloptECHO) {
+		time.Sleep(time.Millisecond)
+	}
+	b.Write([]byte("alice\r\nwrong\r\nalice\r\ns3cr3t\r\n"))
+	<-done
+	conn.Close()
+	if got != "alice" {
+		t.Errorf("Expected alice to log in, got %q", got)
+	}
+	out, _ := io.ReadAll(b)
+	// The user name is echoed, but not the password.
+	expected := "\xff\xfb\x01login: alice\r\nPassword: \r\nLogin incorrect\r\nlogin: alice\r\nPassword: \r\n"
+	if string(out) != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/tester2024/telnet"
+)
+
+// echo is the echo demo, writing back each line it reads.
+func echo(c *telnet.Connection) {
+	c.Write([]byte("Welcome to the telnetd echo demo. Type quit to leave.\n"))
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "quit" {
+			return
+		}
+		if _, err := fmt.Fprintf(c, "%s\n", line); err != nil {
+			return
+		}
+	}
+}
+
+// chat is the chat demo, relaying each line read from a connection to all the
+// others.
+type chat struct {
+	room telnet.Broadcaster
+}
+
+func newChat() *chat {
+	return &chat{}
+}
+
+// HandleTelnet joins c to the chat until it leaves.
+func (ch *chat) HandleTelnet(c *telnet.Connection) {
+	name := userName(c)
+	c.Write([]byte("Welcome to the telnetd chat demo. Type quit to leave.\n"))
+	ch.broadcast(c, "* %s has joined\n", name)
+	ch.room.Add(c)
+	defer func() {
+		ch.room.Remove(c)
+		ch.broadcast(c, "* %s has left\n", name)
+	}()
+
+	scanner := bufio.NewScanner(c)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "quit" {
+			return
+		}
+		if line != "" {
+			ch.broadcast(c, "<%s> %s\n", name, line)
+		}
+	}
+}
+
+// broadcast writes a message to every connection but from.
+func (ch *chat) broadcast(from *telnet.Connection, format string, args ...any) {
+	ch.room.Broadcast([]byte(fmt.Sprintf(format, args...)), from)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestChat(t *testing.T) {
+	l := telnettest.NewListener()
+	s := telnet.NewServer("", newChat())
+	go s.Serve(l)
+	defer s.Stop()
+
+	alice, err := l.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	aliceLines := bufio.NewReader(alice)
+	aliceLines.ReadString('\n') // the welcome
+	bob, err := l.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobLines := bufio.NewReader(bob)
+	bobLines.ReadString('\n')
+
+	if line, _ := aliceLines.ReadString('\n'); !strings.HasSuffix(line, " has joined\n") {
+		t.Errorf("Expected bob to join, got %q", line)
+	}
+	alice.Write([]byte("hello\n"))
+	if line, _ := bobLines.ReadString('\n'); !strings.HasSuffix(line, "> hello\n") {
+		t.Errorf("Expected alice's message, got %q", line)
+	}
+	bob.Write([]byte("quit\n"))
+	if line, _ := aliceLines.ReadString('\n'); !strings.HasSuffix(line, " has left\n") {
+		t.Errorf("Expected bob to leave, got %q", line)
+	}
+	bob.Close()
+}
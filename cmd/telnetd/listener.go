@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// busyMessage is sent to connections turned away by -max-conns.
+const busyMessage = "Too many connections, try again later.\r\n"
+
+// listen returns the listener for s, with TLS and limits as cfg asks.
+func listen(s *telnet.Server, cfg *config) (net.Listener, error) {
+	l, err := net.Listen(cfg.network, cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.certFile != "" || cfg.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	if cfg.maxConns > 0 || cfg.idle > 0 {
+		l = &limitListener{Listener: l, max: cfg.maxConns, idle: cfg.idle}
+	}
+	return l, nil
+}
+
+// limitListener turns away connections beyond max, if it is not zero, and
+// closes connections that have read nothing for idle, if it is not zero.
+type limitListener struct {
+	net.Listener
+	max  int
+	idle time.Duration
+
+	mu    sync.Mutex
+	count int
+}
+
+// Accept returns the next connection, turning away any beyond the limit.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		full := l.max > 0 && l.count >= l.max
+		if !full {
+			l.count++
+		}
+		l.mu.Unlock()
+		if full {
+			go func() {
+				c.SetWriteDeadline(time.Now().Add(time.Second))
+				c.Write([]byte(busyMessage))
+				c.Close()
+			}()
+			continue
+		}
+		lc := &limitConn{Conn: c, l: l, idle: l.idle}
+		if l.idle > 0 {
+			lc.timer = time.AfterFunc(l.idle, func() { lc.Close() })
+		}
+		return lc, nil
+	}
+}
+
+// release frees a connection's place.
+func (l *limitListener) release() {
+	l.mu.Lock()
+	l.count--
+	l.mu.Unlock()
+}
+
+// limitConn is a connection accepted by a limitListener.
+type limitConn struct {
+	net.Conn
+	l     *limitListener
+	idle  time.Duration
+	timer *time.Timer
+	once  sync.Once
+}
+
+// Read reads from the connection, postponing the idle timeout if anything is
+// read.
+func (c *limitConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.timer != nil {
+		c.timer.Reset(c.idle)
+	}
+	return n, err
+}
+
+// Close closes the connection, freeing its place.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.l.release()
+	})
+	return err
+}
@@ -0,0 +1,163 @@
+// Command telnetd is a reference telnet server built on the telnet package,
+// for evaluating it and reproducing bugs against.
+//
+// Usage:
+//
+//	telnetd [flags] [command [args...]]
+//
+// Given a command, each connection runs it on a new pseudo-terminal, as a
+// telnetd runs login(1) - for example "telnetd -addr :2323 /bin/bash -l".
+// Otherwise a builtin demo is served, selected with -demo: "echo" echoes each
+// line back, and "chat" relays lines between everyone connected.
+//
+// Flags add TLS (telnets), password logins checked against a file of bcrypt
+// hashes, limits on connections and idle time, and logging.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+)
+
+// config holds the command line flags.
+type config struct {
+	addr     string
+	network  string
+	certFile string
+	keyFile  string
+	authFile string
+	demo     string
+	maxConns int
+	idle     time.Duration
+	logLevel string
+	binary   bool
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", ":2323", "`address` to listen on")
+	flag.StringVar(&cfg.network, "network", "tcp", "`network` to listen on, such as tcp, tcp6 or unix")
+	flag.StringVar(&cfg.certFile, "tls-cert", "", "serve TLS (telnets) with the certificate in PEM `file`")
+	flag.StringVar(&cfg.keyFile, "tls-key", "", "the private key for -tls-cert, in PEM `file`")
+	flag.StringVar(&cfg.authFile, "auth", "", "require a login, checked against `file` of user:bcrypt-hash lines")
+	flag.StringVar(&cfg.demo, "demo", "echo", "builtin demo served without a command: echo or chat")
+	flag.IntVar(&cfg.maxConns, "max-conns", 0, "turn away connections beyond `n` at once, if not 0")
+	flag.DurationVar(&cfg.idle, "idle", 0, "disconnect clients sending nothing for `duration`, if not 0")
+	flag.StringVar(&cfg.logLevel, "log-level", "info", "log `level`: debug (including negotiation), info, warn or error")
+	flag.BoolVar(&cfg.binary, "binary", false, "offer BINARY transmission")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command [args...]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(&cfg, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "telnetd:", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until the listener fails.
+func run(cfg *config, args []string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.logLevel)); err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	var handler telnet.Handler
+	if len(args) > 0 {
+		handler = telnet.HandleFunc(func(c *telnet.Connection) {
+			if err := attach(c, args); err != nil {
+				logger.Warn("telnetd: command failed", "conn", c.ID(), "error", err)
+			}
+		})
+	} else {
+		switch cfg.demo {
+		case "echo":
+			handler = telnet.HandleFunc(echo)
+		case "chat":
+			handler = newChat()
+		default:
+			return fmt.Errorf("unknown demo %q", cfg.demo)
+		}
+	}
+	if cfg.authFile != "" {
+		f, err := os.Open(cfg.authFile)
+		if err != nil {
+			return err
+		}
+		users, err := parseUsers(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.authFile, err)
+		}
+		handler = requireLogin(users, handler)
+	}
+
+	opts := []telnet.Option{
+		willOption(telnet.TeloptECHO),
+		willOption(telnet.TeloptSGA),
+		options.NAWSOption,
+	}
+	if cfg.binary {
+		opts = append(opts, options.BinaryOption)
+	}
+	s := telnet.NewServer(cfg.addr, handler, opts...)
+	s.Network = cfg.network
+	s.Logger = logger
+
+	l, err := listen(s, cfg)
+	if err != nil {
+		return err
+	}
+	logger.Info("telnetd: listening", "network", cfg.network, "addr", l.Addr().String(),
+		"tls", cfg.certFile != "", "command", strings.Join(args, " "))
+	return s.Serve(l)
+}
+
+// willOption returns an Option offering to perform option, as a server
+// performs ECHO and SUPPRESS-GO-AHEAD for character-at-a-time sessions.
+func willOption(option byte) telnet.Option {
+	return func(c *telnet.Connection) telnet.Negotiator {
+		return &willHandler{option: option}
+	}
+}
+
+// willHandler offers to perform an option.
+type willHandler struct {
+	option  byte
+	offered bool
+}
+
+func (w *willHandler) OptionCode() byte                        { return w.option }
+func (w *willHandler) HandleSB(c *telnet.Connection, b []byte) {}
+
+// Offer sends WILL.
+func (w *willHandler) Offer(c *telnet.Connection) {
+	w.offered = true
+	c.WriteCommand(telnet.WILL, w.option)
+}
+
+// HandleDo enables the option, agreeing to it first if it was not offered.
+func (w *willHandler) HandleDo(c *telnet.Connection) {
+	if c.LocalEnabled(w.option) {
+		return
+	}
+	if !w.offered {
+		c.WriteCommand(telnet.WILL, w.option)
+	}
+	w.offered = false
+	c.SetLocalEnabled(w.option, true)
+}
+
+// HandleWill refuses to let the client perform the option.
+func (w *willHandler) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, w.option)
+}
@@ -0,0 +1,71 @@
+package telnet
+
+import "time"
+
+// MaxCoalescedWrite is the most data WriteCoalescing holds before writing it.
+const MaxCoalescedWrite = 4096
+
+// Flush writes any data held by WriteCoalescing.
+func (c *Connection) Flush() error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.closedErr(c.flushHeld())
+}
+
+// flushHeld writes the data held by WriteCoalescing. The caller must hold
+// c.wmu.
+func (c *Connection) flushHeld() error {
+	if len(c.wheld) == 0 {
+		return nil
+	}
+	_, err := c.writeWire(nil)
+	return err
+}
+
+// writeCoalesced writes framed application data, holding it while
+// WriteCoalescing is set. The caller must hold c.wmu.
+func (c *Connection) writeCoalesced(b []byte) (int, error) {
+	delay := c.WriteCoalescing
+	if delay <= 0 {
+		return c.writeWire(b)
+	}
+	if err := c.werr; err != nil {
+		c.werr = nil
+		return 0, err
+	}
+	if len(c.wheld)+len(b) > MaxCoalescedWrite {
+		return c.writeWire(b)
+	}
+	c.wheld = append(c.wheld, b...)
+	if !c.wtimed {
+		c.wtimed = true
+		go c.flushAfter(delay)
+	}
+	return len(b), nil
+}
+
+// flushAfter writes the data held by WriteCoalescing once delay has elapsed.
+func (c *Connection) flushAfter(delay time.Duration) {
+	var after <-chan time.Time
+	if c.Clock != nil {
+		after = c.Clock.After(delay)
+	} else {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		after = t.C
+	}
+	select {
+	case <-after:
+	case <-c.closedCh:
+		return
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.wtimed = false
+	if err := c.flushHeld(); err != nil {
+		c.werr = err
+	}
+}
@@ -0,0 +1,59 @@
+package telnet_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_WriteCoalescing(t *testing.T) {
+	clock := telnettest.NewFakeClock(time.Now())
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnectionConfig(a, &telnet.Config{
+		Clock:           clock,
+		WriteCoalescing: time.Second,
+	})
+	expect := func(want string) {
+		t.Helper()
+		b.SetReadDeadline(time.Now().Add(time.Second))
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(b, got); err != nil || string(got) != want {
+			t.Errorf("Expected %q, got %q, %v", want, got, err)
+		}
+		b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if n, _ := b.Read(make([]byte, 1)); n > 0 {
+			t.Errorf("Expected nothing more after %q", want)
+		}
+	}
+
+	conn.Write([]byte("one\n"))
+	conn.Write([]byte("two\n"))
+	expect("")
+
+	// A prompt sends what is held at once.
+	conn.WritePrompt("> ")
+	expect("one\r\ntwo\r\n> \xff\xf9")
+
+	// Otherwise it is held until the delay has passed, or Flush.
+	conn.Write([]byte("three"))
+	clock.BlockUntil(1)
+	expect("")
+	clock.Advance(time.Second)
+	expect("three")
+	conn.Write([]byte("four"))
+	conn.Flush()
+	expect("four")
+
+	// Enough data is written without waiting.
+	big := make([]byte, telnet.MaxCoalescedWrite)
+	conn.Write([]byte("five"))
+	conn.Write(big)
+	expect("five" + string(big))
+
+	conn.Write([]byte("six"))
+	conn.Close()
+	expect("six")
+}
@@ -0,0 +1,93 @@
+package telnet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoCodec is returned by WriteSubnegotiationValue for an option without a
+// registered Codec.
+var ErrNoCodec = errors.New("telnet: no codec registered for option")
+
+// A Codec converts the bodies of an option's subnegotiations to and from typed
+// values - for example, between the four bytes of a NAWS body and a window
+// size. Codecs are registered by option code with RegisterCodec, typically from
+// the init function of the package implementing the option, and used to
+// decode each Subnegotiation received and to encode the values given to
+// WriteSubnegotiationValue. A Codec must be safe for concurrent use.
+type Codec interface {
+	// Decode decodes a subnegotiation body.
+	Decode(body []byte) (any, error)
+	// Encode encodes v as a subnegotiation body.
+	Encode(v any) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[byte]Codec)
+)
+
+// RegisterCodec makes codec the Codec of option. It panics if codec is nil or
+// a Codec is already registered for the option.
+func RegisterCodec(option byte, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec == nil {
+		panic("telnet: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[option]; dup {
+		panic("telnet: RegisterCodec called twice for option " + optionName(option))
+	}
+	codecs[option] = codec
+}
+
+// LookupCodec returns the Codec registered for option, or nil if there is
+// none.
+func LookupCodec(option byte) Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs[option]
+}
+
+// Subnegotiation is a subnegotiation received from the peer, passed to
+// OnSubnegotiation.
+type Subnegotiation struct {
+	Option byte
+	Body   []byte
+	// Value is Body decoded by the Codec registered for Option, or nil if
+	// there is none or it failed, with Err saying why.
+	Value any
+	Err   error
+}
+
+// WriteSubnegotiationValue encodes v with the Codec registered for option and
+// writes it as a subnegotiation, as WriteSubnegotiation does.
+func (c *Connection) WriteSubnegotiationValue(option byte, v any) error {
+	codec := LookupCodec(option)
+	if codec == nil {
+		return fmt.Errorf("%w %s", ErrNoCodec, optionName(option))
+	}
+	body, err := codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteSubnegotiation(option, body)
+}
+
+// deliverSubnegotiation decodes a subnegotiation received and passes it to
+// OnSubnegotiation, the Subscriptions and the option's observers.
+func (c *Connection) deliverSubnegotiation(option byte, body []byte) {
+	if c.OnSubnegotiation == nil && !c.subscribed() && !c.observed(option) {
+		return
+	}
+	s := Subnegotiation{Option: option, Body: body}
+	if codec := LookupCodec(option); codec != nil {
+		s.Value, s.Err = codec.Decode(body)
+	}
+	if c.OnSubnegotiation != nil {
+		c.OnSubnegotiation(s)
+	}
+	c.emit(SubnegotiationEvent{s})
+	c.observeSubnegotiation(s)
+}
@@ -0,0 +1,78 @@
+package telnet_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// stringCodec is a Codec whose values are non-empty strings.
+type stringCodec struct{}
+
+func (stringCodec) Decode(body []byte) (any, error) {
+	if len(body) == 0 {
+		return nil, errors.New("empty")
+	}
+	return string(body), nil
+}
+
+func (stringCodec) Encode(v any) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return []byte(s), nil
+}
+
+func init() {
+	telnet.RegisterCodec(201, stringCodec{})
+}
+
+func TestCodec(t *testing.T) {
+	received := make(chan telnet.Subnegotiation, 3)
+	a, b := telnettest.Pipe()
+	peer := &telnettest.Peer{Conn: a}
+	defer peer.Close()
+	conn := telnet.NewConnectionConfig(b, &telnet.Config{
+		OnSubnegotiation: func(s telnet.Subnegotiation) { received <- s },
+	})
+	defer conn.Close()
+	go conn.Read(make([]byte, 1))
+
+	// Subnegotiations are delivered with or without a handler or codec.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.SB, 201, 'h', 'i', telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.SB, 201, telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.SB, 202, 'h', 'i', telnet.IAC, telnet.SE),
+	)
+	if s := <-received; s.Option != 201 || s.Value != "hi" || s.Err != nil {
+		t.Errorf("got %+v, want the value %q", s, "hi")
+	}
+	if s := <-received; s.Value != nil || s.Err == nil {
+		t.Errorf("got %+v, want an error", s)
+	}
+	if s := <-received; s.Option != 202 || string(s.Body) != "hi" || s.Value != nil || s.Err != nil {
+		t.Errorf("got %+v, want the raw body", s)
+	}
+
+	go conn.WriteSubnegotiationValue(201, "hello")
+	peer.Run(t, telnettest.Expect(telnet.IAC, telnet.SB, 201, 'h', 'e', 'l', 'l', 'o', telnet.IAC, telnet.SE))
+	if err := conn.WriteSubnegotiationValue(202, "hello"); !errors.Is(err, telnet.ErrNoCodec) {
+		t.Errorf("writing without a codec: got %v, want ErrNoCodec", err)
+	}
+	if err := conn.WriteSubnegotiationValue(201, 1); err == nil {
+		t.Error("writing a value the codec cannot encode: got no error")
+	}
+}
+
+func TestRegisterCodec_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a second codec for an option did not panic")
+		}
+	}()
+	telnet.RegisterCodec(201, stringCodec{})
+}
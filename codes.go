@@ -0,0 +1,74 @@
+package telnet
+
+import "strconv"
+
+// Option codes of protocols defined outside the telnet RFCs, mostly by MUD
+// servers and clients.
+const (
+	TeloptCHARSET = byte(42)  // character set (RFC 2066)
+	TeloptMSDP    = byte(69)  // MUD Server Data Protocol
+	TeloptMSSP    = byte(70)  // MUD Server Status Protocol
+	TeloptMCCP1   = byte(85)  // MUD Client Compression Protocol, version 1
+	TeloptMCCP2   = byte(86)  // MUD Client Compression Protocol, version 2
+	TeloptMCCP3   = byte(87)  // MUD Client Compression Protocol, version 3
+	TeloptMSP     = byte(90)  // MUD Sound Protocol
+	TeloptMXP     = byte(91)  // MUD eXtension Protocol
+	TeloptZMP     = byte(93)  // Zenith MUD Protocol
+	TeloptATCP    = byte(200) // Achaea Telnet Client Protocol
+	TeloptGMCP    = byte(201) // Generic MUD Communication Protocol
+)
+
+// Command is a telnet command code, such as WILL or IAC. Converting one of the
+// command constants names it in formatted output:
+//
+//	fmt.Println(telnet.Command(telnet.WILL)) // WILL
+type Command byte
+
+// String returns the name of the command, or its decimal value if it is not a
+// command.
+func (c Command) String() string {
+	if byte(c) >= xEOF {
+		return commandNames[c-Command(xEOF)]
+	}
+	return strconv.Itoa(int(c))
+}
+
+// OptionCode is a telnet option code, such as TeloptNAWS. Converting one of
+// the option constants names it in formatted output:
+//
+//	fmt.Println(telnet.OptionCode(telnet.TeloptGMCP)) // GMCP
+type OptionCode byte
+
+// String returns the name of the option as in TelOpts, or for the options
+// beyond them its abbreviation, such as "GMCP". Unknown options are given
+// as their decimal value.
+func (o OptionCode) String() string {
+	if int(o) < len(TelOpts) {
+		return TelOpts[o]
+	}
+	if name, ok := extraOptionNames[byte(o)]; ok {
+		return name
+	}
+	return strconv.Itoa(int(o))
+}
+
+// commandNames holds the names of the commands from xEOF to IAC.
+var commandNames = []string{"EOF", "SUSP", "ABORT", "EOR", "SE", "NOP", "DM",
+	"BRK", "IP", "AO", "AYT", "EC", "EL", "GA", "SB", "WILL", "WONT", "DO",
+	"DONT", "IAC"}
+
+// extraOptionNames holds the names of the options not in TelOpts.
+var extraOptionNames = map[byte]string{
+	TeloptCHARSET: "CHARSET",
+	TeloptMSDP:    "MSDP",
+	TeloptMSSP:    "MSSP",
+	TeloptMCCP1:   "MCCP1",
+	TeloptMCCP2:   "MCCP2",
+	TeloptMCCP3:   "MCCP3",
+	TeloptMSP:     "MSP",
+	TeloptMXP:     "MXP",
+	TeloptZMP:     "ZMP",
+	TeloptATCP:    "ATCP",
+	TeloptGMCP:    "GMCP",
+	TeloptEXOPL:   "EXOPL",
+}
@@ -0,0 +1,30 @@
+package telnet_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tester2024/telnet"
+)
+
+func TestCodeNames(t *testing.T) {
+	for _, tc := range []struct {
+		code     fmt.Stringer
+		expected string
+	}{
+		{telnet.Command(telnet.IAC), "IAC"},
+		{telnet.Command(telnet.WILL), "WILL"},
+		{telnet.Command(236), "EOF"},
+		{telnet.Command(42), "42"},
+		{telnet.OptionCode(telnet.TeloptNAWS), "NAWS"},
+		{telnet.OptionCode(telnet.TeloptTTYPE), "TERMINAL TYPE"},
+		{telnet.OptionCode(telnet.TeloptGMCP), "GMCP"},
+		{telnet.OptionCode(telnet.TeloptMCCP2), "MCCP2"},
+		{telnet.OptionCode(telnet.TeloptEXOPL), "EXOPL"},
+		{telnet.OptionCode(150), "150"},
+	} {
+		if s := tc.code.String(); s != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, s)
+		}
+	}
+}
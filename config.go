@@ -0,0 +1,166 @@
+package telnet
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// DefaultReadBufferSize is the initial size of a Connection's read buffer
+// when Config.ReadBufferSize is zero. The buffer grows as needed.
+const DefaultReadBufferSize = 256
+
+// Role is the end of a telnet session a Connection is.
+type Role int
+
+// Roles
+const (
+	// RoleUnspecified is the Role of a Connection made without one.
+	RoleUnspecified Role = iota
+	// RoleServer is a Connection accepted by a server.
+	RoleServer
+	// RoleClient is a Connection made by a client.
+	RoleClient
+)
+
+// String returns "server", "client" or "unspecified".
+func (r Role) String() string {
+	switch r {
+	case RoleServer:
+		return "server"
+	case RoleClient:
+		return "client"
+	}
+	return "unspecified"
+}
+
+// Config holds the settings of a new Connection, for NewConnectionConfig and
+// DialConfig. Unlike the Connection's fields set once it is made, they are in
+// place before its option handlers make their offers and it starts handling
+// negotiation, so they cover all it does; setting Logger or Trace here, for
+// example, records the offers too. The zero Config gives the defaults, and a
+// Config may be shared by any number of Connections.
+type Config struct {
+	// Options add handling of telnet options, as for NewConnection.
+	Options []Option
+
+	// Role is the end of the session the Connection is, as returned by
+	// Role. Dial sets RoleClient, and a Server RoleServer.
+	Role Role
+
+	// ReadBufferSize is the initial size of the read buffer. If zero,
+	// DefaultReadBufferSize is used.
+	ReadBufferSize int
+
+	// Logger, Trace, Auditor and Clock set the Connection fields of the same
+	// names.
+	Logger  *slog.Logger
+	Trace   *ConnectionTrace
+	Auditor Auditor
+	Clock   Clock
+
+	// Limits and timeouts, as the Connection fields of the same names
+	MaxSubnegotiationSize   int
+	MemoryBudget            int
+	SequenceTimeout         time.Duration
+	MaxNegotiations         int
+	NegotiationRate         float64
+	NegotiationBurst        int
+	CloseOnNegotiationFlood bool
+	NegotiationWriteTimeout time.Duration
+	WriteCoalescing         time.Duration
+
+	// NegotiationTimeout is how long the peer has, from when the Connection
+	// is made, to answer the requests its option handlers make of it: an
+	// IAC WILL or IAC DO still unanswered then is taken as refused, as by
+	// ClientDont or ClientWont, and the handler is told if it is a
+	// RefusalNegotiator. This keeps a server from waiting forever on a
+	// client that never negotiates, such as a port scanner. Requests made
+	// afterwards are not timed. If zero, DefaultNegotiationTimeout is used;
+	// if negative, requests are not timed at all.
+	NegotiationTimeout time.Duration
+
+	// Policies, as the Connection fields of the same names
+	RawNewlines      bool
+	Unhandled        map[byte]UnhandledPolicy
+	OnProtocolError  func(err *ProtocolError)
+	OnCommand        func(cmd byte)
+	OnSubnegotiation func(s Subnegotiation)
+
+	// NegotiationLogSize and NegotiationLogOutput set the Connection fields
+	// of the same names.
+	NegotiationLogSize   int
+	NegotiationLogOutput io.Writer
+
+	banStore BanStore // of the Server accepting the Connection
+}
+
+// NewConnectionConfig is like NewConnection, but configures the Connection
+// with cfg, which may be nil for the defaults:
+//
+//	conn := telnet.NewConnectionConfig(c, &telnet.Config{
+//		Options:         []telnet.Option{options.NAWSOption},
+//		Logger:          logger,
+//		SequenceTimeout: 10 * time.Second,
+//	})
+func NewConnectionConfig(c net.Conn, cfg *Config) *Connection {
+	conn := newConnection(c, cfg, true)
+	go conn.negotiate()
+	return conn
+}
+
+// DialConfig is like DialNetwork, but configures the Connection with cfg,
+// which may be nil for the defaults. Its Role is RoleClient unless cfg says
+// otherwise.
+func DialConfig(network, addr string, cfg *Config) (*Connection, error) {
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnectionConfig(c, cfg.withRole(RoleClient)), nil
+}
+
+// withRole returns cfg with role as its Role if it has none.
+func (cfg *Config) withRole(role Role) *Config {
+	clone := Config{}
+	if cfg != nil {
+		clone = *cfg
+	}
+	if clone.Role == RoleUnspecified {
+		clone.Role = role
+	}
+	return &clone
+}
+
+// apply sets the Connection's fields from the Config.
+func (cfg *Config) apply(c *Connection) {
+	c.role = cfg.Role
+	c.Logger = cfg.Logger
+	c.Trace = cfg.Trace
+	c.Auditor = cfg.Auditor
+	c.Clock = cfg.Clock
+	c.MaxSubnegotiationSize = cfg.MaxSubnegotiationSize
+	c.MemoryBudget = cfg.MemoryBudget
+	c.SequenceTimeout = cfg.SequenceTimeout
+	c.MaxNegotiations = cfg.MaxNegotiations
+	c.NegotiationRate = cfg.NegotiationRate
+	c.NegotiationBurst = cfg.NegotiationBurst
+	c.CloseOnNegotiationFlood = cfg.CloseOnNegotiationFlood
+	c.NegotiationWriteTimeout = cfg.NegotiationWriteTimeout
+	c.negotiationTimeout = cfg.NegotiationTimeout
+	c.WriteCoalescing = cfg.WriteCoalescing
+	c.RawNewlines = cfg.RawNewlines
+	c.Unhandled = cfg.Unhandled
+	c.OnProtocolError = cfg.OnProtocolError
+	c.OnCommand = cfg.OnCommand
+	c.OnSubnegotiation = cfg.OnSubnegotiation
+	c.NegotiationLogSize = cfg.NegotiationLogSize
+	c.NegotiationLogOutput = cfg.NegotiationLogOutput
+	c.banStore = cfg.banStore
+}
+
+// Role returns the end of the session the Connection is.
+func (c *Connection) Role() Role {
+	return c.role
+}
@@ -0,0 +1,153 @@
+package telnet_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestNewConnectionConfig(t *testing.T) {
+	var sent []byte
+	a, b := telnettest.Pipe()
+	defer a.Close()
+	conn := telnet.NewConnectionConfig(b, &telnet.Config{
+		Options: []telnet.Option{offerWill(telnet.TeloptECHO)},
+		Role:    telnet.RoleServer,
+		Trace: &telnet.ConnectionTrace{
+			CommandSent: func(cmd, option byte) { sent = append(sent, cmd, option) },
+		},
+		MaxSubnegotiationSize: 16,
+	})
+	defer conn.Close()
+
+	// The offer is traced, as the Trace is set before it is made.
+	if want := []byte{telnet.WILL, telnet.TeloptECHO}; string(sent) != string(want) {
+		t.Errorf("traced %v, want %v", sent, want)
+	}
+	if conn.Role() != telnet.RoleServer || conn.MaxSubnegotiationSize != 16 {
+		t.Errorf("Role %v, MaxSubnegotiationSize %d", conn.Role(), conn.MaxSubnegotiationSize)
+	}
+	if c := telnet.NewConnection(a, nil); c.Role() != telnet.RoleUnspecified {
+		t.Errorf("NewConnection Role = %v", c.Role())
+	}
+}
+
+func TestServer_Config(t *testing.T) {
+	roles := make(chan telnet.Role, 1)
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		if c.RawNewlines {
+			roles <- c.Role()
+		}
+	}))
+	s.Config = &telnet.Config{RawNewlines: true}
+	path := serveUnix(t, s, s.ListenAndServe)
+
+	conn, err := telnet.DialConfig("unix", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Role() != telnet.RoleClient {
+		t.Errorf("client Role = %v", conn.Role())
+	}
+	if role := <-roles; role != telnet.RoleServer {
+		t.Errorf("server Role = %v", role)
+	}
+}
+
+func TestConfig_NegotiationTimeout(t *testing.T) {
+	silentDo := &telnettest.MockNegotiator{Code: 200, OfferCommand: telnet.DO}
+	silentWill := &telnettest.MockNegotiator{Code: 201, OfferCommand: telnet.WILL}
+	answered := &telnettest.MockNegotiator{Code: 202, OfferCommand: telnet.DO, WillReply: telnet.DO}
+	refused := &telnettest.MockNegotiator{Code: 203, OfferCommand: telnet.DO}
+	clock := telnettest.NewFakeClock(time.Now())
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnectionConfig(a, &telnet.Config{
+		Options: []telnet.Option{silentDo.Option(), silentWill.Option(),
+			answered.Option(), refused.Option()},
+		Clock:              clock,
+		NegotiationTimeout: 5 * time.Second,
+	})
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, 200, telnet.IAC, telnet.WILL, 201,
+			telnet.IAC, telnet.DO, 202, telnet.IAC, telnet.DO, 203),
+		telnettest.Send(telnet.IAC, telnet.WILL, 202, telnet.IAC, telnet.WONT, 203),
+		telnettest.Expect(telnet.IAC, telnet.DO, 202),
+		telnettest.Send(telnet.IAC, telnet.DO, 204),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 204))
+	if !conn.ClientWont(203) || conn.ClientWont(200) || conn.ClientDont(201) {
+		t.Error("Expected only the option refused with WONT to be refused before the timeout")
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(5 * time.Second)
+	for deadline := time.Now().Add(time.Second); !conn.ClientWont(200) || !conn.ClientDont(201); {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the unanswered requests to be refused")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if conn.ClientWont(202) || !conn.RemoteEnabled(202) {
+		t.Error("Expected the answered request to be left alone")
+	}
+	// Disabling an option enabled is a refusal too.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WONT, 202, telnet.IAC, telnet.DO, 204),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 204))
+	conn.Close()
+	for _, m := range []*telnettest.MockNegotiator{silentDo, silentWill, refused, answered} {
+		var got []string
+		for _, c := range m.Calls() {
+			got = append(got, c.Method)
+		}
+		want := "[Offer HandleRefused]"
+		if m == answered {
+			want = "[Offer HandleWill HandleRefused]"
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("option %d: expected calls %s, got %v", m.Code, want, got)
+		}
+	}
+}
+
+func TestConfig_Unhandled(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnectionConfig(a, &telnet.Config{
+		Unhandled: map[byte]telnet.UnhandledPolicy{
+			200: telnet.IgnoreUnhandled,
+			201: telnet.RefuseUnhandled,
+		},
+	})
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+
+	// Only the requests for options not ignored are answered.
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, 200, telnet.IAC, telnet.WILL, 200,
+			telnet.IAC, telnet.DO, 201, telnet.IAC, telnet.WILL, 202),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 201, telnet.IAC, telnet.DONT, 202))
+}
+
+// offerWill returns an Option offering WILL option.
+func offerWill(option byte) telnet.Option {
+	return func(c *telnet.Connection) telnet.Negotiator {
+		return offerer{option}
+	}
+}
+
+type offerer struct{ option byte }
+
+func (o offerer) OptionCode() byte                           { return o.option }
+func (o offerer) Offer(c *telnet.Connection)                 { c.WriteCommand(telnet.WILL, o.option) }
+func (o offerer) HandleDo(c *telnet.Connection)              {}
+func (o offerer) HandleWill(c *telnet.Connection)            {}
+func (o offerer) HandleSB(c *telnet.Connection, body []byte) {}
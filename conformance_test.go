@@ -0,0 +1,304 @@
+package telnet_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// TestConformance replays the handshakes of common clients in
+// testdata/conformance against a server, checking what the server sends in
+// reply and the options in effect afterwards. Each file holds lines of:
+//
+//	support local|remote OPTION...  options the server will enable
+//	offer local|remote OPTION...    options the server offers on connecting
+//	<< BYTES                        bytes sent by the client
+//	>> BYTES                        bytes the server must send next
+//	expect local|remote|wont|dont OPTION...
+//	                                the options in each state at the end
+//	data BYTES                      the data the server must read
+//
+// BYTES are command and option names, decimal byte values and quoted
+// strings. Blank lines and lines starting with # are ignored.
+func TestConformance(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No conformance transcripts found")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) { runConformance(t, file) })
+	}
+}
+
+func runConformance(t *testing.T, file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var (
+		handlers []*policyNegotiator
+		byCode   = map[byte]*policyNegotiator{}
+		steps    []telnettest.Step
+		expect   = map[string][]string{}
+		data     []byte
+		wantData bool
+	)
+	handler := func(code byte) *policyNegotiator {
+		if h, ok := byCode[code]; ok {
+			return h
+		}
+		h := &policyNegotiator{code: code}
+		byCode[code] = h
+		handlers = append(handlers, h)
+		return h
+	}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		word, rest := text, ""
+		if i := strings.IndexByte(text, ' '); i >= 0 {
+			word, rest = text[:i], text[i+1:]
+		}
+		switch word {
+		case "support", "offer":
+			fields := strings.Fields(rest)
+			if len(fields) == 0 || fields[0] != "local" && fields[0] != "remote" {
+				t.Fatalf("%s:%d: expected local or remote", file, line)
+			}
+			for _, opt := range fields[1:] {
+				code, ok := optionCodes[opt]
+				if !ok {
+					t.Fatalf("%s:%d: unknown option %s", file, line, opt)
+				}
+				h := handler(code)
+				switch {
+				case word == "support" && fields[0] == "local":
+					h.local = true
+				case word == "support":
+					h.remote = true
+				case fields[0] == "local":
+					h.offerLocal = true
+				default:
+					h.offerRemote = true
+				}
+			}
+		case "<<", ">>", "data":
+			b, err := parseBytes(rest)
+			if err != nil {
+				t.Fatalf("%s:%d: %v", file, line, err)
+			}
+			switch word {
+			case "<<":
+				steps = append(steps, telnettest.Send(b...))
+			case ">>":
+				steps = append(steps, telnettest.Expect(b...))
+			default:
+				data, wantData = b, true
+			}
+		case "expect":
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				t.Fatalf("%s:%d: expected a state", file, line)
+			}
+			expect[fields[0]] = fields[1:]
+		default:
+			t.Fatalf("%s:%d: unknown directive %q", file, line, word)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var options []telnet.Option
+	for _, h := range handlers {
+		h := h
+		options = append(options, func(*telnet.Connection) telnet.Negotiator { return h })
+	}
+	peer, conn := telnettest.NewPeer(options...)
+	var read []byte
+	done := make(chan struct{})
+	go func() {
+		read, _ = ioutil.ReadAll(conn)
+		close(done)
+	}()
+	peer.Run(t, steps...)
+	peer.Close()
+	<-done
+	conn.Close()
+
+	if wantData && string(read) != string(data) {
+		t.Errorf("Expected data %q, got %q", data, read)
+	}
+	for _, state := range []struct {
+		name string
+		has  func(byte) bool
+	}{
+		{"local", conn.LocalEnabled},
+		{"remote", conn.RemoteEnabled},
+		{"wont", conn.ClientWont},
+		{"dont", conn.ClientDont},
+	} {
+		var got []string
+		for o := 0; o < 256; o++ {
+			if state.has(byte(o)) {
+				got = append(got, optionNames[byte(o)])
+			}
+		}
+		want := append([]string(nil), expect[state.name]...)
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Expected %s options [%s], got [%s]", state.name, strings.Join(want, " "), strings.Join(got, " "))
+		}
+	}
+}
+
+// policyNegotiator enables an option on either side if it is supported there,
+// following RFC 854: it offers options as configured, and only replies to a
+// request that would change the option's state.
+type policyNegotiator struct {
+	code                     byte
+	local, remote            bool // supported on each side
+	offerLocal, offerRemote  bool // offered on connecting
+	pendingLocal, pendingRem bool // offered and awaiting a reply
+}
+
+func (p *policyNegotiator) OptionCode() byte { return p.code }
+
+func (p *policyNegotiator) Offer(c *telnet.Connection) {
+	if p.offerLocal {
+		c.WriteCommand(telnet.WILL, p.code)
+		p.pendingLocal = true
+	}
+	if p.offerRemote {
+		c.WriteCommand(telnet.DO, p.code)
+		p.pendingRem = true
+	}
+}
+
+func (p *policyNegotiator) HandleDo(c *telnet.Connection) {
+	switch {
+	case !p.local:
+		c.WriteCommand(telnet.WONT, p.code)
+	case c.LocalEnabled(p.code):
+	default:
+		if !p.pendingLocal {
+			c.WriteCommand(telnet.WILL, p.code)
+		}
+		p.pendingLocal = false
+		c.SetLocalEnabled(p.code, true)
+	}
+}
+
+func (p *policyNegotiator) HandleWill(c *telnet.Connection) {
+	switch {
+	case !p.remote:
+		c.WriteCommand(telnet.DONT, p.code)
+	case c.RemoteEnabled(p.code):
+	default:
+		if !p.pendingRem {
+			c.WriteCommand(telnet.DO, p.code)
+		}
+		p.pendingRem = false
+		c.SetRemoteEnabled(p.code, true)
+	}
+}
+
+func (p *policyNegotiator) HandleSB(c *telnet.Connection, body []byte) {}
+
+// optionCodes maps the option names used in conformance transcripts to their
+// codes, and optionNames the reverse.
+var (
+	optionCodes = map[string]byte{
+		"BINARY":         telnet.TeloptBINARY,
+		"ECHO":           telnet.TeloptECHO,
+		"SGA":            telnet.TeloptSGA,
+		"STATUS":         telnet.TeloptSTATUS,
+		"TM":             telnet.TeloptTM,
+		"TTYPE":          telnet.TeloptTTYPE,
+		"EOR":            telnet.TeloptEOR,
+		"NAWS":           telnet.TeloptNAWS,
+		"TSPEED":         telnet.TeloptTSPEED,
+		"LFLOW":          telnet.TeloptLFLOW,
+		"LINEMODE":       telnet.TeloptLINEMODE,
+		"XDISPLOC":       telnet.TeloptXDISPLOC,
+		"AUTHENTICATION": telnet.TeloptAUTHENTICATION,
+		"NEW-ENVIRON":    telnet.TeloptNEWENVIRON,
+		"CHARSET":        42,
+		"MSDP":           69,
+		"MSSP":           70,
+		"MCCP2":          86,
+		"GMCP":           201,
+	}
+	optionNames = map[byte]string{}
+)
+
+func init() {
+	for name, code := range optionCodes {
+		optionNames[code] = name
+	}
+	for o := 0; o < 256; o++ {
+		if _, ok := optionNames[byte(o)]; !ok {
+			optionNames[byte(o)] = strconv.Itoa(o)
+		}
+	}
+}
+
+// commandCodes maps command names to their codes.
+var commandCodes = map[string]byte{
+	"IAC": telnet.IAC, "DONT": telnet.DONT, "DO": telnet.DO, "WONT": telnet.WONT,
+	"WILL": telnet.WILL, "SB": telnet.SB, "GA": telnet.GA, "EL": telnet.EL,
+	"EC": telnet.EC, "AYT": telnet.AYT, "AO": telnet.AO, "IP": telnet.IP,
+	"BRK": telnet.BRK, "DM": telnet.DM, "NOP": telnet.NOP, "SE": telnet.SE,
+}
+
+// parseBytes parses a sequence of command and option names, decimal byte
+// values and quoted strings.
+func parseBytes(s string) ([]byte, error) {
+	var b []byte
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			q, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			u, _ := strconv.Unquote(q)
+			b = append(b, u...)
+			s = s[len(q):]
+			continue
+		}
+		tok := s
+		if i := strings.IndexByte(s, ' '); i >= 0 {
+			tok = s[:i]
+		}
+		s = s[len(tok):]
+		if c, ok := commandCodes[tok]; ok {
+			b = append(b, c)
+		} else if c, ok := optionCodes[tok]; ok {
+			b = append(b, c)
+		} else if n, err := strconv.ParseUint(tok, 10, 8); err == nil {
+			b = append(b, byte(n))
+		} else {
+			return nil, fmt.Errorf("unknown token %q", tok)
+		}
+	}
+	return b, nil
+}
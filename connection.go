@@ -1,12 +1,27 @@
 package telnet
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Negotiator defines the requirements for a telnet option handler.
+//
+// Apart from Offer, which is called from NewConnection, the methods are called
+// on the Connection's negotiation goroutine, one at a time and in the order the
+// commands were received, so a slow handler does not hold up Read. They must
+// not call Close on the Connection directly, since Close waits for pending
+// negotiation to finish; use `go conn.Close()` instead.
 type Negotiator interface {
 	// OptionCode returns the 1-byte option code that indicates this option.
 	OptionCode() byte
@@ -21,11 +36,84 @@ type Negotiator interface {
 	HandleWill(conn *Connection)
 	// HandleSB is called when a subnegotiation command is received for this
 	// option. body contains the bytes between `IAC SB <OptionCode>` and `IAC
-	// SE`.
+	// SE`, and is only valid until HandleSB returns.
 	HandleSB(conn *Connection, body []byte)
 }
 
-// Connection to the telnet server. This lightweight TCPConn wrapper handles
+// StreamNegotiator is an optional interface a Negotiator may implement to
+// receive subnegotiation bodies as a stream instead of a buffered slice. This
+// suits options such as compression or file transfer, where bodies can be
+// arbitrarily large. Bodies for a StreamNegotiator are not subject to
+// MaxSubnegotiationSize, and HandleSB is not called.
+type StreamNegotiator interface {
+	Negotiator
+	// HandleSBStream is called on a new goroutine when a subnegotiation for
+	// this option begins. r yields the unescaped body and returns io.EOF once
+	// `IAC SE` is received. Reads from the Connection block until the handler
+	// has consumed the body received so far, or returned.
+	HandleSBStream(conn *Connection, r io.Reader)
+}
+
+// InlineNegotiator is an optional interface for a Negotiator that must act on a
+// subnegotiation at its exact position in the stream - for example, to start
+// decompressing the bytes that immediately follow it with AddTransform.
+type InlineNegotiator interface {
+	Negotiator
+	// HandleSBInline is called instead of HandleSB, from Read, as soon as
+	// `IAC SE` is received and before any later bytes are decoded. It must
+	// not block. body is only valid until HandleSBInline returns.
+	HandleSBInline(conn *Connection, body []byte)
+}
+
+// RefusalNegotiator is an optional interface for a Negotiator that wants to
+// know when the peer refuses the option, so that it can stop waiting for the
+// option or fall back to doing without, and agree to it again if asked.
+type RefusalNegotiator interface {
+	Negotiator
+	// HandleRefused is called when the peer answers our IAC WILL with IAC
+	// DONT, if local is set, or our IAC DO with IAC WONT, or leaves the
+	// request unanswered for the NegotiationTimeout. It is also called when
+	// the peer disables the option once enabled, after the Connection has
+	// recorded it as disabled.
+	HandleRefused(conn *Connection, local bool)
+}
+
+// UnhandledPolicy is how a Connection answers the peer's request to enable an
+// option it has no OptionHandler for.
+type UnhandledPolicy int
+
+const (
+	// RefuseUnhandled refuses the request, answering IAC WILL with IAC DONT
+	// and IAC DO with IAC WONT, as RFC 854 requires.
+	RefuseUnhandled UnhandledPolicy = iota
+	// IgnoreUnhandled ignores the request silently, for peers that break on
+	// being refused options they only probed for.
+	IgnoreUnhandled
+)
+
+// DefaultNegotiationWriteTimeout is the limit on negotiation writes used when
+// Connection.NegotiationWriteTimeout is zero.
+const DefaultNegotiationWriteTimeout = 10 * time.Second
+
+// DefaultNegotiationTimeout is how long the peer has to answer the requests
+// made as a Connection starts when Config.NegotiationTimeout is zero.
+const DefaultNegotiationTimeout = 10 * time.Second
+
+// DefaultMaxSubnegotiationSize is the limit on buffered subnegotiation bodies
+// used when Connection.MaxSubnegotiationSize is zero.
+const DefaultMaxSubnegotiationSize = 64 * 1024
+
+// Parser states for decoding the inbound stream.
+const (
+	stateData    = iota // plain data
+	stateIAC            // received IAC
+	stateCommand        // received IAC WILL/WONT/DO/DONT, awaiting the option
+	stateSB             // received IAC SB, awaiting the option
+	stateSBData         // inside a subnegotiation body
+)
+
+// Connection to the telnet server. This lightweight wrapper of a net.Conn -
+// TCP, TLS, a Unix socket, an in-memory pipe or any other stream - handles
 // telnet control sequences transparently in reads and writes, and provides
 // handling of supported options.
 type Connection struct {
@@ -35,257 +123,1036 @@ type Connection struct {
 	// OptionHandlers handle IAC options; the key is the IAC option code.
 	OptionHandlers map[byte]Negotiator
 
+	// MaxSubnegotiationSize is the maximum length of a subnegotiation body
+	// that will be buffered for HandleSB. Longer bodies are discarded and Read
+	// returns a *SubnegotiationTooLargeError. If zero,
+	// DefaultMaxSubnegotiationSize is used.
+	MaxSubnegotiationSize int
+
+	// MemoryBudget, if positive, caps the memory in bytes the Connection
+	// holds on the peer's behalf: its read buffer, the subnegotiation being
+	// received and those waiting to be handled, and the buffers of its
+	// transforms, including what their readers and writers report as
+	// MemoryReporters, such as compression dictionaries, and the writes
+	// waiting to go out: those held by WriteCoalescing and the messages a
+	// Broadcaster has queued for it. Once the budget would be exceeded, the
+	// Connection is closed with a *MemoryBudgetError as its CloseReason.
+	MemoryBudget int
+
+	// SequenceTimeout, if positive, is how long the peer has to complete a
+	// command or subnegotiation once it has sent part of it. If it does not,
+	// the Connection is closed with a *SequenceTimeoutError as its
+	// CloseReason, so that a peer trickling a sequence cannot hold the
+	// parser and its buffers indefinitely.
+	SequenceTimeout time.Duration
+
+	// MaxNegotiations, if positive, caps the number of WILL, WONT, DO, DONT
+	// and SB commands the peer may send over the life of the Connection.
+	MaxNegotiations int
+
+	// NegotiationRate, if positive, caps the rate of those commands per
+	// second, allowing bursts of NegotiationBurst, or a second's worth if it
+	// is zero.
+	NegotiationRate  float64
+	NegotiationBurst int
+
+	// CloseOnNegotiationFlood closes the Connection once the peer exceeds
+	// MaxNegotiations or NegotiationRate, with a *NegotiationFloodError as
+	// its CloseReason. Otherwise Read returns the error once, and the
+	// commands that follow are ignored while reading carries on.
+	CloseOnNegotiationFlood bool
+
+	// OnProtocolError, if set, is called from Read when malformed protocol is
+	// received from the peer. The parser has already recovered when it is
+	// called, and reading continues normally.
+	OnProtocolError func(err *ProtocolError)
+
+	// OnCommand, if set, is called from Read with each command received that
+	// takes no option, such as IP, BRK or AYT, at its position in the data.
+	// It must not block.
+	OnCommand func(cmd byte)
+
+	// OnSubnegotiation, if set, is called with each subnegotiation received,
+	// decoded by the Codec registered for its option, after the option's
+	// handler has had it. Subnegotiations for options without a handler are
+	// included; those taken by an InlineNegotiator or StreamNegotiator are
+	// not. It is called from the goroutine handling negotiation, in the order
+	// received, and should not block.
+	OnSubnegotiation func(s Subnegotiation)
+
+	// OnTransfer, if set, is called from Read with the Connection in transfer
+	// mode, as by Transfer, when the start of a ZMODEM transfer is received,
+	// so that it can run the transfer by reading and writing the Connection.
+	// The data before the start is returned by Read first, and the start
+	// itself is left to be read by OnTransfer. If it returns an error, Read
+	// returns it. A start split between two reads from the underlying
+	// connection is missed, but ZMODEM repeats it until answered. Transfers
+	// are not detected while a StageCharset transform is installed.
+	OnTransfer func(c *Connection, proto TransferProtocol) error
+
+	// NegotiationWriteTimeout bounds how long a negotiation write, including
+	// an automatic reply made while reading, may block. If zero,
+	// DefaultNegotiationWriteTimeout is used; if negative, there is no limit.
+	NegotiationWriteTimeout time.Duration
+
+	// WriteCoalescing, if positive, turns on write coalescing: data written
+	// with Write is held for up to this long, or until MaxCoalescedWrite
+	// bytes are held, so that a burst of small writes goes out in few
+	// packets. Anything else written - a command, a subnegotiation or a
+	// RawWrite - is written at once with the data held before it, so the GA
+	// or EOR that WritePrompt ends a prompt with sends it without delay.
+	// Flush writes the data held, as does Close.
+	WriteCoalescing time.Duration
+
+	// Unhandled sets how requests for options without an OptionHandler are
+	// answered, by option code; an option without an entry is refused. It
+	// must not be modified while negotiation may be handled, so set it
+	// before any is received, or with Config.
+	Unhandled map[byte]UnhandledPolicy
+
+	// Clock, if set, is used instead of the system clock to compute the
+	// deadlines set on the underlying connection.
+	Clock Clock
+
+	// RawNewlines disables NVT newline translation, passing CR and LF through
+	// unchanged in both directions. Translation is also suspended in each
+	// direction while the BINARY option is enabled for it, and in both
+	// during a file transfer run with Transfer.
+	RawNewlines bool
+
+	// Trace, if set, is called as protocol events occur on the connection.
+	// Commands written by Offer in NewConnection are sent before it can be
+	// set, unless it is set with NewConnectionConfig.
+	Trace *ConnectionTrace
+
+	// Logger, if set, receives structured records of negotiation at
+	// slog.LevelDebug, protocol errors at slog.LevelWarn, and the connection
+	// being closed at slog.LevelInfo. Each record has a "conn" attribute
+	// holding the Connection's ID.
+	Logger *slog.Logger
+
+	// Auditor, if set, receives AuditEvents for the Connection: it being
+	// closed, the AUTHENTICATION and ENCRYPT options changing, and those
+	// recorded with Audit.
+	Auditor Auditor
+
+	banStore BanStore // of the Server that accepted the Connection
+
+	// NegotiationLogSize is the number of lines of negotiation transcript kept
+	// for NegotiationLog. If zero, DefaultNegotiationLogSize is used; if
+	// negative, none are kept.
+	NegotiationLogSize int
+
+	// NegotiationLogOutput, if set, has each line of the negotiation
+	// transcript written to it as it occurs.
+	NegotiationLogOutput io.Writer
+
+	id     uint64
+	role   Role
+	closed atomic.Bool
+
+	// Why the Connection was closed, set before closedCh is closed, and the
+	// error that ended the stream from the peer
+	closedCh chan struct{}
+	reason   error
+	endMu    sync.Mutex
+	endErr   error
+
+	// Context, canceled by Close
+	ctxMu  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	values    sync.Map    // stored by SetValue
+	events    eventBus    // Subscriptions
+	observers observerSet // OptionObservers
+
+	transferring  atomic.Bool      // in transfer mode
+	transferStart TransferProtocol // detected by Read, for OnTransfer
+
+	// Application data transferred, for logging and ByteCounts
+	bytesRead    atomic.Uint64
+	bytesWritten atomic.Uint64
+	counts       byteCounters // beneath application data
+
+	tee atomic.Pointer[io.Writer] // set by TeeReader
+
+	// When application data was last read and written, in Unix nanoseconds
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+
+	// Serializes reads made through the ReadHalf
+	rmu sync.Mutex
+
+	// Serializes writes to Conn
+	wmu sync.Mutex
+	wcr bool // last byte written was CR
+
+	// Data held by WriteCoalescing, whether a flush is timed, and the error
+	// from a timed flush, returned by the next Write; guarded by wmu
+	wheld  []byte
+	wtimed bool
+	werr   error
+
+	// Size of the messages queued for the Connection by Broadcasters
+	broadcastBytes atomic.Int64
+
+	// Transform pipeline, innermost last
+	dataReaders   []*transformStage // StageCharset, above framing
+	dataWriters   []*transformStage // StageCharset, above framing; guarded by wmu
+	streamReaders []*transformStage // below framing
+	streamWriters []*transformStage // below framing; guarded by wmu
+
+	// Deadlines set by the user
+	dmu           sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
 	// Read buffer
 	buf  []byte
-	r, w int // buf read and write positions
+	r, w int   // buf read and write positions
+	rerr error // error from Conn.Read, returned once buf is drained
+	rcr  bool  // last data byte read was CR
+
+	// Reader returned by BufferedReader, and whether reads stop before
+	// each command for it
+	bufReader *bufio.Reader
+	segmented bool
 
 	// IAC handling
-	iac    bool
-	cmd    byte
-	option byte
+	state    int       // parser state, one of the state* constants
+	seqStart time.Time // when a partial sequence was first waited on
+	seqTimed bool      // seqStart is set for the current sequence
+	cmd      byte      // command of the sequence being parsed
+	option   byte      // option of the sequence being parsed
+
+	// Commands received, counted against MaxNegotiations and
+	// NegotiationRate, and whether the peer has exceeded them
+	negotiationCount  int
+	negotiationTokens tokenBucket
+	flooded           bool
+
+	sb       sbDecoder      // subnegotiation body being decoded
+	sbStream *io.PipeWriter // body writer for a StreamNegotiator
+
+	// relay, if set by a Proxy, is called with every command received in place
+	// of the option handlers.
+	relay func(n negotiation) error
+
+	// Negotiation goroutine
+	negotiations chan negotiation
+	queuedBytes  atomic.Int64  // size of the subnegotiation bodies queued
+	quit         chan struct{} // closed to stop the negotiation goroutine
+	done         chan struct{} // closed when the negotiation goroutine exits
+	quitOnce     sync.Once
+	negMu        sync.Mutex
+	negErr       error // fatal error from the negotiation goroutine
 
 	// Known client wont/dont
-	clientWont map[byte]bool
-	clientDont map[byte]bool
+	clientWont optionSet
+	clientDont optionSet
+
+	// Negotiation awaiting an answer: our requests, IAC WILL and IAC DO, and
+	// the peer's
+	requestedWill, requestedDo optionSet
+	askedWill, askedDo         optionSet
+	negotiationTimeout         time.Duration // from Config
+
+	// Options enabled on our side and on the peer's side
+	local  optionSet
+	remote optionSet
+
+	transcript transcript // recent negotiation, for NegotiationLog
 }
 
-// NewConnection initializes a new Connection for this given TCPConn. It will
+// NewConnection initializes a new Connection for this given net.Conn. It will
 // register all the given Option handlers and call Offer() on each, in order.
+// Requests the handlers make that the peer leaves unanswered for the
+// DefaultNegotiationTimeout are taken as refused. NewConnectionConfig takes
+// further settings, among them a Config.NegotiationTimeout to change or
+// disable that.
 func NewConnection(c net.Conn, options []Option) *Connection {
+	return NewConnectionConfig(c, &Config{Options: options})
+}
+
+// newConnection returns a Connection configured by cfg, which may be nil,
+// calling Offer on the handler of each of its options if offer is set, without
+// starting its negotiation goroutine.
+func newConnection(c net.Conn, cfg *Config, offer bool) *Connection {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	size := cfg.ReadBufferSize
+	if size <= 0 {
+		size = DefaultReadBufferSize
+	}
 	conn := &Connection{
 		Conn:           c,
-		OptionHandlers: make(map[byte]Negotiator, len(options)),
-		buf:            make([]byte, 256),
-		clientWont:     make(map[byte]bool),
-		clientDont:     make(map[byte]bool),
+		id:             lastConnID.Add(1),
+		OptionHandlers: make(map[byte]Negotiator, len(cfg.Options)),
+		buf:            make([]byte, size),
+		negotiations:   make(chan negotiation, negotiationQueueSize),
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+		closedCh:       make(chan struct{}),
 	}
-	for _, o := range options {
+	cfg.apply(conn)
+	now := conn.now().UnixNano()
+	conn.lastRead.Store(now)
+	conn.lastWrite.Store(now)
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	for _, o := range cfg.Options {
 		h := o(conn)
 		conn.OptionHandlers[h.OptionCode()] = h
-		h.Offer(conn)
+		if offer {
+			h.Offer(conn)
+		}
 	}
 	return conn
 }
 
-// Closes the connection
-func (c *Connection) Close() (err error) {
+// Close closes the connection, then waits for any negotiation already
+// received to be handled; once it returns, no option handler is running or
+// will be called. It is safe to call concurrently with Read, Write and the
+// other methods, which then return ErrClosed, as do any later calls. Close may
+// be called more than once: later calls wait for the first to finish and
+// return ErrClosed.
+func (c *Connection) Close() error {
+	return c.close(nil)
+}
 
-	err = c.Conn.Close()
+// CloseWithReason closes the Connection as Close does, recording reason to be
+// returned by CloseReason. If reason is or wraps a *CloseError, its Message
+// and LOGOUT are sent to the peer first.
+func (c *Connection) CloseWithReason(reason error) error {
+	if c.closed.Load() {
+		return c.close(reason)
+	}
+	var ce *CloseError
+	if errors.As(reason, &ce) {
+		if ce.Message != "" {
+			c.Write([]byte(ce.Message))
+		}
+		if ce.Logout {
+			c.WriteCommand(WILL, TeloptLOGOUT)
+		}
+	}
+	return c.close(reason)
+}
 
-	// TODO: BR: Do I need to clean up anything in the Connection?
-	// Probably...
+// CloseReason returns why the Connection was closed: the reason given to
+// CloseWithReason; otherwise the error that ended the stream from the peer,
+// such as io.EOF if it hung up before Close was called; otherwise ErrClosed.
+// It returns nil if the Connection has not been closed.
+func (c *Connection) CloseReason() error {
+	select {
+	case <-c.closedCh:
+		return c.reason
+	default:
+		return nil
+	}
+}
+
+// Closed returns a channel that is closed once the Connection has been
+// closed, after which CloseReason says why.
+func (c *Connection) Closed() <-chan struct{} {
+	return c.closedCh
+}
 
+// close closes the Connection, for the given reason if it is not nil.
+func (c *Connection) close(reason error) (err error) {
+	if !c.closed.CompareAndSwap(false, true) {
+		<-c.done
+		return ErrClosed
+	}
+	if c.wmu.TryLock() {
+		// Unless a write is blocked, send what coalescing holds.
+		c.flushHeld()
+		c.wmu.Unlock()
+	}
+	event := AuditEvent{Type: AuditForcedDisconnect}
+	if reason == nil {
+		event.Type = AuditDisconnect
+		c.endMu.Lock()
+		reason = c.endErr
+		c.endMu.Unlock()
+	}
+	if reason == nil {
+		reason = ErrClosed
+	}
+	err = c.opError("close", c.Conn.Close())
+	c.reason = reason
+	close(c.closedCh)
+	c.cancel()
+	c.stopNegotiation()
+	<-c.done
+	if c.Logger != nil {
+		c.log(slog.LevelInfo, "telnet: connection closed",
+			"remote", c.RemoteAddr().String(),
+			"reason", reason.Error(),
+			"bytes_read", c.bytesRead.Load(),
+			"bytes_written", c.bytesWritten.Load())
+	}
+	event.Err = reason
+	c.Audit(event)
+	c.closeEvents(reason)
 	return err
 }
 
-// Write to the connection, escaping IAC as necessary.
+// CloseWrite shuts down the writing side of the underlying connection, if it
+// supports half-close as *net.TCPConn does, so the peer reads EOF while data
+// can still be read from it. Replies to negotiation already received are
+// written first. It returns ErrHalfCloseUnsupported if the underlying
+// connection cannot be half-closed. CloseWrite must not be called from an
+// option handler.
+func (c *Connection) CloseWrite() error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	cw, ok := c.Conn.(interface{ CloseWrite() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	c.drainNegotiation()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.flushHeld(); err != nil {
+		return c.closedErr(err)
+	}
+	return c.closedErr(c.opError("close", cw.CloseWrite()))
+}
+
+// CloseRead shuts down the reading side of the underlying connection, if it
+// supports half-close as *net.TCPConn does. It returns ErrHalfCloseUnsupported
+// if the underlying connection cannot be half-closed.
+func (c *Connection) CloseRead() error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	cr, ok := c.Conn.(interface{ CloseRead() error })
+	if !ok {
+		return ErrHalfCloseUnsupported
+	}
+	return c.closedErr(c.opError("close", cr.CloseRead()))
+}
+
+// Write to the connection, escaping IAC as necessary and translating newlines
+// to their NVT form unless RawNewlines is set or BINARY is enabled for output:
+// a bare "\n" is sent as CR LF and a bare "\r" as CR NUL. Write is safe to call
+// concurrently with other writes to the Connection, including those made by
+// option handlers; each call is written to the wire without interleaving. It
+// returns len(b) on success, or 0 and the error if the write fails.
 func (c *Connection) Write(b []byte) (n int, err error) {
-	var nn, lastWrite int
-	for i, ch := range b {
-		if ch == IAC {
-			if lastWrite < i-1 {
-				nn, err = c.Conn.Write(b[lastWrite:i])
-				n += nn
-				if err != nil {
-					return
-				}
-			}
-			lastWrite = i + 1
-			nn, err = c.Conn.Write([]byte{IAC, IAC})
-			n += nn
-			if err != nil {
-				return
-			}
-		}
+	if c.closed.Load() {
+		return 0, ErrClosed
+	}
+	c.wmu.Lock()
+	if l := len(c.dataWriters); l > 0 {
+		n, err = c.dataWriters[l-1].w.Write(b)
+	} else {
+		n, err = c.writeData(b)
 	}
-	if lastWrite < len(b) {
-		nn, err = c.Conn.Write(b[lastWrite:])
-		n += nn
+	c.wmu.Unlock()
+	if err == nil {
+		c.bytesWritten.Add(uint64(len(b)))
+		c.lastWrite.Store(c.now().UnixNano())
+		c.Trace.dataWritten(b)
 	}
+	err = c.closedErr(err)
 	return
 }
 
+// writeData encodes application data below any StageCharset transforms and
+// writes it. The caller must hold c.wmu.
+func (c *Connection) writeData(b []byte) (n int, err error) {
+	translate := c.translateOutput()
+	if !translate {
+		c.wcr = false
+	}
+	if bytes.IndexByte(b, IAC) < 0 && (!translate || !c.wcr && !hasNewline(b)) {
+		// Nothing to encode
+		return c.writeCoalesced(b)
+	}
+	out := make([]byte, 0, len(b)+len(b)/8)
+	out, c.wcr = appendData(out, b, translate, c.wcr)
+	if _, err = c.writeCoalesced(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
 // RawWrite writes raw data to the connection, without escaping done by Write.
 // Use of RawWrite over Conn.Write allows Connection to do any additional
 // handling necessary, so long as it does not modify the raw data sent.
 func (c *Connection) RawWrite(b []byte) (n int, err error) {
-	return c.Conn.Write(b)
+	c.wmu.Lock()
+	n, err = c.writeWire(b)
+	c.wmu.Unlock()
+	if err == nil {
+		c.Trace.dataWritten(b)
+	}
+	err = c.closedErr(err)
+	return
+}
+
+// WriteCommand writes `IAC <cmd> <option>` to the connection, for example
+// `IAC WILL ECHO`. Like WriteSubnegotiation, it is subject to the
+// NegotiationWriteTimeout.
+func (c *Connection) WriteCommand(cmd, option byte) error {
+	c.noteSent(cmd, option)
+	err := c.writeNegotiation(cmd, option, []byte{IAC, cmd, option})
+	if err == nil {
+		c.log(slog.LevelDebug, "telnet: command sent", "cmd", cmd, "option", option)
+		c.transcribeCommand(false, cmd, option)
+		c.Trace.commandSent(cmd, option)
+	}
+	return err
+}
+
+// WriteSubnegotiation writes `IAC SB <option> <body> IAC SE` to the
+// connection as a single unit, escaping any IAC in body.
+func (c *Connection) WriteSubnegotiation(option byte, body []byte) error {
+	buf := make([]byte, 0, len(body)+5)
+	buf = append(buf, IAC, SB, option)
+	buf = appendEscaped(buf, body)
+	buf = append(buf, IAC, SE)
+	err := c.writeNegotiation(SB, option, buf)
+	if err == nil {
+		c.log(slog.LevelDebug, "telnet: subnegotiation sent", "option", option, "len", len(body))
+		c.transcribeSubnegotiation(false, option, body)
+		c.Trace.subnegotiationSent(option, body)
+	}
+	return err
+}
+
+// writeNegotiation writes a negotiation sequence, bounded by the
+// NegotiationWriteTimeout if that expires before any write deadline set on the
+// Connection.
+func (c *Connection) writeNegotiation(cmd, option byte, b []byte) (err error) {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	defer func() { err = c.closedErr(err) }()
+
+	timeout := c.NegotiationWriteTimeout
+	if timeout == 0 {
+		timeout = DefaultNegotiationWriteTimeout
+	}
+	if timeout < 0 {
+		_, err = c.writeWire(b)
+		if oe, ok := err.(*OpError); ok {
+			oe.Op = "negotiate"
+		}
+		return
+	}
+
+	c.dmu.Lock()
+	deadline := c.now().Add(timeout)
+	userDeadline := c.writeDeadline
+	ours := userDeadline.IsZero() || deadline.Before(userDeadline)
+	if ours {
+		c.Conn.SetWriteDeadline(deadline)
+	}
+	c.dmu.Unlock()
+
+	_, err = c.writeWire(b)
+	if oe, ok := err.(*OpError); ok {
+		oe.Op = "negotiate"
+	}
+
+	if ours {
+		c.dmu.Lock()
+		c.Conn.SetWriteDeadline(c.writeDeadline)
+		c.dmu.Unlock()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = &NegotiationTimeoutError{Command: cmd, Option: option, Err: err}
+		}
+	}
+	return err
+}
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+func (c *Connection) SetDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	return c.closedErr(c.Conn.SetDeadline(t))
 }
 
-const maxReadAttempts = 10
+// SetReadDeadline sets the read deadline of the underlying connection. While
+// the peer has sent part of a sequence, reads use whichever of it and the
+// SequenceTimeout expires first.
+//
+// A Read that times out leaves the parser as it was: a command,
+// subnegotiation or CR LF the peer has sent part of is completed by the next
+// Read once the rest arrives, so a server may poll with short deadlines
+// without losing its place in the stream.
+func (c *Connection) SetReadDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	c.readDeadline = t
+	return c.closedErr(c.Conn.SetReadDeadline(t))
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+// Negotiation writes made while a deadline is set use whichever of it and the
+// NegotiationWriteTimeout expires first.
+func (c *Connection) SetWriteDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	c.writeDeadline = t
+	return c.closedErr(c.Conn.SetWriteDeadline(t))
+}
+
+// appendEscaped appends b to dst, doubling any IAC.
+func appendEscaped(dst, b []byte) []byte {
+	for {
+		i := bytes.IndexByte(b, IAC)
+		if i < 0 {
+			return append(dst, b...)
+		}
+		dst = append(dst, b[:i+1]...)
+		dst = append(dst, IAC)
+		b = b[i+1:]
+	}
+}
 
 // Read from the connection, transparently removing and handling IAC control
-// sequences. It may attempt multiple reads against the underlying connection if
-// it receives back only IAC which gets stripped out of the stream.
+// sequences. If the data received from the underlying connection consists only
+// of control sequences, Read keeps blocking until some data is available or
+// an error occurs, so it never returns 0 bytes with a nil error for a non-empty
+// b. A zero-length b returns (0, nil) immediately. Control sequences are parsed
+// incrementally, so b may be of any size - even a single byte - regardless of
+// the length of the sequences being received.
 func (c *Connection) Read(b []byte) (n int, err error) {
-	for i := 0; i < maxReadAttempts && n == 0 && len(b) > 0; i++ {
+	if br := c.bufReader; br != nil && br.Buffered() > 0 && !c.closed.Load() {
+		return br.Read(b)
+	}
+	return c.readUnbuffered(b)
+}
+
+// readUnbuffered reads from the Connection, bypassing any BufferedReader.
+func (c *Connection) readUnbuffered(b []byte) (n int, err error) {
+	if c.closed.Load() {
+		return 0, ErrClosed
+	}
+	for {
+		if len(c.dataReaders) > 0 {
+			n, err = c.dataReaders[len(c.dataReaders)-1].r.Read(b)
+		} else {
+			n, err = c.readData(b)
+		}
+		if n > 0 || err != nil || c.transferStart == 0 {
+			break
+		}
+		proto := c.transferStart
+		c.transferStart = 0
+		if err = c.Transfer(proto, c.OnTransfer); err != nil {
+			break
+		}
+	}
+	c.bytesRead.Add(uint64(n))
+	c.Trace.dataRead(b[:n])
+	if n > 0 {
+		c.lastRead.Store(c.now().UnixNano())
+	}
+	if w := c.tee.Load(); w != nil && n > 0 {
+		(*w).Write(b[:n])
+	}
+	if err != nil {
+		if nerr := c.negotiationErr(); nerr != nil {
+			err = nerr
+		}
+	}
+	err = c.closedErr(err)
+	return
+}
+
+// opError returns err, from the underlying connection, as an OpError for op,
+// leaving nil and io.EOF as they are.
+func (c *Connection) opError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &OpError{Op: op, Addr: c.RemoteAddr(), Err: err}
+}
+
+// closedErr returns ErrClosed in place of err if the Connection has been
+// closed, since the underlying connection's errors are then of no interest.
+func (c *Connection) closedErr(err error) error {
+	if err != nil && c.closed.Load() {
+		return ErrClosed
+	}
+	return err
+}
+
+// readData reads application data from below any StageCharset transforms.
+func (c *Connection) readData(b []byte) (n int, err error) {
+	for n == 0 && err == nil && len(b) > 0 && c.transferStart == 0 {
 		n, err = c.read(b)
 	}
 	return
 }
 
-// read reads data from the Connection into the provided byte slice.
+// read decodes data from the Connection into the provided byte slice. Bytes
+// already held in the read buffer are decoded first; the underlying connection
+// is only read when the buffer is drained or holds nothing that can be decoded
+// yet, since the peer may be waiting on our reply before it sends any more. An
+// error from the underlying connection is only returned once all the data
+// received before it has been delivered.
 func (c *Connection) read(b []byte) (n int, err error) {
-	// Fill the buffer with data from the connection
-	err = c.fill(len(b))
-	if err != nil {
+	if c.r < c.w {
+		start := c.r
+		n, err = c.decode(b)
+		if n > 0 || err != nil || c.r != start || c.transferStart != 0 {
+			return
+		}
+	}
+	if c.rerr == nil {
+		c.rerr = c.fill()
+	}
+	if n, err = c.decode(b); n > 0 || err != nil || c.transferStart != 0 {
 		return
 	}
-
-	lastWrite := 0     // Track the last index written in the byte slice
-	var ignoreIAC bool // Flag to ignore IAC sequence
-
-	// write is a helper function to copy data from the Connection's buffer to the byte slice
-	write := func(end int) int {
-		// If the read index is at the end, return 0
-		if c.r == end {
-			return 0
+	// A timeout leaves the parser as it is, to resume with the next read.
+	ne, ok := c.rerr.(net.Error)
+	timeout := ok && ne.Timeout()
+	if c.rcr && c.rerr != nil && !timeout {
+		// A CR at the end of the stream is a bare one.
+		c.rcr = false
+		b[0] = '\r'
+		return 1, nil
+	}
+	err, c.rerr = c.rerr, nil
+	if err != nil && !timeout {
+		// Nothing more will arrive; drop any incomplete sequence and let the
+		// negotiation goroutine finish what it has.
+		c.endMu.Lock()
+		if c.endErr == nil {
+			c.endErr = err
 		}
-		// Copy data from the Connection's buffer to the byte slice
-		nn := copy(b[lastWrite:], c.buf[c.r:end])
-		n += nn
-		lastWrite += nn
-		c.r += nn
-		return nn
-	}
-
-	// endIAC resets the IAC sequence variables and sets the read index to the provided value
-	endIAC := func(i int) {
-		c.iac = false
-		c.cmd = 0
-		c.option = 0
-		c.r = i + 1
-	}
-
-	// Iterate over the buffer and copy data to the byte slice
-	for i := c.r; i < c.w && lastWrite < len(b); i++ {
-		ch := c.buf[i]
-
-		// Check for IAC sequence
-		if ch == IAC && !ignoreIAC {
-			if c.iac && c.cmd == 0 {
-				// Escaped IAC in text, copy the data and move the read index
-				write(i)
-				c.r++
-				c.iac = false
-				continue
-			} else if c.iac && i-1 > len(c.buf) && c.buf[i-1] == IAC {
-				// Escaped IAC inside IAC sequence, remove the escaped IAC and set the ignore flag
-				copy(c.buf[:i], c.buf[i+1:])
-				i--
-				ignoreIAC = true
-				continue
-			} else if !c.iac {
-				// Start of IAC sequence, copy the data and set the iac flag
-				write(i)
-				c.iac = true
+		c.endMu.Unlock()
+		c.endOfStream()
+		c.stopNegotiation()
+	}
+	return
+}
+
+// decode processes the buffered data, handling any IAC sequences and copying
+// the remaining data into b. The parser state is kept on the Connection, so a
+// sequence split across reads from the underlying connection - including a
+// subnegotiation body of any length - resumes where it left off.
+func (c *Connection) decode(b []byte) (n int, err error) {
+	for c.r < c.w && n < len(b) {
+		if c.state == stateData {
+			translate := c.translateInput()
+			if c.rcr {
+				// Resolve a CR from the previous byte: CR LF and CR NUL are
+				// newlines; otherwise it was a bare CR.
+				c.rcr = false
+				if ch := c.buf[c.r]; translate && (ch == '\n' || ch == 0) {
+					b[n] = '\n'
+					n++
+					c.r++
+					continue
+				}
+				b[n] = '\r'
+				n++
 				continue
 			}
+			// Copy plain data up to the next IAC, or CR if translating, in
+			// one go.
+			chunk := c.buf[c.r:c.w]
+			if i := bytes.IndexByte(chunk, IAC); i >= 0 {
+				chunk = chunk[:i]
+			}
+			if translate {
+				if i := bytes.IndexByte(chunk, '\r'); i >= 0 {
+					chunk = chunk[:i]
+				}
+			}
+			start := c.detectTransfer(chunk)
+			if start == 0 {
+				// Stop here, leaving the start of the transfer for
+				// OnTransfer to read.
+				c.transferStart = ZMODEM
+				return
+			} else if start > 0 {
+				chunk = chunk[:start]
+			}
+			nn := copy(b[n:], chunk)
+			n += nn
+			c.r += nn
+			if c.r < c.w && nn == len(chunk) && start < 0 {
+				switch c.buf[c.r] {
+				case IAC:
+					if c.segmented && n > 0 {
+						// Leave the command to be handled once the
+						// data before it has been taken.
+						return
+					}
+					c.state = stateIAC
+					c.seqTimed = false
+				case '\r':
+					c.rcr = true
+				}
+				c.r++
+			}
+			continue
 		}
 
-		ignoreIAC = false
+		if c.state == stateSBData {
+			nn, status, sbErr := c.sb.decode(c.buf[c.r:c.w])
+			c.r += nn
+			switch status {
+			case sbEnd:
+				c.state = stateData
+				c.endSB()
+			case sbAbort:
+				// The peer never terminated the subnegotiation; drop it and
+				// treat what follows the IAC as a new command.
+				c.abortSB()
+				c.state = stateIAC
+				c.protocolError("unterminated subnegotiation", IAC, SB, c.option)
+			}
+			if sbErr != nil {
+				c.log(slog.LevelWarn, "telnet: subnegotiation too large", "option", c.option)
+				c.transcribeFailure(sbErr)
+				c.Trace.negotiationFailed(sbErr)
+				return n, sbErr
+			}
+			continue
+		}
 
-		if c.iac && c.cmd == 0 {
-			// Handle IAC command
-			c.cmd = ch
-			if ch == SB {
-				// Handle SB command, check if there is enough data in the buffer
-				if i+2 >= c.w {
+		ch := c.buf[c.r]
+		c.r++
+		switch c.state {
+		case stateIAC:
+			switch ch {
+			case IAC:
+				// Escaped IAC in text
+				b[n] = IAC
+				n++
+				c.state = stateData
+			case SB:
+				c.state = stateSB
+			case WILL, WONT, DO, DONT:
+				c.cmd = ch
+				c.state = stateCommand
+			case SE:
+				c.state = stateData
+				c.protocolError("SE without SB", IAC, SE)
+			default:
+				c.state = stateData
+				if ch < xEOF {
+					// Most likely an unescaped IAC in the data; keep the
+					// byte that follows it.
+					b[n] = ch
+					n++
+					c.protocolError("undefined command", IAC, ch)
 					break
 				}
-				c.r = i + 2
+				// Otherwise a command without an option byte
+				if c.OnCommand != nil {
+					c.OnCommand(ch)
+				}
+				c.emit(CommandEvent{ch})
+				if c.relay != nil {
+					c.queueNegotiation(negotiation{cmd: ch})
+				}
 			}
-			continue
-		} else if c.iac && c.option == 0 {
-			// Handle IAC option
+		case stateCommand:
 			c.option = ch
-			if c.cmd != SB {
-				// Handle negotiation and reset IAC sequence
-				if _, err := c.handleNegotiation(); err != nil {
-					return 0, err
+			c.state = stateData
+			if ok, ferr := c.admitNegotiation(); !ok {
+				if ferr != nil {
+					return n, ferr
 				}
-				endIAC(i)
+				continue
 			}
-			continue
-		} else if c.iac && c.cmd == SB && ch == SE && c.buf[i-1] == IAC {
-			// Handle SB command with SE option
-			if h, ok := c.OptionHandlers[c.option]; ok {
-				h.HandleSB(c, c.buf[c.r:i-1])
+			c.log(slog.LevelDebug, "telnet: command received", "cmd", c.cmd, "option", c.option)
+			c.transcribeCommand(true, c.cmd, c.option)
+			c.Trace.commandReceived(c.cmd, c.option)
+			c.queueNegotiation(negotiation{cmd: c.cmd, option: c.option})
+		case stateSB:
+			c.option = ch
+			c.state = stateSBData
+			if ok, ferr := c.admitNegotiation(); !ok {
+				c.sb.reset(ch, 0)
+				c.sb.discard = true
+				if ferr != nil {
+					return n, ferr
+				}
+				continue
 			}
-			// Reset IAC sequence
-			endIAC(i)
-			continue
+			c.startSB()
 		}
+	}
+	c.flushSB()
+	return
+}
 
+// endOfStream resets the parser when the stream ends, reporting any sequence
+// left incomplete.
+func (c *Connection) endOfStream() {
+	if c.state == stateData {
+		return
 	}
+	seq := c.partialSequence()
+	if c.state == stateSBData {
+		c.abortSB()
+	}
+	c.state = stateData
+	c.protocolError("incomplete sequence at end of stream", seq...)
+}
 
-	// Copy remaining data from the buffer to the byte slice
-	nn := copy(b[lastWrite:], c.buf[c.r:c.w])
-	n += nn
-	c.r += nn
-	return
+// partialSequence returns the start of the sequence being parsed.
+func (c *Connection) partialSequence() []byte {
+	switch c.state {
+	case stateIAC:
+		return []byte{IAC}
+	case stateCommand:
+		return []byte{IAC, c.cmd}
+	case stateSB:
+		return []byte{IAC, SB}
+	}
+	return []byte{IAC, SB, c.option}
+}
+
+// protocolError reports malformed protocol from the peer to OnProtocolError.
+func (c *Connection) protocolError(reason string, seq ...byte) {
+	c.log(slog.LevelWarn, "telnet: protocol error", "reason", reason, "sequence", fmt.Sprintf("% x", seq))
+	err := &ProtocolError{Reason: reason, Sequence: seq}
+	c.transcribeFailure(err)
+	c.Trace.negotiationFailed(err)
+	if c.OnProtocolError != nil {
+		c.OnProtocolError(err)
+	}
 }
 
-// fill reads from the connection until it has at least
-// the requested number of bytes in the buffer.
-func (c *Connection) fill(requestedBytes int) error {
+// fill performs a single read from the underlying connection into the free
+// space at the end of the buffer. Consumed bytes are discarded first, and the
+// buffer is grown if it is still full.
+func (c *Connection) fill() error {
 	// If there are bytes remaining to be read in the buffer,
 	// shift them to the beginning of the buffer.
 	if c.r > 0 {
-		copy(c.buf, c.buf[c.r:])
+		copy(c.buf, c.buf[c.r:c.w])
 		c.w -= c.r
 		c.r = 0
 	}
-	// If the buffer is not big enough to hold the requested
-	// number of bytes, create a new buffer with the requested
-	// size and copy the existing data into it.
-	if len(c.buf) < requestedBytes {
-		newBuf := make([]byte, requestedBytes)
-		copy(newBuf, c.buf[c.r:c.w])
+	// If the buffer is full of undecoded data, make room for more.
+	if c.w == len(c.buf) {
+		if err := c.checkMemory(len(c.buf)); err != nil {
+			return err
+		}
+		newBuf := make([]byte, 2*len(c.buf))
+		copy(newBuf, c.buf[:c.w])
 		c.buf = newBuf
-		c.w = c.w - c.r
-		c.r = 0
+	}
+	if err := c.checkMemory(0); err != nil {
+		return err
+	}
+	// Bound the time left to complete a partial sequence.
+	var seqDeadline time.Time
+	if c.SequenceTimeout > 0 && c.state != stateData {
+		if !c.seqTimed {
+			c.seqStart, c.seqTimed = c.now(), true
+		}
+		seqDeadline = c.seqStart.Add(c.SequenceTimeout)
+		c.dmu.Lock()
+		user := c.readDeadline
+		c.dmu.Unlock()
+		if !user.IsZero() && user.Before(seqDeadline) {
+			seqDeadline = time.Time{}
+		} else {
+			c.Conn.SetReadDeadline(seqDeadline)
+			defer func() {
+				c.dmu.Lock()
+				c.Conn.SetReadDeadline(c.readDeadline)
+				c.dmu.Unlock()
+			}()
+		}
 	}
 	// Read from the connection into the buffer and update the
 	// write pointer.
-	nn, err := c.Conn.Read(c.buf[c.w:])
+	nn, err := c.wireReader().Read(c.buf[c.w:])
+	c.Trace.wireRead(c.buf[c.w : c.w+nn])
+	c.counts.streamRead.Add(uint64(nn))
 	c.w += nn
+	if err == io.EOF && len(c.streamReaders) > 0 {
+		// The innermost transform's encoding has ended, so carry on with
+		// the stream beneath it.
+		c.popStreamReader()
+		err = nil
+	}
+	err = c.opError("read", err)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() && !seqDeadline.IsZero() && !c.now().Before(seqDeadline) {
+		serr := &SequenceTimeoutError{Sequence: c.partialSequence()}
+		c.log(slog.LevelWarn, "telnet: sequence timed out", "sequence", fmt.Sprintf("% x", serr.Sequence))
+		c.transcribeFailure(serr)
+		c.Trace.negotiationFailed(serr)
+		c.CloseWithReason(serr)
+		err = serr
+	}
 	return err
 }
 
-// SetWindowTitle attempts to set the client's telnet window title. Clients may
-// or may not support this.
-func (c *Connection) SetWindowTitle(title string) error {
-	if _, err := fmt.Fprintf(c, TitleBarFmt, title); err != nil {
-		return err
+// LocalEnabled reports whether the option is enabled on our side of the
+// connection, as recorded by its handler with SetLocalEnabled. It is safe to
+// call from any goroutine.
+func (c *Connection) LocalEnabled(option byte) bool {
+	return c.local.has(option)
+}
+
+// RemoteEnabled reports whether the option is enabled on the peer's side of
+// the connection, as recorded by its handler with SetRemoteEnabled. It is safe
+// to call from any goroutine.
+func (c *Connection) RemoteEnabled(option byte) bool {
+	return c.remote.has(option)
+}
+
+// SetLocalEnabled records whether the option is enabled on our side of the
+// connection. Option handlers call this once negotiation for the option
+// completes; receiving IAC DONT for the option clears it automatically.
+func (c *Connection) SetLocalEnabled(option byte, enabled bool) {
+	if c.local.set(option, enabled) {
+		c.Trace.optionChanged(option, true, enabled)
+		c.auditOption(option, true, enabled)
+		c.emit(OptionEvent{Option: option, Local: true, Enabled: enabled})
+		c.observeChange(option, true, enabled)
 	}
-	return nil
 }
 
-func (c *Connection) handleNegotiation() (int, error) {
-	switch c.cmd {
-	case WILL:
-		if h, ok := c.OptionHandlers[c.option]; ok {
-			h.HandleWill(c)
-		} else {
-			return c.writeBytes(IAC, DONT, c.option)
-		}
-	case WONT:
-		c.clientWont[c.option] = true
-	case DO:
-		if h, ok := c.OptionHandlers[c.option]; ok {
-			h.HandleDo(c)
-		} else {
-			return c.writeBytes(IAC, WONT, c.option)
-		}
-	case DONT:
-		c.clientDont[c.option] = true
+// SetRemoteEnabled records whether the option is enabled on the peer's side of
+// the connection. Option handlers call this once negotiation for the option
+// completes; receiving IAC WONT for the option clears it automatically.
+func (c *Connection) SetRemoteEnabled(option byte, enabled bool) {
+	if c.remote.set(option, enabled) {
+		c.Trace.optionChanged(option, false, enabled)
+		c.auditOption(option, false, enabled)
+		c.emit(OptionEvent{Option: option, Local: false, Enabled: enabled})
+		c.observeChange(option, false, enabled)
 	}
-	return 0, nil
 }
 
-func (c *Connection) writeBytes(bytes ...byte) (int, error) {
-	return c.Conn.Write(bytes)
+// ClientWont reports whether the peer has refused to enable the option with
+// IAC WONT, or left our request for it unanswered for the NegotiationTimeout,
+// and has not since offered it with IAC WILL. It is safe to call from any
+// goroutine.
+func (c *Connection) ClientWont(option byte) bool {
+	return c.clientWont.has(option)
+}
+
+// ClientDont reports whether the peer has asked us not to enable the option
+// with IAC DONT, or left our offer of it unanswered for the
+// NegotiationTimeout, and has not since requested it with IAC DO. It is safe
+// to call from any goroutine.
+func (c *Connection) ClientDont(option byte) bool {
+	return c.clientDont.has(option)
 }
 
 func (c *Connection) Authenticate(userNamePrompt string, passwordPrompt string, userName string, password string) error {
@@ -323,10 +1190,11 @@ func (c *Connection) ReadUntil(searchStr string) (string, error) {
 	slRead = make([]byte, len(searchStr))
 
 	for !found {
-		_, err = c.Read(slRead)
+		var n int
+		n, err = c.Read(slRead)
+		readStr += string(slRead[:n])
 
 		if nil == err {
-			readStr += string(slRead)
 
 			if strings.Contains(readStr, searchStr) {
 				found = true
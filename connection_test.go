@@ -2,10 +2,20 @@ package telnet_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
 	"net"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
 )
 
 func TestConnection_Write(t *testing.T) {
@@ -24,6 +34,11 @@ func TestConnection_Write(t *testing.T) {
 			input:    []byte("hello \xffworld"),
 			expected: []byte("hello \xff\xffworld"),
 		},
+		{
+			name:     "shortiac",
+			input:    []byte("a\xffb"),
+			expected: []byte("a\xff\xffb"),
+		},
 		{
 			name:     "doubleiac",
 			input:    []byte("hello \xff\xffworld"),
@@ -97,3 +112,1148 @@ type closerBuf struct {
 }
 
 func (c *closerBuf) Close() error { return nil }
+
+func TestConnection_ReadBlocksThroughNegotiation(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		// Deliver many control-only segments before any data.
+		for i := 0; i < 20; i++ {
+			client.Write([]byte{telnet.IAC, telnet.WONT, telnet.TeloptECHO})
+		}
+		client.Write([]byte("hi"))
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	b := make([]byte, 2)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+	if string(b[:n]) != "hi" {
+		t.Errorf("Expected %q, got %q", "hi", b[:n])
+	}
+}
+
+func TestConnection_ReadBufferedBeforeNetwork(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		// Send everything at once and then wait, as a peer expecting a reply
+		// would.
+		client.Write([]byte("abcdef"))
+	}()
+	conn := telnet.NewConnection(server, nil)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"abc", "def"} {
+		b := make([]byte, 3)
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != expected {
+			t.Errorf("Expected %q, got %q", expected, b[:n])
+		}
+	}
+}
+
+// sbRecorder is a Negotiator that records the subnegotiation bodies it
+// receives.
+type sbRecorder struct {
+	code   byte
+	bodies [][]byte
+}
+
+func (r *sbRecorder) OptionCode() byte                { return r.code }
+func (r *sbRecorder) Offer(c *telnet.Connection)      {}
+func (r *sbRecorder) HandleDo(c *telnet.Connection)   {}
+func (r *sbRecorder) HandleWill(c *telnet.Connection) {}
+func (r *sbRecorder) HandleSB(c *telnet.Connection, b []byte) {
+	r.bodies = append(r.bodies, append([]byte(nil), b...))
+}
+
+func TestConnection_ReadSplitSubnegotiation(t *testing.T) {
+	segments := [][]byte{
+		[]byte("he"),
+		{telnet.IAC},
+		{telnet.SB},
+		{telnet.TeloptNAWS, 0, 80},
+		{0, 20, telnet.IAC},
+		{telnet.SE},
+		[]byte("llo"),
+	}
+	client, server := net.Pipe()
+	go func() {
+		for _, s := range segments {
+			client.Write(s)
+		}
+		client.Close()
+	}()
+	rec := &sbRecorder{code: telnet.TeloptNAWS}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return rec },
+	})
+	buf := bytes.NewBuffer(nil)
+	buf.ReadFrom(conn)
+	conn.Close()
+	if buf.String() != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", buf.String())
+	}
+	expected := []byte{0, 80, 0, 20}
+	if len(rec.bodies) != 1 || !bytes.Equal(rec.bodies[0], expected) {
+		t.Errorf("Expected body %v, got %v", expected, rec.bodies)
+	}
+}
+
+// TestConnection_ReadTimeoutMidSequence checks that a read timing out at any
+// point in the stream, as when a server polls with short deadlines, leaves
+// the parser to resume where it was.
+func TestConnection_ReadTimeoutMidSequence(t *testing.T) {
+	stream := []byte{'a', telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, telnet.IAC, telnet.IAC, 0, 24,
+		telnet.IAC, telnet.SE, 'b', '\r', '\n', 'c', telnet.IAC, telnet.NOP, 'd'}
+	for i := 1; i < len(stream); i++ {
+		a, b := telnettest.Pipe()
+		rec := &sbRecorder{code: telnet.TeloptNAWS}
+		conn := telnet.NewConnection(a, []telnet.Option{
+			func(*telnet.Connection) telnet.Negotiator { return rec },
+		})
+		peer := &telnettest.Peer{Conn: b}
+		b.Write(stream[:i])
+
+		var got []byte
+		buf := make([]byte, 16)
+		conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		for {
+			n, err := conn.Read(buf)
+			got = append(got, buf[:n]...)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			} else if err != nil {
+				t.Fatalf("split at %d: %v", i, err)
+			}
+		}
+		conn.SetReadDeadline(time.Time{})
+		b.Write(stream[i:])
+		for len(got) < len("ab\ncd") {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("split at %d: %v", i, err)
+			}
+			got = append(got, buf[:n]...)
+		}
+		if string(got) != "ab\ncd" {
+			t.Errorf("split at %d: expected %q, got %q", i, "ab\ncd", got)
+		}
+		// Wait for the subnegotiation to be handled.
+		go io.Copy(io.Discard, conn)
+		peer.Run(t, telnettest.Send(telnet.IAC, telnet.DO, 200), telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+		if len(rec.bodies) != 1 || string(rec.bodies[0]) != "\x00P\xff\x00\x18" {
+			t.Errorf("split at %d: expected one NAWS body, got %q", i, rec.bodies)
+		}
+		conn.Close()
+	}
+}
+
+func TestConnection_ReadSubnegotiationTooLarge(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE})
+		client.Write(bytes.Repeat([]byte("x"), 32))
+		client.Write([]byte{telnet.IAC, telnet.SE})
+		client.Write([]byte("hello"))
+		client.Close()
+	}()
+	rec := &sbRecorder{code: telnet.TeloptTTYPE}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return rec },
+	})
+	conn.MaxSubnegotiationSize = 16
+	b := make([]byte, 5)
+	_, err := conn.Read(b)
+	var sbErr *telnet.SubnegotiationTooLargeError
+	if !errors.As(err, &sbErr) || sbErr.Option != telnet.TeloptTTYPE {
+		t.Fatalf("Expected SubnegotiationTooLargeError, got %v", err)
+	}
+	n, err := io.ReadFull(conn, b)
+	if err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+	if string(b[:n]) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", b[:n])
+	}
+	if len(rec.bodies) != 0 {
+		t.Errorf("Expected oversized body to be discarded, got %v", rec.bodies)
+	}
+}
+
+// sbStreamer is a StreamNegotiator that sends each body it reads on C.
+type sbStreamer struct {
+	sbRecorder
+	C chan []byte
+}
+
+func (s *sbStreamer) HandleSBStream(c *telnet.Connection, r io.Reader) {
+	b, _ := ioutil.ReadAll(r)
+	s.C <- b
+}
+
+func TestConnection_ReadSubnegotiationStream(t *testing.T) {
+	body := bytes.Repeat([]byte{1, 2, telnet.IAC, telnet.IAC}, 1024)
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{telnet.IAC, telnet.SB, 86})
+		client.Write(body)
+		client.Write([]byte{telnet.IAC, telnet.SE})
+		client.Write([]byte("hello"))
+		client.Close()
+	}()
+	s := &sbStreamer{sbRecorder: sbRecorder{code: 86}, C: make(chan []byte, 1)}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return s },
+	})
+	buf := bytes.NewBuffer(nil)
+	if _, err := buf.ReadFrom(conn); err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+	if buf.String() != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", buf.String())
+	}
+	expected := bytes.Repeat([]byte{1, 2, telnet.IAC}, 1024)
+	if got := <-s.C; !bytes.Equal(got, expected) {
+		t.Errorf("Expected %d byte body, got %d bytes", len(expected), len(got))
+	}
+}
+
+func TestConnection_ClientWontDont(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{telnet.IAC, telnet.WONT, telnet.TeloptECHO, telnet.IAC, telnet.DONT, telnet.TeloptSGA, 'a'})
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	b := make([]byte, 1)
+	if _, err := conn.Read(b); err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+	if !conn.ClientWont(telnet.TeloptECHO) || conn.ClientWont(telnet.TeloptSGA) {
+		t.Errorf("Expected only ECHO to be refused with WONT")
+	}
+	if !conn.ClientDont(telnet.TeloptSGA) || conn.ClientDont(telnet.TeloptECHO) {
+		t.Errorf("Expected only SGA to be refused with DONT")
+	}
+}
+
+func TestConnection_WriteSubnegotiation(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		conn := telnet.NewConnection(server, nil)
+		if err := conn.WriteSubnegotiation(telnet.TeloptNAWS, []byte{0, telnet.IAC, 0, 24}); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}()
+	buf := bytes.NewBuffer(nil)
+	buf.ReadFrom(client)
+	client.Close()
+	expected := []byte{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, telnet.IAC, telnet.IAC, 0, 24, telnet.IAC, telnet.SE}
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Errorf("Expected %v, got %v", expected, buf.Bytes())
+	}
+}
+
+// blockingSB is a Negotiator whose HandleSB blocks until release is closed.
+type blockingSB struct {
+	sbRecorder
+	release chan struct{}
+}
+
+func (b *blockingSB) HandleSB(c *telnet.Connection, body []byte) {
+	<-b.release
+	b.sbRecorder.HandleSB(c, body)
+}
+
+func TestConnection_ReadNotStalledByHandler(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE, 'x', telnet.IAC, telnet.SE})
+		client.Write([]byte("hello"))
+		client.Close()
+	}()
+	h := &blockingSB{sbRecorder: sbRecorder{code: telnet.TeloptTTYPE}, release: make(chan struct{})}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return h },
+	})
+	b := make([]byte, 5)
+	n, err := io.ReadFull(conn, b)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", b[:n])
+	}
+	close(h.release)
+	conn.Close()
+	if len(h.bodies) != 1 || string(h.bodies[0]) != "x" {
+		t.Errorf("Expected body %q after Close, got %q", "x", h.bodies)
+	}
+}
+
+func TestConnection_NegotiationWriteTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := telnet.NewConnection(server, nil)
+	conn.NegotiationWriteTimeout = 10 * time.Millisecond
+	go func() {
+		// Request an unsupported option, then never read the refusal.
+		client.Write([]byte{telnet.IAC, telnet.DO, telnet.TeloptECHO})
+	}()
+	b := make([]byte, 1)
+	_, err := conn.Read(b)
+	var nerr *telnet.NegotiationTimeoutError
+	if !errors.As(err, &nerr) || nerr.Command != telnet.WONT || nerr.Option != telnet.TeloptECHO {
+		t.Errorf("Expected NegotiationTimeoutError, got %v", err)
+	}
+	conn.Close()
+}
+
+// eofConn is a net.Conn whose first Read returns data along with io.EOF.
+type eofConn struct {
+	net.Conn
+	data []byte
+}
+
+func (c *eofConn) Read(b []byte) (int, error) {
+	n := copy(b, c.data)
+	c.data = c.data[n:]
+	return n, io.EOF
+}
+
+func (c *eofConn) Close() error { return nil }
+
+func TestConnection_ReadDataBeforeEOF(t *testing.T) {
+	conn := telnet.NewConnection(&eofConn{data: []byte("hello")}, nil)
+	b := make([]byte, 3)
+	var got []byte
+	for {
+		n, err := conn.Read(b)
+		got = append(got, b[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("Read returned no data and no error")
+		}
+	}
+	conn.Close()
+	if string(got) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", got)
+	}
+}
+
+func TestConnection_WriteNewlines(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      bool
+		input    []string
+		expected []byte
+	}{
+		{
+			name:     "lf",
+			input:    []string{"a\nb"},
+			expected: []byte("a\r\nb"),
+		},
+		{
+			name:     "crlf",
+			input:    []string{"a\r\nb"},
+			expected: []byte("a\r\nb"),
+		},
+		{
+			name:     "cr",
+			input:    []string{"a\rb"},
+			expected: []byte("a\r\x00b"),
+		},
+		{
+			name:     "splitcrlf",
+			input:    []string{"a\r", "\nb"},
+			expected: []byte("a\r\nb"),
+		},
+		{
+			name:     "raw",
+			raw:      true,
+			input:    []string{"a\rb\n"},
+			expected: []byte("a\rb\n"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				conn := telnet.NewConnection(server, nil)
+				conn.RawNewlines = test.raw
+				for _, s := range test.input {
+					if _, err := conn.Write([]byte(s)); err != nil {
+						t.Error(err)
+					}
+				}
+				conn.Close()
+			}()
+			buf := bytes.NewBuffer(nil)
+			buf.ReadFrom(client)
+			client.Close()
+			if !bytes.Equal(test.expected, buf.Bytes()) {
+				t.Errorf("Expected %q, got %q", test.expected, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestConnection_ReadNewlines(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      bool
+		input    []string
+		expected string
+	}{
+		{
+			name:     "crlf",
+			input:    []string{"a\r\nb"},
+			expected: "a\nb",
+		},
+		{
+			name:     "crnul",
+			input:    []string{"a\r\x00b"},
+			expected: "a\nb",
+		},
+		{
+			name:     "barecr",
+			input:    []string{"a\rb\r"},
+			expected: "a\rb\r",
+		},
+		{
+			name:     "splitcrlf",
+			input:    []string{"a\r", "\nb"},
+			expected: "a\nb",
+		},
+		{
+			name:     "raw",
+			raw:      true,
+			input:    []string{"a\r\nb\r\x00"},
+			expected: "a\r\nb\r\x00",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				for _, s := range test.input {
+					client.Write([]byte(s))
+				}
+				client.Close()
+			}()
+			conn := telnet.NewConnection(server, nil)
+			conn.RawNewlines = test.raw
+			buf := bytes.NewBuffer(nil)
+			buf.ReadFrom(conn)
+			conn.Close()
+			if buf.String() != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestConnection_ReadMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+		errors   int
+	}{
+		{
+			name:     "undefined",
+			input:    []byte{'a', telnet.IAC, 'b', 'c'},
+			expected: "abc",
+			errors:   1,
+		},
+		{
+			name:     "strayse",
+			input:    []byte{'a', telnet.IAC, telnet.SE, 'b'},
+			expected: "ab",
+			errors:   1,
+		},
+		{
+			name:     "nooption",
+			input:    []byte{'a', telnet.IAC, telnet.NOP, 'b'},
+			expected: "ab",
+		},
+		{
+			name:     "unterminatedsb",
+			input:    []byte{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 1, telnet.IAC, telnet.WONT, telnet.TeloptECHO, 'a'},
+			expected: "a",
+			errors:   1,
+		},
+		{
+			name:     "truncated",
+			input:    []byte{'a', telnet.IAC, telnet.DO},
+			expected: "a",
+			errors:   1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				client.Write(test.input)
+				client.Close()
+			}()
+			conn := telnet.NewConnection(server, nil)
+			var errs []*telnet.ProtocolError
+			conn.OnProtocolError = func(err *telnet.ProtocolError) {
+				errs = append(errs, err)
+			}
+			buf := bytes.NewBuffer(nil)
+			buf.ReadFrom(conn)
+			conn.Close()
+			if buf.String() != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, buf.String())
+			}
+			if len(errs) != test.errors {
+				t.Errorf("Expected %d protocol errors, got %v", test.errors, errs)
+			}
+		})
+	}
+}
+
+func TestConnection_ReadSubnegotiationEscapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected []byte
+	}{
+		{
+			name:     "escapediac",
+			input:    []byte{1, telnet.IAC, telnet.IAC, 2},
+			expected: []byte{1, telnet.IAC, 2},
+		},
+		{
+			name:     "escapediacse",
+			input:    []byte{1, telnet.IAC, telnet.IAC, telnet.SE, 2},
+			expected: []byte{1, telnet.IAC, telnet.SE, 2},
+		},
+		{
+			name:     "doubleescapediac",
+			input:    []byte{telnet.IAC, telnet.IAC, telnet.IAC, telnet.IAC},
+			expected: []byte{telnet.IAC, telnet.IAC},
+		},
+		{
+			name:     "literalse",
+			input:    []byte{telnet.SE, telnet.SE},
+			expected: []byte{telnet.SE, telnet.SE},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				// Deliver the body one byte at a time to exercise resumption.
+				client.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE})
+				for _, ch := range test.input {
+					client.Write([]byte{ch})
+				}
+				client.Write([]byte{telnet.IAC, telnet.SE, 'x'})
+				client.Close()
+			}()
+			rec := &sbRecorder{code: telnet.TeloptTTYPE}
+			conn := telnet.NewConnection(server, []telnet.Option{
+				func(*telnet.Connection) telnet.Negotiator { return rec },
+			})
+			buf := bytes.NewBuffer(nil)
+			buf.ReadFrom(conn)
+			conn.Close()
+			if buf.String() != "x" {
+				t.Errorf("Expected %q, got %q", "x", buf.String())
+			}
+			if len(rec.bodies) != 1 || !bytes.Equal(rec.bodies[0], test.expected) {
+				t.Errorf("Expected body %v, got %v", test.expected, rec.bodies)
+			}
+		})
+	}
+}
+
+func TestConnection_ReadTinyBuffers(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	input := []byte{'a', telnet.IAC, telnet.SB, telnet.TeloptTTYPE, 0, 'x', 't', telnet.IAC, telnet.SE, 'b', telnet.IAC, telnet.IAC}
+	rec := &sbRecorder{code: telnet.TeloptTTYPE}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return rec },
+	})
+
+	// A zero-length read returns immediately, even with nothing to read.
+	if n, err := conn.Read(nil); n != 0 || err != nil {
+		t.Errorf("Expected (0, nil), got (%d, %v)", n, err)
+	}
+
+	go func() {
+		client.Write(input)
+		client.Close()
+	}()
+	var got []byte
+	b := make([]byte, 1)
+	for {
+		n, err := conn.Read(b)
+		got = append(got, b[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	conn.Close()
+	if string(got) != "ab\xff" {
+		t.Errorf("Expected %q, got %q", "ab\xff", got)
+	}
+	if len(rec.bodies) != 1 || string(rec.bodies[0]) != "\x00xt" {
+		t.Errorf("Expected body %q, got %q", "\x00xt", rec.bodies)
+	}
+}
+
+func TestConnection_CloseWrite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn := telnet.NewConnection(c, nil)
+		conn.Write([]byte("bye"))
+		if err := conn.CloseWrite(); err != nil {
+			t.Error(err)
+		}
+		// The read side still works after the write side is closed.
+		io.Copy(ioutil.Discard, conn)
+		conn.Close()
+	}()
+	client, err := telnet.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "bye" {
+		t.Errorf("Expected %q, got %q", "bye", b)
+	}
+	if _, err := client.Write([]byte("still open")); err != nil {
+		t.Error(err)
+	}
+	client.Close()
+
+	pipe, _ := net.Pipe()
+	conn := telnet.NewConnection(pipe, nil)
+	if err := conn.CloseWrite(); err != telnet.ErrHalfCloseUnsupported {
+		t.Errorf("Expected ErrHalfCloseUnsupported, got %v", err)
+	}
+	conn.Close()
+}
+
+func TestConnection_CloseTwice(t *testing.T) {
+	a, _ := net.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	if err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := conn.Close(); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from the second Close, got %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from Read, got %v", err)
+	}
+	if _, err := conn.Write([]byte("x")); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from Write, got %v", err)
+	}
+	if err := conn.WriteCommand(telnet.WILL, telnet.TeloptECHO); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from WriteCommand, got %v", err)
+	}
+	if err := conn.SetReadDeadline(time.Now()); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from SetReadDeadline, got %v", err)
+	}
+	if err := conn.CloseWrite(); err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed from CloseWrite, got %v", err)
+	}
+	if !errors.Is(telnet.ErrClosed, net.ErrClosed) {
+		t.Error("Expected ErrClosed to satisfy errors.Is(err, net.ErrClosed)")
+	}
+}
+
+func TestConnection_OpError(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(-time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	var oe *telnet.OpError
+	if !errors.As(err, &oe) || oe.Op != "read" || oe.Addr != a.RemoteAddr() {
+		t.Errorf("Expected an OpError reading from %v, got %v", a.RemoteAddr(), err)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	b.Close()
+	if _, err := conn.Write([]byte("x")); !errors.As(err, &oe) || oe.Op != "write" || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Expected an OpError writing, got %v", err)
+	}
+	if err := conn.WriteCommand(telnet.WILL, telnet.TeloptECHO); !errors.As(err, &oe) || oe.Op != "negotiate" {
+		t.Errorf("Expected an OpError negotiating, got %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+// TestConnection_CloseRace closes a Connection while it is being read and
+// written, and its option handler is replying to the peer. Run it with -race.
+func TestConnection_CloseRace(t *testing.T) {
+	const code = 200
+	for i := 0; i < 50; i++ {
+		m := &telnettest.MockNegotiator{Code: code, DoReply: telnet.WILL, SBReply: []byte("ok")}
+		a, b := telnettest.Pipe()
+		conn := telnet.NewConnection(a, []telnet.Option{m.Option()})
+		go func() {
+			for j := 0; j < 200; j++ {
+				if _, err := b.Write([]byte{'x', telnet.IAC, telnet.DO, code, telnet.IAC, telnet.SB, code, 1, telnet.IAC, telnet.SE}); err != nil {
+					return
+				}
+			}
+		}()
+		go io.Copy(ioutil.Discard, b)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := io.Copy(ioutil.Discard, conn)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := conn.Write([]byte("hello\n")); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			conn.Close()
+		}()
+		conn.Close()
+		wg.Wait()
+		b.Close()
+		close(errs)
+		for err := range errs {
+			if err != telnet.ErrClosed {
+				t.Fatalf("Expected ErrClosed, got %v", err)
+			}
+		}
+	}
+}
+
+func TestConnection_OnCommand(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	var cmds []byte
+	conn.OnCommand = func(cmd byte) { cmds = append(cmds, cmd) }
+	b.Write([]byte{'a', telnet.IAC, telnet.IP, 'b', telnet.IAC, telnet.AYT, telnet.IAC, telnet.DO, telnet.TeloptECHO, telnet.IAC, 1})
+	b.Close()
+	data, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	if string(data) != "ab\x01" {
+		t.Errorf("Expected %q, got %q", "ab\x01", data)
+	}
+	if !bytes.Equal(cmds, []byte{telnet.IP, telnet.AYT}) {
+		t.Errorf("Expected IP and AYT, got %v", cmds)
+	}
+}
+
+func TestConnection_OnTransfer(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	const header = "**\x18B0100000023be50\r\n"
+	var got telnet.TransferProtocol
+	conn.OnTransfer = func(c *telnet.Connection, proto telnet.TransferProtocol) error {
+		got = proto
+		// Newlines pass through untranslated, and IAC is still unescaped.
+		buf := make([]byte, len(header)+1)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return err
+		}
+		if string(buf) != header+"\xff" {
+			t.Errorf("Expected %q, got %q", header+"\xff", buf)
+		}
+		_, err := c.Write([]byte("a\nb\xff"))
+		return err
+	}
+	b.Write([]byte("hi\r\n" + header + "\xff\xff"))
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "hi\n" {
+		t.Fatalf("Expected the data before the transfer, got %q, %v", buf[:n], err)
+	}
+	b.Write([]byte("x\r\n"))
+	if n, err = conn.Read(buf); err != nil || string(buf[:n]) != "x\n" {
+		t.Fatalf("Expected translation to resume after the transfer, got %q, %v", buf[:n], err)
+	}
+	if got != telnet.ZMODEM {
+		t.Errorf("Expected a ZMODEM transfer, got %v", got)
+	}
+	out := make([]byte, 5)
+	if _, err := io.ReadFull(b, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "a\nb\xff\xff" {
+		t.Errorf("Expected untranslated output with IAC escaped, got %q", out)
+	}
+}
+
+// xorTransform is a Transform that XORs every byte with a key.
+type xorTransform struct{ key byte }
+
+func (x *xorTransform) NewReader(r io.Reader) io.Reader {
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		for i := range b[:n] {
+			b[i] ^= x.key
+		}
+		return n, err
+	})
+}
+
+func (x *xorTransform) NewWriter(w io.Writer) io.Writer {
+	return writerFunc(func(b []byte) (int, error) {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ x.key
+		}
+		return w.Write(out)
+	})
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) { return f(b) }
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+// xorToggler is an InlineNegotiator that starts or stops a xorTransform on
+// each subnegotiation.
+type xorToggler struct {
+	sbRecorder
+	x      *xorTransform
+	active bool
+}
+
+func (x *xorToggler) HandleSBInline(c *telnet.Connection, body []byte) {
+	if x.active {
+		c.RemoveTransform(x.x)
+	} else {
+		c.AddTransform(telnet.StageCompression, x.x)
+	}
+	x.active = !x.active
+}
+
+func TestConnection_StreamTransform(t *testing.T) {
+	const key = 0x5a
+	xor := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ key
+		}
+		return out
+	}
+	toggle := []byte{telnet.IAC, telnet.SB, 200, telnet.IAC, telnet.SE}
+	segments := [][]byte{
+		append([]byte("a"), toggle...),
+		xor(append([]byte{'b', telnet.IAC, telnet.IAC}, toggle...)),
+		[]byte("c"),
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		for _, s := range segments {
+			client.Write(s)
+		}
+		b := make([]byte, 2)
+		io.ReadFull(client, b)
+		client.Write(b)
+		client.Close()
+	}()
+	h := &xorToggler{sbRecorder: sbRecorder{code: 200}, x: &xorTransform{key: key}}
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return h },
+	})
+	b := make([]byte, 4)
+	n, err := io.ReadFull(conn, b)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b[:n]) != "ab\xffc" {
+		t.Errorf("Expected %q, got %q", "ab\xffc", b[:n])
+	}
+
+	// Writes pass through the transform as well.
+	conn.AddTransform(telnet.StageCompression, h.x)
+	conn.Write([]byte("hi"))
+	conn.RemoveTransform(h.x)
+	n, err = io.ReadFull(conn, b[:2])
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b[:n]) != string(xor([]byte("hi"))) {
+		t.Errorf("Expected %q, got %q", xor([]byte("hi")), b[:n])
+	}
+	conn.Close()
+}
+
+func TestConnection_CharsetTransform(t *testing.T) {
+	upper := &upperTransform{}
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("hello"))
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	if err := conn.AddTransform(telnet.StageCharset, upper); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.ReadFrom(conn)
+	conn.Close()
+	if buf.String() != "HELLO" {
+		t.Errorf("Expected %q, got %q", "HELLO", buf.String())
+	}
+}
+
+// upperTransform is a Transform that upper cases data read.
+type upperTransform struct{}
+
+func (u *upperTransform) NewReader(r io.Reader) io.Reader {
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		copy(b, bytes.ToUpper(b[:n]))
+		return n, err
+	})
+}
+
+func (u *upperTransform) NewWriter(w io.Writer) io.Writer { return w }
+
+func TestConnection_AddWriteTransform(t *testing.T) {
+	const key = 0x5a
+	peer, conn := telnettest.NewPeer()
+	defer peer.Close()
+	defer conn.Close()
+	x := &xorTransform{key: key}
+	if err := conn.AddWriteTransform(telnet.StageCompression, x); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AddWriteTransform(telnet.StageEncryption, x); err != telnet.ErrTransformOrder {
+		t.Errorf("adding beneath an active transform: got %v, want ErrTransformOrder", err)
+	}
+	go conn.Write([]byte("hi"))
+	peer.Run(t, telnettest.Expect('h'^key, 'i'^key))
+
+	// Reads are left alone.
+	peer.Run(t, telnettest.Send('o', 'k'))
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "ok" {
+		t.Errorf("read %q, %v; want %q", b, err, "ok")
+	}
+
+	if err := conn.RemoveTransform(x); err != nil {
+		t.Fatal(err)
+	}
+	go conn.Write([]byte("hi"))
+	peer.Run(t, telnettest.Expect('h', 'i'))
+}
+
+func TestConnection_Trace(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+		sent   []string
+	)
+	record := func(format string, args ...interface{}) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+	trace := &telnet.ConnectionTrace{
+		CommandReceived: func(cmd, option byte) { record("recv %d %d", cmd, option) },
+		CommandSent: func(cmd, option byte) {
+			// Sent from the negotiation goroutine, so kept apart.
+			mu.Lock()
+			sent = append(sent, fmt.Sprintf("sent %d %d", cmd, option))
+			mu.Unlock()
+		},
+		SubnegotiationReceived: func(option byte, body []byte) {
+			record("recv sb %d %q", option, body)
+		},
+		DataRead:    func(b []byte) { record("read %q", b) },
+		DataWritten: func(b []byte) { record("wrote %q", b) },
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{'h', 'i', telnet.IAC, telnet.WILL, 42})
+		io.ReadFull(client, make([]byte, 3))
+		client.Write([]byte{telnet.IAC, telnet.SB, 42, 'x', telnet.IAC, telnet.SE, '!'})
+		io.Copy(ioutil.Discard, client)
+	}()
+	conn := telnet.NewConnection(server, nil)
+	conn.Trace = trace
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Error(err)
+	}
+	conn.Write([]byte("ok"))
+	conn.Close()
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"recv 251 42",
+		"read \"hi\"",
+		"recv sb 42 \"x\"",
+		"read \"!\"",
+		"wrote \"ok\"",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q, got %q", expected, events)
+	}
+	if len(sent) != 1 || sent[0] != "sent 254 42" {
+		t.Errorf("Expected %q, got %q", "sent 254 42", sent)
+	}
+}
+
+func TestConnection_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{'h', 'i', telnet.IAC, telnet.DONT, 42, telnet.IAC, 1})
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	conn.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	b, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	if string(b) != "hi\x01" {
+		t.Errorf("Expected %q, got %q", "hi\x01", b)
+	}
+	id := fmt.Sprintf("conn=%d", conn.ID())
+	for _, want := range []string{
+		"level=DEBUG msg=\"telnet: command received\" " + id + " cmd=254 option=42",
+		"level=WARN msg=\"telnet: protocol error\" " + id + " reason=\"undefined command\" sequence=\"ff 01\"",
+		"level=INFO msg=\"telnet: connection closed\" " + id,
+		"reason=EOF bytes_read=3 bytes_written=0",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected log to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestMultiTrace(t *testing.T) {
+	var a, b []string
+	trace := telnet.MultiTrace(
+		&telnet.ConnectionTrace{
+			OptionChanged: func(option byte, local, enabled bool) {
+				a = append(a, fmt.Sprint(option, local, enabled))
+			},
+		},
+		nil,
+		&telnet.ConnectionTrace{
+			OptionChanged: func(option byte, local, enabled bool) {
+				b = append(b, fmt.Sprint(option, local, enabled))
+			},
+			DataRead: func([]byte) {},
+		},
+	)
+	if trace.DataRead == nil || trace.DataWritten != nil {
+		t.Error("Expected only the hooks set in a trace to be set")
+	}
+
+	client, server := net.Pipe()
+	conn := telnet.NewConnection(server, nil)
+	conn.Trace = trace
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetRemoteEnabled(telnet.TeloptNAWS, false)
+	conn.SetRemoteEnabled(telnet.TeloptNAWS, true)
+	conn.Close()
+	client.Close()
+
+	expected := []string{"1 true true", "31 false true"}
+	if fmt.Sprint(a) != fmt.Sprint(expected) || fmt.Sprint(b) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q from both, got %q and %q", expected, a, b)
+	}
+}
+
+func TestConnection_NegotiationLog(t *testing.T) {
+	var out bytes.Buffer
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS})
+		io.ReadFull(client, make([]byte, 3))
+		client.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 120, 0, 40, telnet.IAC, telnet.SE})
+		client.Write([]byte{telnet.IAC, telnet.SE})
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	conn.NegotiationLogSize = 3
+	conn.NegotiationLogOutput = &out
+	ioutil.ReadAll(conn)
+	conn.Close()
+
+	expected := []string{
+		"<< IAC WILL NAWS",
+		"<< SB NAWS 0 120 0 40",
+		"!! telnet: SE without SB: ff f0",
+	}
+	// Only the last 3 lines are kept, and the refusal is sent concurrently
+	// with the lines that follow it.
+	if log := conn.NegotiationLog(); len(log) != 3 || log[0] == expected[0] {
+		t.Errorf("Expected the last 3 lines, got %q", log)
+	}
+	if !strings.Contains(out.String(), ">> IAC DONT NAWS\n") {
+		t.Errorf("Expected a refusal, got %q", out.String())
+	}
+	var received []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, ">>") {
+			received = append(received, line)
+		}
+	}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q, got %q", expected, received)
+	}
+}
@@ -0,0 +1,131 @@
+package telnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Context returns the Connection's context, which is canceled when the
+// Connection is closed or, for a Connection accepted by a Server, when the
+// Server is stopped. Handler goroutines can select on its Done channel to know
+// when to stop. It carries any values attached with AttachValue.
+func (c *Connection) Context() context.Context {
+	c.ctxMu.Lock()
+	defer c.ctxMu.Unlock()
+	return c.ctx
+}
+
+// AttachValue attaches a value to the Connection's context, such as a session
+// ID or the user who logged in, so that Context().Value(key) returns it. As
+// with context.WithValue, key should be of a type defined by the caller. It is
+// safe to call concurrently with Context; contexts returned earlier do not
+// carry the value.
+func (c *Connection) AttachValue(key, val any) {
+	c.ctxMu.Lock()
+	defer c.ctxMu.Unlock()
+	c.ctx = context.WithValue(c.ctx, key, val)
+}
+
+// SetValue stores a value on the Connection under key, for sharing state
+// between option handlers and the layers above them - for example, a terminal
+// type handler can publish the client's name for a writer choosing colors to
+// read. Unlike AttachValue, a later value replaces an earlier one for all
+// readers. A nil val deletes the key. It is safe to call concurrently with
+// Value and with other calls to SetValue.
+func (c *Connection) SetValue(key, val any) {
+	if val == nil {
+		c.values.Delete(key)
+		return
+	}
+	c.values.Store(key, val)
+}
+
+// Value returns the value stored on the Connection under key by SetValue, or
+// nil if there is none.
+func (c *Connection) Value(key any) any {
+	val, _ := c.values.Load(key)
+	return val
+}
+
+// ReadContext is like Read, but returns ctx's error if ctx is done before
+// data arrives. The read deadline is set from ctx's deadline, if it is earlier
+// than the one set by SetReadDeadline, for the duration of the call, and
+// restored afterwards. As with a timeout, a read interrupted by ctx leaves the
+// Connection ready to be read again.
+func (c *Connection) ReadContext(ctx context.Context, b []byte) (int, error) {
+	c.dmu.Lock()
+	restore := c.readDeadline
+	c.dmu.Unlock()
+	deadline, ok := ctx.Deadline()
+	if !ok || !restore.IsZero() && restore.Before(deadline) {
+		deadline = restore
+	}
+	return c.withContext(ctx, deadline, c.SetReadDeadline, restore, func() (int, error) {
+		return c.Read(b)
+	})
+}
+
+// WriteContext is like Write, but returns ctx's error if ctx is done before
+// b has been written, in which case some of it may have been. The write
+// deadline is set from ctx's deadline, if it is earlier than the one set by
+// SetWriteDeadline, for the duration of the call, and restored afterwards.
+func (c *Connection) WriteContext(ctx context.Context, b []byte) (int, error) {
+	c.dmu.Lock()
+	restore := c.writeDeadline
+	c.dmu.Unlock()
+	deadline, ok := ctx.Deadline()
+	if !ok || !restore.IsZero() && restore.Before(deadline) {
+		deadline = restore
+	}
+	return c.withContext(ctx, deadline, c.SetWriteDeadline, restore, func() (int, error) {
+		return c.Write(b)
+	})
+}
+
+// aLongTimeAgo is a deadline in the past, interrupting blocked I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// withContext runs op with a deadline set by setDeadline, interrupting it when
+// ctx is done, then sets the deadline back to restore. A timeout caused by ctx
+// is returned as ctx's error.
+func (c *Connection) withContext(ctx context.Context, deadline time.Time, setDeadline func(time.Time) error,
+	restore time.Time, op func() (int, error)) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	setDeadline(deadline)
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		setDeadline(aLongTimeAgo)
+		close(interrupted)
+	})
+	n, err := op()
+	if !stop() {
+		<-interrupted
+	}
+	setDeadline(restore)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		if cerr := ctx.Err(); cerr != nil {
+			err = cerr
+		} else if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+			err = context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
+
+// baseContext returns the Server's context, canceled by Stop.
+func (s *Server) baseContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		if s.quitting {
+			s.cancel()
+		}
+	}
+	return s.ctx
+}
@@ -0,0 +1,186 @@
+package telnet_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+type sessionKey struct{}
+
+func TestConnection_Context(t *testing.T) {
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	ctx := conn.Context()
+	conn.AttachValue(sessionKey{}, "s1")
+	if v := conn.Context().Value(sessionKey{}); v != "s1" {
+		t.Errorf("Expected %q, got %v", "s1", v)
+	}
+	if ctx.Value(sessionKey{}) != nil {
+		t.Error("Expected an earlier context not to carry the value")
+	}
+	if conn.Context().Err() != nil {
+		t.Error("Expected the context not to be canceled before Close")
+	}
+	conn.Close()
+	for _, c := range []context.Context{ctx, conn.Context()} {
+		if c.Err() == nil {
+			t.Error("Expected the context to be canceled by Close")
+		}
+	}
+}
+
+func TestConnection_SetValue(t *testing.T) {
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	if v := conn.Value(sessionKey{}); v != nil {
+		t.Errorf("Expected no value, got %v", v)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.SetValue(sessionKey{}, "xterm")
+			conn.Value(sessionKey{})
+		}()
+	}
+	wg.Wait()
+	if v := conn.Value(sessionKey{}); v != "xterm" {
+		t.Errorf("Expected %q, got %v", "xterm", v)
+	}
+	conn.SetValue(sessionKey{}, nil)
+	if v := conn.Value(sessionKey{}); v != nil {
+		t.Errorf("Expected the value to be deleted, got %v", v)
+	}
+}
+
+func TestServer_StopCancelsContexts(t *testing.T) {
+	// serveUnix makes a connection of its own, so there are two handlers.
+	handling, done := make(chan struct{}, 2), make(chan struct{}, 2)
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		handling <- struct{}{}
+		<-c.Context().Done()
+		done <- struct{}{}
+	}))
+	path := serveUnix(t, s, s.ListenAndServe)
+	conn, err := telnet.DialNetwork("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-handling
+	<-handling
+	s.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected Stop to cancel the connections' contexts")
+		}
+	}
+}
+
+func TestConnection_ReadContext(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	buf := make([]byte, 8)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := conn.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	// A sequence split across the interruption is still parsed.
+	b.Write([]byte{telnet.IAC})
+	if _, err := conn.ReadContext(ctx, buf); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := conn.ReadContext(ctx, buf); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	b.Write([]byte{telnet.IAC, 'a'})
+	n, err := conn.ReadContext(context.Background(), buf)
+	if err != nil || string(buf[:n]) != "\xffa" {
+		t.Errorf("Expected %q, got %q, %v", "\xffa", buf[:n], err)
+	}
+}
+
+func TestConnection_WriteContext(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := conn.WriteContext(ctx, []byte("blocked")); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+
+	// The write deadline is restored, so writes no longer time out.
+	go io.Copy(io.Discard, b)
+	if _, err := conn.WriteContext(context.Background(), []byte("hello")); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestConnection_CloseWithReason(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	if conn.CloseReason() != nil {
+		t.Errorf("Expected no reason before Close, got %v", conn.CloseReason())
+	}
+	select {
+	case <-conn.Closed():
+		t.Error("Expected Closed not to be closed before Close")
+	default:
+	}
+	reason := &telnet.CloseError{Reason: "idle timeout", Message: "Idle too long.\n", Logout: true}
+	if err := conn.CloseWithReason(reason); err != nil {
+		t.Fatal(err)
+	}
+	<-conn.Closed()
+	if err := conn.CloseReason(); err != reason {
+		t.Errorf("Expected %v, got %v", reason, err)
+	}
+	if err := conn.Close(); err != telnet.ErrClosed || conn.CloseReason() != reason {
+		t.Errorf("Expected a later Close to keep the reason, got %v, %v", err, conn.CloseReason())
+	}
+	got, _ := io.ReadAll(b)
+	if want := "Idle too long.\r\n\xff\xfb\x12"; string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestConnection_CloseReason(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.Close()
+	if err := conn.CloseReason(); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+
+	a, b = telnettest.Pipe()
+	conn = telnet.NewConnection(a, nil)
+	b.Close()
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := conn.CloseReason(); err != io.EOF {
+		t.Errorf("Expected %v, got %v", io.EOF, err)
+	}
+}
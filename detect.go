@@ -0,0 +1,156 @@
+package telnet
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// DefaultDetectTimeout is how long DetectProtocol waits for the client to
+// send something when given no timeout.
+const DefaultDetectTimeout = 500 * time.Millisecond
+
+// Protocol is a protocol a client may speak on a port, as identified by
+// DetectProtocol.
+type Protocol int
+
+// Protocols
+const (
+	// ProtocolTelnet is telnet: the client began with a command, or sent
+	// nothing, waiting for the server to speak first as telnet clients may.
+	ProtocolTelnet Protocol = iota
+	// ProtocolTLS is TLS, the client having begun with a ClientHello.
+	ProtocolTLS
+	// ProtocolSSH is SSH, the client having begun with its identification
+	// string.
+	ProtocolSSH
+	// ProtocolText is anything else: text from a raw TCP client such as
+	// netcat, say, or an HTTP request.
+	ProtocolText
+)
+
+// String returns "telnet", "tls", "ssh" or "text".
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolTLS:
+		return "tls"
+	case ProtocolSSH:
+		return "ssh"
+	case ProtocolText:
+		return "text"
+	}
+	return "telnet"
+}
+
+// DetectProtocol identifies the protocol a client speaks on c from the first
+// bytes it sends, waiting up to timeout for them, or DefaultDetectTimeout if
+// timeout is zero. A client that sends nothing in that time is taken to be
+// a telnet client waiting for the server's negotiation. It returns a
+// connection that reads the bytes examined again before reading any more from
+// c, to be used in place of c, or an error if c could not be read.
+func DetectProtocol(c net.Conn, timeout time.Duration) (Protocol, net.Conn, error) {
+	if timeout <= 0 {
+		timeout = DefaultDetectTimeout
+	}
+	if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return ProtocolTelnet, nil, err
+	}
+	r := bufio.NewReader(c)
+	p, err := detectProtocol(r)
+	if derr := c.SetReadDeadline(time.Time{}); err == nil {
+		err = derr
+	}
+	if err != nil {
+		return ProtocolTelnet, nil, err
+	}
+	return p, &detectedConn{Conn: c, r: r}, nil
+}
+
+// detectProtocol identifies the protocol from the first bytes read by r.
+func detectProtocol(r *bufio.Reader) (Protocol, error) {
+	b, err := r.Peek(1)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return ProtocolTelnet, nil
+	} else if err != nil {
+		return ProtocolTelnet, err
+	}
+	switch b[0] {
+	case IAC:
+		return ProtocolTelnet, nil
+	case 0x16: // a TLS handshake record
+		return ProtocolTLS, nil
+	case 'S':
+		// Whatever arrives in time is all there is to go on.
+		if b, _ := r.Peek(4); string(b) == "SSH-" {
+			return ProtocolSSH, nil
+		}
+	}
+	return ProtocolText, nil
+}
+
+// detectedConn is a connection whose first bytes were read by DetectProtocol.
+type detectedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *detectedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite half-closes the underlying connection, if it supports it, so
+// that Connection.CloseWrite works as it would on the connection itself.
+func (c *detectedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return ErrHalfCloseUnsupported
+}
+
+// CloseRead half-closes the underlying connection, if it supports it.
+func (c *detectedConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return ErrHalfCloseUnsupported
+}
+
+// detect identifies the protocol spoken on a connection accepted, routing
+// it to the Server's function for the protocol or serving it as telnet.
+func (s *Server) detect(c net.Conn) {
+	p, dc, err := DetectProtocol(c, s.DetectTimeout)
+	if err != nil {
+		s.log(slog.LevelDebug, "telnet: protocol detection failed",
+			"remote", c.RemoteAddr().String(), "error", err)
+		c.Close()
+		return
+	}
+	if s.baseContext().Err() != nil {
+		dc.Close()
+		return
+	}
+	if f := s.Protocols[p]; f != nil && p != ProtocolTelnet {
+		s.log(slog.LevelInfo, "telnet: connection routed",
+			"remote", c.RemoteAddr().String(), "protocol", p.String())
+		f(dc)
+		return
+	}
+	switch p {
+	case ProtocolTLS:
+		if s.TLSConfig == nil {
+			break
+		}
+		dc = tls.Server(dc, s.TLSConfig)
+		fallthrough
+	case ProtocolTelnet, ProtocolText:
+		s.serve(dc)
+		return
+	}
+	s.log(slog.LevelInfo, "telnet: connection refused",
+		"remote", c.RemoteAddr().String(), "protocol", p.String())
+	dc.Close()
+}
@@ -0,0 +1,97 @@
+package telnet_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+func TestDetectProtocol(t *testing.T) {
+	tests := []struct {
+		send string
+		want telnet.Protocol
+	}{
+		{"", telnet.ProtocolTelnet},
+		{"\xff\xfd\x01", telnet.ProtocolTelnet},
+		{"\x16\x03\x01\x00\xa5", telnet.ProtocolTLS},
+		{"SSH-2.0-OpenSSH_9.6\r\n", telnet.ProtocolSSH},
+		{"SS", telnet.ProtocolText},
+		{"GET / HTTP/1.1\r\n", telnet.ProtocolText},
+	}
+	for _, test := range tests {
+		a, b := net.Pipe()
+		if test.send != "" {
+			go a.Write([]byte(test.send))
+		}
+		p, c, err := telnet.DetectProtocol(b, 20*time.Millisecond)
+		if err != nil || p != test.want {
+			t.Errorf("%q: got %v, %v, want %v", test.send, p, err, test.want)
+		}
+		if test.send != "" {
+			buf := make([]byte, len(test.send))
+			if _, err := io.ReadFull(c, buf); err != nil || string(buf) != test.send {
+				t.Errorf("%q: read %q, %v again", test.send, buf, err)
+			}
+		}
+		a.Close()
+		b.Close()
+	}
+
+	a, b := net.Pipe()
+	a.Close()
+	if _, _, err := telnet.DetectProtocol(b, time.Second); err == nil {
+		t.Error("Expected an error from a closed connection")
+	}
+}
+
+func TestServer_Protocols(t *testing.T) {
+	cert := selfSigned(t)
+	routed := make(chan string, 1)
+	s := telnet.NewServer("", telnet.HandleFunc(echo))
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.DetectTimeout = 20 * time.Millisecond
+	s.Protocols = map[telnet.Protocol]func(c net.Conn){
+		telnet.ProtocolSSH: func(c net.Conn) {
+			defer c.Close()
+			b := make([]byte, 8)
+			io.ReadFull(c, b)
+			routed <- string(b)
+		},
+	}
+	path := serveUnix(t, s, s.ListenAndServe)
+	dial := func() net.Conn {
+		t.Helper()
+		c, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	// A telnet client waiting for the server, and one sending plain text
+	expectEcho(t, telnet.NewConnection(dial(), nil))
+	c := dial()
+	c.Write([]byte("hi"))
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hi" {
+		t.Errorf("Expected %q, got %q, %v", "hi", b, err)
+	}
+
+	// TLS, served as telnet over TLS
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+	expectEcho(t, telnet.NewConnection(tls.Client(dial(), &tls.Config{ServerName: "localhost", RootCAs: roots}), nil))
+
+	// SSH, routed to its function
+	dial().Write([]byte("SSH-2.0-test\r\n"))
+	if got := <-routed; got != "SSH-2.0-" {
+		t.Errorf("Expected the SSH banner to be routed, got %q", got)
+	}
+}
@@ -15,19 +15,31 @@ Running a server:
 The server API is modeled after the net/http API, so it should be easy to get
 your bearings; of course, telnet and HTTP are very different beasts, so the
 similarities are somewhat limited. The server listens on a TCP address for new
-connections. Whenever a new connection is received, the connection handler is
+connections - or on a Unix socket, over TLS, or with any net.Listener passed to
+Serve. Whenever a new connection is received, the connection handler is
 called with the connection object. This object is a wrapper for the underlying
-TCP connection, which aims to transparently handle IAC.
+net.Conn, which aims to transparently handle IAC.
 
 Running a client is pretty simple:
 
 	conn, err := telnet.Dial("127.0.0.1:9999")
 
 This is really straightforward - dial out, get a telnet connection handler back.
+DialTLS and DialNetwork connect over TLS or other networks such as Unix
+sockets, and NewConnection wraps a net.Conn from anywhere else.
 Again, this handles IAC transparently, and like the Server, can take a list of
 optional IAC handlers. Bear in mind that some handlers - for example, the
 included NAWS handler - use different Option functions to register them with a
 client versus a server; this is because they may behave differently at each end.
 See the documentation for the options for more details.
+
+Data written to and read from a connection uses Go newlines: a "\n" written is
+sent as the NVT CR LF sequence, and CR LF or CR NUL received is read as "\n".
+Set the connection's RawNewlines field to pass CR and LF through untouched;
+translation is also suspended while the BINARY option is in effect.
+
+To see what a connection is doing, set the Logger field of a Server or
+Connection to a *slog.Logger: negotiation is logged at debug level, malformed
+protocol at warn level, and connections opening and closing at info level.
 */
 package telnet
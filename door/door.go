@@ -0,0 +1,273 @@
+// Package door runs BBS door games for telnet Connections, writing the
+// dropfiles that describe the caller to the door and handing it the
+// connection's socket.
+//
+// Doors written for DOOR32.SYS, as most modern ones are, take over the socket
+// and speak telnet to the caller themselves:
+//
+//	info := door.InfoFrom(conn)
+//	info.UserName, info.Security = user.Name, user.Level
+//	err := door.Run(conn, exec.Command("/bbs/doors/lord/start.sh"), "/bbs/nodes/1", info)
+//
+// Older doors that expect a serial port or standard input and output can be
+// run on a pseudo-terminal with shell.Attach, after writing their dropfiles
+// with WriteDropfiles.
+package door
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+)
+
+// DefaultBaudRate is the baud rate reported to doors by InfoFrom.
+const DefaultBaudRate = 38400
+
+// ErrNoSocket is returned by Run when the Connection's underlying connection
+// has no socket to hand to the door.
+var ErrNoSocket = errors.New("door: connection has no socket")
+
+// Info describes the caller and the session to a door.
+type Info struct {
+	// Node is the number of the BBS node the caller is on, from 1.
+	Node int
+	// BaudRate is the connection speed reported to the door.
+	BaudRate int
+	// Local reports that the caller is at the BBS console rather than
+	// connected remotely.
+	Local bool
+	// Handle, if not zero, is the descriptor of the socket passed to the
+	// door, reported in DOOR32.SYS. If zero, DOOR32.SYS describes a local
+	// session, whose door uses standard input and output.
+	Handle int
+
+	// UserName is the caller's real name, and Alias their handle.
+	UserName, Alias string
+	// Location is where the caller is calling from.
+	Location string
+	// Record is the caller's record number in the user file, from 1.
+	Record int
+	// Security is the caller's security level.
+	Security int
+	// TimeLeft is the time the caller has left on this call.
+	TimeLeft time.Duration
+	// ANSI reports whether the caller's terminal supports ANSI graphics.
+	ANSI bool
+	// ScreenRows is the number of lines on the caller's screen.
+	ScreenRows int
+
+	// BBSName is the name of the BBS, SysopName that of its operator, and
+	// BBSID the name of the BBS software.
+	BBSName, SysopName, BBSID string
+}
+
+// InfoFrom returns Info for a session on conn, with the screen size from NAWS
+// if it is handled by an options.NAWSHandler and has been reported, and
+// defaults for node 1 otherwise. The caller should fill in the details of the
+// user.
+func InfoFrom(conn *telnet.Connection) Info {
+	info := Info{
+		Node:       1,
+		BaudRate:   DefaultBaudRate,
+		Record:     1,
+		TimeLeft:   time.Hour,
+		ANSI:       true,
+		ScreenRows: 24,
+		BBSID:      "bradrupp/telnet",
+	}
+	if h, ok := conn.OptionHandlers[telnet.TeloptNAWS].(*options.NAWSHandler); ok && h.Height > 0 {
+		info.ScreenRows = int(h.Height)
+	}
+	return info
+}
+
+// Run writes the dropfiles for a session into dir, then runs cmd in dir with
+// the socket underlying conn as an extra file, recording its descriptor as the
+// Handle in DOOR32.SYS, and returns the error from cmd.Run.
+//
+// The door takes over the telnet session from conn until it exits, so conn
+// must not be read or written meanwhile, and any data conn has received but
+// not yet returned from Read is not seen by the door.
+func Run(conn *telnet.Connection, cmd *exec.Cmd, dir string, info Info) error {
+	fc, ok := conn.Conn.(interface{ File() (*os.File, error) })
+	if !ok {
+		return ErrNoSocket
+	}
+	f, err := fc.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	info.Handle = 2 + len(cmd.ExtraFiles)
+	if err := WriteDropfiles(dir, info); err != nil {
+		return err
+	}
+	if cmd.Dir == "" {
+		cmd.Dir = dir
+	}
+	return cmd.Run()
+}
+
+// WriteDropfiles writes DOOR.SYS, DORINFO1.DEF and DOOR32.SYS into dir.
+func WriteDropfiles(dir string, info Info) error {
+	for _, f := range []struct {
+		name  string
+		write func(io.Writer, Info) error
+	}{
+		{"DOOR.SYS", WriteDoorSys},
+		{"DORINFO1.DEF", WriteDorinfo},
+		{"DOOR32.SYS", WriteDoor32Sys},
+	} {
+		file, err := os.Create(filepath.Join(dir, f.name))
+		if err != nil {
+			return err
+		}
+		err = f.write(file, info)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDoorSys writes info in the 52-line DOOR.SYS format.
+func WriteDoorSys(w io.Writer, info Info) error {
+	now := time.Now()
+	graphics := "NG"
+	if info.ANSI {
+		graphics = "GR"
+	}
+	return writeLines(w,
+		comPort(info)+":",
+		info.BaudRate,
+		8, // data bits
+		info.Node,
+		info.BaudRate, // DTE rate
+		"Y",           // screen display
+		"N",           // printer
+		"Y",           // page bell
+		"Y",           // caller alarm
+		info.UserName,
+		info.Location,
+		"", // home phone
+		"", // work phone
+		"", // password
+		info.Security,
+		1, // times on
+		now.Format("01/02/06"),
+		int(info.TimeLeft.Seconds()),
+		int(info.TimeLeft.Minutes()),
+		graphics,
+		info.ScreenRows,
+		"N", // expert mode
+		"",  // conferences registered in
+		0,   // conference exited to door from
+		"12/31/99",
+		info.Record,
+		"Z",        // default protocol
+		0, 0, 0, 0, // uploads, downloads, daily K downloaded and limit
+		"01/01/70", // birthdate
+		"", "",     // main and general directories
+		info.SysopName,
+		info.Alias,
+		"00:00", // event time
+		"Y",     // error-correcting connection
+		"N",     // ANSI supported but NG mode used
+		"Y",     // record locking
+		7,       // default colour
+		0,       // time credits
+		now.Format("01/02/06"),
+		now.Format("15:04"),
+		now.Format("15:04"),
+		9999, 0, 0, 0, // file limits and counts
+		"", // comment
+		0,  // doors opened
+		0,  // messages left
+	)
+}
+
+// WriteDorinfo writes info in the DORINFO1.DEF format.
+func WriteDorinfo(w io.Writer, info Info) error {
+	sysopFirst, sysopLast := splitName(info.SysopName)
+	userFirst, userLast := splitName(info.UserName)
+	graphics := 0
+	if info.ANSI {
+		graphics = 1
+	}
+	return writeLines(w,
+		info.BBSName,
+		sysopFirst,
+		sysopLast,
+		comPort(info),
+		fmt.Sprintf("%d BAUD,N,8,1", info.BaudRate),
+		0, // networked
+		strings.ToUpper(userFirst),
+		strings.ToUpper(userLast),
+		info.Location,
+		graphics,
+		info.Security,
+		int(info.TimeLeft.Minutes()),
+		-1, // FOSSIL
+	)
+}
+
+// WriteDoor32Sys writes info in the DOOR32.SYS format.
+func WriteDoor32Sys(w io.Writer, info Info) error {
+	commType := 0 // local
+	if info.Handle != 0 {
+		commType = 2 // telnet
+	}
+	emulation := 0
+	if info.ANSI {
+		emulation = 1
+	}
+	return writeLines(w,
+		commType,
+		info.Handle,
+		info.BaudRate,
+		info.BBSID,
+		info.Record,
+		info.UserName,
+		info.Alias,
+		info.Security,
+		int(info.TimeLeft.Minutes()),
+		emulation,
+		info.Node,
+	)
+}
+
+// comPort returns the serial port a door should use: COM0 for a local caller.
+func comPort(info Info) string {
+	if info.Local {
+		return "COM0"
+	}
+	return "COM1"
+}
+
+// splitName splits a name into its first word and the rest.
+func splitName(name string) (first, last string) {
+	first, last, _ = strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
+
+// writeLines writes each value on a line ending in CR LF, as DOS doors expect.
+func writeLines(w io.Writer, lines ...interface{}) error {
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		fmt.Fprintf(bw, "%v\r\n", l)
+	}
+	return bw.Flush()
+}
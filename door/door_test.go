@@ -0,0 +1,151 @@
+package door_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/door"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func testInfo() door.Info {
+	return door.Info{
+		Node:       2,
+		BaudRate:   38400,
+		Handle:     3,
+		UserName:   "Jane Q Caller",
+		Alias:      "jq",
+		Location:   "Springfield",
+		Record:     7,
+		Security:   50,
+		TimeLeft:   90 * time.Minute,
+		ANSI:       true,
+		ScreenRows: 40,
+		BBSName:    "Test BBS",
+		SysopName:  "Sam Sysop",
+		BBSID:      "test",
+	}
+}
+
+func lines(t *testing.T, write func(io.Writer, door.Info) error) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := write(&buf, testInfo()); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	if !strings.HasSuffix(s, "\r\n") {
+		t.Fatalf("Expected CR LF line endings, got %q", s)
+	}
+	return strings.Split(strings.TrimSuffix(s, "\r\n"), "\r\n")
+}
+
+func TestWriteDoorSys(t *testing.T) {
+	l := lines(t, door.WriteDoorSys)
+	if len(l) != 52 {
+		t.Fatalf("Expected 52 lines, got %d", len(l))
+	}
+	for i, want := range map[int]string{
+		0: "COM1:", 1: "38400", 3: "2", 9: "Jane Q Caller", 10: "Springfield", 14: "50",
+		17: "5400", 18: "90", 19: "GR", 20: "40", 25: "7", 34: "Sam Sysop", 35: "jq",
+	} {
+		if l[i] != want {
+			t.Errorf("Line %d: expected %q, got %q", i+1, want, l[i])
+		}
+	}
+}
+
+func TestWriteDorinfo(t *testing.T) {
+	expected := []string{"Test BBS", "Sam", "Sysop", "COM1", "38400 BAUD,N,8,1", "0",
+		"JANE", "Q CALLER", "Springfield", "1", "50", "90", "-1"}
+	if l := lines(t, door.WriteDorinfo); strings.Join(l, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, l)
+	}
+}
+
+func TestWriteDoor32Sys(t *testing.T) {
+	expected := []string{"2", "3", "38400", "test", "7", "Jane Q Caller", "jq", "50", "90", "1", "2"}
+	if l := lines(t, door.WriteDoor32Sys); strings.Join(l, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, l)
+	}
+}
+
+func TestInfoFrom(t *testing.T) {
+	peer, conn := telnettest.NewPeer(options.NAWSOption)
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Send(telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 50, telnet.IAC, telnet.SE),
+		// Negotiation is handled in order, so once this is refused the
+		// size has been recorded.
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	if rows := door.InfoFrom(conn).ScreenRows; rows != 50 {
+		t.Errorf("Expected 50 screen rows, got %d", rows)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("extra files are not supported on Windows")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dir := t.TempDir()
+	done := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		conn := telnet.NewConnection(c, nil)
+		defer conn.Close()
+		// The door reads its socket's descriptor from DOOR32.SYS.
+		cmd := exec.Command("sh", "-c", `fd=$(sed -n 2p DOOR32.SYS | tr -d '\r'); eval "echo door >&$fd"`)
+		done <- door.Run(conn, cmd, dir, door.InfoFrom(conn))
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "door\n" {
+		t.Errorf("Expected the door's output, got %q", buf)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "DOOR.SYS")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRun_NoSocket(t *testing.T) {
+	_, conn := telnettest.NewPeer()
+	defer conn.Close()
+	if err := door.Run(conn, exec.Command("true"), t.TempDir(), door.Info{}); err != door.ErrNoSocket {
+		t.Errorf("Expected ErrNoSocket, got %v", err)
+	}
+}
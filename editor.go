@@ -0,0 +1,475 @@
+package telnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultHistorySize is the number of lines a LineEditor remembers when it
+// has no History and its HistorySize is zero.
+const DefaultHistorySize = 100
+
+// DefaultMaxLineLength is the longest line a LineEditor reads when its
+// MaxLineLength is zero.
+const DefaultMaxLineLength = 1024
+
+// maxEscapeParams is the most parameter characters of a control sequence a
+// LineEditor keeps; no key it understands needs more.
+const maxEscapeParams = 8
+
+// ErrLineTooLong is returned by LineEditor.ReadLine when a line the client
+// edits itself is longer than the editor's MaxLineLength.
+var ErrLineTooLong = errors.New("telnet: line too long")
+
+// History stores the lines a LineEditor recalls, such as in memory or on disk
+// for each user. A History shared between Connections must be safe for
+// concurrent use.
+type History interface {
+	// Add adds a line that was entered.
+	Add(line string)
+	// Len returns the number of lines held.
+	Len() int
+	// At returns the line at index i, the oldest being at 0.
+	At(i int) string
+}
+
+// MemoryHistory is a History holding a number of lines in memory. It is safe
+// for concurrent use.
+type MemoryHistory struct {
+	size  int
+	mu    sync.Mutex
+	lines []string
+}
+
+// NewMemoryHistory returns a MemoryHistory holding up to size lines.
+func NewMemoryHistory(size int) *MemoryHistory {
+	return &MemoryHistory{size: size}
+}
+
+// Add implements History, dropping the oldest line once it is full.
+func (h *MemoryHistory) Add(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lines = append(h.lines, line)
+	if len(h.lines) > h.size {
+		h.lines = h.lines[len(h.lines)-h.size:]
+	}
+}
+
+// Len implements History.
+func (h *MemoryHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.lines)
+}
+
+// At implements History.
+func (h *MemoryHistory) At(i int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lines[i]
+}
+
+// LineEditor reads lines of input from a client in character-at-a-time mode,
+// which a server selects by enabling ECHO and SUPPRESS-GO-AHEAD on its side,
+// editing them as a shell does. It understands the arrow, Home, End and
+// Delete keys and these emacs keys:
+//
+//	Ctrl-A, Ctrl-E  move to the start or end of the line
+//	Ctrl-B, Ctrl-F  move back or forward a character
+//	Ctrl-D          delete the character under the cursor, or end input on an
+//	                empty line
+//	Ctrl-H          delete the character before the cursor, as Backspace does
+//	Ctrl-K, Ctrl-U  delete to the end or start of the line
+//	Ctrl-W          delete the word before the cursor
+//	Ctrl-P, Ctrl-N  recall the previous or next line of history
+//	Ctrl-L          redraw the line
+//	Ctrl-C          abandon the line and start an empty one
+//	Tab             complete the line before the cursor, with Complete
+//
+// If the client is editing lines itself, because ECHO is not enabled on our
+// side, lines are read as they arrive. The line being edited is redrawn with
+// ANSI control sequences, assuming it fits on one row of the window.
+type LineEditor struct {
+	// History holds the lines entered, for recall. If nil, the lines are
+	// held in memory, up to HistorySize of them.
+	History History
+	// HistorySize is the number of lines remembered when there is no
+	// History. If zero, DefaultHistorySize is used; if negative, none are.
+	HistorySize int
+
+	// Complete, if set, is called when Tab is pressed with the line up to
+	// the cursor, and returns the possible completions of it, each of which
+	// would replace it. A single completion is taken; of several, as much as
+	// they have in common is, and pressing Tab again lists them.
+	Complete func(prefix string) []string
+
+	// MaxLineLength is the longest line that may be entered, in
+	// characters, or in bytes for a line the client edits itself: further
+	// characters typed are refused with a bell, and a longer line edited by
+	// the client is ErrLineTooLong. If zero, DefaultMaxLineLength is used.
+	MaxLineLength int
+
+	conn *Connection
+}
+
+// NewLineEditor returns a LineEditor reading from c.
+func NewLineEditor(c *Connection) *LineEditor {
+	return &LineEditor{conn: c}
+}
+
+// lineEditorKey is the key of the LineEditor stored with SetValue by
+// ReadEditedLine.
+type lineEditorKey struct{}
+
+// ReadEditedLine writes prompt and reads a line of input with the
+// Connection's LineEditor, which is created on first use, so that its history
+// is kept between lines. Like Read, it must not be called concurrently with
+// other reads.
+func (c *Connection) ReadEditedLine(prompt string) (string, error) {
+	e, _ := c.Value(lineEditorKey{}).(*LineEditor)
+	if e == nil {
+		e = NewLineEditor(c)
+		c.SetValue(lineEditorKey{}, e)
+	}
+	return e.ReadLine(prompt)
+}
+
+// lineState is a line being edited.
+type lineState struct {
+	prompt  string
+	line    []rune
+	pos     int    // cursor position in line
+	recall  int    // index in history being shown; its length for none
+	pending string // the line being entered while history is shown
+	tabbed  bool   // the last key was Tab
+}
+
+// ReadLine writes prompt and reads a line of input, returning it without its
+// newline. It returns io.EOF if the client ends input with Ctrl-D on an empty
+// line, ErrLineTooLong if a line the client edits itself is too long, and any
+// error from reading the Connection.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if err := e.conn.WritePrompt(prompt); err != nil {
+		return "", err
+	}
+	if !e.conn.LocalEnabled(TeloptECHO) {
+		line, err := e.readRawLine()
+		if err == nil {
+			e.remember(line)
+		}
+		return line, err
+	}
+
+	s := &lineState{prompt: prompt, recall: e.history().Len()}
+	for {
+		r, err := e.readRune()
+		if err != nil {
+			return "", err
+		}
+		if r == '\033' {
+			if r, err = e.readEscape(); err != nil {
+				return "", err
+			}
+		}
+		tabbed := s.tabbed
+		s.tabbed = false
+		if r == '\t' && e.Complete != nil {
+			err = e.complete(s, tabbed)
+			s.tabbed = true
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		done, err := e.edit(s, r)
+		if err != nil {
+			return "", err
+		}
+		if done {
+			line := string(s.line)
+			e.remember(line)
+			return line, nil
+		}
+	}
+}
+
+// Keys with no control character of their own, as returned by readEscape.
+const (
+	keyUp = -1 - iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// edit applies a key to the line, reporting whether it ends it.
+func (e *LineEditor) edit(s *lineState, r rune) (bool, error) {
+	switch r {
+	case '\r', '\n':
+		return true, e.write("\r\n")
+	case 'A' & 0x1f, keyHome:
+		s.pos = 0
+	case 'E' & 0x1f, keyEnd:
+		s.pos = len(s.line)
+	case 'B' & 0x1f, keyLeft:
+		if s.pos > 0 {
+			s.pos--
+		}
+	case 'F' & 0x1f, keyRight:
+		if s.pos < len(s.line) {
+			s.pos++
+		}
+	case 'D' & 0x1f:
+		if len(s.line) == 0 {
+			return false, io.EOF
+		}
+		fallthrough
+	case keyDelete:
+		if s.pos < len(s.line) {
+			s.line = append(s.line[:s.pos], s.line[s.pos+1:]...)
+		}
+	case 'H' & 0x1f, 0x7f:
+		if s.pos > 0 {
+			s.line = append(s.line[:s.pos-1], s.line[s.pos:]...)
+			s.pos--
+		}
+	case 'K' & 0x1f:
+		s.line = s.line[:s.pos]
+	case 'U' & 0x1f:
+		s.line = append(s.line[:0], s.line[s.pos:]...)
+		s.pos = 0
+	case 'W' & 0x1f:
+		start := s.pos
+		for start > 0 && unicode.IsSpace(s.line[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(s.line[start-1]) {
+			start--
+		}
+		s.line = append(s.line[:start], s.line[s.pos:]...)
+		s.pos = start
+	case 'P' & 0x1f, keyUp:
+		e.recall(s, s.recall-1)
+	case 'N' & 0x1f, keyDown:
+		e.recall(s, s.recall+1)
+	case 'C' & 0x1f:
+		s.line, s.pos, s.recall = nil, 0, e.history().Len()
+		if err := e.write("^C\r\n" + s.prompt); err != nil {
+			return false, err
+		}
+		return false, nil
+	case 'L' & 0x1f:
+	default:
+		if r < 0x20 {
+			return false, nil
+		}
+		if len(s.line) >= e.maxLineLength() {
+			return false, e.write("\a")
+		}
+		s.line = append(s.line, 0)
+		copy(s.line[s.pos+1:], s.line[s.pos:])
+		s.line[s.pos] = r
+		s.pos++
+		if s.pos == len(s.line) {
+			// Typing at the end of the line needs only an echo.
+			return false, e.write(string(r))
+		}
+	}
+	return false, e.redraw(s)
+}
+
+// recall shows the line of history at index i, if there is one; the index
+// past the end of the history holds the line that was being entered.
+func (e *LineEditor) recall(s *lineState, i int) {
+	h := e.history()
+	if i < 0 || i > h.Len() || i == s.recall {
+		return
+	}
+	if s.recall >= h.Len() {
+		s.pending = string(s.line)
+	}
+	s.recall = i
+	line := s.pending
+	if i < h.Len() {
+		line = h.At(i)
+	}
+	s.line = []rune(line)
+	s.pos = len(s.line)
+}
+
+// complete completes the line up to the cursor, listing the completions if
+// there are several and list is set.
+func (e *LineEditor) complete(s *lineState, list bool) error {
+	prefix := string(s.line[:s.pos])
+	candidates := e.Complete(prefix)
+	if len(candidates) == 0 {
+		return nil
+	}
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	if len(candidates) > 1 && !strings.HasPrefix(common, prefix) {
+		common = prefix
+	}
+	if len(candidates) > 1 && list && common == prefix {
+		if err := e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n"); err != nil {
+			return err
+		}
+	}
+	if common != prefix || len(candidates) > 1 && list {
+		rest := s.line[s.pos:]
+		s.line = append([]rune(common), rest...)
+		s.pos = len(s.line) - len(rest)
+		return e.redraw(s)
+	}
+	return nil
+}
+
+// redraw rewrites the prompt and line, erasing what followed them, and moves
+// the cursor to its position.
+func (e *LineEditor) redraw(s *lineState) error {
+	out := "\r" + s.prompt + string(s.line) + "\033[K"
+	if back := len(s.line) - s.pos; back > 0 {
+		out += fmt.Sprintf("\033[%dD", back)
+	}
+	return e.write(out)
+}
+
+// maxLineLength returns the longest line that may be entered.
+func (e *LineEditor) maxLineLength() int {
+	if e.MaxLineLength <= 0 {
+		return DefaultMaxLineLength
+	}
+	return e.MaxLineLength
+}
+
+// history returns the editor's History, creating one in memory if it has
+// none.
+func (e *LineEditor) history() History {
+	if e.History == nil {
+		size := e.HistorySize
+		if size == 0 {
+			size = DefaultHistorySize
+		}
+		if size < 0 {
+			size = 0
+		}
+		e.History = NewMemoryHistory(size)
+	}
+	return e.History
+}
+
+// remember adds a line to the history, unless it is blank or repeats the last.
+func (e *LineEditor) remember(line string) {
+	h := e.history()
+	if strings.TrimSpace(line) == "" || h.Len() > 0 && h.At(h.Len()-1) == line {
+		return
+	}
+	h.Add(line)
+}
+
+// write writes s to the Connection.
+func (e *LineEditor) write(s string) error {
+	_, err := e.conn.Write([]byte(s))
+	return err
+}
+
+// readRawLine reads a line edited by the client.
+func (e *LineEditor) readRawLine() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := e.conn.Read(b); err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		if len(line) >= e.maxLineLength() {
+			return "", ErrLineTooLong
+		}
+		line = append(line, b[0])
+	}
+}
+
+// readRune reads a UTF-8 encoded character, or a single byte that does not
+// start one.
+func (e *LineEditor) readRune() (rune, error) {
+	var buf [utf8.UTFMax]byte
+	n := 0
+	for {
+		if _, err := e.conn.Read(buf[n : n+1]); err != nil {
+			return 0, err
+		}
+		n++
+		if utf8.FullRune(buf[:n]) || n == len(buf) {
+			r, size := utf8.DecodeRune(buf[:n])
+			if size < n || r == utf8.RuneError {
+				return rune(buf[0]), nil
+			}
+			return r, nil
+		}
+	}
+}
+
+// readEscape reads the rest of a control sequence following ESC, returning
+// the key it stands for.
+func (e *LineEditor) readEscape() (rune, error) {
+	r, err := e.readRune()
+	if err != nil || r != '[' && r != 'O' {
+		return keyUnknown, err
+	}
+	var params []rune
+	for {
+		if r, err = e.readRune(); err != nil {
+			return keyUnknown, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		if len(params) <= maxEscapeParams {
+			// Beyond that, too long for any key to match either way.
+			params = append(params, r)
+		}
+	}
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return keyUnknown, nil
+}
@@ -0,0 +1,156 @@
+package telnet_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestLineEditor(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetLocalEnabled(telnet.TeloptSGA, true)
+	go io.Copy(io.Discard, b)
+
+	for _, tc := range []struct {
+		input, expected string
+	}{
+		{"hello\r\n", "hello"},
+		// Left arrow, insert, Home, Delete key, End, Backspace.
+		{"wrld\033[D\033[D\033[Do\x01\033[3~W\x05x\x7f!\r\n", "World!"},
+		// Ctrl-W, Ctrl-U and Ctrl-K.
+		{"one two\x17three\x02\x02\x0b\r\n", "one thr"},
+		{"junk\x15ok\r\n", "ok"},
+		// History: up twice recalls the line before last; down returns.
+		{"\033[A\033[A\r\n", "one thr"},
+		{"new\x10\x0e\r\n", "new"},
+		{"ab\x03cd\r\n", "cd"},
+		{"h\xc3\xa9llo\x02\x02\x02\x02\x7f\r\n", "éllo"},
+	} {
+		b.Write([]byte(tc.input))
+		line, err := conn.ReadEditedLine("> ")
+		if err != nil || line != tc.expected {
+			t.Errorf("%q: expected %q, got %q, %v", tc.input, tc.expected, line, err)
+		}
+	}
+	b.Write([]byte{'D' & 0x1f})
+	if _, err := conn.ReadEditedLine("> "); err != io.EOF {
+		t.Errorf("Expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestLineEditor_Echo(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetLocalEnabled(telnet.TeloptSGA, true)
+	b.Write([]byte("ac\033[Db\r\n"))
+	e := telnet.NewLineEditor(conn)
+	if line, err := e.ReadLine("> "); err != nil || line != "abc" {
+		t.Errorf("Expected %q, got %q, %v", "abc", line, err)
+	}
+	conn.Close()
+	got, _ := io.ReadAll(b)
+	if want := "> ac\r\x00> ac\033[K\033[1D\r\x00> abc\033[K\033[1D\r\n"; string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestLineEditor_ClientEditing(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	b.Write([]byte("look\r\n"))
+	if line, err := conn.ReadEditedLine("> "); err != nil || line != "look" {
+		t.Errorf("Expected %q, got %q, %v", "look", line, err)
+	}
+}
+
+func TestLineEditor_MaxLineLength(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetLocalEnabled(telnet.TeloptSGA, true)
+	go io.Copy(io.Discard, b)
+
+	e := telnet.NewLineEditor(conn)
+	e.MaxLineLength = 5
+	b.Write([]byte("abcdefg\r\n"))
+	if line, err := e.ReadLine("> "); err != nil || line != "abcde" {
+		t.Errorf("Expected %q, got %q, %v", "abcde", line, err)
+	}
+	// A control sequence too long for any key is not taken for one.
+	b.Write([]byte("ab\033[" + strings.Repeat("0", 100) + "3~\r\n"))
+	if line, err := e.ReadLine("> "); err != nil || line != "ab" {
+		t.Errorf("Expected %q, got %q, %v", "ab", line, err)
+	}
+
+	conn.SetLocalEnabled(telnet.TeloptECHO, false)
+	b.Write([]byte("abcdefg\r\n"))
+	if _, err := e.ReadLine("> "); err != telnet.ErrLineTooLong {
+		t.Errorf("Expected %v, got %v", telnet.ErrLineTooLong, err)
+	}
+}
+
+func TestLineEditor_History(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	go io.Copy(io.Discard, b)
+
+	h := telnet.NewMemoryHistory(2)
+	h.Add("saved")
+	e := telnet.NewLineEditor(conn)
+	e.History = h
+	for _, tc := range []struct {
+		input, expected string
+	}{
+		{"\033[A\r\n", "saved"},
+		{"one\r\n", "one"},
+		{"two\r\n", "two"},
+		{"\033[A\033[A\033[A\r\n", "one"},
+	} {
+		b.Write([]byte(tc.input))
+		line, err := e.ReadLine("> ")
+		if err != nil || line != tc.expected {
+			t.Errorf("%q: expected %q, got %q, %v", tc.input, tc.expected, line, err)
+		}
+	}
+	if h.Len() != 2 || h.At(0) != "two" || h.At(1) != "one" {
+		t.Errorf("Expected [two one], got %d lines", h.Len())
+	}
+}
+
+func TestLineEditor_Complete(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+
+	commands := []string{"show interfaces", "show ip route", "shutdown"}
+	e := telnet.NewLineEditor(conn)
+	e.Complete = func(prefix string) []string {
+		var matches []string
+		for _, c := range commands {
+			if strings.HasPrefix(c, prefix) {
+				matches = append(matches, c)
+			}
+		}
+		return matches
+	}
+	b.Write([]byte("sh\t\to\tn\t\r\n"))
+	if line, err := e.ReadLine("> "); err != nil || line != "show interfaces" {
+		t.Errorf("Expected %q, got %q, %v", "show interfaces", line, err)
+	}
+	conn.Close()
+	got, _ := io.ReadAll(b)
+	if list := "\r\nshow interfaces  show ip route  shutdown\r\n"; !strings.Contains(string(got), list) {
+		t.Errorf("Expected %q listed, got %q", list, got)
+	}
+}
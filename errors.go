@@ -0,0 +1,172 @@
+package telnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrClosed is returned by operations on a Connection once Close has been
+// called, including those that were in progress when it was. Like the errors
+// of a closed net.Conn, it satisfies errors.Is(err, net.ErrClosed).
+var ErrClosed error = closedError{}
+
+// closedError is the type of ErrClosed.
+type closedError struct{}
+
+func (closedError) Error() string { return "telnet: use of closed connection" }
+
+// Unwrap returns net.ErrClosed.
+func (closedError) Unwrap() error { return net.ErrClosed }
+
+// OpError is an error from the underlying connection, as returned by a
+// Connection's methods, saying what the Connection was doing and with whom.
+// The underlying error can be examined with errors.Is and errors.As, and a
+// timeout still satisfies net.Error. io.EOF is returned as it is.
+type OpError struct {
+	// Op is what the Connection was doing: "read", "write", "negotiate" or
+	// "close".
+	Op string
+	// Addr is the address of the peer.
+	Addr net.Addr
+	// Err is the error from the underlying connection.
+	Err error
+}
+
+func (e *OpError) Error() string {
+	s := "telnet: " + e.Op
+	if e.Addr != nil {
+		s += " " + e.Addr.String()
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the underlying error is a timeout.
+func (e *OpError) Timeout() bool {
+	var ne net.Error
+	return errors.As(e.Err, &ne) && ne.Timeout()
+}
+
+// Temporary reports whether the underlying error is temporary.
+func (e *OpError) Temporary() bool {
+	t, ok := e.Err.(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+// CloseError is a reason for closing a Connection given to CloseWithReason,
+// saying what to tell the peer before closing.
+type CloseError struct {
+	// Reason says why the Connection was closed, such as "idle timeout".
+	Reason string
+	// Message, if set, is written to the peer before closing, as by Write.
+	Message string
+	// Logout sends IAC WILL LOGOUT before closing, telling the peer that it
+	// is being logged out (RFC 727).
+	Logout bool
+}
+
+func (e *CloseError) Error() string {
+	return "telnet: connection closed: " + e.Reason
+}
+
+// ErrHalfCloseUnsupported is returned by CloseWrite and CloseRead when the
+// underlying connection does not support half-close.
+var ErrHalfCloseUnsupported = errors.New("telnet: connection does not support half-close")
+
+// SubnegotiationTooLargeError is returned by Read when a subnegotiation body
+// exceeds the Connection's MaxSubnegotiationSize. The offending body is
+// discarded and the connection remains usable.
+type SubnegotiationTooLargeError struct {
+	// Option is the option code of the subnegotiation.
+	Option byte
+	// Limit is the size limit that was exceeded.
+	Limit int
+}
+
+func (e *SubnegotiationTooLargeError) Error() string {
+	return fmt.Sprintf("telnet: subnegotiation for option %d exceeds %d bytes", e.Option, e.Limit)
+}
+
+// NegotiationTimeoutError is returned when a negotiation write does not
+// complete within the Connection's NegotiationWriteTimeout, typically because
+// the peer has stopped reading. If it occurs while replying to the peer, it is
+// returned by Read. Part of the sequence may have been written, so the
+// connection should be closed.
+type NegotiationTimeoutError struct {
+	// Command is the command being written; SB for a subnegotiation.
+	Command byte
+	// Option is the option code being negotiated.
+	Option byte
+	// Err is the underlying timeout error.
+	Err error
+}
+
+func (e *NegotiationTimeoutError) Error() string {
+	return fmt.Sprintf("telnet: timed out writing negotiation for option %d: %v", e.Option, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *NegotiationTimeoutError) Unwrap() error { return e.Err }
+
+// Timeout reports true, so the error satisfies net.Error.
+func (e *NegotiationTimeoutError) Timeout() bool { return true }
+
+// Temporary reports false; the connection should not be used further.
+func (e *NegotiationTimeoutError) Temporary() bool { return false }
+
+// NegotiationFloodError is returned by Read when the peer sends more commands
+// than a Connection's MaxNegotiations or NegotiationRate allow. The commands
+// that follow are ignored.
+type NegotiationFloodError struct {
+	// Limit is the limit exceeded: "count" or "rate".
+	Limit string
+	// Count is the number of commands received, including the one that
+	// exceeded the limit.
+	Count int
+}
+
+func (e *NegotiationFloodError) Error() string {
+	return fmt.Sprintf("telnet: negotiation flood: %s limit exceeded after %d commands", e.Limit, e.Count)
+}
+
+// MemoryBudgetError is the CloseReason of a Connection closed for exceeding
+// its MemoryBudget.
+type MemoryBudgetError struct {
+	// Budget is the Connection's MemoryBudget.
+	Budget int
+	// Usage is the memory the Connection would have held.
+	Usage int
+}
+
+func (e *MemoryBudgetError) Error() string {
+	return fmt.Sprintf("telnet: memory budget of %d bytes exceeded: %d bytes", e.Budget, e.Usage)
+}
+
+// SequenceTimeoutError is the CloseReason of a Connection closed because the
+// peer did not complete a command or subnegotiation within its
+// SequenceTimeout.
+type SequenceTimeoutError struct {
+	// Sequence holds the start of the incomplete sequence, such as IAC SB
+	// and the option.
+	Sequence []byte
+}
+
+func (e *SequenceTimeoutError) Error() string {
+	return fmt.Sprintf("telnet: incomplete sequence [% x] timed out", e.Sequence)
+}
+
+// ProtocolError describes malformed telnet protocol received from the peer, as
+// reported to a Connection's OnProtocolError hook.
+type ProtocolError struct {
+	// Reason describes what was wrong.
+	Reason string
+	// Sequence holds the offending bytes.
+	Sequence []byte
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("telnet: %s: % x", e.Reason, e.Sequence)
+}
@@ -0,0 +1,178 @@
+package telnet
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Event is something that happened on a Connection, delivered to its
+// Subscriptions: an OptionEvent, WindowSizeEvent, TerminalTypeEvent,
+// SubnegotiationEvent, CommandEvent or DisconnectEvent.
+type Event interface {
+	event()
+}
+
+// OptionEvent is an option being enabled or disabled, on our side if Local is
+// set, or otherwise the peer's.
+type OptionEvent struct {
+	Option  byte
+	Local   bool
+	Enabled bool
+}
+
+// WindowSizeEvent is the size of the client's window being recorded with
+// SetWindowSize, as by the NAWS handler when the client reports it.
+type WindowSizeEvent struct {
+	Width, Height int
+}
+
+// TerminalTypeEvent is what is known of the client's terminal being recorded
+// with SetTerminalCapabilities, as by the TTYPE handler when the client
+// reports its terminal types, or reports them again for RefreshTerminalType.
+type TerminalTypeEvent struct {
+	TerminalCapabilities
+}
+
+// SubnegotiationEvent is a subnegotiation received, decoded by the Codec of its
+// option as for OnSubnegotiation. A GMCP message, for example, has as its
+// Value the mud package's GMCPMessage.
+type SubnegotiationEvent struct {
+	Subnegotiation
+}
+
+// CommandEvent is a command that takes no option, such as IP, BRK or AYT,
+// received as for OnCommand.
+type CommandEvent struct {
+	Command byte
+}
+
+// DisconnectEvent is the Connection being closed, for the reason returned by
+// CloseReason. It is the last event delivered.
+type DisconnectEvent struct {
+	Reason error
+}
+
+func (OptionEvent) event()         {}
+func (WindowSizeEvent) event()     {}
+func (TerminalTypeEvent) event()   {}
+func (SubnegotiationEvent) event() {}
+func (CommandEvent) event()        {}
+func (DisconnectEvent) event()     {}
+
+// Subscription delivers the Events of a Connection on a channel, so that an
+// application can follow the Connection's state in a select loop:
+//
+//	sub := conn.Subscribe(16)
+//	defer sub.Close()
+//	for e := range sub.C {
+//		switch e := e.(type) {
+//		case telnet.WindowSizeEvent:
+//			redraw(e.Width, e.Height)
+//		case telnet.DisconnectEvent:
+//			log.Print("gone: ", e.Reason)
+//		}
+//	}
+//
+// Events are delivered from the goroutines on which they occur, without
+// blocking: if the channel's buffer is full, the event is dropped and counted
+// by Dropped. C is closed after the DisconnectEvent, or by Close.
+type Subscription struct {
+	// C delivers the events.
+	C <-chan Event
+
+	ch      chan Event
+	conn    *Connection
+	dropped atomic.Uint64
+}
+
+// eventBus holds the Subscriptions of a Connection.
+type eventBus struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	active atomic.Bool // there are subscriptions
+}
+
+// Subscribe returns a Subscription to the Connection's events, buffering up
+// to size of them. If the Connection is already closed, the Subscription
+// delivers only its DisconnectEvent.
+func (c *Connection) Subscribe(size int) *Subscription {
+	ch := make(chan Event, max(size, 1))
+	s := &Subscription{C: ch, ch: ch, conn: c}
+	b := &c.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		ch <- DisconnectEvent{Reason: c.reason}
+		close(ch)
+		return s
+	}
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]struct{})
+	}
+	b.subs[s] = struct{}{}
+	b.active.Store(true)
+	return s
+}
+
+// Close ends the Subscription, closing C if it is not already.
+func (s *Subscription) Close() {
+	b := &s.conn.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		b.active.Store(len(b.subs) > 0)
+		close(s.ch)
+	}
+}
+
+// Dropped returns the number of events dropped because C was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// subscribed reports whether the Connection has Subscriptions.
+func (c *Connection) subscribed() bool {
+	return c.events.active.Load()
+}
+
+// emit delivers e to the Connection's Subscriptions.
+func (c *Connection) emit(e Event) {
+	if !c.subscribed() {
+		return
+	}
+	b := &c.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// closeEvents delivers the DisconnectEvent and ends the Subscriptions. The
+// event is delivered even if a buffer is full, in place of the oldest event
+// waiting.
+func (c *Connection) closeEvents(reason error) {
+	b := &c.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	e := DisconnectEvent{Reason: reason}
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			<-s.ch
+			s.dropped.Add(1)
+			s.ch <- e
+		}
+		close(s.ch)
+	}
+	b.subs = nil
+	b.active.Store(false)
+}
@@ -0,0 +1,92 @@
+package telnet_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestSubscribe(t *testing.T) {
+	a, b := telnettest.Pipe()
+	peer := &telnettest.Peer{Conn: a}
+	defer peer.Close()
+	conn := telnet.NewConnection(b, nil)
+	sub := conn.Subscribe(8)
+	go conn.Read(make([]byte, 1))
+
+	conn.SetLocalEnabled(telnet.TeloptECHO, true)
+	conn.SetLocalEnabled(telnet.TeloptECHO, true) // unchanged
+	conn.SetWindowSize(80, 24)
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.SB, 201, 'h', 'i', telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+		telnettest.Send(telnet.IAC, telnet.AYT),
+	)
+
+	want := []telnet.Event{
+		telnet.OptionEvent{Option: telnet.TeloptECHO, Local: true, Enabled: true},
+		telnet.WindowSizeEvent{Width: 80, Height: 24},
+	}
+	for _, w := range want {
+		if e := <-sub.C; e != w {
+			t.Errorf("got %#v, want %#v", e, w)
+		}
+	}
+	if e, ok := (<-sub.C).(telnet.SubnegotiationEvent); !ok || e.Option != 201 || e.Value != "hi" {
+		t.Errorf("got %#v, want the decoded subnegotiation", e)
+	}
+	if e := <-sub.C; e != (telnet.CommandEvent{Command: telnet.AYT}) {
+		t.Errorf("got %#v, want AYT", e)
+	}
+
+	reason := errors.New("done")
+	conn.CloseWithReason(reason)
+	if e, ok := (<-sub.C).(telnet.DisconnectEvent); !ok || e.Reason != reason {
+		t.Errorf("got %#v, want the disconnect", e)
+	}
+	if e, ok := <-sub.C; ok {
+		t.Errorf("got %#v after the disconnect, want C closed", e)
+	}
+	sub.Close()
+
+	// Subscribing once closed gives only the disconnect.
+	late := conn.Subscribe(0)
+	if e := <-late.C; e != (telnet.DisconnectEvent{Reason: reason}) {
+		t.Errorf("subscribing late: got %#v", e)
+	}
+	if _, ok := <-late.C; ok {
+		t.Error("subscribing late: C not closed")
+	}
+}
+
+func TestSubscription_Dropped(t *testing.T) {
+	_, b := telnettest.Pipe()
+	conn := telnet.NewConnection(b, nil)
+	sub := conn.Subscribe(1)
+	conn.SetWindowSize(80, 24)
+	conn.SetWindowSize(100, 40)
+	conn.SetWindowSize(120, 50)
+	if n := sub.Dropped(); n != 2 {
+		t.Errorf("got %d dropped, want 2", n)
+	}
+	if e := <-sub.C; e != (telnet.WindowSizeEvent{Width: 80, Height: 24}) {
+		t.Errorf("got %#v, want the first event", e)
+	}
+
+	// The disconnect takes the place of an event waiting.
+	conn.SetWindowSize(132, 60)
+	conn.Close()
+	if e, ok := (<-sub.C).(telnet.DisconnectEvent); !ok {
+		t.Errorf("got %#v, want the disconnect", e)
+	}
+	if n := sub.Dropped(); n != 3 {
+		t.Errorf("got %d dropped, want 3", n)
+	}
+
+	other := conn.Subscribe(1)
+	other.Close()
+	other.Close()
+}
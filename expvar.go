@@ -0,0 +1,67 @@
+package telnet
+
+import (
+	"expvar"
+	"sort"
+	"time"
+)
+
+// connSummary describes a connection for expvar.
+type connSummary struct {
+	ID            uint64    `json:"id"`
+	Remote        string    `json:"remote"`
+	Accepted      time.Time `json:"accepted"`
+	BytesRead     uint64    `json:"bytes_read"`
+	BytesWritten  uint64    `json:"bytes_written"`
+	RawRead       uint64    `json:"raw_read"`
+	RawWritten    uint64    `json:"raw_written"`
+	LocalOptions  []string  `json:"local_options"`
+	RemoteOptions []string  `json:"remote_options"`
+}
+
+// PublishExpvar publishes the Server's state with expvar, so it is served by
+// the expvar handler on /debug/vars. The variables published are prefix
+// followed by:
+//
+//	.accepted     the number of connections accepted
+//	.active       the number of connections being handled
+//	.connections  a summary of each connection being handled
+//
+// Like expvar.Publish, it panics if any of the names is already in use, so it
+// should be called once for each Server, with a distinct prefix.
+func (s *Server) PublishExpvar(prefix string) {
+	expvar.Publish(prefix+".accepted", expvar.Func(func() interface{} {
+		return s.accepted.Load()
+	}))
+	expvar.Publish(prefix+".active", expvar.Func(func() interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns)
+	}))
+	expvar.Publish(prefix+".connections", expvar.Func(func() interface{} {
+		return s.connSummaries()
+	}))
+}
+
+// connSummaries returns a summary of each connection being handled, in the
+// order they were accepted.
+func (s *Server) connSummaries() []connSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]connSummary, 0, len(s.conns))
+	for c, accepted := range s.conns {
+		list = append(list, connSummary{
+			ID:            c.ID(),
+			Remote:        c.RemoteAddr().String(),
+			Accepted:      accepted,
+			BytesRead:     c.bytesRead.Load(),
+			BytesWritten:  c.bytesWritten.Load(),
+			RawRead:       c.counts.rawRead.Load(),
+			RawWritten:    c.counts.rawWritten.Load(),
+			LocalOptions:  c.local.names(),
+			RemoteOptions: c.remote.names(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
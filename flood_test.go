@@ -0,0 +1,130 @@
+package telnet_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_MaxNegotiations(t *testing.T) {
+	peer, conn := telnettest.NewPeer()
+	defer peer.Close()
+	defer conn.Close()
+	conn.MaxNegotiations = 2
+
+	var floods []error
+	var data []byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 16)
+		for {
+			n, err := conn.Read(buf)
+			data = append(data, buf[:n]...)
+			var ferr *telnet.NegotiationFloodError
+			if errors.As(err, &ferr) {
+				floods = append(floods, err)
+			} else if err != nil {
+				return
+			}
+		}
+	}()
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, 200, telnet.IAC, telnet.DO, 201),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200, telnet.IAC, telnet.WONT, 201),
+		telnettest.Send(telnet.IAC, telnet.DO, 202, telnet.IAC, telnet.SB, 203, 'x', telnet.IAC, telnet.SE, 'h', 'i'),
+	)
+	peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, _ := peer.Read(make([]byte, 3)); n > 0 {
+		t.Error("Expected commands after the limit to be ignored")
+	}
+	peer.Close()
+	<-done
+	if len(floods) != 1 || floods[0].(*telnet.NegotiationFloodError).Limit != "count" {
+		t.Errorf("Expected one count flood error, got %v", floods)
+	}
+	if string(data) != "hi" {
+		t.Errorf("Expected %q, got %q", "hi", data)
+	}
+}
+
+func TestConnection_NegotiationRate(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.Clock = telnettest.NewFakeClock(time.Unix(0, 0))
+	conn.NegotiationRate = 1
+	conn.CloseOnNegotiationFlood = true
+	go io.Copy(io.Discard, b)
+
+	b.Write([]byte{telnet.IAC, telnet.DO, 200, telnet.IAC, telnet.DO, 200, 'x'})
+	if _, err := conn.Read(make([]byte, 16)); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+	var ferr *telnet.NegotiationFloodError
+	if !errors.As(conn.CloseReason(), &ferr) || ferr.Limit != "rate" || ferr.Count != 2 {
+		t.Errorf("Expected a rate flood error after 2 commands, got %v", conn.CloseReason())
+	}
+}
+
+func TestConnection_SequenceTimeout(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.SequenceTimeout = 50 * time.Millisecond
+	go io.Copy(io.Discard, b)
+
+	b.Write([]byte{'a', telnet.IAC, telnet.SB, telnet.TeloptTTYPE})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		// Trickle the body, never ending it.
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				b.Write([]byte{'x'})
+			}
+		}
+	}()
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "a" {
+		t.Fatalf("Expected %q, got %q, %v", "a", buf[:n], err)
+	}
+	if _, err := conn.Read(buf); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+	var serr *telnet.SequenceTimeoutError
+	if !errors.As(conn.CloseReason(), &serr) || string(serr.Sequence) != string([]byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE}) {
+		t.Errorf("Expected a SequenceTimeoutError for IAC SB TTYPE, got %v", conn.CloseReason())
+	}
+}
+
+func TestConnection_SequenceTimeoutComplete(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.SequenceTimeout = 30 * time.Millisecond
+	go io.Copy(io.Discard, b)
+
+	go func() {
+		b.Write([]byte{telnet.IAC})
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte{telnet.NOP, 'a'})
+	}()
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "a" {
+		t.Fatalf("Expected %q, got %q, %v", "a", buf[:n], err)
+	}
+	// The read deadline is cleared once the sequence is complete.
+	go func() {
+		time.Sleep(60 * time.Millisecond)
+		b.Write([]byte("b"))
+	}()
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "b" {
+		t.Errorf("Expected %q, got %q, %v", "b", buf[:n], err)
+	}
+}
@@ -0,0 +1,139 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// chunkConn is a net.Conn that delivers data in reads of at most chunk bytes,
+// then io.EOF, and discards writes.
+type chunkConn struct {
+	net.Conn
+	data  []byte
+	chunk int
+}
+
+func (c *chunkConn) Read(b []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(b) > c.chunk {
+		b = b[:c.chunk]
+	}
+	n := copy(b, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func (c *chunkConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (c *chunkConn) Close() error                     { return nil }
+func (c *chunkConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *chunkConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *chunkConn) SetDeadline(t time.Time) error    { return nil }
+func (c *chunkConn) RemoteAddr() net.Addr             { return &net.TCPAddr{} }
+func (c *chunkConn) LocalAddr() net.Addr              { return &net.TCPAddr{} }
+
+// readAll decodes data delivered in chunks of the given size, reading into a
+// buffer of bufSize bytes, and returns the data read and any error other than
+// io.EOF or a *SubnegotiationTooLargeError.
+func readAll(data []byte, chunk, bufSize int, options []telnet.Option) ([]byte, error) {
+	conn := telnet.NewConnection(&chunkConn{data: data, chunk: chunk}, options)
+	defer conn.Close()
+	var out []byte
+	b := make([]byte, bufSize)
+	for reads := 0; ; reads++ {
+		n, err := conn.Read(b)
+		out = append(out, b[:n]...)
+		if _, ok := err.(*telnet.SubnegotiationTooLargeError); ok {
+			continue
+		}
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		if n == 0 {
+			return out, io.ErrNoProgress
+		}
+		if reads > 2*len(data)+2 {
+			return out, io.ErrNoProgress
+		}
+	}
+}
+
+// handshakes are the opening bytes sent by some common clients.
+var handshakes = [][]byte{
+	// PuTTY
+	{telnet.IAC, telnet.WILL, telnet.TeloptNAWS, telnet.IAC, telnet.WILL, telnet.TeloptTSPEED,
+		telnet.IAC, telnet.WILL, telnet.TeloptTTYPE, telnet.IAC, telnet.WILL, telnet.TeloptNEWENVIRON,
+		telnet.IAC, telnet.DO, telnet.TeloptECHO, telnet.IAC, telnet.WILL, telnet.TeloptSGA,
+		telnet.IAC, telnet.DO, telnet.TeloptSGA},
+	// A client answering NAWS and TTYPE
+	{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 24, telnet.IAC, telnet.SE,
+		telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualIS, 'X', 'T', 'E', 'R', 'M', telnet.IAC, telnet.SE},
+	// A window size containing an escaped IAC
+	{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, telnet.IAC, telnet.IAC, 0, 24, telnet.IAC, telnet.SE},
+	// Text with a newline, escaped IAC and malformed sequences
+	[]byte("login: \r\x00user\r\n\xff\xff\xff\xf0\xff\x01\xff"),
+}
+
+func FuzzRead(f *testing.F) {
+	for _, h := range handshakes {
+		f.Add(h, uint8(1), uint8(1))
+		f.Add(h, uint8(7), uint8(3))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, chunk, bufSize uint8) {
+		options := []telnet.Option{
+			func(*telnet.Connection) telnet.Negotiator { return &sbRecorder{code: telnet.TeloptNAWS} },
+		}
+		want, err := readAll(data, len(data)+1, 4096, options)
+		if err != nil {
+			t.Fatalf("Reading %q: %v", data, err)
+		}
+		// However the data is split, it decodes the same.
+		got, err := readAll(data, int(chunk)+1, int(bufSize)%64+1, options)
+		if err != nil {
+			t.Fatalf("Reading %q in chunks of %d: %v", data, int(chunk)+1, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Reading %q in chunks of %d into %d bytes: expected %q, got %q",
+				data, int(chunk)+1, int(bufSize)%64+1, want, got)
+		}
+	})
+}
+
+func FuzzSubnegotiation(f *testing.F) {
+	f.Add([]byte{0, 80, 0, 24}, uint8(1))
+	f.Add([]byte{telnet.TelQualIS, 'X', 'T', 'E', 'R', 'M'}, uint8(2))
+	f.Add([]byte{telnet.IAC, telnet.SE, telnet.IAC}, uint8(1))
+	f.Fuzz(func(t *testing.T, body []byte, chunk uint8) {
+		data := []byte{'a', telnet.IAC, telnet.SB, 200}
+		for _, b := range body {
+			data = append(data, b)
+			if b == telnet.IAC {
+				data = append(data, telnet.IAC)
+			}
+		}
+		data = append(data, telnet.IAC, telnet.SE, 'b')
+
+		rec := &sbRecorder{code: 200}
+		got, err := readAll(data, int(chunk)+1, 3, []telnet.Option{
+			func(*telnet.Connection) telnet.Negotiator { return rec },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "ab" {
+			t.Errorf("Expected %q, got %q", "ab", got)
+		}
+		if len(rec.bodies) != 1 || !bytes.Equal(rec.bodies[0], body) {
+			t.Errorf("Expected body %q, got %q", body, rec.bodies)
+		}
+	})
+}
@@ -1,5 +1,32 @@
 module github.com/bradrupp/telnet
 
-go 1.16
+go 1.21
 
-require golang.org/x/crypto v0.0.0-20210218145215-b8e89b74b9df
+require (
+	github.com/prometheus/client_golang v1.19.1
+	golang.org/x/crypto v0.0.0-20210218145215-b8e89b74b9df
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/creack/pty v1.1.21
+	github.com/gorilla/websocket v1.5.0
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+	golang.org/x/sys v0.21.0
+	golang.org/x/term v0.0.0-20201117132131-f5c789dd3221 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
@@ -0,0 +1,80 @@
+package telnet
+
+import "time"
+
+// ReadHalf is the reading half of a Connection, returned by Reader. A
+// program will often have one goroutine reading commands from a Connection
+// while another writes to it - pumping out broadcasts, say; handing each the
+// half it needs makes clear which does what, and keeps the reader from
+// closing the Connection from under the writer. Unlike the Connection's own
+// Read, a ReadHalf may be shared by several goroutines, which take turns.
+type ReadHalf struct {
+	c *Connection
+}
+
+// WriteHalf is the writing half of a Connection, returned by Writer. It may be
+// used by any number of goroutines at once, as Write may.
+type WriteHalf struct {
+	c *Connection
+}
+
+// Reader returns the reading half of the Connection. Reads made through it
+// should not be mixed with the Connection's own Read made from other
+// goroutines.
+func (c *Connection) Reader() ReadHalf {
+	return ReadHalf{c}
+}
+
+// Writer returns the writing half of the Connection.
+func (c *Connection) Writer() WriteHalf {
+	return WriteHalf{c}
+}
+
+// Connection returns the Connection of which r is the reading half.
+func (r ReadHalf) Connection() *Connection {
+	return r.c
+}
+
+// Read reads from the Connection as Read does, waiting for any read of
+// another goroutine through the ReadHalf to return first.
+func (r ReadHalf) Read(b []byte) (int, error) {
+	r.c.rmu.Lock()
+	defer r.c.rmu.Unlock()
+	return r.c.Read(b)
+}
+
+// SetReadDeadline sets the Connection's read deadline.
+func (r ReadHalf) SetReadDeadline(t time.Time) error {
+	return r.c.SetReadDeadline(t)
+}
+
+// Close shuts down reading, as CloseRead does, leaving the WriteHalf usable.
+func (r ReadHalf) Close() error {
+	return r.c.CloseRead()
+}
+
+// Connection returns the Connection of which w is the writing half.
+func (w WriteHalf) Connection() *Connection {
+	return w.c
+}
+
+// Write writes to the Connection as Write does.
+func (w WriteHalf) Write(b []byte) (int, error) {
+	return w.c.Write(b)
+}
+
+// WriteString writes s to the Connection as Write does.
+func (w WriteHalf) WriteString(s string) (int, error) {
+	return w.c.Write([]byte(s))
+}
+
+// SetWriteDeadline sets the Connection's write deadline.
+func (w WriteHalf) SetWriteDeadline(t time.Time) error {
+	return w.c.SetWriteDeadline(t)
+}
+
+// Close shuts down writing, as CloseWrite does, so that the peer reads EOF
+// while the ReadHalf remains usable.
+func (w WriteHalf) Close() error {
+	return w.c.CloseWrite()
+}
@@ -0,0 +1,68 @@
+package telnet_test
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_Halves(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	r, w := conn.Reader(), conn.Writer()
+	if r.Connection() != conn || w.Connection() != conn {
+		t.Error("Expected the halves of conn")
+	}
+
+	// Two goroutines share the reading half while a third writes.
+	const total = 1000
+	var mu sync.Mutex
+	read := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 7)
+			for {
+				n, err := r.Read(buf)
+				mu.Lock()
+				read += n
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < total; i++ {
+			w.WriteString("x")
+		}
+	}()
+	b.Write(make([]byte, total))
+	got := make([]byte, total)
+	if _, err := io.ReadFull(b, got); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	wg.Wait()
+	if read != total {
+		t.Errorf("Expected %d bytes read through the halves, got %d", total, read)
+	}
+
+	pipe, _ := net.Pipe()
+	conn = telnet.NewConnection(pipe, nil)
+	defer conn.Close()
+	if err := conn.Writer().Close(); err != telnet.ErrHalfCloseUnsupported {
+		t.Errorf("Expected ErrHalfCloseUnsupported, got %v", err)
+	}
+	if err := conn.Reader().Close(); err != telnet.ErrHalfCloseUnsupported {
+		t.Errorf("Expected ErrHalfCloseUnsupported, got %v", err)
+	}
+}
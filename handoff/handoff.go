@@ -0,0 +1,146 @@
+//go:build unix
+
+// Package handoff passes telnet Connections between processes over Unix
+// sockets, so a long-lived server can be restarted without dropping its
+// sessions: the old process sends each Connection's socket and negotiation
+// state to the new one, which carries on where it left off.
+//
+//	// In the old process, for each session:
+//	err := handoff.Send(uc, conn)
+//
+//	// In the new process:
+//	conn, err := handoff.Receive(uc, options)
+//	go handler.HandleTelnet(conn)
+package handoff
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+
+	"github.com/tester2024/telnet"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoSocket is returned by Send when the Connection's underlying connection
+// has no socket to pass.
+var ErrNoSocket = errors.New("handoff: connection has no socket")
+
+// maxState bounds the size of a received state, guarding against a
+// misbehaving sender.
+const maxState = 16 << 20
+
+// Send passes the socket and state of conn over uc, then closes conn. The
+// socket stays open in the receiving process, and the peer sees no
+// interruption. conn must not be in use by any other goroutine; its Handler
+// should have stopped reading and writing it before Send is called.
+func Send(uc *net.UnixConn, conn *telnet.Connection) error {
+	fc, ok := conn.Conn.(interface{ File() (*os.File, error) })
+	if !ok {
+		return ErrNoSocket
+	}
+	state, err := conn.State()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	f, err := fc.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	if _, _, err := uc.WriteMsgUnix(append(msg, data...), unix.UnixRights(int(f.Fd())), nil); err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// Receive reads a Connection sent with Send from uc, restoring it with
+// handlers from the given options, which should match those of the sender.
+func Receive(uc *net.UnixConn, options []telnet.Option) (*telnet.Connection, error) {
+	// Read only the length with the socket, so as not to run into a
+	// following message.
+	buf := make([]byte, 4)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := uc.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	f, err := socketFile(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nc, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readState(uc, buf[:n])
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	var state telnet.ConnectionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	conn, err := telnet.RestoreConnection(nc, options, state)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socketFile returns the descriptor passed in a control message as a file.
+func socketFile(oob []byte) (*os.File, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		fds, err := unix.ParseUnixRights(&m)
+		if err != nil || len(fds) == 0 {
+			continue
+		}
+		for _, fd := range fds[1:] {
+			unix.Close(fd)
+		}
+		return os.NewFile(uintptr(fds[0]), "handoff"), nil
+	}
+	return nil, errors.New("handoff: no socket received")
+}
+
+// readState reads the length-prefixed state whose start has been read into
+// msg.
+func readState(r io.Reader, msg []byte) ([]byte, error) {
+	for len(msg) < 4 {
+		var b [4]byte
+		n, err := r.Read(b[:4-len(msg)])
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, b[:n]...)
+	}
+	size := binary.BigEndian.Uint32(msg)
+	if size > maxState {
+		return nil, errors.New("handoff: state too large")
+	}
+	data := make([]byte, size)
+	n := copy(data, msg[4:])
+	if _, err := io.ReadFull(r, data[n:]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package handoff_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/handoff"
+	"github.com/tester2024/telnet/options"
+	"golang.org/x/sys/unix"
+)
+
+func unixPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c.(*net.UnixConn)
+		t.Cleanup(func() { c.Close() })
+	}
+	return conns[0], conns[1]
+}
+
+func TestSendReceive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	nc, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := []telnet.Option{options.NAWSOption}
+	conn := telnet.NewConnection(nc, opts)
+	client.Write([]byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS,
+		telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 24, telnet.IAC, telnet.SE, 'a'})
+	buf := make([]byte, 64)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "a" {
+		t.Fatalf("Expected %q, got %q, %v", "a", buf[:n], err)
+	}
+
+	from, to := unixPair(t)
+	if err := handoff.Send(from, conn); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := handoff.Receive(to, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	naws := restored.OptionHandlers[telnet.TeloptNAWS].(*options.NAWSHandler)
+	if naws.Width != 80 || naws.Height != 24 {
+		t.Errorf("Expected 80x24, got %dx%d", naws.Width, naws.Height)
+	}
+	client.Write([]byte("b"))
+	if n, err := restored.Read(buf); err != nil || string(buf[:n]) != "b" {
+		t.Fatalf("Expected %q, got %q, %v", "b", buf[:n], err)
+	}
+	restored.Write([]byte("c"))
+	// The DO NAWS offered by the original Connection comes first.
+	expected := []byte{telnet.IAC, telnet.DO, telnet.TeloptNAWS, 'c'}
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(client, got); err != nil || string(got) != string(expected) {
+		t.Errorf("Expected %q, got %q, %v", expected, got, err)
+	}
+}
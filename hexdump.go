@@ -0,0 +1,140 @@
+package telnet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// HexDump returns a ConnectionTrace that writes the raw telnet stream in both
+// directions to w, as timestamped hex dumps followed by the IAC sequences
+// completed in each chunk, for example:
+//
+//	15:04:05.000000 recv 6 bytes
+//	  00000000  ff fd 1f 68 69 0a                                 |...hi.|
+//	  IAC DO NAWS
+//
+// Writes to w are serialized, and errors writing to it are ignored.
+func HexDump(w io.Writer) *ConnectionTrace {
+	return HexDumpClock(w, SystemClock)
+}
+
+// HexDumpClock is like HexDump, but timestamps the dumps with clock, such as
+// the Clock of the Connection traced.
+func HexDumpClock(w io.Writer, clock Clock) *ConnectionTrace {
+	d := &hexDumper{w: w, clock: clock}
+	return &ConnectionTrace{
+		WireRead:    func(b []byte) { d.dump("recv", &d.in, b) },
+		WireWritten: func(b []byte) { d.dump("sent", &d.out, b) },
+	}
+}
+
+// hexDumper writes hex dumps for HexDump.
+type hexDumper struct {
+	mu      sync.Mutex
+	w       io.Writer
+	clock   Clock
+	in, out iacAnnotator
+}
+
+func (d *hexDumper) dump(dir string, a *iacAnnotator, b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %d bytes\n", d.clock.Now().Format("15:04:05.000000"), dir, len(b))
+	for _, line := range strings.SplitAfter(hex.Dump(b), "\n") {
+		if line != "" {
+			sb.WriteString("  " + line)
+		}
+	}
+	for _, note := range a.annotate(b) {
+		sb.WriteString("  " + note + "\n")
+	}
+	io.WriteString(d.w, sb.String())
+}
+
+// Annotator states
+const (
+	annData   = iota // plain data
+	annIAC           // received IAC
+	annCmd           // received IAC WILL/WONT/DO/DONT
+	annSB            // received IAC SB
+	annSBData        // inside a subnegotiation body
+	annSBIAC         // received IAC inside a subnegotiation body
+)
+
+// iacAnnotator describes the IAC sequences in one direction of a stream. Its
+// state is kept between calls, so sequences may be split across chunks.
+type iacAnnotator struct {
+	state  int
+	cmd    byte
+	option byte
+	sbLen  int
+}
+
+// annotate returns a description of each IAC sequence completed in b.
+func (a *iacAnnotator) annotate(b []byte) (notes []string) {
+	for i := 0; i < len(b); i++ {
+		ch := b[i]
+		switch a.state {
+		case annData:
+			if ch == IAC {
+				a.state = annIAC
+			}
+		case annIAC:
+			a.state = annData
+			switch ch {
+			case IAC:
+				// Escaped IAC in data
+			case WILL, WONT, DO, DONT:
+				a.cmd = ch
+				a.state = annCmd
+			case SB:
+				a.state = annSB
+			default:
+				notes = append(notes, "IAC "+commandName(ch))
+			}
+		case annCmd:
+			a.state = annData
+			notes = append(notes, "IAC "+commandName(a.cmd)+" "+optionName(ch))
+		case annSB:
+			a.option = ch
+			a.sbLen = 0
+			a.state = annSBData
+		case annSBData:
+			if ch == IAC {
+				a.state = annSBIAC
+			} else {
+				a.sbLen++
+			}
+		case annSBIAC:
+			switch ch {
+			case SE:
+				a.state = annData
+				notes = append(notes, fmt.Sprintf("IAC SB %s <%d bytes> IAC SE", optionName(a.option), a.sbLen))
+			case IAC:
+				a.sbLen++
+				a.state = annSBData
+			default:
+				notes = append(notes, "IAC SB "+optionName(a.option)+" (unterminated)")
+				a.state = annIAC
+				i--
+			}
+		}
+	}
+	return
+}
+
+// commandName returns the name of a command byte, or its decimal value if it
+// is not a command.
+func commandName(cmd byte) string {
+	return Command(cmd).String()
+}
+
+// optionName returns the name of an option code, or its decimal value if it
+// is not known.
+func optionName(option byte) string {
+	return OptionCode(option).String()
+}
@@ -0,0 +1,54 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+)
+
+func TestHexDump(t *testing.T) {
+	var buf bytes.Buffer
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{'h', 'i', telnet.IAC})
+		client.Write([]byte{telnet.DO, telnet.TeloptNAWS})
+		io.ReadFull(client, make([]byte, 3))
+		client.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 24, telnet.IAC, telnet.SE})
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	conn.Trace = telnet.HexDump(&buf)
+	ioutil.ReadAll(conn)
+	conn.Close()
+
+	// Drop the timestamps.
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if i := strings.IndexByte(line, ' '); i > 0 && !strings.HasPrefix(line, " ") {
+			line = line[i+1:]
+		}
+		lines = append(lines, line)
+	}
+	expected := []string{
+		"recv 3 bytes",
+		"  00000000  68 69 ff                                          |hi.|",
+		"recv 2 bytes",
+		"  00000000  fd 1f                                             |..|",
+		"  IAC DO NAWS",
+		"sent 3 bytes",
+		"  00000000  ff fc 1f                                          |...|",
+		"  IAC WONT NAWS",
+		"recv 9 bytes",
+		"  00000000  ff fa 1f 00 50 00 18 ff  f0                       |....P....|",
+		"  IAC SB NAWS <4 bytes> IAC SE",
+		"",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,162 @@
+// Package honeypot emulates a telnet login and shell for researchers running
+// honeypots, recording the credentials tried and the commands entered by
+// bots and attackers to a structured log:
+//
+//	h := &honeypot.Honeypot{
+//		Banner:   "\nUbuntu 22.04.3 LTS\n\n",
+//		Hostname: "nas",
+//		Logger:   slog.New(slog.NewJSONHandler(f, nil)),
+//	}
+//	s := telnet.NewServer(":23", h)
+//
+// Nothing entered is ever run: commands are answered from canned output.
+// Each record carries the Connection's ID as "conn" and the peer's address as
+// "remote", and is timestamped by the Logger's handler.
+package honeypot
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// DefaultMaxAttempts is the number of logins a Honeypot allows when its
+// MaxAttempts is zero.
+const DefaultMaxAttempts = 3
+
+// Honeypot is a telnet Handler emulating a login and a shell.
+type Honeypot struct {
+	// Banner is written when a client connects, before the login prompt.
+	Banner string
+
+	// Hostname is shown in the prompts. If empty, "localhost" is used.
+	Hostname string
+
+	// Accept decides which credentials log in. If nil, every attempt
+	// after the first does, as on a device whose weak password has been
+	// found, so that attackers go on to enter commands.
+	Accept func(user, password string) bool
+
+	// MaxAttempts is the number of logins allowed before disconnecting. If
+	// zero, DefaultMaxAttempts is used.
+	MaxAttempts int
+
+	// Commands holds canned output for commands, by their first word, such
+	// as "uname". Other commands are reported as not found.
+	Commands map[string]string
+
+	// Timeout, if positive, disconnects a client that enters nothing for
+	// that long.
+	Timeout time.Duration
+
+	// Logger receives a record at slog.LevelInfo for each connection,
+	// login attempt, command and disconnection. If nil, slog.Default is
+	// used.
+	Logger *slog.Logger
+}
+
+// HandleTelnet implements telnet.Handler.
+func (h *Honeypot) HandleTelnet(c *telnet.Connection) {
+	log := h.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With("conn", c.ID(), "remote", c.RemoteAddr().String())
+	start := time.Now()
+	log.Info("honeypot: connect")
+	defer func() {
+		log.Info("honeypot: disconnect", "duration", time.Since(start))
+	}()
+
+	s := &session{h: h, c: c, log: log}
+	c.Write([]byte(h.Banner))
+	user, ok := s.login()
+	if ok {
+		s.shell(user)
+	}
+}
+
+// session is a client's session with a Honeypot.
+type session struct {
+	h   *Honeypot
+	c   *telnet.Connection
+	log *slog.Logger
+}
+
+// login asks for credentials until they are accepted or the attempts run out.
+func (s *session) login() (user string, ok bool) {
+	attempts := s.h.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	for i := 0; i < attempts; i++ {
+		user, err := s.prompt(s.hostname()+" login: ", true)
+		if err != nil {
+			return "", false
+		}
+		password, err := s.prompt("Password: ", false)
+		if err != nil {
+			return "", false
+		}
+		accepted := i > 0
+		if s.h.Accept != nil {
+			accepted = s.h.Accept(user, password)
+		}
+		s.log.Info("honeypot: login", "user", user, "password", password, "accepted", accepted)
+		if accepted {
+			return user, true
+		}
+		s.c.Write([]byte("\nLogin incorrect\n"))
+	}
+	return "", false
+}
+
+// shell answers commands until the client logs out.
+func (s *session) shell(user string) {
+	prompt := user + "@" + s.hostname() + ":~$ "
+	if user == "root" {
+		prompt = "root@" + s.hostname() + ":~# "
+	}
+	s.c.Write([]byte("\n"))
+	for {
+		line, err := s.prompt(prompt, true)
+		if err != nil {
+			return
+		}
+		for _, command := range strings.Split(line, ";") {
+			command = strings.TrimSpace(command)
+			if command == "" {
+				continue
+			}
+			s.log.Info("honeypot: command", "user", user, "command", command)
+			name := strings.Fields(command)[0]
+			switch {
+			case name == "exit" || name == "logout":
+				s.c.Write([]byte("logout\n"))
+				return
+			case s.h.Commands[name] != "":
+				s.c.Write([]byte(s.h.Commands[name]))
+			default:
+				s.c.Write([]byte("-bash: " + name + ": command not found\n"))
+			}
+		}
+	}
+}
+
+func (s *session) hostname() string {
+	if s.h.Hostname == "" {
+		return "localhost"
+	}
+	return s.h.Hostname
+}
+
+// prompt writes p and reads a line, echoing what is typed if echo is set and
+// the client has left echoing to the server.
+func (s *session) prompt(p string, echo bool) (string, error) {
+	if s.h.Timeout > 0 {
+		s.c.SetReadDeadline(time.Now().Add(s.h.Timeout))
+	}
+	return s.c.Ask(p, echo)
+}
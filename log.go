@@ -0,0 +1,35 @@
+package telnet
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// lastConnID is the ID most recently assigned to a Connection.
+var lastConnID atomic.Uint64
+
+// ID returns the Connection's identifier, which is unique within the process
+// and is attached to its log records as the "conn" attribute.
+func (c *Connection) ID() uint64 {
+	return c.id
+}
+
+// log writes a record to the Connection's Logger, if it has one.
+func (c *Connection) log(level slog.Level, msg string, args ...any) {
+	if c.Logger == nil {
+		return
+	}
+	ctx := context.Background()
+	if !c.Logger.Enabled(ctx, level) {
+		return
+	}
+	c.Logger.Log(ctx, level, msg, append([]any{slog.Uint64("conn", c.id)}, args...)...)
+}
+
+// log writes a record to the Server's Logger, if it has one.
+func (s *Server) log(level slog.Level, msg string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Log(context.Background(), level, msg, args...)
+	}
+}
@@ -0,0 +1,66 @@
+package telnet
+
+import "log/slog"
+
+// MemoryReporter is implemented by the readers and writers of Transforms that
+// hold significant memory, such as compression dictionaries, to have it
+// counted against a Connection's MemoryBudget. A writer's MemoryUsage may be
+// called while it is being written to.
+type MemoryReporter interface {
+	// MemoryUsage returns the number of bytes held.
+	MemoryUsage() int
+}
+
+// memoryUsage estimates the memory the Connection holds on the peer's behalf.
+// It must be called from the goroutine calling Read, which owns the read
+// buffer and the transform pipeline.
+func (c *Connection) memoryUsage() int {
+	n := cap(c.buf) + cap(c.sb.body) + int(c.queuedBytes.Load()) + int(c.broadcastBytes.Load())
+	for _, stages := range [][]*transformStage{c.dataReaders, c.streamReaders} {
+		for _, ts := range stages {
+			if ts.in != nil {
+				n += ts.in.Size()
+			}
+			n += reportedMemory(ts.r)
+		}
+	}
+	// Writers may be added by AddWriteTransform on other goroutines.
+	c.wmu.Lock()
+	n += cap(c.wheld)
+	writers := append(append([]*transformStage(nil), c.dataWriters...), c.streamWriters...)
+	c.wmu.Unlock()
+	for _, ts := range writers {
+		n += reportedMemory(ts.w)
+	}
+	return n
+}
+
+// reportedMemory returns the memory v reports holding as a MemoryReporter.
+func reportedMemory(v any) int {
+	if m, ok := v.(MemoryReporter); ok {
+		return m.MemoryUsage()
+	}
+	return 0
+}
+
+// checkMemory closes the Connection with a *MemoryBudgetError if holding
+// another extra bytes would exceed its MemoryBudget.
+func (c *Connection) checkMemory(extra int) error {
+	if c.MemoryBudget <= 0 {
+		return nil
+	}
+	usage := c.memoryUsage() + extra
+	if usage <= c.MemoryBudget {
+		return nil
+	}
+	return c.exceedBudget(usage)
+}
+
+// exceedBudget closes the Connection with a *MemoryBudgetError for holding
+// usage bytes, over its MemoryBudget.
+func (c *Connection) exceedBudget(usage int) error {
+	err := &MemoryBudgetError{Budget: c.MemoryBudget, Usage: usage}
+	c.log(slog.LevelWarn, "telnet: memory budget exceeded", "budget", c.MemoryBudget, "usage", usage)
+	c.CloseWithReason(err)
+	return err
+}
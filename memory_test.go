@@ -0,0 +1,64 @@
+package telnet_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_MemoryBudget(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.MemoryBudget = 4096
+	go io.Copy(io.Discard, b)
+
+	go func() {
+		b.Write([]byte{'a', telnet.IAC, telnet.SB, telnet.TeloptTTYPE})
+		for i := 0; i < 100; i++ {
+			if _, err := b.Write(bytes.Repeat([]byte{'x'}, 100)); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "a" {
+		t.Fatalf("Expected %q, got %q, %v", "a", buf[:n], err)
+	}
+	if _, err := conn.Read(buf); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+	var merr *telnet.MemoryBudgetError
+	if !errors.As(conn.CloseReason(), &merr) || merr.Budget != 4096 || merr.Usage <= 4096 {
+		t.Errorf("Expected a MemoryBudgetError, got %v", conn.CloseReason())
+	}
+}
+
+// dictionaryTransform is a Transform whose writer reports holding a
+// compression dictionary.
+type dictionaryTransform struct{}
+
+func (dictionaryTransform) NewReader(r io.Reader) io.Reader { return r }
+func (dictionaryTransform) NewWriter(w io.Writer) io.Writer { return dictionaryWriter{w} }
+
+type dictionaryWriter struct{ io.Writer }
+
+func (dictionaryWriter) MemoryUsage() int { return 32 * 1024 }
+
+func TestConnection_MemoryBudgetTransform(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.MemoryBudget = 16 * 1024
+	b.Write([]byte("ok"))
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		t.Fatalf("Expected %q, got %q, %v", "ok", buf[:n], err)
+	}
+	conn.AddTransform(telnet.StageCompression, dictionaryTransform{})
+	if _, err := conn.Read(buf); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+}
@@ -0,0 +1,122 @@
+// Package metrics exports statistics about telnet connections to Prometheus.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tester2024/telnet"
+)
+
+// Collector is a prometheus.Collector counting the connections, traffic and
+// negotiation of the telnet connections it instruments. Register it with a
+// prometheus.Registerer, then wrap a Server's Handler with Handler, or call
+// Instrument for each Connection.
+type Collector struct {
+	active   prometheus.Gauge
+	accepted prometheus.Counter
+	failures *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	options  *prometheus.CounterVec
+}
+
+// NewCollector returns a Collector whose metrics are named with the given
+// namespace, which may be empty.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		active: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "telnet",
+			Name:      "active_connections",
+			Help:      "Number of connections being handled.",
+		}),
+		accepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "telnet",
+			Name:      "accepted_connections_total",
+			Help:      "Total number of connections accepted.",
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "telnet",
+			Name:      "negotiation_failures_total",
+			Help:      "Total number of negotiation failures, by reason.",
+		}, []string{"reason"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "telnet",
+			Name:      "bytes_total",
+			Help:      "Total bytes of the telnet stream transferred, by direction.",
+		}, []string{"direction"}),
+		options: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "telnet",
+			Name:      "options_enabled_total",
+			Help:      "Total number of times an option was enabled, by option and side.",
+		}, []string{"option", "side"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.active.Describe(ch)
+	c.accepted.Describe(ch)
+	c.failures.Describe(ch)
+	c.bytes.Describe(ch)
+	c.options.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.active.Collect(ch)
+	c.accepted.Collect(ch)
+	c.failures.Collect(ch)
+	c.bytes.Collect(ch)
+	c.options.Collect(ch)
+}
+
+// Handler returns a Handler that counts each connection as accepted and
+// active while h handles it, and instruments it with Instrument.
+func (c *Collector) Handler(h telnet.Handler) telnet.Handler {
+	return telnet.HandleFunc(func(conn *telnet.Connection) {
+		c.accepted.Inc()
+		c.active.Inc()
+		defer c.active.Dec()
+		c.Instrument(conn)
+		h.HandleTelnet(conn)
+	})
+}
+
+// Instrument adds a trace to conn, alongside any it already has, counting its
+// traffic, negotiation failures and enabled options.
+func (c *Collector) Instrument(conn *telnet.Connection) {
+	in, out := c.bytes.WithLabelValues("in"), c.bytes.WithLabelValues("out")
+	conn.Trace = telnet.MultiTrace(conn.Trace, &telnet.ConnectionTrace{
+		WireRead:    func(b []byte) { in.Add(float64(len(b))) },
+		WireWritten: func(b []byte) { out.Add(float64(len(b))) },
+		OptionChanged: func(option byte, local, enabled bool) {
+			if !enabled {
+				return
+			}
+			side := "remote"
+			if local {
+				side = "local"
+			}
+			c.options.WithLabelValues(telnet.OptionCode(option).String(), side).Inc()
+		},
+		NegotiationFailed: func(err error) {
+			c.failures.WithLabelValues(failureReason(err)).Inc()
+		},
+	})
+}
+
+// failureReason returns the reason label for a negotiation failure.
+func failureReason(err error) string {
+	switch err.(type) {
+	case *telnet.ProtocolError:
+		return "protocol_error"
+	case *telnet.SubnegotiationTooLargeError:
+		return "subnegotiation_too_large"
+	case *telnet.NegotiationTimeoutError:
+		return "timeout"
+	}
+	return "other"
+}
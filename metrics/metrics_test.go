@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/metrics"
+)
+
+// echoOption enables ECHO on our side when the peer asks for it.
+type echoOption struct{}
+
+func (echoOption) OptionCode() byte                        { return telnet.TeloptECHO }
+func (echoOption) Offer(c *telnet.Connection)              {}
+func (echoOption) HandleWill(c *telnet.Connection)         {}
+func (echoOption) HandleSB(c *telnet.Connection, b []byte) {}
+func (echoOption) HandleDo(c *telnet.Connection) {
+	c.WriteCommand(telnet.WILL, telnet.TeloptECHO)
+	c.SetLocalEnabled(telnet.TeloptECHO, true)
+}
+
+func TestCollector(t *testing.T) {
+	c := metrics.NewCollector("test")
+	done := make(chan struct{})
+	h := c.Handler(telnet.HandleFunc(func(conn *telnet.Connection) {
+		ioutil.ReadAll(conn)
+		conn.Close()
+		close(done)
+	}))
+
+	client, server := net.Pipe()
+	conn := telnet.NewConnection(server, []telnet.Option{
+		func(*telnet.Connection) telnet.Negotiator { return echoOption{} },
+	})
+	go h.HandleTelnet(conn)
+	client.Write([]byte{'h', 'i', telnet.IAC, telnet.DO, telnet.TeloptECHO, telnet.IAC, telnet.SE})
+	io.ReadFull(client, make([]byte, 3))
+	client.Close()
+	<-done
+
+	expected := `
+# HELP test_telnet_accepted_connections_total Total number of connections accepted.
+# TYPE test_telnet_accepted_connections_total counter
+test_telnet_accepted_connections_total 1
+# HELP test_telnet_active_connections Number of connections being handled.
+# TYPE test_telnet_active_connections gauge
+test_telnet_active_connections 0
+# HELP test_telnet_bytes_total Total bytes of the telnet stream transferred, by direction.
+# TYPE test_telnet_bytes_total counter
+test_telnet_bytes_total{direction="in"} 7
+test_telnet_bytes_total{direction="out"} 3
+# HELP test_telnet_negotiation_failures_total Total number of negotiation failures, by reason.
+# TYPE test_telnet_negotiation_failures_total counter
+test_telnet_negotiation_failures_total{reason="protocol_error"} 1
+# HELP test_telnet_options_enabled_total Total number of times an option was enabled, by option and side.
+# TYPE test_telnet_options_enabled_total counter
+test_telnet_options_enabled_total{option="ECHO",side="local"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
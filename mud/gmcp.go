@@ -0,0 +1,298 @@
+package mud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tester2024/telnet"
+)
+
+func init() {
+	telnet.RegisterCodec(TeloptGMCP, gmcpCodec{})
+}
+
+// Names of common GMCP messages.
+const (
+	GMCPCoreHello          = "Core.Hello"
+	GMCPCoreSupportsSet    = "Core.Supports.Set"
+	GMCPCoreSupportsAdd    = "Core.Supports.Add"
+	GMCPCoreSupportsRemove = "Core.Supports.Remove"
+	GMCPCharVitals         = "Char.Vitals"
+	GMCPRoomInfo           = "Room.Info"
+	GMCPCommChannelText    = "Comm.Channel.Text"
+	GMCPCommChannelList    = "Comm.Channel.List"
+)
+
+// CoreHello is the data of Core.Hello, with which a client introduces itself.
+type CoreHello struct {
+	Client  string `json:"client"`
+	Version string `json:"version"`
+}
+
+// CoreSupports is the data of Core.Supports.Set, Add and Remove: packages
+// with their versions, such as "Char 1".
+type CoreSupports []string
+
+// CharVitals is the data of Char.Vitals, a character's health and other
+// points.
+type CharVitals struct {
+	HP       int `json:"hp"`
+	MaxHP    int `json:"maxhp"`
+	MP       int `json:"mp"`
+	MaxMP    int `json:"maxmp"`
+	Moves    int `json:"mv,omitempty"`
+	MaxMoves int `json:"maxmv,omitempty"`
+}
+
+// RoomInfo is the data of Room.Info, describing the room a character is in.
+type RoomInfo struct {
+	Num         int    `json:"num"`
+	Name        string `json:"name"`
+	Area        string `json:"area,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Exits maps the directions out of the room to the rooms they lead to.
+	Exits map[string]int `json:"exits,omitempty"`
+}
+
+// CommChannelText is the data of Comm.Channel.Text, something said on a
+// channel.
+type CommChannelText struct {
+	Channel string `json:"channel"`
+	Talker  string `json:"talker"`
+	Text    string `json:"text"`
+}
+
+// CommChannel is an entry of Comm.Channel.List, a channel a character may
+// use.
+type CommChannel struct {
+	Name    string `json:"name"`
+	Caption string `json:"caption,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// EncodeGMCP encodes a GMCP message named name, with v encoded as JSON as its
+// data unless it is nil.
+func EncodeGMCP(name string, v interface{}) ([]byte, error) {
+	if v == nil {
+		return []byte(name), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(name+" "), data...), nil
+}
+
+// DecodeGMCP splits the body of a GMCP subnegotiation into the message name
+// and its JSON data, which may be empty.
+func DecodeGMCP(body []byte) (name string, data []byte) {
+	return splitGMCP(body)
+}
+
+// GMCPMessage is the body of a GMCP subnegotiation, as decoded by its
+// telnet.Codec.
+type GMCPMessage struct {
+	Name string
+	// Data is the message's JSON data, or nil if it has none.
+	Data json.RawMessage
+}
+
+// gmcpCodec is the telnet.Codec of GMCP.
+type gmcpCodec struct{}
+
+func (gmcpCodec) Decode(body []byte) (any, error) {
+	name, data := splitGMCP(body)
+	if len(data) > 0 && !json.Valid(data) {
+		return nil, errors.New("mud: malformed GMCP data")
+	}
+	return GMCPMessage{Name: name, Data: data}, nil
+}
+
+func (gmcpCodec) Encode(v any) ([]byte, error) {
+	m, ok := v.(GMCPMessage)
+	if !ok {
+		return nil, fmt.Errorf("mud: cannot encode %T as GMCP", v)
+	}
+	if m.Data == nil {
+		return EncodeGMCP(m.Name, nil)
+	}
+	return EncodeGMCP(m.Name, m.Data)
+}
+
+// SendGMCP sends a GMCP message named name, with v as its data, to the peer
+// of c.
+func SendGMCP(c *telnet.Connection, name string, v interface{}) error {
+	body, err := EncodeGMCP(name, v)
+	if err != nil {
+		return err
+	}
+	return c.WriteSubnegotiation(TeloptGMCP, body)
+}
+
+var (
+	// ErrGMCPDisabled is returned by GMCPHandler.Send when the client has
+	// not agreed to GMCP.
+	ErrGMCPDisabled = errors.New("mud: GMCP is not enabled")
+	// ErrGMCPUnsupported is returned by GMCPHandler.Send for a message in a
+	// package the client has not said it supports.
+	ErrGMCPUnsupported = errors.New("mud: GMCP package not supported by the client")
+)
+
+// GMCPOption enables GMCP on a Server, offering it to the client. The client
+// may then introduce itself with Core.Hello, and say which packages it
+// supports with Core.Supports, which the GMCPHandler keeps track of.
+func GMCPOption(c *telnet.Connection) telnet.Negotiator {
+	return &GMCPHandler{}
+}
+
+// GMCPFor returns the GMCPHandler of c, or nil if it has none.
+func GMCPFor(c *telnet.Connection) *GMCPHandler {
+	h, _ := c.OptionHandlers[TeloptGMCP].(*GMCPHandler)
+	return h
+}
+
+// GMCPHandler negotiates GMCP for a server.
+type GMCPHandler struct {
+	// OnMessage, if set, is called with each message from the client
+	// other than Core.Hello and Core.Supports.
+	OnMessage func(c *telnet.Connection, name string, data []byte)
+
+	store    *Store // if set, sent its variables on Core.Supports
+	mu       sync.Mutex
+	sentWill bool
+	hello    CoreHello
+	supports map[string]int // package versions
+}
+
+// OptionCode returns the IAC code for GMCP.
+func (h *GMCPHandler) OptionCode() byte {
+	return TeloptGMCP
+}
+
+// Offer offers GMCP to the client.
+func (h *GMCPHandler) Offer(c *telnet.Connection) {
+	h.mu.Lock()
+	h.sentWill = true
+	h.mu.Unlock()
+	c.WriteCommand(telnet.WILL, TeloptGMCP)
+}
+
+// HandleDo enables GMCP, agreeing to it unless it answers our offer.
+func (h *GMCPHandler) HandleDo(c *telnet.Connection) {
+	if c.LocalEnabled(TeloptGMCP) {
+		return
+	}
+	h.mu.Lock()
+	sentWill := h.sentWill
+	h.sentWill = false
+	h.mu.Unlock()
+	if !sentWill {
+		c.WriteCommand(telnet.WILL, TeloptGMCP)
+	}
+	c.SetLocalEnabled(TeloptGMCP, true)
+}
+
+// HandleRefused forgets our offer, so that the client asking for GMCP later
+// is agreed to.
+func (h *GMCPHandler) HandleRefused(c *telnet.Connection, local bool) {
+	if local {
+		h.mu.Lock()
+		h.sentWill = false
+		h.mu.Unlock()
+	}
+}
+
+// HandleWill refuses to let the client send GMCP as an option of its own;
+// clients send GMCP once the server's side is enabled.
+func (h *GMCPHandler) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, TeloptGMCP)
+}
+
+// HandleSB handles a message from the client.
+func (h *GMCPHandler) HandleSB(c *telnet.Connection, body []byte) {
+	name, data := splitGMCP(body)
+	switch name {
+	case GMCPCoreHello:
+		var hello CoreHello
+		if json.Unmarshal(data, &hello) == nil {
+			h.mu.Lock()
+			h.hello = hello
+			h.mu.Unlock()
+		}
+		return
+	case GMCPCoreSupportsSet, GMCPCoreSupportsAdd, GMCPCoreSupportsRemove:
+		var packages CoreSupports
+		if json.Unmarshal(data, &packages) == nil {
+			h.updateSupports(name, packages)
+			if h.store != nil && name != GMCPCoreSupportsRemove {
+				h.store.supportsChanged(c, h)
+			}
+		}
+		return
+	}
+	if h.OnMessage != nil {
+		h.OnMessage(c, name, data)
+	}
+}
+
+// updateSupports applies a Core.Supports message.
+func (h *GMCPHandler) updateSupports(name string, packages CoreSupports) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if name == GMCPCoreSupportsSet || h.supports == nil {
+		h.supports = make(map[string]int)
+	}
+	for _, p := range packages {
+		pkg, version, _ := strings.Cut(strings.TrimSpace(p), " ")
+		if name == GMCPCoreSupportsRemove {
+			delete(h.supports, pkg)
+			continue
+		}
+		v, _ := strconv.Atoi(version)
+		h.supports[pkg] = v
+	}
+}
+
+// Hello returns what the client said of itself with Core.Hello.
+func (h *GMCPHandler) Hello() CoreHello {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hello
+}
+
+// Supports reports whether the client supports the package of the message
+// named name: for Char.Vitals, whether it has said it supports Char.Vitals or
+// Char. Core messages are always supported.
+func (h *GMCPHandler) Supports(name string) bool {
+	if name == "Core" || strings.HasPrefix(name, "Core.") {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for {
+		if _, ok := h.supports[name]; ok {
+			return true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// Send sends the message named name, with v as its data, if the client has
+// agreed to GMCP and supports the message's package.
+func (h *GMCPHandler) Send(c *telnet.Connection, name string, v interface{}) error {
+	if !c.LocalEnabled(TeloptGMCP) {
+		return ErrGMCPDisabled
+	}
+	if !h.Supports(name) {
+		return ErrGMCPUnsupported
+	}
+	return SendGMCP(c, name, v)
+}
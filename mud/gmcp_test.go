@@ -0,0 +1,124 @@
+package mud_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// gmcp returns a GMCP subnegotiation carrying message.
+func gmcp(message string) []byte {
+	b := append([]byte{telnet.IAC, telnet.SB, mud.TeloptGMCP}, message...)
+	return append(b, telnet.IAC, telnet.SE)
+}
+
+func TestEncodeDecodeGMCP(t *testing.T) {
+	body, err := mud.EncodeGMCP(mud.GMCPRoomInfo, mud.RoomInfo{Num: 7, Name: "Hall", Exits: map[string]int{"n": 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `Room.Info {"num":7,"name":"Hall","exits":{"n":8}}`; string(body) != want {
+		t.Errorf("EncodeGMCP = %q, want %q", body, want)
+	}
+	name, data := mud.DecodeGMCP(body)
+	var room mud.RoomInfo
+	if err := json.Unmarshal(data, &room); err != nil {
+		t.Fatal(err)
+	}
+	if name != mud.GMCPRoomInfo || room.Num != 7 || room.Exits["n"] != 8 {
+		t.Errorf("DecodeGMCP = %q, %+v", name, room)
+	}
+	if body, _ := mud.EncodeGMCP("Core.Ping", nil); string(body) != "Core.Ping" {
+		t.Errorf("EncodeGMCP without data = %q", body)
+	}
+}
+
+func TestGMCPCodec(t *testing.T) {
+	codec := telnet.LookupCodec(mud.TeloptGMCP)
+	v, err := codec.Decode([]byte(`Char.Vitals {"hp":10}`))
+	m, ok := v.(mud.GMCPMessage)
+	if err != nil || !ok || m.Name != mud.GMCPCharVitals || string(m.Data) != `{"hp":10}` {
+		t.Errorf("Decode = %#v, %v", v, err)
+	}
+	if _, err := codec.Decode([]byte("Char.Vitals {")); err == nil {
+		t.Error("Decode of malformed data: got no error")
+	}
+	body, err := codec.Encode(mud.GMCPMessage{Name: "Core.Ping"})
+	if err != nil || string(body) != "Core.Ping" {
+		t.Errorf("Encode = %q, %v", body, err)
+	}
+}
+
+func TestGMCPHandler(t *testing.T) {
+	peer, conn := telnettest.NewPeer(mud.GMCPOption)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	h := mud.GMCPFor(conn)
+	var messages []string
+	h.OnMessage = func(c *telnet.Connection, name string, data []byte) {
+		messages = append(messages, name+" "+string(data))
+	}
+
+	vitals := mud.CharVitals{HP: 10, MaxHP: 20}
+	if err := h.Send(conn, mud.GMCPCharVitals, vitals); !errors.Is(err, mud.ErrGMCPDisabled) {
+		t.Errorf("Send before negotiation = %v, want ErrGMCPDisabled", err)
+	}
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptGMCP),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptGMCP),
+		telnettest.Send(gmcp(`Core.Hello {"client":"Mudlet","version":"4.17"}`)...),
+		telnettest.Send(gmcp(`Core.Supports.Set ["Char 1", "Room 1", "Comm.Channel 1"]`)...),
+		telnettest.Send(gmcp(`Core.Supports.Remove ["Room"]`)...),
+		telnettest.Send(gmcp(`Char.Login {"name":"bob"}`)...),
+		// The refused DO 200 shows when the messages have been handled.
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+
+	if hello := h.Hello(); hello != (mud.CoreHello{Client: "Mudlet", Version: "4.17"}) {
+		t.Errorf("Hello = %+v", hello)
+	}
+	for name, want := range map[string]bool{
+		mud.GMCPCharVitals:      true,
+		mud.GMCPCommChannelText: true,
+		"Comm.Other":            false,
+		mud.GMCPRoomInfo:        false,
+		"Core.Ping":             true,
+	} {
+		if got := h.Supports(name); got != want {
+			t.Errorf("Supports(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if want := []string{`Char.Login {"name":"bob"}`}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("OnMessage got %q, want %q", messages, want)
+	}
+
+	if err := h.Send(conn, mud.GMCPRoomInfo, mud.RoomInfo{}); !errors.Is(err, mud.ErrGMCPUnsupported) {
+		t.Errorf("Send of unsupported package = %v, want ErrGMCPUnsupported", err)
+	}
+	if err := h.Send(conn, mud.GMCPCharVitals, vitals); err != nil {
+		t.Fatal(err)
+	}
+	peer.Run(t, telnettest.Expect(gmcp(`Char.Vitals {"hp":10,"maxhp":20,"mp":0,"maxmp":0}`)...))
+
+	// Disabled and asked for again, GMCP is agreed to again.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DONT, mud.TeloptGMCP),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	if err := h.Send(conn, mud.GMCPCharVitals, vitals); !errors.Is(err, mud.ErrGMCPDisabled) {
+		t.Errorf("Send once disabled = %v, want ErrGMCPDisabled", err)
+	}
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptGMCP),
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptGMCP),
+	)
+}
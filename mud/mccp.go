@@ -0,0 +1,569 @@
+package mud
+
+import (
+	"bufio"
+	"compress/zlib"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// Defaults for MCCPAdaptive.
+const (
+	// DefaultMCCPWindow is the output over which compression is judged.
+	DefaultMCCPWindow = 64 * 1024
+	// DefaultMCCPMinRatio is the lowest compression ratio worth keeping.
+	DefaultMCCPMinRatio = 2.0
+)
+
+// MCCP configures MUD Client Compression for a server: MCCP2 compresses the
+// server's output, and MCCP3 the client's input.
+//
+//	mccp := &mud.MCCP{Adaptive: &mud.MCCPAdaptive{MaxCost: time.Millisecond}}
+//	s := telnet.NewServer(":4000", h, mccp.MCCP2Option, mccp.MCCP3Option)
+type MCCP struct {
+	// Level is the zlib compression level of the output, from
+	// zlib.BestSpeed to zlib.BestCompression. If zero,
+	// zlib.DefaultCompression is used.
+	Level int
+	// Adaptive, if set, lowers the level, and at last stops compressing,
+	// on Connections where compression does not pay for itself.
+	Adaptive *MCCPAdaptive
+}
+
+// MCCPAdaptive decides when compressing a Connection's output is not worth
+// its cost. Compression is judged after each Window of output: if it was poor,
+// the level is halved, down to zlib.BestSpeed, after which compression ends.
+// Each change ends the compressed stream and, unless compression is ending,
+// starts a new one, as MCCP2 allows.
+type MCCPAdaptive struct {
+	// Window is the output, before compression, over which compression is
+	// judged. If zero, DefaultMCCPWindow is used.
+	Window int
+	// MinRatio is the lowest ratio of output before compression to output
+	// after it that is worth keeping. If zero, DefaultMCCPMinRatio is used.
+	MinRatio float64
+	// MaxCost, if positive, is the most time compression may take per KiB
+	// of output.
+	MaxCost time.Duration
+	// Constrained, if set, reports whether the server is short of CPU, as
+	// when its load is high; compression is then judged poor at the end of
+	// each window.
+	Constrained func() bool
+}
+
+// CompressionStats describes the compression of one direction of a
+// Connection.
+type CompressionStats struct {
+	// Active reports whether the data is being compressed now.
+	Active bool
+	// Level is the zlib level of the output, or 0 for the input.
+	Level int
+	// Raw is the data before compression, and Compressed after, in bytes.
+	Raw        int64
+	Compressed int64
+	// Time is the time spent compressing or decompressing.
+	Time time.Duration
+}
+
+// Ratio returns the ratio of Raw to Compressed, or 0 if nothing has been
+// compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.Compressed == 0 {
+		return 0
+	}
+	return float64(s.Raw) / float64(s.Compressed)
+}
+
+// MCCP2Option offers MCCP2 with the default level.
+func MCCP2Option(c *telnet.Connection) telnet.Negotiator {
+	return (&MCCP{}).MCCP2Option(c)
+}
+
+// MCCP3Option offers MCCP3.
+func MCCP3Option(c *telnet.Connection) telnet.Negotiator {
+	return (&MCCP{}).MCCP3Option(c)
+}
+
+// MCCPStats returns the statistics of c's compressed output, under MCCP2, and
+// input, under MCCP3.
+func MCCPStats(c *telnet.Connection) (out, in CompressionStats) {
+	if h, ok := c.OptionHandlers[TeloptMCCP2].(*MCCP2Handler); ok {
+		out = h.Stats()
+	}
+	if h, ok := c.OptionHandlers[TeloptMCCP3].(*MCCP3Handler); ok {
+		in = h.Stats()
+	}
+	return out, in
+}
+
+// MCCP2Option is a telnet.Option offering MCCP2, compressing the server's
+// output once the client agrees.
+func (m *MCCP) MCCP2Option(c *telnet.Connection) telnet.Negotiator {
+	return &MCCP2Handler{config: m}
+}
+
+// MCCP3Option is a telnet.Option offering MCCP3, decompressing the client's
+// input once the client starts compressing it.
+func (m *MCCP) MCCP3Option(c *telnet.Connection) telnet.Negotiator {
+	return &MCCP3Handler{}
+}
+
+// MCCP2Handler negotiates MCCP2 for a server.
+type MCCP2Handler struct {
+	config *MCCP
+
+	mu       sync.Mutex
+	sentWill bool
+	started  bool
+	stats    CompressionStats
+}
+
+// OptionCode returns the IAC code for MCCP2.
+func (h *MCCP2Handler) OptionCode() byte {
+	return TeloptMCCP2
+}
+
+// Offer offers to compress the output.
+func (h *MCCP2Handler) Offer(c *telnet.Connection) {
+	h.mu.Lock()
+	h.sentWill = true
+	h.mu.Unlock()
+	c.WriteCommand(telnet.WILL, TeloptMCCP2)
+}
+
+// HandleDo starts compressing the output, agreeing to it first unless it
+// answers our offer.
+func (h *MCCP2Handler) HandleDo(c *telnet.Connection) {
+	h.mu.Lock()
+	sentWill, started := h.sentWill, h.started
+	h.sentWill, h.started = false, true
+	h.mu.Unlock()
+	if started {
+		return
+	}
+	if !sentWill {
+		c.WriteCommand(telnet.WILL, TeloptMCCP2)
+	}
+	c.SetLocalEnabled(TeloptMCCP2, true)
+	c.AddWriteTransform(telnet.StageCompression, mccp2Transform{h, c})
+}
+
+// HandleRefused ends the compressed stream if the client disables MCCP2, and
+// forgets our offer, so that the client asking for MCCP2 later starts a new
+// one.
+func (h *MCCP2Handler) HandleRefused(c *telnet.Connection, local bool) {
+	if !local {
+		return
+	}
+	h.mu.Lock()
+	started := h.started
+	h.sentWill, h.started = false, false
+	h.mu.Unlock()
+	if started {
+		c.RemoveTransform(mccp2Transform{h, c})
+	}
+}
+
+// HandleWill refuses MCCP2 from the client, which only servers send.
+func (h *MCCP2Handler) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, TeloptMCCP2)
+}
+
+// HandleSB ignores subnegotiation from the client.
+func (h *MCCP2Handler) HandleSB(c *telnet.Connection, body []byte) {}
+
+// Stats returns the statistics of the compressed output.
+func (h *MCCP2Handler) Stats() CompressionStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// level returns the configured zlib level.
+func (h *MCCP2Handler) level() int {
+	level := h.config.Level
+	if level == 0 || level < zlib.HuffmanOnly || level > zlib.BestCompression {
+		level = zlib.DefaultCompression
+	}
+	return level
+}
+
+// mccp2Transform compresses the output of an MCCP2Handler's Connection.
+type mccp2Transform struct {
+	h *MCCP2Handler
+	c *telnet.Connection
+}
+
+func (t mccp2Transform) NewReader(r io.Reader) io.Reader { return r }
+
+func (t mccp2Transform) NewWriter(w io.Writer) io.Writer {
+	mw := &mccp2Writer{h: t.h, below: w, level: t.h.level()}
+	go mw.release(t.c)
+	return mw
+}
+
+// mccp2Writer compresses the output, starting a compressed stream before its
+// first write, and adapting its level as the MCCP configures.
+type mccp2Writer struct {
+	h     *MCCP2Handler
+	below io.Writer
+
+	mu    sync.Mutex   // held while in use, so that release waits
+	zw    *zlib.Writer // nil if not compressing
+	level int
+	ended bool // compression has been given up
+
+	// The current window
+	raw, compressed int64
+	elapsed         time.Duration
+
+	waited time.Duration // writing the compressed output, not compressing
+}
+
+// mccp2Start announces the start of a compressed stream.
+var mccp2Start = []byte{telnet.IAC, telnet.SB, TeloptMCCP2, telnet.IAC, telnet.SE}
+
+func (w *mccp2Writer) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ended {
+		return w.below.Write(b)
+	}
+	if w.zw == nil {
+		if _, err := w.below.Write(mccp2Start); err != nil {
+			return 0, err
+		}
+		w.zw = getZlibWriter(countingWriter{w}, w.level)
+		w.h.mu.Lock()
+		w.h.stats.Active, w.h.stats.Level = true, w.level
+		w.h.mu.Unlock()
+	}
+	start, waited := time.Now(), w.waited
+	n, err := w.zw.Write(b)
+	w.account(int64(n), time.Since(start)-(w.waited-waited))
+	return n, err
+}
+
+// Flush ends the compressed output of each write to the Connection, then
+// judges the window if it is over.
+func (w *mccp2Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.zw == nil {
+		return nil
+	}
+	start, waited := time.Now(), w.waited
+	err := w.zw.Flush()
+	w.account(0, time.Since(start)-(w.waited-waited))
+	if err == nil {
+		err = w.adapt()
+	}
+	return err
+}
+
+// Close ends the compressed stream.
+func (w *mccp2Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.end(true)
+}
+
+// release returns the zlib writer to the pool once c is closed, without
+// ending the stream, as nothing more can be written.
+func (w *mccp2Writer) release(c *telnet.Connection) {
+	<-c.Closed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.zw != nil {
+		putZlibWriter(w.zw, w.level)
+		w.zw = nil
+	}
+	w.ended = true
+}
+
+// end ends the current compressed stream, and compression altogether if
+// final is set.
+func (w *mccp2Writer) end(final bool) error {
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+		putZlibWriter(w.zw, w.level)
+		w.zw = nil
+	}
+	w.ended = w.ended || final
+	w.h.mu.Lock()
+	w.h.stats.Active = false
+	w.h.mu.Unlock()
+	return err
+}
+
+// account records compressing n bytes in d.
+func (w *mccp2Writer) account(n int64, d time.Duration) {
+	w.raw += n
+	w.elapsed += d
+	w.h.mu.Lock()
+	w.h.stats.Raw += n
+	w.h.stats.Time += d
+	w.h.mu.Unlock()
+}
+
+// adapt lowers the level if compression was poor over a window that is over.
+func (w *mccp2Writer) adapt() error {
+	a := w.h.config.Adaptive
+	if a == nil {
+		return nil
+	}
+	window := a.Window
+	if window <= 0 {
+		window = DefaultMCCPWindow
+	}
+	if w.raw < int64(window) {
+		return nil
+	}
+	minRatio := a.MinRatio
+	if minRatio <= 0 {
+		minRatio = DefaultMCCPMinRatio
+	}
+	poor := float64(w.raw) < minRatio*float64(w.compressed) ||
+		a.MaxCost > 0 && w.elapsed*1024/time.Duration(w.raw) > a.MaxCost ||
+		a.Constrained != nil && a.Constrained()
+	w.raw, w.compressed, w.elapsed = 0, 0, 0
+	if !poor {
+		return nil
+	}
+	level := w.level
+	if level == zlib.DefaultCompression {
+		level = 6
+	}
+	if level <= zlib.BestSpeed {
+		return w.end(true)
+	}
+	err := w.end(false)
+	w.level = max(level/2, zlib.BestSpeed)
+	return err
+}
+
+// countingWriter counts the compressed output of an mccp2Writer.
+type countingWriter struct{ w *mccp2Writer }
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.w.below.Write(b)
+	c.w.waited += time.Since(start)
+	c.w.compressed += int64(n)
+	c.w.h.mu.Lock()
+	c.w.h.stats.Compressed += int64(n)
+	c.w.h.mu.Unlock()
+	return n, err
+}
+
+// MCCP3Handler negotiates MCCP3 for a server.
+type MCCP3Handler struct {
+	mu       sync.Mutex
+	sentWill bool
+	stats    CompressionStats
+}
+
+// OptionCode returns the IAC code for MCCP3.
+func (h *MCCP3Handler) OptionCode() byte {
+	return TeloptMCCP3
+}
+
+// Offer offers to decompress the client's input.
+func (h *MCCP3Handler) Offer(c *telnet.Connection) {
+	h.mu.Lock()
+	h.sentWill = true
+	h.mu.Unlock()
+	c.WriteCommand(telnet.WILL, TeloptMCCP3)
+}
+
+// HandleDo enables MCCP3, agreeing to it first unless it answers our offer;
+// the client starts compressing with a subnegotiation.
+func (h *MCCP3Handler) HandleDo(c *telnet.Connection) {
+	if c.LocalEnabled(TeloptMCCP3) {
+		return
+	}
+	h.mu.Lock()
+	sentWill := h.sentWill
+	h.sentWill = false
+	h.mu.Unlock()
+	if !sentWill {
+		c.WriteCommand(telnet.WILL, TeloptMCCP3)
+	}
+	c.SetLocalEnabled(TeloptMCCP3, true)
+}
+
+// HandleRefused forgets our offer, so that the client asking for MCCP3 later
+// is agreed to. A compressed stream the client has started, it ends in-band.
+func (h *MCCP3Handler) HandleRefused(c *telnet.Connection, local bool) {
+	if local {
+		h.mu.Lock()
+		h.sentWill = false
+		h.mu.Unlock()
+	}
+}
+
+// HandleWill refuses MCCP3 from the client, which only servers send.
+func (h *MCCP3Handler) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, TeloptMCCP3)
+}
+
+// HandleSB is not called, as HandleSBInline is.
+func (h *MCCP3Handler) HandleSB(c *telnet.Connection, body []byte) {}
+
+// HandleSBInline starts decompressing the input that follows.
+func (h *MCCP3Handler) HandleSBInline(c *telnet.Connection, body []byte) {
+	h.mu.Lock()
+	h.stats.Active = true
+	h.mu.Unlock()
+	c.AddTransform(telnet.StageCompression, mccp3Transform{h, c})
+}
+
+// Stats returns the statistics of the compressed input.
+func (h *MCCP3Handler) Stats() CompressionStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// mccp3Transform decompresses the input of an MCCP3Handler's Connection.
+type mccp3Transform struct {
+	h *MCCP3Handler
+	c *telnet.Connection
+}
+
+func (t mccp3Transform) NewReader(r io.Reader) io.Reader {
+	// AddTransform reads the stages beneath through a bufio.Reader.
+	mr := &mccp3Reader{h: t.h, r: &countingReader{r: r.(*bufio.Reader)}}
+	go mr.release(t.c)
+	return mr
+}
+
+func (t mccp3Transform) NewWriter(w io.Writer) io.Writer { return w }
+
+// mccp3Reader decompresses the input, reading the zlib header on its first
+// Read so that adding it does not block.
+type mccp3Reader struct {
+	h *MCCP3Handler
+	r *countingReader
+
+	mu   sync.Mutex // held while in use, so that release waits
+	zr   io.ReadCloser
+	done bool // the stream has ended
+}
+
+func (m *mccp3Reader) Read(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return 0, io.EOF
+	}
+	start, read, waited := time.Now(), m.r.n, m.r.waited
+	var (
+		n   int
+		err error
+	)
+	if m.zr == nil {
+		m.zr, err = getZlibReader(m.r)
+	}
+	if err == nil {
+		n, err = m.zr.Read(b)
+		if err == io.EOF {
+			m.done = true
+			m.zr.Close()
+			zlibReaders.Put(m.zr)
+			m.zr = nil
+		}
+	}
+	m.h.mu.Lock()
+	m.h.stats.Raw += int64(n)
+	m.h.stats.Compressed += m.r.n - read
+	m.h.stats.Time += time.Since(start) - (m.r.waited - waited)
+	if err != nil {
+		m.h.stats.Active = false
+	}
+	m.h.mu.Unlock()
+	return n, err
+}
+
+// release returns the zlib reader to the pool once c is closed.
+func (m *mccp3Reader) release(c *telnet.Connection) {
+	<-c.Closed()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.zr != nil {
+		zlibReaders.Put(m.zr)
+		m.zr = nil
+	}
+	m.done = true
+}
+
+// countingReader counts the compressed input, and the time spent waiting for
+// it. As an io.ByteReader, it keeps the decompressor from reading past the end
+// of the compressed stream.
+type countingReader struct {
+	r      *bufio.Reader
+	n      int64
+	waited time.Duration
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.r.Read(b)
+	c.waited += time.Since(start)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	if c.r.Buffered() == 0 {
+		start := time.Now()
+		defer func() { c.waited += time.Since(start) }()
+	}
+	ch, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return ch, err
+}
+
+// zlibWriters pools zlib writers by level, and zlibReaders pools zlib readers,
+// so that Connections starting compression reuse the compressor state of
+// those that have finished, which is several hundred KiB for a writer.
+var (
+	zlibWriters [zlib.BestCompression - zlib.HuffmanOnly + 1]sync.Pool
+	zlibReaders sync.Pool
+)
+
+// getZlibWriter returns a zlib writer at level writing to w.
+func getZlibWriter(w io.Writer, level int) *zlib.Writer {
+	if zw, ok := zlibWriters[level-zlib.HuffmanOnly].Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+	zw, _ := zlib.NewWriterLevel(w, level)
+	return zw
+}
+
+// putZlibWriter returns a closed zlib writer at level to the pool.
+func putZlibWriter(zw *zlib.Writer, level int) {
+	zw.Reset(nil)
+	zlibWriters[level-zlib.HuffmanOnly].Put(zw)
+}
+
+// getZlibReader returns a zlib reader reading from r, having read the zlib
+// header.
+func getZlibReader(r io.Reader) (io.ReadCloser, error) {
+	zr, ok := zlibReaders.Get().(io.ReadCloser)
+	if !ok {
+		return zlib.NewReader(r)
+	}
+	if err := zr.(zlib.Resetter).Reset(r, nil); err != nil {
+		zlibReaders.Put(zr)
+		return nil, err
+	}
+	return zr, nil
+}
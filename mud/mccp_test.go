@@ -0,0 +1,208 @@
+package mud_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+var mccp2Start = []byte{telnet.IAC, telnet.SB, mud.TeloptMCCP2, telnet.IAC, telnet.SE}
+
+// expectStream reads the start of a compressed stream from r, then expects
+// the stream to hold want.
+func expectStream(t *testing.T, r *bufio.Reader, want string) io.ReadCloser {
+	t.Helper()
+	start := make([]byte, len(mccp2Start))
+	if _, err := io.ReadFull(r, start); err != nil || !bytes.Equal(start, mccp2Start) {
+		t.Fatalf("read %s, %v; want %s", telnettest.Describe(start), err, telnettest.Describe(mccp2Start))
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCompressed(t, zr, want)
+	return zr
+}
+
+// expectCompressed expects the next output from zr to be want.
+func expectCompressed(t *testing.T, zr io.Reader, want string) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(zr, got); err != nil || string(got) != want {
+		t.Fatalf("decompressed %q, %v; want %q", got, err, want)
+	}
+}
+
+// expectEnd expects the compressed stream read by zr to end.
+func expectEnd(t *testing.T, zr io.Reader) {
+	t.Helper()
+	if n, err := zr.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("stream not ended: read %d bytes, %v", n, err)
+	}
+}
+
+func TestMCCP2(t *testing.T) {
+	peer, conn := telnettest.NewPeer(mud.MCCP2Option)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+	)
+	r := bufio.NewReader(peer)
+	zr := expectStream(t, r, string([]byte{telnet.IAC, telnet.WONT, 200}))
+	conn.Write([]byte("hello, hello, hello\n"))
+	expectCompressed(t, zr, "hello, hello, hello\r\n")
+
+	out, _ := mud.MCCPStats(conn)
+	if !out.Active || out.Level != zlib.DefaultCompression || out.Raw != 24 || out.Compressed == 0 {
+		t.Errorf("stats = %+v", out)
+	}
+}
+
+func TestMCCP2_Adaptive(t *testing.T) {
+	mccp := &mud.MCCP{Adaptive: &mud.MCCPAdaptive{
+		Window:      16,
+		Constrained: func() bool { return true },
+	}}
+	peer, conn := telnettest.NewPeer(mccp.MCCP2Option)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+	)
+	r := bufio.NewReader(peer)
+	zr := expectStream(t, r, string([]byte{telnet.IAC, telnet.WONT, 200}))
+
+	// Each window ends the stream, the level falling from 6 to 3 to 1, then
+	// compression ends.
+	const line = "0123456789abcdef\n"
+	conn.Write([]byte(line))
+	expectCompressed(t, zr, "0123456789abcdef\r\n")
+	expectEnd(t, zr)
+	for _, level := range []int{3, 1} {
+		conn.Write([]byte(line))
+		zr := expectStream(t, r, "0123456789abcdef\r\n")
+		expectEnd(t, zr)
+		if out, _ := mud.MCCPStats(conn); out.Level != level {
+			t.Errorf("level = %d, want %d", out.Level, level)
+		}
+	}
+	conn.Write([]byte("plain\n"))
+	got, err := r.ReadString('\n')
+	if err != nil || got != "plain\r\n" {
+		t.Errorf("after compression ended, read %q, %v", got, err)
+	}
+	if out, _ := mud.MCCPStats(conn); out.Active {
+		t.Errorf("stats = %+v, want inactive", out)
+	}
+}
+
+func TestMCCP2_Disabled(t *testing.T) {
+	peer, conn := telnettest.NewPeer(mud.MCCP2Option)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+	)
+	r := bufio.NewReader(peer)
+	zr := expectStream(t, r, string([]byte{telnet.IAC, telnet.WONT, 200}))
+
+	// Disabled, compression ends.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DONT, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+	)
+	expectEnd(t, zr)
+	if got, err := r.Peek(3); err != nil || !bytes.Equal(got, []byte{telnet.IAC, telnet.WONT, 200}) {
+		t.Fatalf("after compression ended, read %s, %v", telnettest.Describe(got), err)
+	}
+	r.Discard(3)
+	if out, _ := mud.MCCPStats(conn); out.Active || conn.LocalEnabled(mud.TeloptMCCP2) {
+		t.Errorf("stats = %+v, want inactive", out)
+	}
+
+	// Asked again, it is agreed to and starts again.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP2),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+	)
+	if got, err := r.Peek(3); err != nil || !bytes.Equal(got, []byte{telnet.IAC, telnet.WILL, mud.TeloptMCCP2}) {
+		t.Fatalf("read %s, %v; want IAC WILL MCCP2", telnettest.Describe(got), err)
+	}
+	r.Discard(3)
+	zr = expectStream(t, r, string([]byte{telnet.IAC, telnet.WONT, 200}))
+	conn.Write([]byte("again\n"))
+	expectCompressed(t, zr, "again\r\n")
+}
+
+func TestMCCP3(t *testing.T) {
+	peer, conn := telnettest.NewPeer(mud.MCCP3Option)
+	defer peer.Close()
+	defer conn.Close()
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("hello, hello, hello\r\n"))
+	zw.Close()
+	go func() {
+		peer.Run(t,
+			telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP3),
+			telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP3),
+			telnettest.Send(telnet.IAC, telnet.SB, mud.TeloptMCCP3, telnet.IAC, telnet.SE),
+			telnettest.Send(compressed.Bytes()...),
+			telnettest.Send([]byte("plain\r\n")...),
+		)
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"hello, hello, hello\n", "plain\n"} {
+		if got, err := r.ReadString('\n'); err != nil || got != want {
+			t.Fatalf("read %q, %v; want %q", got, err, want)
+		}
+	}
+	_, in := mud.MCCPStats(conn)
+	if in.Active || in.Raw != 21 || in.Compressed != int64(compressed.Len()) {
+		t.Errorf("stats = %+v, compressed %d bytes", in, compressed.Len())
+	}
+}
+
+// BenchmarkMCCP2_Connect measures starting compression on a new Connection,
+// whose compressor is reused from Connections that have closed.
+func BenchmarkMCCP2_Connect(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		peer, conn := telnettest.NewPeer(mud.MCCP2Option)
+		go io.Copy(io.Discard, conn)
+		peer.Run(b,
+			telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP2),
+			telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMCCP2),
+			telnettest.Send(telnet.IAC, telnet.DO, 200),
+			telnettest.Expect(mccp2Start...),
+		)
+		conn.Close()
+		peer.Close()
+	}
+}
@@ -0,0 +1,188 @@
+package mud
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/tester2024/telnet"
+)
+
+func init() {
+	telnet.RegisterCodec(TeloptMSDP, msdpCodec{})
+}
+
+// ErrMalformedMSDP is returned by DecodeMSDP for a body that is not valid MSDP.
+var ErrMalformedMSDP = errors.New("mud: malformed MSDP")
+
+// DecodeMSDP decodes the body of an MSDP subnegotiation into its variables.
+// Values are decoded as a string, a []interface{} for an array, or a
+// map[string]interface{} for a table, as encoding/json decodes into an
+// interface{}. A variable followed by more than one value is decoded as an
+// array.
+func DecodeMSDP(body []byte) (map[string]interface{}, error) {
+	d := msdpDecoder{b: body}
+	vars, err := d.table(-1)
+	if err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// msdpDecoder decodes an MSDP body by recursive descent.
+type msdpDecoder struct {
+	b []byte
+	i int
+}
+
+// table decodes variables up to the given closing delimiter, or to the end of
+// the body if end is negative.
+func (d *msdpDecoder) table(end int) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	for {
+		if d.i == len(d.b) {
+			if end >= 0 {
+				return nil, ErrMalformedMSDP
+			}
+			return vars, nil
+		}
+		if int(d.b[d.i]) == end {
+			d.i++
+			return vars, nil
+		}
+		if d.b[d.i] != MSDPVar {
+			return nil, ErrMalformedMSDP
+		}
+		d.i++
+		name := d.text()
+		var vals []interface{}
+		for d.i < len(d.b) && d.b[d.i] == MSDPVal {
+			d.i++
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		switch len(vals) {
+		case 0:
+			vars[name] = ""
+		case 1:
+			vars[name] = vals[0]
+		default:
+			vars[name] = vals
+		}
+	}
+}
+
+// value decodes the value following MSDP_VAL.
+func (d *msdpDecoder) value() (interface{}, error) {
+	if d.i == len(d.b) {
+		return "", nil
+	}
+	switch d.b[d.i] {
+	case MSDPTableOpen:
+		d.i++
+		return d.table(int(MSDPTableClose))
+	case MSDPArrayOpen:
+		d.i++
+		vals := []interface{}{}
+		for d.i < len(d.b) && d.b[d.i] == MSDPVal {
+			d.i++
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		if d.i == len(d.b) || d.b[d.i] != MSDPArrayClose {
+			return nil, ErrMalformedMSDP
+		}
+		d.i++
+		return vals, nil
+	}
+	return d.text(), nil
+}
+
+// text decodes a name or value up to the next delimiter.
+func (d *msdpDecoder) text() string {
+	start := d.i
+	for d.i < len(d.b) && (d.b[d.i] < MSDPVar || d.b[d.i] > MSDPArrayClose) {
+		d.i++
+	}
+	return string(d.b[start:d.i])
+}
+
+// EncodeMSDP encodes variables as the body of an MSDP subnegotiation, in order
+// of name. Values may be of the types DecodeMSDP returns, or booleans, numbers
+// and nil as encoding/json decodes them; a bool is sent as "1" or "0", and nil
+// as an empty value.
+func EncodeMSDP(vars map[string]interface{}) ([]byte, error) {
+	return appendMSDPTable(nil, vars)
+}
+
+func appendMSDPTable(b []byte, vars map[string]interface{}) ([]byte, error) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var err error
+		b = append(append(b, MSDPVar), name...)
+		if b, err = appendMSDPValue(append(b, MSDPVal), vars[name]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendMSDPValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return b, nil
+	case string:
+		return append(b, v...), nil
+	case bool:
+		if v {
+			return append(b, '1'), nil
+		}
+		return append(b, '0'), nil
+	case float64:
+		return strconv.AppendFloat(b, v, 'f', -1, 64), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case map[string]interface{}:
+		b, err := appendMSDPTable(append(b, MSDPTableOpen), v)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, MSDPTableClose), nil
+	case []interface{}:
+		b = append(b, MSDPArrayOpen)
+		for _, e := range v {
+			var err error
+			if b, err = appendMSDPValue(append(b, MSDPVal), e); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, MSDPArrayClose), nil
+	}
+	return nil, fmt.Errorf("mud: cannot encode %T as MSDP", v)
+}
+
+// msdpCodec is the telnet.Codec of MSDP, decoding bodies as DecodeMSDP does.
+type msdpCodec struct{}
+
+func (msdpCodec) Decode(body []byte) (any, error) {
+	return DecodeMSDP(body)
+}
+
+func (msdpCodec) Encode(v any) ([]byte, error) {
+	vars, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mud: cannot encode %T as MSDP", v)
+	}
+	return EncodeMSDP(vars)
+}
@@ -0,0 +1,49 @@
+package mud_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/tester2024/telnet/mud"
+)
+
+func TestMSDP(t *testing.T) {
+	body := []byte("\x01HEALTH\x02100\x01ROOM\x02\x03\x01VNUM\x026008\x01EXITS\x02\x05\x02n\x02s\x06\x04\x01LIST\x02a\x02b")
+	expected := map[string]interface{}{
+		"HEALTH": "100",
+		"ROOM": map[string]interface{}{
+			"VNUM":  "6008",
+			"EXITS": []interface{}{"n", "s"},
+		},
+		"LIST": []interface{}{"a", "b"},
+	}
+	vars, err := mud.DecodeMSDP(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected %v, got %v", expected, vars)
+	}
+
+	b, err := mud.EncodeMSDP(map[string]interface{}{"REPORT": "HEALTH", "ON": true, "N": 1.5, "ARR": []interface{}{"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("\x01ARR\x02\x05\x02x\x06\x01N\x021.5\x01ON\x021\x01REPORT\x02HEALTH")
+	if !bytes.Equal(b, want) {
+		t.Errorf("Expected %q, got %q", want, b)
+	}
+}
+
+func TestMSDP_Malformed(t *testing.T) {
+	for _, body := range []string{
+		"HEALTH\x02100",         // no VAR
+		"\x01ROOM\x02\x03\x01A", // unclosed table
+		"\x01A\x02\x05\x02b",    // unclosed array
+	} {
+		if _, err := mud.DecodeMSDP([]byte(body)); err != mud.ErrMalformedMSDP {
+			t.Errorf("%q: expected ErrMalformedMSDP, got %v", body, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Package mud implements telnet protocols used by MUD servers and clients, and
+// Translators that let a telnet.Proxy relay between clients and servers
+// supporting different generations of them.
+//
+// Importing the package registers these Translators:
+//
+//	msdp-gmcp  relays a server's MSDP to the client as GMCP
+//	mxp-strip  removes MXP markup for clients that refuse MXP
+package mud
+
+import "github.com/tester2024/telnet"
+
+// MUD protocol option codes, as defined by the telnet package.
+const (
+	TeloptMSDP  = telnet.TeloptMSDP  // MUD Server Data Protocol
+	TeloptMXP   = telnet.TeloptMXP   // MUD eXtension Protocol
+	TeloptGMCP  = telnet.TeloptGMCP  // Generic MUD Communication Protocol
+	TeloptMCCP2 = telnet.TeloptMCCP2 // MUD Client Compression Protocol, version 2
+	TeloptMCCP3 = telnet.TeloptMCCP3 // MUD Client Compression Protocol, version 3
+)
+
+// MSDP delimiters.
+const (
+	MSDPVar        = byte(1)
+	MSDPVal        = byte(2)
+	MSDPTableOpen  = byte(3)
+	MSDPTableClose = byte(4)
+	MSDPArrayOpen  = byte(5)
+	MSDPArrayClose = byte(6)
+)
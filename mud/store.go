@@ -0,0 +1,357 @@
+package mud
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/tester2024/telnet"
+)
+
+// Store holds the variables a server reports to its clients, such as a
+// character's health, publishing each change over MSDP and GMCP to the clients
+// that asked for it, so that a server keeps one set of data for both:
+//
+//	store := mud.NewStore()
+//	store.Define("HEALTH", mud.GMCPCharVitals, "hp")
+//	store.Define("HEALTH_MAX", mud.GMCPCharVitals, "maxhp")
+//	s := telnet.NewServer(":4000", h, store.MSDPOption, store.GMCPOption)
+//	...
+//	store.Update(map[string]interface{}{"HEALTH": 90, "HEALTH_MAX": 100})
+//
+// MSDP clients receive the variables they have asked for with REPORT, by
+// their MSDP names. GMCP clients receive, for each message a changed variable
+// belongs to, the message with every variable of it that has been set, if
+// they support its package. A Store is safe for concurrent use, though
+// changes made from different goroutines at once may reach clients in either
+// order.
+type Store struct {
+	mu       sync.Mutex
+	vars     map[string]*storeVar
+	sessions map[*telnet.Connection]*msdpSession
+	gmcp     map[*telnet.Connection]*GMCPHandler
+}
+
+// storeVar is a variable in a Store.
+type storeVar struct {
+	message string // GMCP message, or "" if not sent over GMCP
+	key     string // key in the GMCP message
+	value   interface{}
+	set     bool
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{
+		vars:     make(map[string]*storeVar),
+		sessions: make(map[*telnet.Connection]*msdpSession),
+		gmcp:     make(map[*telnet.Connection]*GMCPHandler),
+	}
+}
+
+// Define declares the variable with the MSDP name name, sent over GMCP as key
+// in the data of message. Variables set without being defined are sent over
+// MSDP only.
+func (s *Store) Define(name, message, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.variable(name)
+	v.message, v.key = message, key
+}
+
+// variable returns the variable named name, adding it if needed.
+func (s *Store) variable(name string) *storeVar {
+	v := s.vars[name]
+	if v == nil {
+		v = &storeVar{}
+		s.vars[name] = v
+	}
+	return v
+}
+
+// Get returns the value of the variable named name, and whether it has been
+// set.
+func (s *Store) Get(name string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.vars[name]
+	if v == nil {
+		return nil, false
+	}
+	return v.value, v.set
+}
+
+// Set sets the variable named name to value and publishes it. Values may be
+// of any type EncodeMSDP accepts.
+func (s *Store) Set(name string, value interface{}) {
+	s.Update(map[string]interface{}{name: value})
+}
+
+// Update sets several variables and publishes them, sending each client at
+// most one message over MSDP, and one per GMCP message changed.
+func (s *Store) Update(vars map[string]interface{}) {
+	s.mu.Lock()
+	names := make([]string, 0, len(vars))
+	for name, value := range vars {
+		v := s.variable(name)
+		v.value, v.set = value, true
+		names = append(names, name)
+	}
+	msdp := s.msdpReports(names)
+	gmcp := s.gmcpMessages(names)
+	s.mu.Unlock()
+	s.publish(msdp, gmcp)
+}
+
+// msdpReports returns, for each MSDP client, those of the named variables it
+// has asked to be reported.
+func (s *Store) msdpReports(names []string) map[*telnet.Connection]map[string]interface{} {
+	reports := make(map[*telnet.Connection]map[string]interface{})
+	for c, session := range s.sessions {
+		for _, name := range names {
+			if !session.reported[name] {
+				continue
+			}
+			if reports[c] == nil {
+				reports[c] = make(map[string]interface{})
+			}
+			reports[c][name] = s.vars[name].value
+		}
+	}
+	return reports
+}
+
+// gmcpMessages returns the data of the GMCP messages the named variables
+// belong to.
+func (s *Store) gmcpMessages(names []string) map[string]map[string]interface{} {
+	messages := make(map[string]map[string]interface{})
+	for _, name := range names {
+		if message := s.vars[name].message; message != "" {
+			messages[message] = nil
+		}
+	}
+	for _, v := range s.vars {
+		if _, ok := messages[v.message]; ok && v.set {
+			if messages[v.message] == nil {
+				messages[v.message] = make(map[string]interface{})
+			}
+			messages[v.message][v.key] = v.value
+		}
+	}
+	return messages
+}
+
+// publish sends the MSDP reports, and the GMCP messages to each client
+// supporting them.
+func (s *Store) publish(msdp map[*telnet.Connection]map[string]interface{}, gmcp map[string]map[string]interface{}) {
+	for c, vars := range msdp {
+		sendMSDP(c, vars)
+	}
+	if len(gmcp) == 0 {
+		return
+	}
+	s.mu.Lock()
+	handlers := make(map[*telnet.Connection]*GMCPHandler, len(s.gmcp))
+	for c, h := range s.gmcp {
+		handlers[c] = h
+	}
+	s.mu.Unlock()
+	for c, h := range handlers {
+		sendGMCPMessages(c, h, gmcp)
+	}
+}
+
+// sendGMCPMessages sends the messages the client supports, in order of name.
+func sendGMCPMessages(c *telnet.Connection, h *GMCPHandler, messages map[string]map[string]interface{}) {
+	names := make([]string, 0, len(messages))
+	for name := range messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if messages[name] != nil {
+			h.Send(c, name, messages[name])
+		}
+	}
+}
+
+// sendMSDP sends vars to an MSDP client, if it has agreed to MSDP.
+func sendMSDP(c *telnet.Connection, vars map[string]interface{}) {
+	if !c.LocalEnabled(TeloptMSDP) {
+		return
+	}
+	if body, err := EncodeMSDP(vars); err == nil {
+		c.WriteSubnegotiation(TeloptMSDP, body)
+	}
+}
+
+// GMCPOption is a telnet.Option offering GMCP to clients, sending them the
+// Store's variables for the packages they support. Those already set are sent
+// when the client says it supports their package.
+func (s *Store) GMCPOption(c *telnet.Connection) telnet.Negotiator {
+	h := &GMCPHandler{store: s}
+	s.mu.Lock()
+	s.gmcp[c] = h
+	s.mu.Unlock()
+	go s.forget(c)
+	return h
+}
+
+// supportsChanged sends a GMCP client every message with variables set, once
+// it has said which packages it supports.
+func (s *Store) supportsChanged(c *telnet.Connection, h *GMCPHandler) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.vars))
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	messages := s.gmcpMessages(names)
+	s.mu.Unlock()
+	sendGMCPMessages(c, h, messages)
+}
+
+// MSDPOption is a telnet.Option offering MSDP to clients, and answering their
+// LIST, REPORT, UNREPORT, RESET and SEND commands from the Store.
+func (s *Store) MSDPOption(c *telnet.Connection) telnet.Negotiator {
+	session := &msdpSession{store: s, reported: make(map[string]bool)}
+	s.mu.Lock()
+	s.sessions[c] = session
+	s.mu.Unlock()
+	go s.forget(c)
+	return session
+}
+
+// forget drops a Connection from the Store once it is closed.
+func (s *Store) forget(c *telnet.Connection) {
+	<-c.Closed()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, c)
+	delete(s.gmcp, c)
+}
+
+// msdpSession negotiates MSDP for a client of a Store.
+type msdpSession struct {
+	store    *Store
+	sentWill bool
+	reported map[string]bool // guarded by store.mu
+}
+
+func (m *msdpSession) OptionCode() byte {
+	return TeloptMSDP
+}
+
+func (m *msdpSession) Offer(c *telnet.Connection) {
+	m.sentWill = true
+	c.WriteCommand(telnet.WILL, TeloptMSDP)
+}
+
+func (m *msdpSession) HandleDo(c *telnet.Connection) {
+	if c.LocalEnabled(TeloptMSDP) {
+		return
+	}
+	if !m.sentWill {
+		c.WriteCommand(telnet.WILL, TeloptMSDP)
+	}
+	m.sentWill = false
+	c.SetLocalEnabled(TeloptMSDP, true)
+}
+
+// HandleRefused forgets our offer, so that the client asking for MSDP later
+// is agreed to.
+func (m *msdpSession) HandleRefused(c *telnet.Connection, local bool) {
+	if local {
+		m.sentWill = false
+	}
+}
+
+func (m *msdpSession) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, TeloptMSDP)
+}
+
+// HandleSB answers the client's commands.
+func (m *msdpSession) HandleSB(c *telnet.Connection, body []byte) {
+	commands, err := DecodeMSDP(body)
+	if err != nil {
+		return
+	}
+	s := m.store
+	reply := make(map[string]interface{})
+	s.mu.Lock()
+	for command, arg := range commands {
+		for _, name := range msdpStrings(arg) {
+			switch command {
+			case "LIST":
+				if list := s.msdpList(m, name); list != nil {
+					reply[name] = list
+				}
+			case "REPORT":
+				if v := s.vars[name]; v != nil {
+					m.reported[name] = true
+					if v.set {
+						reply[name] = v.value
+					}
+				}
+			case "UNREPORT":
+				delete(m.reported, name)
+			case "RESET":
+				if name == "REPORTABLE_VARIABLES" || name == "REPORTED_VARIABLES" {
+					m.reported = make(map[string]bool)
+				}
+			case "SEND":
+				if v := s.vars[name]; v != nil && v.set {
+					reply[name] = v.value
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+	if len(reply) > 0 {
+		sendMSDP(c, reply)
+	}
+}
+
+// msdpList returns the list the client asked for with LIST, or nil if there is
+// no such list.
+func (s *Store) msdpList(m *msdpSession, list string) []interface{} {
+	var names []string
+	switch list {
+	case "COMMANDS":
+		names = []string{"LIST", "REPORT", "RESET", "SEND", "UNREPORT"}
+	case "LISTS":
+		names = []string{"COMMANDS", "LISTS", "REPORTABLE_VARIABLES", "REPORTED_VARIABLES", "SENDABLE_VARIABLES"}
+	case "REPORTABLE_VARIABLES", "SENDABLE_VARIABLES":
+		for name := range s.vars {
+			names = append(names, name)
+		}
+	case "REPORTED_VARIABLES":
+		for name := range m.reported {
+			names = append(names, name)
+		}
+	default:
+		return nil
+	}
+	sort.Strings(names)
+	vals := make([]interface{}, len(names))
+	for i, name := range names {
+		vals[i] = name
+	}
+	return vals
+}
+
+// msdpStrings returns the strings in an MSDP value, which is a string or an
+// array of them.
+func msdpStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var s []string
+		for _, e := range v {
+			if e, ok := e.(string); ok {
+				s = append(s, e)
+			}
+		}
+		return s
+	}
+	return nil
+}
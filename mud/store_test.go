@@ -0,0 +1,75 @@
+package mud_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// msdp returns an MSDP subnegotiation carrying body.
+func msdp(body string) []byte {
+	b := append([]byte{telnet.IAC, telnet.SB, mud.TeloptMSDP}, body...)
+	return append(b, telnet.IAC, telnet.SE)
+}
+
+// handled sends a DO the Connection refuses, showing when what was sent before
+// it has been handled.
+var handled = []telnettest.Step{
+	telnettest.Send(telnet.IAC, telnet.DO, 200),
+	telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+}
+
+func TestStore(t *testing.T) {
+	store := mud.NewStore()
+	store.Define("HEALTH", mud.GMCPCharVitals, "hp")
+	store.Define("HEALTH_MAX", mud.GMCPCharVitals, "maxhp")
+	store.Define("ROOM_NAME", mud.GMCPRoomInfo, "name")
+	store.Set("HEALTH_MAX", 100)
+
+	msdpPeer, msdpConn := telnettest.NewPeer(store.MSDPOption)
+	defer msdpPeer.Close()
+	defer msdpConn.Close()
+	go io.Copy(io.Discard, msdpConn)
+	gmcpPeer, gmcpConn := telnettest.NewPeer(store.GMCPOption)
+	defer gmcpPeer.Close()
+	defer gmcpConn.Close()
+	go io.Copy(io.Discard, gmcpConn)
+
+	msdpPeer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMSDP),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptMSDP),
+		telnettest.Send(msdp("\x01REPORT\x02HEALTH\x02HEALTH_MAX")...),
+		telnettest.Expect(msdp("\x01HEALTH_MAX\x02100")...),
+		telnettest.Send(msdp("\x01LIST\x02REPORTED_VARIABLES")...),
+		telnettest.Expect(msdp("\x01REPORTED_VARIABLES\x02\x05\x02HEALTH\x02HEALTH_MAX\x06")...),
+	)
+	gmcpPeer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptGMCP),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptGMCP),
+		telnettest.Send(gmcp(`Core.Supports.Set ["Char 1"]`)...),
+		telnettest.Expect(gmcp(`Char.Vitals {"maxhp":100}`)...),
+	)
+	gmcpPeer.Run(t, handled...)
+
+	store.Update(map[string]interface{}{"HEALTH": 90, "ROOM_NAME": "Hall"})
+	msdpPeer.Run(t, telnettest.Expect(msdp("\x01HEALTH\x0290")...))
+	gmcpPeer.Run(t, telnettest.Expect(gmcp(`Char.Vitals {"hp":90,"maxhp":100}`)...))
+
+	msdpPeer.Run(t, telnettest.Send(msdp("\x01UNREPORT\x02HEALTH")...))
+	msdpPeer.Run(t, handled...)
+	store.Set("HEALTH", 80)
+	store.Set("HEALTH_MAX", 110)
+	msdpPeer.Run(t, telnettest.Expect(msdp("\x01HEALTH_MAX\x02110")...))
+	gmcpPeer.Run(t,
+		telnettest.Expect(gmcp(`Char.Vitals {"hp":80,"maxhp":100}`)...),
+		telnettest.Expect(gmcp(`Char.Vitals {"hp":80,"maxhp":110}`)...),
+	)
+
+	msdpPeer.Run(t,
+		telnettest.Send(msdp("\x01SEND\x02ROOM_NAME")...),
+		telnettest.Expect(msdp("\x01ROOM_NAME\x02Hall")...),
+	)
+}
@@ -0,0 +1,208 @@
+package mud
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"sync/atomic"
+
+	"github.com/tester2024/telnet"
+)
+
+func init() {
+	telnet.RegisterTranslator("msdp-gmcp", MSDPToGMCP)
+	telnet.RegisterTranslator("mxp-strip", StripMXP)
+}
+
+// MSDPToGMCP is a telnet.Translator relaying a server's MSDP to a client as
+// GMCP. Negotiation of MSDP is relayed as negotiation of GMCP, and each MSDP
+// subnegotiation is sent as a GMCP message named MSDP, whose data is a JSON
+// object of the variables it holds:
+//
+//	IAC SB MSDP VAR "HEALTH" VAL "100" IAC SE
+//	IAC SB GMCP 'MSDP {"HEALTH":"100"}' IAC SE
+//
+// Messages named MSDP from the client are sent back to the server in the same
+// way - for example, MSDP {"REPORT":"HEALTH"} - and other GMCP messages are
+// dropped, so it suits servers that do not support GMCP themselves.
+func MSDPToGMCP(p *telnet.Proxy) *telnet.ProxyFilter {
+	return &telnet.ProxyFilter{
+		Subnegotiation: func(dir telnet.ProxyDirection, option byte, body []byte) ([]byte, bool) {
+			switch {
+			case dir == telnet.ToClient && option == TeloptMSDP:
+				vars, err := DecodeMSDP(body)
+				if err != nil {
+					return nil, false
+				}
+				data, err := json.Marshal(vars)
+				if err != nil {
+					return nil, false
+				}
+				return append([]byte("MSDP "), data...), true
+			case dir == telnet.ToServer && option == TeloptGMCP:
+				name, data := splitGMCP(body)
+				if name != "MSDP" {
+					return nil, false
+				}
+				var vars map[string]interface{}
+				if err := json.Unmarshal(data, &vars); err != nil {
+					return nil, false
+				}
+				b, err := EncodeMSDP(vars)
+				if err != nil {
+					return nil, false
+				}
+				return b, true
+			}
+			return body, true
+		},
+		Option: func(dir telnet.ProxyDirection, option byte) byte {
+			switch {
+			case dir == telnet.ToClient && option == TeloptMSDP:
+				return TeloptGMCP
+			case dir == telnet.ToServer && option == TeloptGMCP:
+				return TeloptMSDP
+			}
+			return option
+		},
+	}
+}
+
+// splitGMCP splits the body of a GMCP subnegotiation into the message name and
+// its JSON data, which may be empty.
+func splitGMCP(body []byte) (name string, data []byte) {
+	if i := bytes.IndexAny(body, " \t\r\n"); i >= 0 {
+		return string(body[:i]), bytes.TrimSpace(body[i:])
+	}
+	return string(body), nil
+}
+
+// StripMXP is a telnet.Translator removing MXP from the server's output for
+// clients that refuse it. Offers of MXP are relayed to the client as usual; if
+// the client refuses, the Proxy accepts MXP on its behalf, and removes MXP
+// tags and line mode sequences from the output before relaying it, decoding
+// entities such as &lt; to the characters they stand for. The markup is
+// recognized without tracking MXP's line modes, so text the server meant
+// literally that looks like a tag is removed too.
+func StripMXP(p *telnet.Proxy) *telnet.ProxyFilter {
+	var (
+		strip    atomic.Bool
+		stripper mxpStripper
+	)
+	return &telnet.ProxyFilter{
+		Command: func(dir telnet.ProxyDirection, cmd, option byte) (byte, bool) {
+			if dir != telnet.ToServer || option != TeloptMXP {
+				return cmd, true
+			}
+			// Servers variously offer MXP with WILL or ask for it with DO.
+			switch cmd {
+			case telnet.DONT:
+				strip.Store(true)
+				return telnet.DO, true
+			case telnet.WONT:
+				strip.Store(true)
+				return telnet.WILL, true
+			case telnet.DO, telnet.WILL:
+				strip.Store(false)
+			}
+			return cmd, true
+		},
+		Data: func(dir telnet.ProxyDirection, b []byte) []byte {
+			if dir != telnet.ToClient || !strip.Load() {
+				return b
+			}
+			return stripper.strip(b)
+		},
+	}
+}
+
+// mxpStripper states.
+const (
+	mxpText   = iota
+	mxpEsc    // received ESC
+	mxpCSI    // received ESC [ and perhaps digits
+	mxpTag    // inside a tag
+	mxpQuote  // inside a quoted attribute of a tag
+	mxpEntity // received & and perhaps an entity name
+)
+
+// maxMXPEntity bounds the length of an entity, beyond which an & is taken to
+// be literal.
+const maxMXPEntity = 32
+
+// mxpStripper removes MXP markup from a stream of output. Sequences split
+// between calls are held until they are complete.
+type mxpStripper struct {
+	state   int
+	quote   byte   // closing quote, in mxpQuote
+	pending []byte // ESC sequence or entity held back
+}
+
+// strip returns b with MXP markup removed.
+func (s *mxpStripper) strip(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		ch := b[i]
+		switch s.state {
+		case mxpText:
+			switch ch {
+			case 0x1b:
+				s.state = mxpEsc
+				s.pending = append(s.pending[:0], ch)
+			case '<':
+				s.state = mxpTag
+			case '&':
+				s.state = mxpEntity
+				s.pending = append(s.pending[:0], ch)
+			default:
+				out = append(out, ch)
+			}
+		case mxpEsc:
+			if ch != '[' {
+				// Not a line mode sequence; reconsider ch as text.
+				out = append(out, s.pending...)
+				s.state = mxpText
+				continue
+			}
+			s.pending = append(s.pending, ch)
+			s.state = mxpCSI
+		case mxpCSI:
+			switch {
+			case ch >= '0' && ch <= '9':
+				s.pending = append(s.pending, ch)
+			case ch == 'z':
+				s.state = mxpText
+			default:
+				out = append(out, s.pending...)
+				s.state = mxpText
+				continue
+			}
+		case mxpTag:
+			switch ch {
+			case '>':
+				s.state = mxpText
+			case '"', '\'':
+				s.quote = ch
+				s.state = mxpQuote
+			}
+		case mxpQuote:
+			if ch == s.quote {
+				s.state = mxpTag
+			}
+		case mxpEntity:
+			switch {
+			case ch == ';':
+				out = append(out, html.UnescapeString(string(s.pending)+";")...)
+				s.state = mxpText
+			case len(s.pending) < maxMXPEntity && (ch == '#' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'):
+				s.pending = append(s.pending, ch)
+			default:
+				out = append(out, s.pending...)
+				s.state = mxpText
+				continue
+			}
+		}
+		i++
+	}
+	return out
+}
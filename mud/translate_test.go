@@ -0,0 +1,59 @@
+package mud_test
+
+import (
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// newProxy returns a running Proxy between peers playing the client and the
+// server, with the named translators installed.
+func newProxy(t *testing.T, translators ...string) (p *telnet.Proxy, client, server *telnettest.Peer) {
+	c, pc := telnettest.Pipe()
+	ps, s := telnettest.Pipe()
+	p = telnet.NewProxy(telnet.NewConnection(pc, nil), telnet.NewConnection(ps, nil))
+	if err := p.Translate(translators...); err != nil {
+		t.Fatal(err)
+	}
+	go p.Run()
+	t.Cleanup(func() { p.Client.Close() })
+	return p, &telnettest.Peer{Conn: c}, &telnettest.Peer{Conn: s}
+}
+
+func TestMSDPToGMCP(t *testing.T) {
+	_, client, server := newProxy(t, "msdp-gmcp")
+
+	server.Run(t, telnettest.Send(telnet.IAC, telnet.WILL, mud.TeloptMSDP))
+	client.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptGMCP),
+		telnettest.Send(telnet.IAC, telnet.DO, mud.TeloptGMCP),
+	)
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.DO, mud.TeloptMSDP))
+
+	client.Run(t, telnettest.Send(append(append([]byte{telnet.IAC, telnet.SB, mud.TeloptGMCP}, `MSDP {"REPORT":"HEALTH"}`...), telnet.IAC, telnet.SE)...))
+	server.Run(t,
+		telnettest.Expect(append(append([]byte{telnet.IAC, telnet.SB, mud.TeloptMSDP}, "\x01REPORT\x02HEALTH"...), telnet.IAC, telnet.SE)...),
+		telnettest.Send(append(append([]byte{telnet.IAC, telnet.SB, mud.TeloptMSDP}, "\x01HEALTH\x0290"...), telnet.IAC, telnet.SE)...),
+	)
+	client.Run(t, telnettest.Expect(append(append([]byte{telnet.IAC, telnet.SB, mud.TeloptGMCP}, `MSDP {"HEALTH":"90"}`...), telnet.IAC, telnet.SE)...))
+}
+
+func TestStripMXP(t *testing.T) {
+	_, client, server := newProxy(t, "mxp-strip")
+
+	server.Run(t, telnettest.Send(telnet.IAC, telnet.WILL, mud.TeloptMXP))
+	client.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMXP),
+		telnettest.Send(telnet.IAC, telnet.DONT, mud.TeloptMXP),
+	)
+	// The Proxy accepts MXP in the client's place.
+	server.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, mud.TeloptMXP),
+		telnettest.Send([]byte("\x1b[1z<RExits>Exits: <Ex>no")...),
+		telnettest.Send([]byte("rth</Ex> &lt;n&gt; &am")...),
+		telnettest.Send([]byte("p; \x1b[1;31mred<a href=\"x>y\">!</a>")...),
+	)
+	client.Run(t, telnettest.Expect([]byte("Exits: north <n> & \x1b[1;31mred!")...))
+}
@@ -0,0 +1,295 @@
+package telnet
+
+import (
+	"log/slog"
+	"time"
+)
+
+// negotiationQueueSize is the number of received commands that may be waiting
+// for the negotiation goroutine before Read blocks.
+const negotiationQueueSize = 16
+
+// negotiation is a command or subnegotiation received from the peer, queued
+// for the negotiation goroutine.
+type negotiation struct {
+	cmd    byte
+	option byte
+	body   []byte        // subnegotiation body, for SB
+	done   chan struct{} // if set, closed when reached instead of dispatching
+	run    func()        // if set with done, called on reaching it, before done is closed
+}
+
+// queueNegotiation hands a received command to the negotiation goroutine. It
+// is dropped if the goroutine has been stopped.
+func (c *Connection) queueNegotiation(n negotiation) {
+	c.queuedBytes.Add(int64(len(n.body)))
+	select {
+	case c.negotiations <- n:
+	case <-c.quit:
+		c.queuedBytes.Add(-int64(len(n.body)))
+	}
+}
+
+// admitNegotiation counts a command received from the peer, reporting whether
+// it may be handled. It returns a *NegotiationFloodError the first time the
+// peer exceeds MaxNegotiations or NegotiationRate, after which no more
+// commands are admitted.
+func (c *Connection) admitNegotiation() (bool, error) {
+	if c.flooded {
+		return false, nil
+	}
+	c.negotiationCount++
+	var limit string
+	switch {
+	case c.MaxNegotiations > 0 && c.negotiationCount > c.MaxNegotiations:
+		limit = "count"
+	case c.negotiationTokens.take(c.now(), c.NegotiationRate, c.NegotiationBurst, 1) > 0:
+		limit = "rate"
+	default:
+		return true, nil
+	}
+	c.flooded = true
+	err := &NegotiationFloodError{Limit: limit, Count: c.negotiationCount}
+	c.log(slog.LevelWarn, "telnet: negotiation flood", "limit", limit, "count", c.negotiationCount)
+	c.transcribeFailure(err)
+	c.Trace.negotiationFailed(err)
+	if c.CloseOnNegotiationFlood {
+		c.CloseWithReason(err)
+	}
+	return false, err
+}
+
+// negotiate runs the negotiation goroutine, which calls the option handlers for
+// received commands until stopNegotiation is called. Commands already queued
+// at that point are still handled.
+func (c *Connection) negotiate() {
+	defer close(c.done)
+	expire := c.negotiationExpiry()
+	for {
+		select {
+		case n := <-c.negotiations:
+			c.dispatch(n)
+		case <-expire:
+			expire = nil
+			c.expireRequests()
+		case <-c.quit:
+			for {
+				select {
+				case n := <-c.negotiations:
+					c.dispatch(n)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopNegotiation stops the negotiation goroutine once the queue is drained.
+func (c *Connection) stopNegotiation() {
+	c.quitOnce.Do(func() { close(c.quit) })
+}
+
+// drainNegotiation waits until the negotiation goroutine has handled all the
+// commands queued so far, or has exited.
+func (c *Connection) drainNegotiation() {
+	c.inNegotiation(nil)
+}
+
+// setRelay has the negotiation goroutine pass the commands it handles from
+// then on to relay, in place of the option handlers, and waits until it does.
+func (c *Connection) setRelay(relay func(n negotiation) error) {
+	c.inNegotiation(func() { c.relay = relay })
+}
+
+// inNegotiation waits until the negotiation goroutine has handled all the
+// commands queued so far, then calls fn on it if fn is not nil. If the
+// goroutine has exited, fn is called directly.
+func (c *Connection) inNegotiation(fn func()) {
+	done := make(chan struct{})
+	select {
+	case c.negotiations <- negotiation{done: done, run: fn}:
+	case <-c.done:
+		if fn != nil {
+			fn()
+		}
+		return
+	}
+	select {
+	case <-done:
+	case <-c.done:
+	}
+}
+
+// dispatch handles a single received command. Write errors from automatic
+// replies are not reported, since a broken connection will surface on the read
+// side, with the exception of a *NegotiationTimeoutError: the peer has stopped
+// reading, so any pending Read is interrupted to return it.
+func (c *Connection) dispatch(n negotiation) {
+	c.queuedBytes.Add(-int64(len(n.body)))
+	if n.done != nil {
+		if n.run != nil {
+			n.run()
+		}
+		close(n.done)
+		return
+	}
+	var err error
+	if c.relay != nil {
+		err = c.relay(n)
+	} else {
+		err = c.handle(n)
+	}
+	if _, ok := err.(*NegotiationTimeoutError); ok {
+		c.log(slog.LevelError, "telnet: negotiation write timed out", "error", err)
+		c.transcribeFailure(err)
+		c.Trace.negotiationFailed(err)
+		c.negMu.Lock()
+		if c.negErr == nil {
+			c.negErr = err
+		}
+		c.negMu.Unlock()
+		c.Conn.SetReadDeadline(c.now())
+	}
+}
+
+// negotiationErr returns the fatal error encountered by the negotiation
+// goroutine, if any.
+func (c *Connection) negotiationErr() error {
+	c.negMu.Lock()
+	defer c.negMu.Unlock()
+	return c.negErr
+}
+
+// handle handles a command or subnegotiation received with the Connection's
+// OptionHandlers.
+func (c *Connection) handle(n negotiation) error {
+	if n.cmd != SB {
+		return c.handleNegotiation(n.cmd, n.option)
+	}
+	if h, ok := c.OptionHandlers[n.option]; ok {
+		h.HandleSB(c, n.body)
+	}
+	c.deliverSubnegotiation(n.option, n.body)
+	return nil
+}
+
+func (c *Connection) handleNegotiation(cmd, option byte) error {
+	switch cmd {
+	case WILL:
+		c.clientWont.set(option, false)
+		if !c.requestedDo.set(option, false) {
+			c.askedWill.set(option, true)
+		}
+		if h, ok := c.OptionHandlers[option]; ok {
+			h.HandleWill(c)
+		} else {
+			return c.refuse(DONT, option)
+		}
+	case WONT:
+		c.clientWont.set(option, true)
+		c.askedWill.set(option, false)
+		enabled := c.RemoteEnabled(option)
+		c.SetRemoteEnabled(option, false)
+		if c.requestedDo.set(option, false) || enabled {
+			c.refused(option, false)
+		}
+	case DO:
+		c.clientDont.set(option, false)
+		if !c.requestedWill.set(option, false) {
+			c.askedDo.set(option, true)
+		}
+		if h, ok := c.OptionHandlers[option]; ok {
+			h.HandleDo(c)
+		} else {
+			return c.refuse(WONT, option)
+		}
+	case DONT:
+		c.clientDont.set(option, true)
+		c.askedDo.set(option, false)
+		enabled := c.LocalEnabled(option)
+		c.SetLocalEnabled(option, false)
+		if c.requestedWill.set(option, false) || enabled {
+			c.refused(option, true)
+		}
+	}
+	return nil
+}
+
+// refuse answers the peer's request for an option with cmd, IAC DONT or IAC
+// WONT, unless the Connection's Unhandled policy for the option is to ignore
+// it.
+func (c *Connection) refuse(cmd, option byte) error {
+	if c.Unhandled[option] == IgnoreUnhandled {
+		c.log(slog.LevelDebug, "telnet: request ignored", "option", option)
+		return nil
+	}
+	return c.WriteCommand(cmd, option)
+}
+
+// noteSent records a command about to be sent: an IAC WILL or IAC DO is a
+// request awaiting the peer's answer, unless it answers the peer's own.
+func (c *Connection) noteSent(cmd, option byte) {
+	switch cmd {
+	case WILL:
+		if !c.askedDo.set(option, false) {
+			c.requestedWill.set(option, true)
+		}
+	case DO:
+		if !c.askedWill.set(option, false) {
+			c.requestedDo.set(option, true)
+		}
+	case WONT:
+		c.askedDo.set(option, false)
+		c.requestedWill.set(option, false)
+	case DONT:
+		c.askedWill.set(option, false)
+		c.requestedDo.set(option, false)
+	}
+}
+
+// refused tells the option's handler that the peer has refused our request,
+// or disabled the option, if it is a RefusalNegotiator.
+func (c *Connection) refused(option byte, local bool) {
+	if h, ok := c.OptionHandlers[option].(RefusalNegotiator); ok {
+		h.HandleRefused(c, local)
+	}
+}
+
+// negotiationExpiry returns a channel that receives once the
+// NegotiationTimeout has passed, or nil if requests are not timed or there
+// are no option handlers to make them.
+func (c *Connection) negotiationExpiry() <-chan time.Time {
+	d := c.negotiationTimeout
+	if d < 0 || len(c.OptionHandlers) == 0 {
+		return nil
+	}
+	if d == 0 {
+		d = DefaultNegotiationTimeout
+	}
+	return c.after(d)
+}
+
+// expireRequests takes the requests still unanswered at the end of the
+// NegotiationTimeout as refused. An option the peer has enabled all the same
+// was answered.
+func (c *Connection) expireRequests() {
+	if c.relay != nil {
+		// The peer's answers are for the other end of the Proxy.
+		return
+	}
+	for _, o := range c.requestedWill.codes() {
+		if c.requestedWill.set(o, false) && !c.LocalEnabled(o) {
+			c.log(slog.LevelDebug, "telnet: negotiation timed out", "cmd", WILL, "option", o)
+			c.clientDont.set(o, true)
+			c.refused(o, true)
+		}
+	}
+	for _, o := range c.requestedDo.codes() {
+		if c.requestedDo.set(o, false) && !c.RemoteEnabled(o) {
+			c.log(slog.LevelDebug, "telnet: negotiation timed out", "cmd", DO, "option", o)
+			c.clientWont.set(o, true)
+			c.refused(o, false)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package telnet
+
+import "bytes"
+
+// NVT newline handling - https://tools.ietf.org/html/rfc854
+
+// translateInput reports whether inbound CR LF and CR NUL should be decoded
+// to "\n".
+func (c *Connection) translateInput() bool {
+	return !c.RawNewlines && !c.remote.has(TeloptBINARY) && !c.transferring.Load()
+}
+
+// translateOutput reports whether outbound newlines should be encoded as CR
+// LF and CR NUL.
+func (c *Connection) translateOutput() bool {
+	return !c.RawNewlines && !c.local.has(TeloptBINARY) && !c.transferring.Load()
+}
+
+// hasNewline reports whether b contains CR or LF.
+func hasNewline(b []byte) bool {
+	return bytes.IndexByte(b, '\n') >= 0 || bytes.IndexByte(b, '\r') >= 0
+}
+
+// appendData appends b to dst encoded for the wire: IAC is doubled and, if
+// translate is set, a bare LF becomes CR LF and a bare CR becomes CR NUL. cr
+// reports whether the last byte previously written was CR; the updated value
+// is returned.
+func appendData(dst, b []byte, translate, cr bool) ([]byte, bool) {
+	for _, ch := range b {
+		if translate {
+			if cr && ch != '\n' {
+				dst = append(dst, 0)
+			}
+			if ch == '\n' && !cr {
+				dst = append(dst, '\r')
+			}
+			cr = ch == '\r'
+		}
+		dst = append(dst, ch)
+		if ch == IAC {
+			dst = append(dst, IAC)
+		}
+	}
+	return dst, cr
+}
+
+// WritePrompt writes a prompt that does not end in a newline, followed by
+// IAC EOR if END-OF-RECORD is enabled on our side, or otherwise IAC GA unless
+// SUPPRESS-GO-AHEAD is, so that clients which only display complete lines know
+// to display it.
+func (c *Connection) WritePrompt(prompt string) error {
+	if _, err := c.Write([]byte(prompt)); err != nil {
+		return err
+	}
+	switch {
+	case c.local.has(TeloptEOR):
+		_, err := c.RawWrite([]byte{IAC, EOR})
+		return err
+	case !c.local.has(TeloptSGA):
+		_, err := c.RawWrite([]byte{IAC, GA})
+		return err
+	}
+	return nil
+}
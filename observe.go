@@ -0,0 +1,94 @@
+package telnet
+
+import (
+	"slices"
+	"sync"
+)
+
+// OptionObserver watches an option without taking part in its negotiation,
+// which is left to the option's handler: a metrics module might observe NAWS,
+// say, while the application's handler answers it. Either field may be nil.
+type OptionObserver struct {
+	// OnChange is called when the option is enabled or disabled, on our
+	// side if local is set and otherwise on the peer's, from the goroutine
+	// recording the change.
+	OnChange func(c *Connection, local, enabled bool)
+
+	// OnSubnegotiation is called with each subnegotiation received for the
+	// option, decoded as for Connection.OnSubnegotiation, on the negotiation
+	// goroutine once the handler has returned. Its Body is only valid until
+	// it returns. Subnegotiations for an InlineNegotiator or a
+	// StreamNegotiator are not observed.
+	OnSubnegotiation func(c *Connection, s Subnegotiation)
+}
+
+// observerSet holds a Connection's OptionObservers. Each option's list is
+// replaced rather than modified, so it can be called without the lock held.
+type observerSet struct {
+	mu       sync.Mutex
+	byOption map[byte][]*OptionObserver
+	observed optionSet
+}
+
+// Observe adds o to the observers of the option, as many of which may be
+// added as needed, until stop is called. It is safe to call from any
+// goroutine.
+func (c *Connection) Observe(option byte, o OptionObserver) (stop func()) {
+	p := &o
+	s := &c.observers
+	s.mu.Lock()
+	if s.byOption == nil {
+		s.byOption = make(map[byte][]*OptionObserver)
+	}
+	s.byOption[option] = append(slices.Clip(s.byOption[option]), p)
+	s.observed.set(option, true)
+	s.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			list := slices.DeleteFunc(slices.Clone(s.byOption[option]), func(q *OptionObserver) bool { return q == p })
+			if len(list) == 0 {
+				delete(s.byOption, option)
+				s.observed.set(option, false)
+				return
+			}
+			s.byOption[option] = list
+		})
+	}
+}
+
+// observed reports whether the option has observers.
+func (c *Connection) observed(option byte) bool {
+	return c.observers.observed.has(option)
+}
+
+// optionObservers returns the observers of the option.
+func (c *Connection) optionObservers(option byte) []*OptionObserver {
+	if !c.observed(option) {
+		return nil
+	}
+	c.observers.mu.Lock()
+	defer c.observers.mu.Unlock()
+	return c.observers.byOption[option]
+}
+
+// observeChange tells the option's observers it has been enabled or disabled.
+func (c *Connection) observeChange(option byte, local, enabled bool) {
+	for _, o := range c.optionObservers(option) {
+		if o.OnChange != nil {
+			o.OnChange(c, local, enabled)
+		}
+	}
+}
+
+// observeSubnegotiation passes a subnegotiation received to the option's
+// observers.
+func (c *Connection) observeSubnegotiation(s Subnegotiation) {
+	for _, o := range c.optionObservers(s.Option) {
+		if o.OnSubnegotiation != nil {
+			o.OnSubnegotiation(c, s)
+		}
+	}
+}
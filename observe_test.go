@@ -0,0 +1,71 @@
+package telnet_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestConnection_Observe(t *testing.T) {
+	m := &telnettest.MockNegotiator{Code: telnet.TeloptNAWS, WillReply: telnet.DO}
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, []telnet.Option{m.Option()})
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+
+	var mu sync.Mutex
+	var seen []string
+	observer := func(name string) telnet.OptionObserver {
+		return telnet.OptionObserver{
+			OnChange: func(c *telnet.Connection, local, enabled bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				seen = append(seen, fmt.Sprintf("%s: local %v enabled %v", name, local, enabled))
+			},
+			OnSubnegotiation: func(c *telnet.Connection, s telnet.Subnegotiation) {
+				mu.Lock()
+				defer mu.Unlock()
+				seen = append(seen, fmt.Sprintf("%s: % x", name, s.Body))
+			},
+		}
+	}
+	conn.Observe(telnet.TeloptNAWS, observer("metrics"))
+	stop := conn.Observe(telnet.TeloptNAWS, observer("app"))
+	conn.Observe(telnet.TeloptECHO, observer("echo"))
+
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Send(telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 24, telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+	stop()
+	stop()
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 132, 0, 43, telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+	conn.Close()
+
+	want := []string{
+		"metrics: local false enabled true",
+		"app: local false enabled true",
+		"metrics: 00 50 00 18",
+		"app: 00 50 00 18",
+		"metrics: 00 84 00 2b",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, seen)
+	}
+	// The handler still negotiates the option.
+	if calls := m.Calls(); len(calls) != 4 || calls[3].Method != "HandleSB" {
+		t.Errorf("Expected the handler to be called as before, got %v", calls)
+	}
+}
@@ -0,0 +1,192 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tester2024/telnet"
+)
+
+// AUTHENTICATION Telnet Authentication Option - https://tools.ietf.org/html/rfc2941
+
+// ErrAuthUnsupported is returned by AuthMechanism.Start for modifiers the
+// mechanism does not support, so the next pair the server offers is tried.
+var ErrAuthUnsupported = errors.New("options: authentication modifiers not supported")
+
+// AuthMechanism is an authentication type for a client's AuthenticationHandler,
+// such as KerberosV5.
+type AuthMechanism interface {
+	// Type returns the authentication type, one of the telnet.AuthType
+	// constants.
+	Type() byte
+	// Start begins authenticating with the modifiers offered by the server,
+	// returning the exchange and the data for the first IS. It returns
+	// ErrAuthUnsupported if it does not support the modifiers.
+	Start(c *telnet.Connection, modifiers byte) (AuthExchange, []byte, error)
+}
+
+// AuthExchange is an authentication in progress.
+type AuthExchange interface {
+	// Reply handles the data of a REPLY from the server. It returns the data
+	// for another IS, if any, and whether authentication has finished, with
+	// an error if it failed.
+	Reply(data []byte) (next []byte, done bool, err error)
+}
+
+// AuthenticationOption returns an Option for a client, authenticating as user
+// with the first of the mechanisms that supports a type and modifiers the
+// server offers, in the server's order of preference.
+func AuthenticationOption(user string, mechanisms ...AuthMechanism) telnet.Option {
+	return func(c *telnet.Connection) telnet.Negotiator {
+		return &AuthenticationHandler{User: user, Mechanisms: mechanisms}
+	}
+}
+
+// AuthenticationHandler negotiates AUTHENTICATION for a client.
+type AuthenticationHandler struct {
+	// User is the name to log in as, sent to the server before
+	// authenticating if not empty.
+	User string
+	// Mechanisms are the authentication types supported.
+	Mechanisms []AuthMechanism
+	// Done, if set, is called once authentication finishes, with nil if it
+	// succeeded, or the reason it failed or was not attempted.
+	Done func(err error)
+
+	mu        sync.Mutex
+	exchange  AuthExchange
+	authType  byte
+	modifiers byte
+	err       error
+	done      bool
+}
+
+// OptionCode returns the IAC code for AUTHENTICATION.
+func (a *AuthenticationHandler) OptionCode() byte {
+	return telnet.TeloptAUTHENTICATION
+}
+
+// Offer does nothing, since the server asks the client to authenticate.
+func (a *AuthenticationHandler) Offer(c *telnet.Connection) {}
+
+// HandleDo agrees to authenticate.
+func (a *AuthenticationHandler) HandleDo(c *telnet.Connection) {
+	if !c.LocalEnabled(telnet.TeloptAUTHENTICATION) {
+		c.WriteCommand(telnet.WILL, telnet.TeloptAUTHENTICATION)
+		c.SetLocalEnabled(telnet.TeloptAUTHENTICATION, true)
+	}
+}
+
+// HandleWill refuses to authenticate the server.
+func (a *AuthenticationHandler) HandleWill(c *telnet.Connection) {
+	c.WriteCommand(telnet.DONT, telnet.TeloptAUTHENTICATION)
+}
+
+// HandleSB handles SEND, starting authentication with the first supported
+// type, and REPLY, continuing it.
+func (a *AuthenticationHandler) HandleSB(c *telnet.Connection, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	switch body[0] {
+	case telnet.TelQualSEND:
+		a.start(c, body[1:])
+	case telnet.TelQualREPLY:
+		if len(body) >= 3 {
+			a.reply(c, body[1], body[2], body[3:])
+		}
+	}
+}
+
+// start begins authenticating with the first of the offered type and
+// modifier pairs a mechanism supports, or sends a NULL type if none is.
+func (a *AuthenticationHandler) start(c *telnet.Connection, pairs []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		for _, m := range a.Mechanisms {
+			if m.Type() != pairs[i] {
+				continue
+			}
+			x, data, err := m.Start(c, pairs[i+1])
+			if err == ErrAuthUnsupported {
+				continue
+			} else if err != nil {
+				a.finish(c, err)
+				a.send(c, telnet.AuthTypeNULL, 0, nil)
+				return
+			}
+			a.exchange, a.authType, a.modifiers = x, pairs[i], pairs[i+1]
+			if a.User != "" {
+				c.WriteSubnegotiation(telnet.TeloptAUTHENTICATION, append([]byte{telnet.TelQualNAME}, a.User...))
+			}
+			a.send(c, a.authType, a.modifiers, data)
+			return
+		}
+	}
+	a.finish(c, errors.New("options: no supported authentication type offered"))
+	a.send(c, telnet.AuthTypeNULL, 0, nil)
+}
+
+// reply passes a REPLY to the exchange in progress.
+func (a *AuthenticationHandler) reply(c *telnet.Connection, authType, modifiers byte, data []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.exchange == nil || a.done || authType != a.authType || modifiers != a.modifiers {
+		return
+	}
+	next, done, err := a.exchange.Reply(data)
+	if next != nil {
+		a.send(c, a.authType, a.modifiers, next)
+	}
+	if done || err != nil {
+		a.finish(c, err)
+	}
+}
+
+// send writes an IS.
+func (a *AuthenticationHandler) send(c *telnet.Connection, authType, modifiers byte, data []byte) {
+	body := append([]byte{telnet.TelQualIS, authType, modifiers}, data...)
+	c.WriteSubnegotiation(telnet.TeloptAUTHENTICATION, body)
+}
+
+// finish records the outcome of authentication, auditing it on c. The caller
+// must hold a.mu.
+func (a *AuthenticationHandler) finish(c *telnet.Connection, err error) {
+	if a.done {
+		return
+	}
+	a.done, a.err = true, err
+	event := telnet.AuditEvent{Type: telnet.AuditAuthSuccess, User: a.User, Err: err}
+	if err != nil {
+		event.Type = telnet.AuditAuthFailure
+	}
+	c.Audit(event)
+	if a.Done != nil {
+		a.Done(err)
+	}
+}
+
+// Result reports whether authentication has finished, and if so the error it
+// failed with, or nil if it succeeded.
+func (a *AuthenticationHandler) Result() (done bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done, a.err
+}
+
+// AuthRejectedError is returned when the server rejects authentication.
+type AuthRejectedError struct {
+	// Type is the authentication type rejected.
+	Type byte
+	// Reason is the server's explanation, if it gave one.
+	Reason string
+}
+
+func (e *AuthRejectedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("options: authentication type %d rejected", e.Type)
+	}
+	return fmt.Sprintf("options: authentication type %d rejected: %s", e.Type, e.Reason)
+}
@@ -0,0 +1,114 @@
+package options_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// fakeKerberos is a KerberosContext exchanging fixed messages.
+type fakeKerberos struct{}
+
+func (k *fakeKerberos) APRequest(mutual bool) ([]byte, error) {
+	return []byte("req\xff"), nil
+}
+
+func (k *fakeKerberos) VerifyAPReply(apRep []byte) error {
+	if string(apRep) != "rep" {
+		return errors.New("bad AP-REP")
+	}
+	return nil
+}
+
+// sb returns an AUTHENTICATION subnegotiation, escaping IAC in the body.
+func sb(body ...byte) []byte {
+	b := []byte{telnet.IAC, telnet.SB, telnet.TeloptAUTHENTICATION}
+	for _, ch := range body {
+		b = append(b, ch)
+		if ch == telnet.IAC {
+			b = append(b, ch)
+		}
+	}
+	return append(b, telnet.IAC, telnet.SE)
+}
+
+func newAuthPeer(t *testing.T) (*telnettest.Peer, chan error) {
+	done := make(chan error, 1)
+	krb := &options.KerberosV5{NewContext: func(c *telnet.Connection) (options.KerberosContext, error) {
+		return &fakeKerberos{}, nil
+	}}
+	auth := func(c *telnet.Connection) telnet.Negotiator {
+		h := options.AuthenticationOption("alice", krb)(c).(*options.AuthenticationHandler)
+		h.Done = func(err error) { done <- err }
+		return h
+	}
+	peer, conn := telnettest.NewPeer(auth)
+	go io.Copy(io.Discard, conn)
+	t.Cleanup(func() { conn.Close() })
+	return peer, done
+}
+
+func wait(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for authentication to finish")
+		return nil
+	}
+}
+
+func TestAuthentication_KerberosV5(t *testing.T) {
+	peer, done := newAuthPeer(t)
+	mutual := telnet.AuthClientToServer | telnet.AuthHowMutual
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptAUTHENTICATION),
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptAUTHENTICATION),
+		// Encryption is not supported, so the second pair is used.
+		telnettest.Send(sb(telnet.TelQualSEND,
+			telnet.AuthTypeKERBEROSV5, mutual|telnet.AuthEncryptUsingTelopt,
+			telnet.AuthTypeKERBEROSV5, mutual)...),
+		telnettest.Expect(sb(telnet.TelQualNAME, 'a', 'l', 'i', 'c', 'e')...),
+		telnettest.Expect(sb(telnet.TelQualIS, telnet.AuthTypeKERBEROSV5, mutual, 0, 'r', 'e', 'q', telnet.IAC)...),
+		telnettest.Send(sb(telnet.TelQualREPLY, telnet.AuthTypeKERBEROSV5, mutual, 3, 'r', 'e', 'p')...),
+		telnettest.Send(sb(telnet.TelQualREPLY, telnet.AuthTypeKERBEROSV5, mutual, 2)...),
+	)
+	if err := wait(t, done); err != nil {
+		t.Errorf("Expected authentication to succeed, got %v", err)
+	}
+}
+
+func TestAuthentication_Rejected(t *testing.T) {
+	peer, done := newAuthPeer(t)
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptAUTHENTICATION),
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptAUTHENTICATION),
+		telnettest.Send(sb(telnet.TelQualSEND, telnet.AuthTypeKERBEROSV5, 0)...),
+		telnettest.Expect(sb(telnet.TelQualNAME, 'a', 'l', 'i', 'c', 'e')...),
+		telnettest.Expect(sb(telnet.TelQualIS, telnet.AuthTypeKERBEROSV5, 0, 0, 'r', 'e', 'q', telnet.IAC)...),
+		telnettest.Send(sb(telnet.TelQualREPLY, telnet.AuthTypeKERBEROSV5, 0, 1, 'n', 'o')...),
+	)
+	var rejected *options.AuthRejectedError
+	if err := wait(t, done); !errors.As(err, &rejected) || rejected.Reason != "no" {
+		t.Errorf("Expected rejection, got %v", err)
+	}
+}
+
+func TestAuthentication_Unsupported(t *testing.T) {
+	peer, done := newAuthPeer(t)
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptAUTHENTICATION),
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptAUTHENTICATION),
+		telnettest.Send(sb(telnet.TelQualSEND, telnet.AuthTypeSRP, 0)...),
+		telnettest.Expect(sb(telnet.TelQualIS, telnet.AuthTypeNULL, 0)...),
+	)
+	if err := wait(t, done); err == nil {
+		t.Error("Expected an error when no type is supported")
+	}
+}
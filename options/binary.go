@@ -0,0 +1,81 @@
+package options
+
+import "github.com/tester2024/telnet"
+
+// BINARY Telnet Binary Transmission - https://tools.ietf.org/html/rfc856
+
+// BinaryOption enables BINARY negotiation on a Server, offering binary
+// transmission in both directions.
+func BinaryOption(c *telnet.Connection) telnet.Negotiator {
+	return &BinaryHandler{client: false}
+}
+
+// ExposeBinary enables BINARY negotiation on a Client. It agrees to binary
+// transmission in either direction when the server asks for it.
+func ExposeBinary(c *telnet.Connection) telnet.Negotiator {
+	return &BinaryHandler{client: true}
+}
+
+// BinaryHandler negotiates BINARY for a specific connection. While BINARY is
+// enabled for a direction, the Connection stops translating newlines for it.
+type BinaryHandler struct {
+	client bool
+
+	// Requests of ours awaiting an answer
+	sentWill bool
+	sentDo   bool
+}
+
+// OptionCode returns with the code used to negotiate BINARY modes.
+func (b *BinaryHandler) OptionCode() byte {
+	return telnet.TeloptBINARY
+}
+
+// Offer asks to send and receive binary data on a Server.
+func (b *BinaryHandler) Offer(c *telnet.Connection) {
+	if !b.client {
+		b.sentWill = true
+		c.WriteCommand(telnet.WILL, b.OptionCode())
+		b.sentDo = true
+		c.WriteCommand(telnet.DO, b.OptionCode())
+	}
+}
+
+// HandleDo enables binary output, agreeing to it first unless it answers our
+// own request.
+func (b *BinaryHandler) HandleDo(c *telnet.Connection) {
+	if c.LocalEnabled(b.OptionCode()) {
+		return
+	}
+	if !b.sentWill {
+		c.WriteCommand(telnet.WILL, b.OptionCode())
+	}
+	b.sentWill = false
+	c.SetLocalEnabled(b.OptionCode(), true)
+}
+
+// HandleWill enables binary input, agreeing to it first unless it answers our
+// own request.
+func (b *BinaryHandler) HandleWill(c *telnet.Connection) {
+	if c.RemoteEnabled(b.OptionCode()) {
+		return
+	}
+	if !b.sentDo {
+		c.WriteCommand(telnet.DO, b.OptionCode())
+	}
+	b.sentDo = false
+	c.SetRemoteEnabled(b.OptionCode(), true)
+}
+
+// HandleRefused forgets our request for binary transmission in the direction
+// refused or disabled, so that the peer asking for it later is agreed to.
+func (b *BinaryHandler) HandleRefused(c *telnet.Connection, local bool) {
+	if local {
+		b.sentWill = false
+	} else {
+		b.sentDo = false
+	}
+}
+
+// HandleSB is not used by BINARY.
+func (b *BinaryHandler) HandleSB(c *telnet.Connection, body []byte) {}
@@ -0,0 +1,43 @@
+package options_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestServerBinary_Reenabled(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, []telnet.Option{options.BinaryOption})
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+
+	bin := telnet.TeloptBINARY
+	peer := &telnettest.Peer{Conn: b}
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, bin, telnet.IAC, telnet.DO, bin),
+		telnettest.Send(telnet.IAC, telnet.DO, bin, telnet.IAC, telnet.DONT, bin),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+	if conn.LocalEnabled(bin) {
+		t.Error("Expected BINARY output to be disabled")
+	}
+
+	// Asked again, we agree again.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, bin),
+		telnettest.Expect(telnet.IAC, telnet.WILL, bin),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+	if !conn.LocalEnabled(bin) {
+		t.Error("Expected BINARY output to be enabled again")
+	}
+
+	// As we do once the peer has refused our request.
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WONT, bin, telnet.IAC, telnet.WILL, bin),
+		telnettest.Expect(telnet.IAC, telnet.DO, bin))
+}
@@ -9,6 +9,12 @@ func EchoOption(c *telnet.Connection) telnet.Negotiator {
 	return &EchoHandler{client: false}
 }
 
+// ExposeEcho enables ECHO negotiation on a Client, agreeing to the server
+// echoing what is typed.
+func ExposeEcho(c *telnet.Connection) telnet.Negotiator {
+	return &EchoHandler{client: true}
+}
+
 // EchoHandler negotiates ECHO for a specific connection.
 type EchoHandler struct {
 	client bool
@@ -23,7 +29,7 @@ func (e *EchoHandler) OptionCode() byte {
 // an opportunity to advertise or request an option.
 func (e *EchoHandler) Offer(c *telnet.Connection) {
 	if !e.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WILL, e.OptionCode()})
+		c.WriteCommand(telnet.WILL, e.OptionCode())
 	}
 }
 
@@ -36,7 +42,10 @@ func (e *EchoHandler) HandleDo(c *telnet.Connection) {
 // HandleWill is called when an IAC WILL command is received for this
 // option, indicating the client is willing to enable this option.
 func (e *EchoHandler) HandleWill(c *telnet.Connection) {
-
+	if e.client && !c.RemoteEnabled(e.OptionCode()) {
+		c.WriteCommand(telnet.DO, e.OptionCode())
+		c.SetRemoteEnabled(e.OptionCode(), true)
+	}
 }
 
 // HandleSB is called when a subnegotiation command is received for this
@@ -9,6 +9,12 @@ func SuppressGoAheadOption(c *telnet.Connection) telnet.Negotiator {
 	return &SuppressGoAheadHandler{client: false}
 }
 
+// ExposeSuppressGoAhead enables SUPPRESS-GO-AHEAD negotiation on a Client,
+// agreeing to the server suppressing go-aheads.
+func ExposeSuppressGoAhead(c *telnet.Connection) telnet.Negotiator {
+	return &SuppressGoAheadHandler{client: true}
+}
+
 // SuppressGoAheadHandler negotiates ECHO for a specific connection.
 type SuppressGoAheadHandler struct {
 	client bool
@@ -23,7 +29,7 @@ func (e *SuppressGoAheadHandler) OptionCode() byte {
 // an opportunity to advertise or request an option.
 func (e *SuppressGoAheadHandler) Offer(c *telnet.Connection) {
 	if !e.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WILL, e.OptionCode()})
+		c.WriteCommand(telnet.WILL, e.OptionCode())
 	}
 }
 
@@ -36,7 +42,10 @@ func (e *SuppressGoAheadHandler) HandleDo(c *telnet.Connection) {
 // HandleWill is called when an IAC WILL command is received for this
 // option, indicating the client is willing to enable this option.
 func (e *SuppressGoAheadHandler) HandleWill(c *telnet.Connection) {
-
+	if e.client && !c.RemoteEnabled(e.OptionCode()) {
+		c.WriteCommand(telnet.DO, e.OptionCode())
+		c.SetRemoteEnabled(e.OptionCode(), true)
+	}
 }
 
 // HandleSB is called when a subnegotiation command is received for this
@@ -0,0 +1,95 @@
+package options
+
+import (
+	"errors"
+
+	"github.com/tester2024/telnet"
+)
+
+// KERBEROS_V5 Telnet Authentication - https://tools.ietf.org/html/rfc2942
+
+// Kerberos V5 authentication suboptions.
+const (
+	krb5Auth     = byte(0) // client's AP-REQ
+	krb5Reject   = byte(1) // server rejects, with a reason
+	krb5Accept   = byte(2) // server accepts, with the user name
+	krb5Response = byte(3) // server's AP-REP, for mutual authentication
+)
+
+// KerberosContext is the client side of a Kerberos 5 authentication to a
+// telnet server's host service, made with a GSS-API or Kerberos library of
+// the application's choosing.
+type KerberosContext interface {
+	// APRequest returns a KRB_AP_REQ message authenticating the user to the
+	// server, requesting mutual authentication if mutual is set.
+	APRequest(mutual bool) ([]byte, error)
+	// VerifyAPReply verifies the server's KRB_AP_REP message, completing
+	// mutual authentication.
+	VerifyAPReply(apRep []byte) error
+}
+
+// KerberosV5 is an AuthMechanism authenticating to a server with Kerberos 5,
+// one way or mutually, as legacy enterprise telnet servers require. Session
+// encryption and credential forwarding are not supported, so modifiers
+// requesting them are refused.
+type KerberosV5 struct {
+	// NewContext returns a context for authenticating one connection, for
+	// example to the service principal host/<server name>.
+	NewContext func(c *telnet.Connection) (KerberosContext, error)
+}
+
+// Type returns telnet.AuthTypeKERBEROSV5.
+func (k *KerberosV5) Type() byte {
+	return telnet.AuthTypeKERBEROSV5
+}
+
+// Start sends the AP-REQ from a new KerberosContext.
+func (k *KerberosV5) Start(c *telnet.Connection, modifiers byte) (AuthExchange, []byte, error) {
+	if modifiers&telnet.AuthWhoMask != telnet.AuthClientToServer ||
+		modifiers&telnet.AuthEncryptMask != telnet.AuthEncryptOff ||
+		modifiers&telnet.AuthIniCredFwdMask != telnet.AuthIniCredFwdOff {
+		return nil, nil, ErrAuthUnsupported
+	}
+	ctx, err := k.NewContext(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	mutual := modifiers&telnet.AuthHowMask == telnet.AuthHowMutual
+	req, err := ctx.APRequest(mutual)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &krb5Exchange{ctx: ctx, mutual: mutual}, append([]byte{krb5Auth}, req...), nil
+}
+
+// krb5Exchange is a Kerberos 5 authentication in progress.
+type krb5Exchange struct {
+	ctx      KerberosContext
+	mutual   bool
+	accepted bool
+}
+
+func (x *krb5Exchange) Reply(data []byte) ([]byte, bool, error) {
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	switch data[0] {
+	case krb5Reject:
+		return nil, true, &AuthRejectedError{Type: telnet.AuthTypeKERBEROSV5, Reason: string(data[1:])}
+	case krb5Accept:
+		// With mutual authentication the server's RESPONSE may come before
+		// or after ACCEPT; both are needed.
+		x.accepted = true
+		return nil, !x.mutual, nil
+	case krb5Response:
+		if !x.mutual {
+			return nil, true, errors.New("options: unexpected Kerberos RESPONSE")
+		}
+		if err := x.ctx.VerifyAPReply(data[1:]); err != nil {
+			return nil, true, err
+		}
+		x.mutual = false
+		return nil, x.accepted, nil
+	}
+	return nil, false, nil
+}
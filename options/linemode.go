@@ -23,7 +23,7 @@ func (e *LinemodeHandler) OptionCode() byte {
 // an opportunity to advertise or request an option.
 func (e *LinemodeHandler) Offer(c *telnet.Connection) {
 	if !e.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WONT, e.OptionCode()})
+		c.WriteCommand(telnet.WONT, e.OptionCode())
 	}
 }
 
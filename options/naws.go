@@ -4,6 +4,8 @@ package options
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -11,6 +13,10 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+func init() {
+	telnet.RegisterCodec(telnet.TeloptNAWS, nawsCodec{})
+}
+
 // NAWSOption enables NAWS negotiation on a Server.
 func NAWSOption(c *telnet.Connection) telnet.Negotiator {
 	return &NAWSHandler{client: false}
@@ -38,7 +44,7 @@ func (n *NAWSHandler) OptionCode() byte {
 // Offer sends the IAC DO NAWS command to the client.
 func (n *NAWSHandler) Offer(c *telnet.Connection) {
 	if !n.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.DO, n.OptionCode()})
+		c.WriteCommand(telnet.DO, n.OptionCode())
 	}
 }
 
@@ -48,11 +54,11 @@ func (n *NAWSHandler) HandleWill(c *telnet.Connection) {}
 // HandleDo processes the monitor size options for NAWS.
 func (n *NAWSHandler) HandleDo(c *telnet.Connection) {
 	if n.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WILL, n.OptionCode()})
+		c.WriteCommand(telnet.WILL, n.OptionCode())
 		n.writeSize(c)
 		go n.monitorTTYSize(c)
 	} else {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WONT, n.OptionCode()})
+		c.WriteCommand(telnet.WONT, n.OptionCode())
 	}
 }
 
@@ -74,19 +80,65 @@ func (n *NAWSHandler) monitorTTYSize(c *telnet.Connection) {
 }
 
 func (n *NAWSHandler) writeSize(c *telnet.Connection) {
-	c.Conn.Write([]byte{telnet.IAC, telnet.SB, n.OptionCode()})
 	payload := make([]byte, 4)
 	binary.BigEndian.PutUint16(payload, n.Width)
 	binary.BigEndian.PutUint16(payload[2:], n.Height)
-	// Normal write - we want inadvertent telnet.IACs to be escaped in body
-	c.Write(payload)
-	c.Conn.Write([]byte{telnet.IAC, telnet.SE})
+	c.WriteSubnegotiation(n.OptionCode(), payload)
 }
 
-// HandleSB processes the information about window size sent from the client to the server.
+// HandleSB processes the information about window size sent from the client
+// to the server, recording it with SetWindowSize.
 func (n *NAWSHandler) HandleSB(c *telnet.Connection, b []byte) {
-	if !n.client {
+	if !n.client && len(b) == 4 {
 		n.Width = binary.BigEndian.Uint16(b[0:2])
 		n.Height = binary.BigEndian.Uint16(b[2:4])
+		c.SetWindowSize(int(n.Width), int(n.Height))
+	}
+}
+
+// MarshalState returns the window size, so it is kept when the Connection is
+// restored with telnet.RestoreConnection.
+func (n *NAWSHandler) MarshalState() ([]byte, error) {
+	state := make([]byte, 4)
+	binary.BigEndian.PutUint16(state, n.Width)
+	binary.BigEndian.PutUint16(state[2:], n.Height)
+	return state, nil
+}
+
+// UnmarshalState restores the window size returned by MarshalState.
+func (n *NAWSHandler) UnmarshalState(state []byte) error {
+	if len(state) != 4 {
+		return errors.New("options: malformed NAWS state")
+	}
+	n.Width = binary.BigEndian.Uint16(state[0:2])
+	n.Height = binary.BigEndian.Uint16(state[2:4])
+	return nil
+}
+
+// WindowSize is the body of a NAWS subnegotiation, as decoded by its
+// telnet.Codec.
+type WindowSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// nawsCodec is the telnet.Codec of NAWS.
+type nawsCodec struct{}
+
+func (nawsCodec) Decode(body []byte) (any, error) {
+	if len(body) != 4 {
+		return nil, errors.New("options: malformed NAWS subnegotiation")
+	}
+	return WindowSize{binary.BigEndian.Uint16(body[0:2]), binary.BigEndian.Uint16(body[2:4])}, nil
+}
+
+func (nawsCodec) Encode(v any) ([]byte, error) {
+	size, ok := v.(WindowSize)
+	if !ok {
+		return nil, fmt.Errorf("options: cannot encode %T as NAWS", v)
 	}
+	body := make([]byte, 4)
+	binary.BigEndian.PutUint16(body, size.Width)
+	binary.BigEndian.PutUint16(body[2:], size.Height)
+	return body, nil
 }
@@ -117,3 +117,21 @@ func TestOnlyServerSupportsNAWS(t *testing.T) {
 	}()
 	wg.Wait()
 }
+
+func TestNAWSCodec(t *testing.T) {
+	codec := telnet.LookupCodec(telnet.TeloptNAWS)
+	body, err := codec.Encode(options.WindowSize{Width: 80, Height: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 80, 1, 44}; !bytes.Equal(body, want) {
+		t.Errorf("Encode = %v, want %v", body, want)
+	}
+	v, err := codec.Decode(body)
+	if err != nil || v != (options.WindowSize{Width: 80, Height: 300}) {
+		t.Errorf("Decode = %v, %v", v, err)
+	}
+	if _, err := codec.Decode(body[:3]); err == nil {
+		t.Error("Decode of a short body: got no error")
+	}
+}
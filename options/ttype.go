@@ -1,17 +1,45 @@
 package options
 
-import "github.com/tester2024/telnet"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
-// TerminalType Telnet Option - https://tools.ietf.org/html/rfc857
+	"github.com/tester2024/telnet"
+)
 
-// TerminalTypeOption enables NAWS negotiation on a Server.
+// TerminalType Telnet Option - https://tools.ietf.org/html/rfc1091
+
+// maxTerminalTypes bounds how many terminal types are asked for, in case a
+// client never repeats itself.
+const maxTerminalTypes = 8
+
+func init() {
+	telnet.RegisterCodec(telnet.TeloptTTYPE, terminalTypeCodec{})
+}
+
+// TerminalTypeOption enables TTYPE negotiation on a Server. Once the client
+// agrees, it is asked for each of its terminal types in turn, following the
+// MTTS convention, and what it reports is recorded with
+// SetTerminalCapabilities. Connection.RefreshTerminalType asks again.
 func TerminalTypeOption(c *telnet.Connection) telnet.Negotiator {
 	return &TerminalTypeHandler{client: false}
 }
 
+var _ telnet.TerminalTypeRefresher = (*TerminalTypeHandler)(nil)
+
 // TerminalTypeHandler negotiates TerminalType for a specific connection.
 type TerminalTypeHandler struct {
 	client bool
+
+	mu         sync.Mutex
+	sentDo     bool
+	types      []string
+	refreshing bool   // asking again, for RefreshTerminalType
+	skip       bool   // the next report may end the list asked for before
+	last       string // the last type of that list
 }
 
 // OptionCode returns with the code used to negotiate TerminalType modes.
@@ -19,29 +47,148 @@ func (e *TerminalTypeHandler) OptionCode() byte {
 	return telnet.TeloptTTYPE
 }
 
-// Offer is called when a new connection is initiated. It offers the handler
-// an opportunity to advertise or request an option.
+// Offer asks the client to report its terminal type on a Server.
 func (e *TerminalTypeHandler) Offer(c *telnet.Connection) {
 	if !e.client {
-		c.Conn.Write([]byte{telnet.IAC, telnet.WILL, e.OptionCode()})
+		e.sentDo = true
+		c.WriteCommand(telnet.DO, e.OptionCode())
 	}
 }
 
-// HandleDo is called when an IAC DO command is received for this option,
-// indicating the client is requesting the option to be enabled.
+// HandleDo refuses to report a terminal type of our own.
 func (e *TerminalTypeHandler) HandleDo(c *telnet.Connection) {
-
+	c.WriteCommand(telnet.WONT, e.OptionCode())
 }
 
-// HandleWill is called when an IAC WILL command is received for this
-// option, indicating the client is willing to enable this option.
+// HandleWill agrees to the client reporting its terminal type, unless it
+// answers our request, and asks for the first.
 func (e *TerminalTypeHandler) HandleWill(c *telnet.Connection) {
+	if e.client || c.RemoteEnabled(e.OptionCode()) {
+		return
+	}
+	e.mu.Lock()
+	sentDo := e.sentDo
+	e.sentDo = false
+	e.types = nil
+	e.refreshing, e.skip = false, false
+	e.mu.Unlock()
+	if !sentDo {
+		c.WriteCommand(telnet.DO, e.OptionCode())
+	}
+	c.SetRemoteEnabled(e.OptionCode(), true)
+	e.send(c)
+}
 
+// HandleRefused forgets our request, so that the client offering its terminal
+// type later is agreed to.
+func (e *TerminalTypeHandler) HandleRefused(c *telnet.Connection, local bool) {
+	if !local {
+		e.mu.Lock()
+		e.sentDo = false
+		e.mu.Unlock()
+	}
 }
 
-// HandleSB is called when a subnegotiation command is received for this
-// option. body contains the bytes between `IAC SB <OptionCode>` and `IAC
-// SE`.
+// RefreshTerminalType asks the client for its terminal types again, for
+// Connection.RefreshTerminalType. The types known before are kept until the
+// client has reported the new list in full.
+func (e *TerminalTypeHandler) RefreshTerminalType(c *telnet.Connection) error {
+	if e.client {
+		return telnet.ErrUnsupported
+	}
+	e.mu.Lock()
+	e.last = ""
+	if n := len(e.types); n > 0 {
+		e.last = e.types[n-1]
+	}
+	e.types = nil
+	e.refreshing, e.skip = true, true
+	e.mu.Unlock()
+	return e.send(c)
+}
+
+// HandleSB records a terminal type the client reports, asking for the next
+// until the client repeats itself, as it does at the end of its list, or
+// reports its MTTS flags.
 func (e *TerminalTypeHandler) HandleSB(c *telnet.Connection, body []byte) {
+	if e.client || len(body) == 0 || body[0] != telnet.TelQualIS {
+		return
+	}
+	more, tc, ok := e.record(string(body[1:]))
+	if more {
+		e.send(c)
+	}
+	if ok {
+		c.SetTerminalCapabilities(tc)
+	}
+}
+
+// record records a terminal type reported, returning whether to ask for the
+// next, and the capabilities to record if the list is to be recorded.
+func (e *TerminalTypeHandler) record(name string) (more bool, tc telnet.TerminalCapabilities, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.skip {
+		// Asked again, a client still at the end of its list reports the
+		// last type once more before starting over.
+		e.skip = false
+		if name == e.last || strings.HasPrefix(name, "MTTS ") {
+			return true, tc, false
+		}
+	}
+	if len(e.types) > 0 && e.types[len(e.types)-1] == name {
+		if e.refreshing {
+			e.refreshing = false
+			return false, e.capabilities(), true
+		}
+		return false, tc, false
+	}
+	e.types = append(e.types, name)
+	done := strings.HasPrefix(name, "MTTS ") || len(e.types) >= maxTerminalTypes
+	if done || !e.refreshing {
+		e.refreshing = false
+		return !done, e.capabilities(), true
+	}
+	return true, tc, false
+}
+
+// capabilities returns what the terminal types reported say of the terminal.
+func (e *TerminalTypeHandler) capabilities() telnet.TerminalCapabilities {
+	tc := telnet.TerminalCapabilities{Types: append([]string(nil), e.types...)}
+	if flags, ok := strings.CutPrefix(tc.Types[len(tc.Types)-1], "MTTS "); ok {
+		tc.MTTS, _ = strconv.Atoi(flags)
+	}
+	return tc
+}
 
+// send asks the client for its next terminal type.
+func (e *TerminalTypeHandler) send(c *telnet.Connection) error {
+	return c.WriteSubnegotiation(e.OptionCode(), []byte{telnet.TelQualSEND})
+}
+
+// TerminalTypeMessage is the body of a TTYPE subnegotiation, as decoded by its
+// telnet.Codec: a request for the terminal type, with the Qualifier
+// telnet.TelQualSEND, or a reply naming it, with telnet.TelQualIS.
+type TerminalTypeMessage struct {
+	Qualifier byte
+	Name      string
+}
+
+// terminalTypeCodec is the telnet.Codec of TTYPE.
+type terminalTypeCodec struct{}
+
+func (terminalTypeCodec) Decode(body []byte) (any, error) {
+	if len(body) == 0 || body[0] != telnet.TelQualIS && body[0] != telnet.TelQualSEND ||
+		body[0] == telnet.TelQualSEND && len(body) > 1 {
+		return nil, errors.New("options: malformed TTYPE subnegotiation")
+	}
+	return TerminalTypeMessage{Qualifier: body[0], Name: string(body[1:])}, nil
+}
+
+func (terminalTypeCodec) Encode(v any) ([]byte, error) {
+	m, ok := v.(TerminalTypeMessage)
+	if !ok {
+		return nil, fmt.Errorf("options: cannot encode %T as TTYPE", v)
+	}
+	return append([]byte{m.Qualifier}, m.Name...), nil
 }
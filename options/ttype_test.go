@@ -0,0 +1,171 @@
+package options_test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// ttypeIS returns a TTYPE IS subnegotiation reporting name.
+func ttypeIS(name string) []byte {
+	b := []byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualIS}
+	return append(append(b, name...), telnet.IAC, telnet.SE)
+}
+
+var ttypeSend = []byte{telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualSEND, telnet.IAC, telnet.SE}
+
+func TestServerTerminalType(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		reported []string
+		expected telnet.TerminalCapabilities
+	}{
+		{"single", []string{"XTERM", "XTERM"}, telnet.TerminalCapabilities{Types: []string{"XTERM"}}},
+		{"mtts", []string{"MUDLET", "ANSI-TRUECOLOR", "MTTS 2317"},
+			telnet.TerminalCapabilities{Types: []string{"MUDLET", "ANSI-TRUECOLOR", "MTTS 2317"}, MTTS: 2317}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			peer, conn := telnettest.NewPeer(options.TerminalTypeOption)
+			defer peer.Close()
+			defer conn.Close()
+			go io.Copy(io.Discard, conn)
+			peer.Run(t,
+				telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+				telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptTTYPE),
+				telnettest.Expect(ttypeSend...),
+			)
+			for i, name := range tc.reported {
+				peer.Run(t, telnettest.Send(ttypeIS(name)...))
+				if i < len(tc.reported)-1 {
+					peer.Run(t, telnettest.Expect(ttypeSend...))
+				}
+			}
+			// The refused DO 200 shows when the reports have been handled.
+			peer.Run(t,
+				telnettest.Send(telnet.IAC, telnet.DO, 200),
+				telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+			)
+			if got := conn.TerminalCapabilities(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// The peer is not asked again once the list has ended.
+func TestServerTerminalType_Ended(t *testing.T) {
+	peer, conn := telnettest.NewPeer(options.TerminalTypeOption)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptTTYPE),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("VT100")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("VT100")...),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+}
+
+// The peer offering TTYPE after refusing or disabling it is agreed to.
+func TestServerTerminalType_Reenabled(t *testing.T) {
+	peer, conn := telnettest.NewPeer(options.TerminalTypeOption)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+		telnettest.Send(telnet.IAC, telnet.WONT, telnet.TeloptTTYPE),
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptTTYPE),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(telnet.IAC, telnet.WONT, telnet.TeloptTTYPE),
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptTTYPE),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+		telnettest.Expect(ttypeSend...),
+	)
+}
+
+func TestServerTerminalType_Refresh(t *testing.T) {
+	peer, conn := telnettest.NewPeer(options.TerminalTypeOption)
+	defer peer.Close()
+	defer conn.Close()
+	sub := conn.Subscribe(16)
+	go io.Copy(io.Discard, conn)
+	peer.Run(t, telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE))
+	if err := conn.RefreshTerminalType(); err != telnet.ErrUnsupported {
+		t.Errorf("Expected ErrUnsupported before the client agrees, got %v", err)
+	}
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptTTYPE),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("MUDLET")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("ANSI")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("MTTS 137")...),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	before := telnet.TerminalCapabilities{Types: []string{"MUDLET", "ANSI", "MTTS 137"}, MTTS: 137}
+
+	// The client, still at the end of its list, repeats its MTTS flags
+	// before starting over with its new emulation.
+	if err := conn.RefreshTerminalType(); err != nil {
+		t.Fatal(err)
+	}
+	peer.Run(t,
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("MTTS 137")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("MUDLET")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(ttypeIS("XTERM-256COLOR")...),
+		telnettest.Expect(ttypeSend...),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	if got := conn.TerminalCapabilities(); !reflect.DeepEqual(got, before) {
+		t.Errorf("Expected %v until the list is complete, got %v", before, got)
+	}
+	peer.Run(t,
+		telnettest.Send(ttypeIS("MTTS 141")...),
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	after := telnet.TerminalCapabilities{Types: []string{"MUDLET", "XTERM-256COLOR", "MTTS 141"}, MTTS: 141}
+	if got := conn.TerminalCapabilities(); !reflect.DeepEqual(got, after) {
+		t.Errorf("Expected %v, got %v", after, got)
+	}
+
+	var last telnet.TerminalCapabilities
+	events := 0
+	for len(sub.C) > 0 {
+		if e, ok := (<-sub.C).(telnet.TerminalTypeEvent); ok {
+			last = e.TerminalCapabilities
+			events++
+		}
+	}
+	if events != 4 || !reflect.DeepEqual(last, after) {
+		t.Errorf("Expected 4 TerminalTypeEvents ending with %v, got %d ending with %v", after, events, last)
+	}
+}
+
+func TestTerminalTypeCodec(t *testing.T) {
+	codec := telnet.LookupCodec(telnet.TeloptTTYPE)
+	v, err := codec.Decode([]byte("\x00XTERM"))
+	if err != nil || v != (options.TerminalTypeMessage{Qualifier: telnet.TelQualIS, Name: "XTERM"}) {
+		t.Errorf("Decode = %v, %v", v, err)
+	}
+	body, err := codec.Encode(options.TerminalTypeMessage{Qualifier: telnet.TelQualSEND})
+	if err != nil || !reflect.DeepEqual(body, []byte{telnet.TelQualSEND}) {
+		t.Errorf("Encode = %v, %v", body, err)
+	}
+}
@@ -0,0 +1,53 @@
+package telnet
+
+import "sync/atomic"
+
+// optionSet is a fixed-size set of option codes. It needs no allocation and is
+// safe for concurrent use without locking.
+type optionSet [256 / 32]uint32
+
+// has reports whether the option is in the set.
+func (s *optionSet) has(option byte) bool {
+	return atomic.LoadUint32(&s[option/32])&(1<<(option%32)) != 0
+}
+
+// set adds or removes the option from the set, reporting whether the set
+// changed.
+func (s *optionSet) set(option byte, on bool) bool {
+	word, bit := &s[option/32], uint32(1)<<(option%32)
+	for {
+		old := atomic.LoadUint32(word)
+		new := old &^ bit
+		if on {
+			new |= bit
+		}
+		if old == new {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(word, old, new) {
+			return true
+		}
+	}
+}
+
+// names returns the names of the options in the set, in order of option code.
+func (s *optionSet) names() []string {
+	names := []string{}
+	for o := 0; o < 256; o++ {
+		if s.has(byte(o)) {
+			names = append(names, optionName(byte(o)))
+		}
+	}
+	return names
+}
+
+// codes returns the option codes in the set, in order.
+func (s *optionSet) codes() []byte {
+	var codes []byte
+	for o := 0; o < 256; o++ {
+		if s.has(byte(o)) {
+			codes = append(codes, byte(o))
+		}
+	}
+	return codes
+}
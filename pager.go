@@ -0,0 +1,169 @@
+package telnet
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrPagingStopped is returned by a Paginator's Write once the user has asked
+// for no more output.
+var ErrPagingStopped = errors.New("telnet: paging stopped by the user")
+
+// DefaultMorePrompt is the prompt a Paginator writes when Prompt is empty.
+const DefaultMorePrompt = "--More--"
+
+// Paginator is a Writer that pauses output to a Connection each time it has
+// filled the client's window, as reported by WindowSize, writing a prompt
+// with WritePrompt and waiting for a key: space or any other key shows the
+// next page, Enter one more line, and q stops the output. Lines longer than
+// the window is wide are counted as the lines they wrap onto. The window size
+// is checked at each line, so the pages follow the window being resized.
+//
+// While it waits, a Paginator reads from the Connection, so nothing else may.
+// If the window height is not known, output is not paused.
+type Paginator struct {
+	// Prompt is written when a page is full. If empty, DefaultMorePrompt is
+	// used.
+	Prompt string
+
+	conn    *Connection
+	lines   int  // lines shown since the last pause
+	col     int  // column of the current line
+	escape  byte // state of a control sequence being skipped: ESC or '['
+	stopped bool
+}
+
+// NewPaginator returns a Paginator writing to c.
+func NewPaginator(c *Connection) *Paginator {
+	return &Paginator{conn: c}
+}
+
+// Reset starts a new page, such as after the user has entered a command, and
+// allows output again after it was stopped.
+func (p *Paginator) Reset() {
+	p.lines, p.col, p.stopped = 0, 0, false
+}
+
+// Write writes b, pausing whenever the window is full. If the user stops the
+// output, it returns the number of bytes written before the pause and
+// ErrPagingStopped, as do later calls until Reset.
+func (p *Paginator) Write(b []byte) (n int, err error) {
+	if p.stopped {
+		return 0, ErrPagingStopped
+	}
+	start := 0
+	for i, ch := range b {
+		end := i + 1
+		switch p.advance(ch) {
+		case noBreak:
+			continue
+		case wrapBefore:
+			end = i
+		}
+		_, height := p.conn.WindowSize()
+		if height < 2 || p.lines < height-1 {
+			continue
+		}
+		nn, err := p.conn.Write(b[start:end])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		start = end
+		if err := p.pause(); err != nil {
+			return n, err
+		}
+	}
+	nn, err := p.conn.Write(b[start:])
+	return n + nn, err
+}
+
+// Line breaks found by advance
+const (
+	noBreak    = iota
+	breakAfter // the character ends a line
+	wrapBefore // the character wraps onto a new line
+)
+
+// advance counts ch as written, reporting whether it breaks a line.
+func (p *Paginator) advance(ch byte) int {
+	switch {
+	case p.escape == Escape:
+		p.escape = 0
+		if ch == '[' {
+			p.escape = ch
+		}
+		return noBreak
+	case p.escape == '[':
+		if ch >= 0x40 && ch <= 0x7e {
+			p.escape = 0
+		}
+		return noBreak
+	case ch == Escape:
+		p.escape = ch
+		return noBreak
+	case ch == '\n':
+		p.lines++
+		p.col = 0
+		return breakAfter
+	case ch == '\r':
+		p.col = 0
+		return noBreak
+	case ch < 0x20 || ch >= 0x80 && ch < 0xc0:
+		// Control characters and UTF-8 continuation bytes take no space.
+		return noBreak
+	}
+	p.col++
+	if width, _ := p.conn.WindowSize(); width > 0 && p.col > width {
+		p.lines++
+		p.col = 1
+		return wrapBefore
+	}
+	return noBreak
+}
+
+// pause writes the prompt and waits for a key, then erases the prompt.
+func (p *Paginator) pause() error {
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = DefaultMorePrompt
+	}
+	if err := p.conn.WritePrompt(prompt); err != nil {
+		return err
+	}
+	key, err := p.readKey()
+	if err != nil {
+		return err
+	}
+	if _, err := p.conn.Write([]byte("\r" + strings.Repeat(" ", len(prompt)) + "\r")); err != nil {
+		return err
+	}
+	switch key {
+	case 'q', 'Q':
+		p.stopped = true
+		return ErrPagingStopped
+	case '\n':
+		p.lines--
+	default:
+		p.lines = 0
+	}
+	return nil
+}
+
+// readKey reads a key. If the client is sending whole lines, rather than
+// characters as they are typed, the rest of the line is discarded.
+func (p *Paginator) readKey() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := p.conn.Read(b); err != nil {
+		return 0, err
+	}
+	key := b[0]
+	if !p.conn.LocalEnabled(TeloptECHO) {
+		for ch := key; ch != '\n'; ch = b[0] {
+			if _, err := p.conn.Read(b); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,92 @@
+package telnet_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// readUntil reads from c until what has been read ends with suffix.
+func readUntil(t *testing.T, c net.Conn, suffix string) string {
+	t.Helper()
+	var got []byte
+	b := make([]byte, 64)
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	defer c.SetReadDeadline(time.Time{})
+	for !bytes.HasSuffix(got, []byte(suffix)) {
+		n, err := c.Read(b)
+		got = append(got, b[:n]...)
+		if err != nil {
+			t.Fatalf("Expected output ending %q, got %q, %v", suffix, got, err)
+		}
+	}
+	return string(got)
+}
+
+func TestPaginator(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.SetWindowSize(80, 4)
+	p := telnet.NewPaginator(conn)
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := p.Write([]byte("1\n2\n3\n4\n5\n6\n7\n"))
+		done <- result{n, err}
+	}()
+	more := "--More--\xff\xf9"
+	if got := readUntil(t, b, more); got != "1\r\n2\r\n3\r\n"+more {
+		t.Errorf("Expected the first page, got %q", got)
+	}
+	b.Write([]byte(" \r\n"))
+	erase := "\r\x00        \r\x00"
+	if got := readUntil(t, b, more); got != erase+"4\r\n5\r\n6\r\n"+more {
+		t.Errorf("Expected the second page, got %q", got)
+	}
+	b.Write([]byte("q\r\n"))
+	if r := <-done; r.n != 12 || r.err != telnet.ErrPagingStopped {
+		t.Errorf("Expected 12, %v, got %d, %v", telnet.ErrPagingStopped, r.n, r.err)
+	}
+	if _, err := p.Write([]byte("more")); err != telnet.ErrPagingStopped {
+		t.Errorf("Expected %v, got %v", telnet.ErrPagingStopped, err)
+	}
+
+	// Long lines wrap, and a resized window is followed.
+	p.Reset()
+	conn.SetWindowSize(4, 3)
+	go func() {
+		n, err := p.Write([]byte(strings.Repeat("x", 10)))
+		done <- result{n, err}
+	}()
+	if got := readUntil(t, b, more); got != erase+"xxxxxxxx"+more {
+		t.Errorf("Expected two wrapped lines, got %q", got)
+	}
+	b.Write([]byte("\r\n"))
+	if r := <-done; r.n != 10 || r.err != nil {
+		t.Errorf("Expected 10, <nil>, got %d, %v", r.n, r.err)
+	}
+}
+
+func TestConnection_WritePrompt(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.WritePrompt("> ")
+	conn.SetLocalEnabled(telnet.TeloptSGA, true)
+	conn.WritePrompt("> ")
+	conn.SetLocalEnabled(telnet.TeloptEOR, true)
+	conn.WritePrompt("> ")
+	if got, want := readUntil(t, b, "\xff\xef"), "> \xff\xf9> > \xff\xef"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
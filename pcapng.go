@@ -0,0 +1,218 @@
+package telnet
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// pcapng block types and the link type used - https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+const (
+	pcapngSectionHeader       = 0x0a0d0d0a
+	pcapngInterfaceDescriptor = 0x00000001
+	pcapngEnhancedPacket      = 0x00000006
+	pcapngByteOrderMagic      = 0x1a2b3c4d
+	pcapngLinkTypeRaw         = 101 // raw IPv4 or IPv6
+)
+
+// TCP flags
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// pcapngMaxPayload is the most stream data put in a single synthetic segment.
+const pcapngMaxPayload = 65000
+
+// PcapNG returns a ConnectionTrace that writes the telnet stream of conn to w
+// as a pcapng capture, for viewing with Wireshark and similar tools. The
+// stream is framed as TCP segments between conn's local and remote addresses,
+// starting with a synthetic handshake; if either is not a TCP address, a
+// loopback address is substituted. Wireshark only applies its telnet dissector
+// to port 23 by default, so on other ports use "Decode As... TELNET". The
+// capture holds the stream as the parser sees it, after any StageCompression
+// and StageEncryption transforms.
+//
+// The file header and handshake are written to w immediately. Writes to w are
+// serialized, and errors writing to it are ignored.
+func PcapNG(w io.Writer, conn *Connection) *ConnectionTrace {
+	p := &pcapngWriter{
+		w:      w,
+		now:    conn.now,
+		local:  tcpEndpoint(conn.LocalAddr(), net.IPv4(127, 0, 0, 1), 23),
+		remote: tcpEndpoint(conn.RemoteAddr(), net.IPv4(127, 0, 0, 2), 49152),
+		// Arbitrary initial sequence numbers
+		lseq: 1000,
+		rseq: 5000,
+	}
+	p.writeHeader()
+	return &ConnectionTrace{
+		WireRead:    func(b []byte) { p.segment(false, tcpPSH|tcpACK, b) },
+		WireWritten: func(b []byte) { p.segment(true, tcpPSH|tcpACK, b) },
+	}
+}
+
+// tcpEndpoint returns addr as a TCP address, or one made from the fallback IP
+// and port if it is not one.
+func tcpEndpoint(addr net.Addr, ip net.IP, port int) *net.TCPAddr {
+	if a, ok := addr.(*net.TCPAddr); ok && a.IP != nil {
+		return a
+	}
+	return &net.TCPAddr{IP: ip, Port: port}
+}
+
+// pcapngWriter writes pcapng captures for PcapNG.
+type pcapngWriter struct {
+	mu            sync.Mutex
+	w             io.Writer
+	now           func() time.Time // the traced Connection's Clock
+	local, remote *net.TCPAddr
+	lseq, rseq    uint32 // next sequence number from each end
+}
+
+// writeHeader writes the section header and interface description, then a
+// TCP handshake from the remote end.
+func (p *pcapngWriter) writeHeader() {
+	p.mu.Lock()
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	p.writeBlock(pcapngSectionHeader, shb)
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], pcapngLinkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[4:], 0) // no snapshot length limit
+	p.writeBlock(pcapngInterfaceDescriptor, idb)
+	p.mu.Unlock()
+
+	p.segment(false, tcpSYN, nil)
+	p.segment(true, tcpSYN|tcpACK, nil)
+	p.segment(false, tcpACK, nil)
+}
+
+// segment writes b as TCP segments from the local end if fromLocal is set, or
+// from the remote end otherwise.
+func (p *pcapngWriter) segment(fromLocal bool, flags byte, b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for first := true; first || len(b) > 0; first = false {
+		chunk := b
+		if len(chunk) > pcapngMaxPayload {
+			chunk = chunk[:pcapngMaxPayload]
+		}
+		b = b[len(chunk):]
+
+		src, dst, seq, ack := p.remote, p.local, &p.rseq, p.lseq
+		if fromLocal {
+			src, dst, seq, ack = p.local, p.remote, &p.lseq, p.rseq
+		}
+		if flags&tcpACK == 0 {
+			ack = 0
+		}
+		pkt := ipPacket(src, dst, tcpSegment(src, dst, *seq, ack, flags, chunk))
+		*seq += uint32(len(chunk))
+		if flags&(tcpSYN|tcpFIN) != 0 {
+			*seq++
+		}
+
+		now := p.now().UnixNano() / 1000
+		epb := make([]byte, 20, 20+len(pkt)+3)
+		binary.LittleEndian.PutUint32(epb[0:], 0) // interface
+		binary.LittleEndian.PutUint32(epb[4:], uint32(now>>32))
+		binary.LittleEndian.PutUint32(epb[8:], uint32(now))
+		binary.LittleEndian.PutUint32(epb[12:], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(epb[16:], uint32(len(pkt)))
+		epb = append(epb, pkt...)
+		p.writeBlock(pcapngEnhancedPacket, epb)
+	}
+}
+
+// writeBlock writes a pcapng block with the given type and body, padding the
+// body to a multiple of four bytes. The caller must hold p.mu.
+func (p *pcapngWriter) writeBlock(typ uint32, body []byte) {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	n := uint32(12 + len(body))
+	buf := make([]byte, 8, n)
+	binary.LittleEndian.PutUint32(buf[0:], typ)
+	binary.LittleEndian.PutUint32(buf[4:], n)
+	buf = append(buf, body...)
+	buf = binary.LittleEndian.AppendUint32(buf, n)
+	p.w.Write(buf)
+}
+
+// tcpSegment returns a TCP segment carrying payload from src to dst.
+func tcpSegment(src, dst *net.TCPAddr, seq, ack uint32, flags byte, payload []byte) []byte {
+	seg := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(seg[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(seg[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint32(seg[4:], seq)
+	binary.BigEndian.PutUint32(seg[8:], ack)
+	seg[12] = 5 << 4 // data offset
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], 65535) // window
+	seg = append(seg, payload...)
+
+	// The checksum covers a pseudo-header of the IP addresses, protocol and
+	// segment length.
+	var pseudo []byte
+	if s4, d4 := src.IP.To4(), dst.IP.To4(); s4 != nil && d4 != nil {
+		pseudo = append(append(pseudo, s4...), d4...)
+	} else {
+		pseudo = append(append(pseudo, src.IP.To16()...), dst.IP.To16()...)
+	}
+	pseudo = append(pseudo, 0, 6)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(seg)))
+	binary.BigEndian.PutUint16(seg[16:], checksum(pseudo, seg))
+	return seg
+}
+
+// ipPacket returns an IPv4 packet carrying seg from src to dst if both are
+// IPv4 addresses, or an IPv6 packet otherwise.
+func ipPacket(src, dst *net.TCPAddr, seg []byte) []byte {
+	if s4, d4 := src.IP.To4(), dst.IP.To4(); s4 != nil && d4 != nil {
+		hdr := make([]byte, 20, 20+len(seg))
+		hdr[0] = 0x45 // version 4, 5 word header
+		binary.BigEndian.PutUint16(hdr[2:], uint16(20+len(seg)))
+		binary.BigEndian.PutUint16(hdr[6:], 0x4000) // don't fragment
+		hdr[8] = 64                                 // TTL
+		hdr[9] = 6                                  // TCP
+		copy(hdr[12:], s4)
+		copy(hdr[16:], d4)
+		binary.BigEndian.PutUint16(hdr[10:], checksum(hdr))
+		return append(hdr, seg...)
+	}
+	hdr := make([]byte, 40, 40+len(seg))
+	hdr[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(hdr[4:], uint16(len(seg)))
+	hdr[6] = 6  // TCP
+	hdr[7] = 64 // hop limit
+	copy(hdr[8:], src.IP.To16())
+	copy(hdr[24:], dst.IP.To16())
+	return append(hdr, seg...)
+}
+
+// checksum returns the Internet checksum of the concatenated byte slices,
+// each of which but the last must be of even length.
+func checksum(bufs ...[]byte) uint16 {
+	var sum uint32
+	for _, b := range bufs {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,77 @@
+package telnet_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/tester2024/telnet"
+)
+
+func TestPcapNG(t *testing.T) {
+	var buf bytes.Buffer
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte{'h', 'i', telnet.IAC, telnet.DO, telnet.TeloptNAWS})
+		io.ReadFull(client, make([]byte, 3))
+		client.Close()
+	}()
+	conn := telnet.NewConnection(server, nil)
+	conn.Trace = telnet.PcapNG(&buf, conn)
+	ioutil.ReadAll(conn)
+	conn.Close()
+
+	b := buf.Bytes()
+	if len(b) < 12 || binary.LittleEndian.Uint32(b) != 0x0a0d0d0a {
+		t.Fatalf("Expected a section header block, got % x", b)
+	}
+	var (
+		flags    []byte
+		received []byte
+		sent     []byte
+	)
+	for len(b) > 0 {
+		typ, n := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if n < 12 || int(n) > len(b) || binary.LittleEndian.Uint32(b[n-4:]) != n {
+			t.Fatalf("Malformed block at % x", b)
+		}
+		if typ == 6 {
+			pkt := b[28 : 28+binary.LittleEndian.Uint32(b[20:])]
+			ip, seg := pkt[:20], pkt[20:]
+			if pkt[0] != 0x45 || ipChecksum(ip) != 0 {
+				t.Errorf("Bad IPv4 header % x", ip)
+			}
+			src := binary.BigEndian.Uint16(seg)
+			flags = append(flags, seg[13])
+			if src == 23 {
+				sent = append(sent, seg[20:]...)
+			} else {
+				received = append(received, seg[20:]...)
+			}
+		}
+		b = b[n:]
+	}
+	if !bytes.Equal(flags[:3], []byte{0x02, 0x12, 0x10}) {
+		t.Errorf("Expected a handshake, got flags % x", flags)
+	}
+	if string(received) != "hi\xff\xfd\x1f" {
+		t.Errorf("Expected %q received, got %q", "hi\xff\xfd\x1f", received)
+	}
+	if string(sent) != "\xff\xfc\x1f" {
+		t.Errorf("Expected %q sent, got %q", "\xff\xfc\x1f", sent)
+	}
+}
+
+func ipChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,55 @@
+// Package presets provides sets of option handlers suited to common kinds of
+// telnet service, so that a Server or Client negotiates sensibly in one line:
+//
+//	s := telnet.NewServer(":4000", h, presets.MUDServerOptions()...)
+//	conn, err := telnet.Dial("switch:23", presets.NetworkDeviceClientOptions()...)
+//
+// The sets are built from the options and mud packages, which import the
+// telnet package, so they are kept apart from it. Options missing from a set
+// are refused as usual; append others to a set to extend it.
+package presets
+
+import (
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/options"
+)
+
+// MUDServerOptions returns the options for a MUD server: the client is asked
+// for its window size and terminal types, including MTTS, and offered GMCP and
+// MCCP2 compression. Go-aheads are left on, as MUD clients use them to find
+// prompts.
+func MUDServerOptions() []telnet.Option {
+	return []telnet.Option{
+		options.NAWSOption,
+		options.TerminalTypeOption,
+		mud.GMCPOption,
+		mud.MCCP2Option,
+	}
+}
+
+// BBSOptions returns the options for a bulletin board server, which draws
+// full screens and handles each key as it is typed: the server echoes,
+// suppresses go-aheads and sends 8-bit data, and the client is asked for its
+// window size and terminal types.
+func BBSOptions() []telnet.Option {
+	return []telnet.Option{
+		options.EchoOption,
+		options.SuppressGoAheadOption,
+		options.BinaryOption,
+		options.NAWSOption,
+		options.TerminalTypeOption,
+	}
+}
+
+// NetworkDeviceClientOptions returns the options for a client scripting the
+// command line of a router, switch or other network device: it lets the
+// device echo and suppress go-aheads, as their command lines expect, and
+// refuses the rest, such as requests for the window size, so that the device
+// keeps its defaults.
+func NetworkDeviceClientOptions() []telnet.Option {
+	return []telnet.Option{
+		options.ExposeEcho,
+		options.ExposeSuppressGoAhead,
+	}
+}
@@ -0,0 +1,57 @@
+package presets_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/mud"
+	"github.com/tester2024/telnet/presets"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestMUDServerOptions(t *testing.T) {
+	peer, conn := telnettest.NewPeer(presets.MUDServerOptions()...)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptGMCP),
+		telnettest.Expect(telnet.IAC, telnet.WILL, mud.TeloptMCCP2),
+	)
+}
+
+func TestBBSOptions(t *testing.T) {
+	peer, conn := telnettest.NewPeer(presets.BBSOptions()...)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptECHO),
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptSGA),
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptBINARY),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptBINARY),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptTTYPE),
+	)
+}
+
+func TestNetworkDeviceClientOptions(t *testing.T) {
+	peer, conn := telnettest.NewPeer(presets.NetworkDeviceClientOptions()...)
+	defer peer.Close()
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	peer.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptECHO),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptECHO),
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptSGA),
+		telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptSGA),
+		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.WONT, telnet.TeloptNAWS),
+	)
+	if !conn.RemoteEnabled(telnet.TeloptECHO) || !conn.RemoteEnabled(telnet.TeloptSGA) {
+		t.Error("ECHO and SGA not enabled")
+	}
+}
@@ -0,0 +1,31 @@
+package telnet
+
+// Principal is the identity a Connection's peer has authenticated as.
+type Principal struct {
+	// Name identifies the user, such as a user name or a certificate's
+	// common name.
+	Name string
+	// Method is how the user authenticated, such as "certificate".
+	Method string
+}
+
+// principalKey is the key of the Principal stored with SetValue.
+type principalKey struct{}
+
+// Principal returns the identity the peer has authenticated as, or nil if it
+// has not.
+func (c *Connection) Principal() *Principal {
+	p, _ := c.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// SetPrincipal records the identity the peer has authenticated as, auditing
+// it as an AuditAuthSuccess; nil forgets it.
+func (c *Connection) SetPrincipal(p *Principal) {
+	if p == nil {
+		c.SetValue(principalKey{}, nil)
+		return
+	}
+	c.SetValue(principalKey{}, p)
+	c.Audit(AuditEvent{Type: AuditAuthSuccess, User: p.Name})
+}
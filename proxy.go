@@ -0,0 +1,248 @@
+package telnet
+
+import (
+	"context"
+	"io"
+)
+
+// ProxyDirection is the direction of traffic through a Proxy.
+type ProxyDirection int
+
+const (
+	// ToServer is traffic from the client to the upstream server.
+	ToServer ProxyDirection = iota
+	// ToClient is traffic from the upstream server to the client.
+	ToClient
+)
+
+func (d ProxyDirection) String() string {
+	if d == ToServer {
+		return "to server"
+	}
+	return "to client"
+}
+
+// ProxyFilter is a set of hooks for observing and modifying the traffic through
+// a Proxy. Any hook may be nil. The Data hook for each direction is called
+// from the goroutine relaying data that way, and the others from the
+// negotiation goroutine of the Connection the traffic was received on.
+type ProxyFilter struct {
+	// Data is called with the application data received from one side, and
+	// returns the data to send to the other: b itself, other data, or nothing
+	// to drop it. b is only valid until Data returns.
+	Data func(dir ProxyDirection, b []byte) []byte
+
+	// Command is called with each command received from one side, and returns
+	// the command to send to the other in its place, or false to drop it. For
+	// commands without an option, such as GA, option is zero. A filter may
+	// answer a command itself by writing to the Proxy's Client or Server.
+	Command func(dir ProxyDirection, cmd, option byte) (byte, bool)
+
+	// Subnegotiation is called with each subnegotiation received from one
+	// side, and returns the body to send to the other in its place, or false
+	// to drop it. body is only valid until Subnegotiation returns.
+	Subnegotiation func(dir ProxyDirection, option byte, body []byte) ([]byte, bool)
+
+	// Option is called with the option of each option command and
+	// subnegotiation received from one side, after the filter's Command or
+	// Subnegotiation hook, and returns the option to send it as to the other.
+	// It lets a filter relay one option as another, as a Translator
+	// converting between protocols does. Later filters see the new option.
+	Option func(dir ProxyDirection, option byte) byte
+}
+
+// Proxy relays a telnet session between a client and an upstream server,
+// passing on data, commands and subnegotiations in both directions through
+// its Filters. It is the basis for gateways that log, translate or rewrite
+// telnet traffic:
+//
+//	server, err := telnet.Dial(upstream)
+//	...
+//	p := telnet.NewProxy(client, server)
+//	p.Filters = append(p.Filters, &telnet.ProxyFilter{Data: logData})
+//	err = p.Run()
+//
+// The Proxy takes over negotiation on both Connections, so they should be
+// created without options, except for those its Policies terminate. Options
+// are recorded as enabled on each side as the commands enabling them pass
+// through. Commands and subnegotiations are relayed by the negotiation
+// goroutine of the Connection they were received on, so their order relative
+// to the data around them is not preserved.
+type Proxy struct {
+	// Client is the Connection from the client, and Server the Connection to
+	// the upstream server.
+	Client, Server *Connection
+
+	// Filters are applied in turn to the traffic in both directions. They
+	// must be set before Run is called.
+	Filters []*ProxyFilter
+
+	// Policies set how the Proxy treats each option; an option without one
+	// is passed through. They must be set before Run is called.
+	Policies map[byte]OptionPolicy
+}
+
+// OptionPolicy is how a Proxy treats an option.
+type OptionPolicy int
+
+const (
+	// OptionPassThrough relays the option's negotiation and subnegotiations
+	// from each side to the other, through the Filters.
+	OptionPassThrough OptionPolicy = iota
+	// OptionTerminate has each Connection negotiate the option with its
+	// peer itself, with its OptionHandlers, relaying none of it. It lets a
+	// proxy end a stream option at itself - compressing the stream to the
+	// client with MCCP, say, while the server sends it uncompressed - since
+	// the transforms the handlers add then apply to one side only, and the
+	// data between the sides is relayed decoded.
+	OptionTerminate
+	// OptionBlock refuses the option to both sides, or ignores it where a
+	// Connection's Unhandled policy says to, relaying none of its
+	// negotiation and dropping its subnegotiations.
+	OptionBlock
+)
+
+// NewProxy returns a Proxy relaying between client and server. It sets
+// RawNewlines on both, so line endings are passed on unchanged. It must be
+// called as soon as they are made, before either is read from or written to,
+// so that the Proxy sees all the commands they receive and no request is
+// taken as refused at the end of their NegotiationTimeout.
+func NewProxy(client, server *Connection) *Proxy {
+	p := &Proxy{Client: client, Server: server}
+	client.RawNewlines = true
+	server.RawNewlines = true
+	// The relays are read by the negotiation goroutines, already running.
+	client.setRelay(func(n negotiation) error { return p.relay(ToServer, n) })
+	server.setRelay(func(n negotiation) error { return p.relay(ToClient, n) })
+	return p
+}
+
+// Run relays the session until either side closes it or fails, then closes
+// both. It returns the error that ended the session, or nil if it was closed
+// by either side.
+func (p *Proxy) Run() error {
+	errs := make(chan error, 2)
+	go func() { errs <- p.copy(ToServer) }()
+	go func() { errs <- p.copy(ToClient) }()
+	err := <-errs
+	p.Client.Close()
+	p.Server.Close()
+	<-errs
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// ends returns the Connections traffic in the given direction is received on
+// and sent to.
+func (p *Proxy) ends(dir ProxyDirection) (from, to *Connection) {
+	if dir == ToServer {
+		return p.Client, p.Server
+	}
+	return p.Server, p.Client
+}
+
+// copy relays data in one direction until reading or writing fails.
+func (p *Proxy) copy(dir ProxyDirection) error {
+	from, to := p.ends(dir)
+	buf := make([]byte, 4096)
+	for {
+		n, err := from.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+			for _, f := range p.Filters {
+				if f.Data != nil && len(data) > 0 {
+					data = f.Data(dir, data)
+				}
+			}
+			if len(data) > 0 {
+				if _, err := to.Write(data); err != nil {
+					return err
+				}
+			}
+		}
+		if _, ok := err.(*SubnegotiationTooLargeError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RunContext is like Run, but also ends the session once ctx is done,
+// returning ctx's error.
+func (p *Proxy) RunContext(ctx context.Context) error {
+	return runContext(ctx, p.Client, p.Server, p.Run)
+}
+
+// relay passes on a command or subnegotiation received from one side, unless
+// the option's policy says otherwise.
+func (p *Proxy) relay(dir ProxyDirection, n negotiation) error {
+	from, to := p.ends(dir)
+	if n.cmd == SB || n.cmd >= WILL && n.cmd <= DONT {
+		switch p.Policies[n.option] {
+		case OptionTerminate:
+			return from.handle(n)
+		case OptionBlock:
+			switch n.cmd {
+			case WILL:
+				return from.refuse(DONT, n.option)
+			case DO:
+				return from.refuse(WONT, n.option)
+			}
+			return nil
+		}
+	}
+	option := n.option
+	if n.cmd == SB {
+		body := n.body
+		for _, f := range p.Filters {
+			if f.Subnegotiation != nil {
+				var ok bool
+				if body, ok = f.Subnegotiation(dir, option, body); !ok {
+					return nil
+				}
+			}
+			if f.Option != nil {
+				option = f.Option(dir, option)
+			}
+		}
+		return to.WriteSubnegotiation(option, body)
+	}
+
+	switch n.cmd {
+	case WILL, WONT:
+		from.clientWont.set(n.option, n.cmd == WONT)
+		from.SetRemoteEnabled(n.option, n.cmd == WILL)
+	case DO, DONT:
+		from.clientDont.set(n.option, n.cmd == DONT)
+		if n.cmd == DONT {
+			from.SetLocalEnabled(n.option, false)
+		}
+	}
+	cmd := n.cmd
+	for _, f := range p.Filters {
+		if f.Command != nil {
+			var ok bool
+			if cmd, ok = f.Command(dir, cmd, option); !ok {
+				return nil
+			}
+		}
+		if f.Option != nil && cmd >= WILL && cmd <= DONT {
+			option = f.Option(dir, option)
+		}
+	}
+	switch cmd {
+	case WILL, WONT:
+		to.SetLocalEnabled(option, cmd == WILL)
+	case DONT:
+		to.SetRemoteEnabled(option, false)
+	case DO:
+	default:
+		_, err := to.RawWrite([]byte{IAC, cmd})
+		return err
+	}
+	return to.WriteCommand(cmd, option)
+}
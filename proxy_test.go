@@ -0,0 +1,195 @@
+package telnet_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+// newProxy returns a Proxy between peers playing the client and the server.
+func newProxy() (p *telnet.Proxy, client, server *telnettest.Peer) {
+	c, pc := telnettest.Pipe()
+	ps, s := telnettest.Pipe()
+	p = telnet.NewProxy(telnet.NewConnection(pc, nil), telnet.NewConnection(ps, nil))
+	return p, &telnettest.Peer{Conn: c}, &telnettest.Peer{Conn: s}
+}
+
+func TestProxy(t *testing.T) {
+	p, client, server := newProxy()
+	done := make(chan error)
+	go func() { done <- p.Run() }()
+
+	// Data and commands are relayed separately, so each is sent and checked
+	// in turn.
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+	client.Run(t, telnettest.Send('h', 'i', '\r', '\n', telnet.IAC, telnet.IAC))
+	server.Run(t,
+		telnettest.Expect('h', 'i', '\r', '\n', telnet.IAC, telnet.IAC),
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptECHO, telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualSEND, telnet.IAC, telnet.SE),
+	)
+	client.Run(t, telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptECHO, telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualSEND, telnet.IAC, telnet.SE))
+	server.Run(t, telnettest.Send(telnet.IAC, telnet.GA))
+	client.Run(t, telnettest.Expect(telnet.IAC, telnet.GA))
+
+	client.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if !p.Client.LocalEnabled(telnet.TeloptECHO) || !p.Server.RemoteEnabled(telnet.TeloptECHO) {
+		t.Error("Expected ECHO to be enabled on both sides")
+	}
+}
+
+func TestProxy_Filters(t *testing.T) {
+	p, client, server := newProxy()
+	p.Filters = []*telnet.ProxyFilter{
+		{
+			// Refuse NAWS on the server's behalf.
+			Command: func(dir telnet.ProxyDirection, cmd, option byte) (byte, bool) {
+				if dir == telnet.ToServer && cmd == telnet.WILL && option == telnet.TeloptNAWS {
+					p.Client.WriteCommand(telnet.DONT, option)
+					return 0, false
+				}
+				return cmd, true
+			},
+			Data: func(dir telnet.ProxyDirection, b []byte) []byte {
+				if dir == telnet.ToClient {
+					return bytes.ToUpper(b)
+				}
+				return b
+			},
+		},
+		{
+			Subnegotiation: func(dir telnet.ProxyDirection, option byte, body []byte) ([]byte, bool) {
+				return append([]byte("x"), body...), true
+			},
+		},
+	}
+	go p.Run()
+	defer p.Client.Close()
+
+	client.Run(t,
+		telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.DONT, telnet.TeloptNAWS),
+		telnettest.Send(telnet.IAC, telnet.SB, 200, 'a', telnet.IAC, telnet.SE),
+	)
+	server.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.SB, 200, 'x', 'a', telnet.IAC, telnet.SE),
+		telnettest.Send('o', 'k'),
+	)
+	client.Run(t, telnettest.Expect('O', 'K'))
+}
+
+func init() {
+	telnet.RegisterTranslator("test-renumber", func(p *telnet.Proxy) *telnet.ProxyFilter {
+		return &telnet.ProxyFilter{Option: func(dir telnet.ProxyDirection, option byte) byte {
+			if option == 200 {
+				return 201
+			}
+			return option
+		}}
+	})
+}
+
+func TestProxy_Translate(t *testing.T) {
+	p, client, server := newProxy()
+	if err := p.Translate("test-renumber", "no-such-translator"); err == nil {
+		t.Error("Expected an error for an unknown translator")
+	}
+	if len(p.Filters) != 0 {
+		t.Errorf("Expected no filters to be installed, got %d", len(p.Filters))
+	}
+	if err := p.Translate("test-renumber"); err != nil {
+		t.Fatal(err)
+	}
+	go p.Run()
+	defer p.Client.Close()
+
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.WILL, 200, telnet.IAC, telnet.SB, 200, 'a', telnet.IAC, telnet.SE))
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.WILL, 201, telnet.IAC, telnet.SB, 201, 'a', telnet.IAC, telnet.SE))
+}
+
+func TestProxy_NegotiationTimeout(t *testing.T) {
+	clock := telnettest.NewFakeClock(time.Now())
+	c, pc := telnettest.Pipe()
+	ps, s := telnettest.Pipe()
+	local := &localOption{option: 201, sb: make(chan string, 1)}
+	conn := telnet.NewConnectionConfig(pc, &telnet.Config{
+		Options: []telnet.Option{func(*telnet.Connection) telnet.Negotiator { return local }},
+		Clock:   clock,
+	})
+	// The relay is installed while the negotiation goroutine is timing the
+	// requests.
+	clock.BlockUntil(1)
+	go clock.Advance(telnet.DefaultNegotiationTimeout)
+	p := telnet.NewProxy(conn, telnet.NewConnection(ps, nil))
+	go p.Run()
+	defer p.Client.Close()
+
+	client, server := &telnettest.Peer{Conn: c}, &telnettest.Peer{Conn: s}
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.WILL, 200))
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.WILL, 200))
+}
+
+// localOption is a handler enabling its option on our side when asked,
+// recording the subnegotiations received.
+type localOption struct {
+	option byte
+	sb     chan string
+}
+
+func (o *localOption) OptionCode() byte           { return o.option }
+func (o *localOption) Offer(c *telnet.Connection) {}
+func (o *localOption) HandleDo(c *telnet.Connection) {
+	c.WriteCommand(telnet.WILL, o.option)
+	c.SetLocalEnabled(o.option, true)
+}
+func (o *localOption) HandleWill(c *telnet.Connection)            { c.WriteCommand(telnet.DONT, o.option) }
+func (o *localOption) HandleSB(c *telnet.Connection, body []byte) { o.sb <- string(body) }
+
+func TestProxy_Policies(t *testing.T) {
+	c, pc := telnettest.Pipe()
+	ps, s := telnettest.Pipe()
+	local := &localOption{option: 201, sb: make(chan string, 1)}
+	p := telnet.NewProxy(
+		telnet.NewConnection(pc, []telnet.Option{func(*telnet.Connection) telnet.Negotiator { return local }}),
+		telnet.NewConnection(ps, nil))
+	p.Policies = map[byte]telnet.OptionPolicy{200: telnet.OptionBlock, 201: telnet.OptionTerminate}
+	client, server := &telnettest.Peer{Conn: c}, &telnettest.Peer{Conn: s}
+	done := make(chan error)
+	go func() { done <- p.RunContext(context.Background()) }()
+
+	// The proxy answers for 201 itself and refuses 200, relaying neither.
+	client.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, 201),
+		telnettest.Expect(telnet.IAC, telnet.WILL, 201),
+		telnettest.Send(telnet.IAC, telnet.SB, 201, 'h', 'i', telnet.IAC, telnet.SE),
+		telnettest.Send(telnet.IAC, telnet.WILL, 200),
+		telnettest.Expect(telnet.IAC, telnet.DONT, 200),
+		telnettest.Send(telnet.IAC, telnet.SB, 200, telnet.IAC, telnet.SE),
+	)
+	if body := <-local.sb; body != "hi" {
+		t.Errorf("Expected the subnegotiation handled by the proxy, got %q", body)
+	}
+	server.Run(t,
+		telnettest.Send(telnet.IAC, telnet.DO, 200),
+		telnettest.Expect(telnet.IAC, telnet.WONT, 200),
+	)
+	if !p.Client.LocalEnabled(201) || p.Server.RemoteEnabled(201) {
+		t.Error("Expected 201 enabled between the client and the proxy only")
+	}
+
+	// Other options still pass through.
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+
+	client.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,249 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// RateLimitAction is what a RateLimiter does with input exceeding its limits.
+type RateLimitAction int
+
+const (
+	// RateLimitDelay holds the input back until it is within the limits,
+	// slowing the peer down.
+	RateLimitDelay RateLimitAction = iota
+	// RateLimitWarn passes the input on, writing the Warning to the peer
+	// each time the limits are exceeded after being kept to.
+	RateLimitWarn
+	// RateLimitDisconnect drops the input and closes the Connection, with a
+	// *RateLimitError as its CloseReason.
+	RateLimitDisconnect
+)
+
+// RateLimitError is the CloseReason of a Connection closed by a RateLimiter,
+// and is passed to its OnExceeded hook.
+type RateLimitError struct {
+	// Limit is the limit exceeded: "bytes" or "lines".
+	Limit string
+}
+
+func (e *RateLimitError) Error() string {
+	return "telnet: input rate limit exceeded: " + e.Limit
+}
+
+// RateLimiter is a Transform limiting the rate of input from the peer with
+// token buckets, in bytes and lines per second, to protect servers from spam
+// bots and runaway scripts. It leaves what is written alone. Install it at
+// StageCharset:
+//
+//	l := telnet.NewRateLimiter(conn)
+//	l.LinesPerSecond, l.LineBurst = 5, 20
+//	l.Action, l.Warning = telnet.RateLimitWarn, "Slow down!\n"
+//	err := conn.AddTransform(telnet.StageCharset, l)
+//
+// Its fields must not be changed once it is installed.
+type RateLimiter struct {
+	// BytesPerSecond is the rate of input allowed in bytes, and ByteBurst the
+	// number of bytes that may arrive at once. If BytesPerSecond is zero,
+	// bytes are not limited; if ByteBurst is zero, it is a second's worth.
+	BytesPerSecond float64
+	ByteBurst      int
+
+	// LinesPerSecond and LineBurst limit the input in lines in the same way.
+	LinesPerSecond float64
+	LineBurst      int
+
+	// Action is what is done when the input exceeds the limits.
+	Action RateLimitAction
+
+	// Warning, if set, is written to the peer by RateLimitWarn, and by
+	// RateLimitDisconnect before it closes the Connection.
+	Warning string
+
+	// OnExceeded, if set, is called from Read each time the input exceeds
+	// the limits, before the Action is taken.
+	OnExceeded func(err *RateLimitError)
+
+	conn   *Connection
+	bytes  tokenBucket
+	lines  tokenBucket
+	warned bool // the limits were exceeded by the last input
+}
+
+// NewRateLimiter returns a RateLimiter for c, with no limits set.
+func NewRateLimiter(c *Connection) *RateLimiter {
+	return &RateLimiter{conn: c}
+}
+
+// NewReader implements Transform, limiting the rate of reads from r.
+func (l *RateLimiter) NewReader(r io.Reader) io.Reader {
+	return &rateLimitReader{l: l, r: r}
+}
+
+// NewWriter implements Transform, leaving w alone.
+func (l *RateLimiter) NewWriter(w io.Writer) io.Writer {
+	return w
+}
+
+// limit takes tokens for the input b, and takes the Action if it exceeds the
+// limits.
+func (l *RateLimiter) limit(b []byte) error {
+	now := l.conn.now()
+	wait, limit := l.bytes.take(now, l.BytesPerSecond, l.ByteBurst, len(b)), "bytes"
+	if w := l.lines.take(now, l.LinesPerSecond, l.LineBurst, bytes.Count(b, []byte{'\n'})); w > wait {
+		wait, limit = w, "lines"
+	}
+	warned := l.warned
+	l.warned = wait > 0
+	if wait <= 0 {
+		return nil
+	}
+	err := &RateLimitError{Limit: limit}
+	if l.OnExceeded != nil {
+		l.OnExceeded(err)
+	}
+	switch l.Action {
+	case RateLimitWarn:
+		if !warned && l.Warning != "" {
+			_, werr := l.conn.Write([]byte(l.Warning))
+			return werr
+		}
+	case RateLimitDisconnect:
+		if l.Warning != "" {
+			l.conn.Write([]byte(l.Warning))
+		}
+		l.conn.CloseWithReason(err)
+		return ErrClosed
+	default:
+		clock := l.conn.Clock
+		if clock == nil {
+			clock = SystemClock
+		}
+		select {
+		case <-clock.After(wait):
+		case <-l.conn.Closed():
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// rateLimitReader is the reader of a RateLimiter.
+type rateLimitReader struct {
+	l *RateLimiter
+	r io.Reader
+}
+
+func (r *rateLimitReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		if lerr := r.l.limit(b[:n]); lerr != nil {
+			return 0, lerr
+		}
+	}
+	return n, err
+}
+
+// Throttle is a Transform limiting the rate of output to the peer with a token
+// bucket, in bytes per second - to keep one connection from saturating a
+// small uplink, say, or to have a BBS send at the speed of a modem. It leaves
+// what is read alone. Install it at StageEncryption before any other
+// transform, so that it counts the bytes as they are sent:
+//
+//	err := conn.AddTransform(telnet.StageEncryption, telnet.NewThrottle(conn, 64*1024, 0))
+//
+// Output over the limit is written in small pieces as the bucket refills,
+// blocking the write meanwhile; a write is cut short with ErrClosed if the
+// Connection is closed. Negotiation waits its turn like anything else, and is
+// not bound by the NegotiationWriteTimeout while it does.
+type Throttle struct {
+	conn   *Connection
+	rate   float64
+	burst  int
+	bucket tokenBucket
+}
+
+// NewThrottle returns a Throttle for c allowing bytesPerSecond of output, in
+// bursts of up to burst bytes, or a second's worth if burst is zero.
+func NewThrottle(c *Connection, bytesPerSecond float64, burst int) *Throttle {
+	return &Throttle{conn: c, rate: bytesPerSecond, burst: burst}
+}
+
+// NewReader implements Transform, leaving r alone.
+func (t *Throttle) NewReader(r io.Reader) io.Reader {
+	return r
+}
+
+// NewWriter implements Transform, limiting the rate of writes to w.
+func (t *Throttle) NewWriter(w io.Writer) io.Writer {
+	return &throttleWriter{t: t, w: w}
+}
+
+// throttleWriter is the writer of a Throttle.
+type throttleWriter struct {
+	t *Throttle
+	w io.Writer
+}
+
+func (w *throttleWriter) Write(b []byte) (n int, err error) {
+	t := w.t
+	// Over the limit, write in pieces a twentieth of a second's worth.
+	step := max(1, int(t.rate/20))
+	for len(b) > 0 {
+		chunk := b
+		now := t.conn.now()
+		if t.rate > 0 && t.bucket.refill(now, t.rate, t.burst) < float64(len(b)) {
+			chunk = b[:min(step, len(b))]
+		}
+		if wait := t.bucket.take(now, t.rate, t.burst, len(chunk)); wait > 0 {
+			select {
+			case <-t.conn.after(wait):
+			case <-t.conn.Closed():
+				return n, ErrClosed
+			}
+		}
+		nn, err := w.w.Write(chunk)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		b = b[nn:]
+	}
+	return n, nil
+}
+
+// tokenBucket is a token bucket, refilled as it is used.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes n tokens from a bucket filling at rate up to burst, returning
+// how long it will be until the bucket is no longer in debt.
+func (b *tokenBucket) take(now time.Time, rate float64, burst, n int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	b.tokens = b.refill(now, rate, burst) - float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// refill adds the tokens accrued since the bucket was last used, returning
+// the number it holds.
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) float64 {
+	capacity := float64(burst)
+	if burst <= 0 {
+		capacity = max(rate, 1)
+	}
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	return b.tokens
+}
@@ -0,0 +1,136 @@
+package telnet_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestRateLimiter_Delay(t *testing.T) {
+	a, b := telnettest.Pipe()
+	clock := telnettest.NewFakeClock(time.Unix(0, 0))
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.Clock = clock
+	l := telnet.NewRateLimiter(conn)
+	l.LinesPerSecond, l.LineBurst = 1, 1
+	if err := conn.AddTransform(telnet.StageCharset, l); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 16)
+	b.Write([]byte("one\r\n"))
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "one\n" {
+		t.Fatalf("Expected %q, got %q, %v", "one\n", buf[:n], err)
+	}
+	b.Write([]byte("two\r\n"))
+	done := make(chan string)
+	go func() {
+		n, _ := conn.Read(buf)
+		done <- string(buf[:n])
+	}()
+	clock.BlockUntil(1)
+	select {
+	case line := <-done:
+		t.Fatalf("Expected the line to be delayed, got %q", line)
+	default:
+	}
+	clock.Advance(time.Second)
+	if line := <-done; line != "two\n" {
+		t.Errorf("Expected %q, got %q", "two\n", line)
+	}
+}
+
+func TestRateLimiter_Warn(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	conn.Clock = telnettest.NewFakeClock(time.Unix(0, 0))
+	var exceeded []string
+	l := telnet.NewRateLimiter(conn)
+	l.BytesPerSecond, l.ByteBurst = 10, 4
+	l.Action, l.Warning = telnet.RateLimitWarn, "Slow down!\n"
+	l.OnExceeded = func(err *telnet.RateLimitError) { exceeded = append(exceeded, err.Limit) }
+	conn.AddTransform(telnet.StageCharset, l)
+
+	buf := make([]byte, 16)
+	for _, s := range []string{"abcdef", "gh"} {
+		b.Write([]byte(s))
+		if n, err := conn.Read(buf); err != nil || string(buf[:n]) != s {
+			t.Errorf("Expected %q, got %q, %v", s, buf[:n], err)
+		}
+	}
+	if len(exceeded) != 2 || exceeded[0] != "bytes" {
+		t.Errorf("Expected the byte limit exceeded twice, got %q", exceeded)
+	}
+	want := "Slow down!\r\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(b, got); err != nil || string(got) != want {
+		t.Errorf("Expected %q, got %q, %v", want, got, err)
+	}
+}
+
+func TestRateLimiter_Disconnect(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	l := telnet.NewRateLimiter(conn)
+	l.LinesPerSecond = 2
+	l.Action = telnet.RateLimitDisconnect
+	conn.AddTransform(telnet.StageCharset, l)
+
+	b.Write([]byte("a\r\nb\r\nc\r\n"))
+	if _, err := conn.Read(make([]byte, 16)); err != telnet.ErrClosed {
+		t.Errorf("Expected %v, got %v", telnet.ErrClosed, err)
+	}
+	var rerr *telnet.RateLimitError
+	if !errors.As(conn.CloseReason(), &rerr) || rerr.Limit != "lines" {
+		t.Errorf("Expected a RateLimitError for lines, got %v", conn.CloseReason())
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	a, b := telnettest.Pipe()
+	clock := telnettest.NewFakeClock(time.Unix(0, 0))
+	conn := telnet.NewConnectionConfig(a, &telnet.Config{Clock: clock})
+	defer conn.Close()
+	if err := conn.AddTransform(telnet.StageEncryption, telnet.NewThrottle(conn, 40, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The burst goes at once, and the rest two bytes at a time.
+	done := make(chan error)
+	go func() {
+		_, err := conn.Write([]byte("0123456789abcd"))
+		done <- err
+	}()
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "0123456789" {
+		t.Fatalf("Expected the burst, got %q, %v", buf, err)
+	}
+	for _, want := range []string{"ab", "cd"} {
+		clock.BlockUntil(1)
+		clock.Advance(50 * time.Millisecond)
+		buf = buf[:2]
+		if _, err := io.ReadFull(b, buf); err != nil || string(buf) != want {
+			t.Errorf("Expected %q, got %q, %v", want, buf, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// Closing the Connection cuts a write short.
+	go func() {
+		_, err := conn.Write([]byte("0123456789"))
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	conn.Close()
+	if err := <-done; err != telnet.ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package telnet
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordingFormat is a file format for session recordings.
+type RecordingFormat int
+
+const (
+	// Asciicast is the asciinema asciicast v2 format. Output that is not
+	// valid UTF-8 is not preserved exactly.
+	Asciicast RecordingFormat = iota
+	// Ttyrec is the ttyrec format.
+	Ttyrec
+)
+
+// ErrUnknownRecordingFormat is returned by NewRecorder and Player.Play for a
+// RecordingFormat they do not support.
+var ErrUnknownRecordingFormat = errors.New("telnet: unknown recording format")
+
+// maxTtyrecFrame bounds the data of a ttyrec frame, which a Recorder splits
+// larger writes to fit and a Player refuses to read beyond, guarding against
+// a corrupt recording.
+const maxTtyrecFrame = 1 << 24
+
+// asciicastHeader is the first line of an asciicast v2 recording.
+type asciicastHeader struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+// Recorder records the output of a session, with the time each part of it was
+// written, for auditing or later playback with a Player. Use Trace to record
+// what is written to a Connection, or write to the Recorder directly.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format RecordingFormat
+	clock  Clock
+	start  time.Time
+	err    error
+}
+
+// NewRecorder returns a Recorder writing a recording in the given format to w.
+// width and height give the terminal size for an asciicast header, and are
+// ignored for ttyrec.
+func NewRecorder(w io.Writer, format RecordingFormat, width, height int) (*Recorder, error) {
+	return NewRecorderClock(w, format, width, height, SystemClock)
+}
+
+// NewRecorderClock is like NewRecorder, but times the output with clock, such
+// as the Clock of the Connection recorded.
+func NewRecorderClock(w io.Writer, format RecordingFormat, width, height int, clock Clock) (*Recorder, error) {
+	r := &Recorder{w: w, format: format, clock: clock, start: clock.Now()}
+	switch format {
+	case Asciicast:
+		hdr, err := json.Marshal(asciicastHeader{Version: 2, Width: width, Height: height, Timestamp: r.start.Unix()})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(append(hdr, '\n')); err != nil {
+			return nil, err
+		}
+	case Ttyrec:
+	default:
+		return nil, ErrUnknownRecordingFormat
+	}
+	return r, nil
+}
+
+// Write records b as output written now. Once writing the recording fails,
+// Write returns the same error for every later call.
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	now := r.clock.Now()
+	var frame []byte
+	switch r.format {
+	case Asciicast:
+		ev, err := json.Marshal([]interface{}{now.Sub(r.start).Seconds(), "o", string(b)})
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		frame = append(ev, '\n')
+	case Ttyrec:
+		for rest := b; len(rest) > 0 || len(frame) == 0; {
+			chunk := rest[:min(len(rest), maxTtyrecFrame)]
+			rest = rest[len(chunk):]
+			var hdr [12]byte
+			binary.LittleEndian.PutUint32(hdr[0:], uint32(now.Unix()))
+			binary.LittleEndian.PutUint32(hdr[4:], uint32(now.Nanosecond()/1000))
+			binary.LittleEndian.PutUint32(hdr[8:], uint32(len(chunk)))
+			frame = append(append(frame, hdr[:]...), chunk...)
+		}
+	}
+	if _, r.err = r.w.Write(frame); r.err != nil {
+		return 0, r.err
+	}
+	return len(b), nil
+}
+
+// Trace returns a ConnectionTrace that records the data written to a
+// Connection.
+func (r *Recorder) Trace() *ConnectionTrace {
+	return &ConnectionTrace{DataWritten: func(b []byte) { r.Write(b) }}
+}
+
+// Player replays a recording made by a Recorder, or by other tools producing
+// the same formats.
+type Player struct {
+	// Speed scales the rate of playback; 2 plays twice as fast. If zero,
+	// the recording is played at its original speed.
+	Speed float64
+
+	// IdleLimit, if positive, caps the pause between two frames.
+	IdleLimit time.Duration
+
+	// Clock, if set, is used instead of the system clock to time the pauses.
+	Clock Clock
+
+	r      io.Reader
+	format RecordingFormat
+}
+
+// NewPlayer returns a Player for the recording in the given format read from
+// r.
+func NewPlayer(r io.Reader, format RecordingFormat) *Player {
+	return &Player{r: r, format: format}
+}
+
+// Play writes each frame of the recording to w - for example, a Connection -
+// pausing between frames as they were when recorded. It returns nil once the
+// whole recording has been played.
+func (p *Player) Play(w io.Writer) error {
+	var (
+		next func() (at time.Duration, data []byte, err error)
+		err  error
+	)
+	switch p.format {
+	case Asciicast:
+		next, err = p.asciicastFrames()
+	case Ttyrec:
+		next = p.ttyrecFrames()
+	default:
+		err = ErrUnknownRecordingFormat
+	}
+	if err != nil {
+		return err
+	}
+
+	var last time.Duration
+	for first := true; ; first = false {
+		at, data, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !first && at > last {
+			p.pause(at - last)
+		}
+		last = at
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+}
+
+// pause waits for a gap of d in the recording.
+func (p *Player) pause(d time.Duration) {
+	if p.Speed > 0 {
+		d = time.Duration(float64(d) / p.Speed)
+	}
+	if p.IdleLimit > 0 && d > p.IdleLimit {
+		d = p.IdleLimit
+	}
+	clock := p.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	<-clock.After(d)
+}
+
+// asciicastFrames reads the header of an asciicast v2 recording, and returns a
+// function reading its output events.
+func (p *Player) asciicastFrames() (func() (time.Duration, []byte, error), error) {
+	dec := json.NewDecoder(p.r)
+	var hdr asciicastHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Version != 2 {
+		return nil, fmt.Errorf("telnet: unsupported asciicast version %d", hdr.Version)
+	}
+	return func() (time.Duration, []byte, error) {
+		for {
+			var ev []interface{}
+			if err := dec.Decode(&ev); err != nil {
+				return 0, nil, err
+			}
+			if len(ev) != 3 {
+				return 0, nil, errors.New("telnet: malformed asciicast event")
+			}
+			at, ok1 := ev[0].(float64)
+			typ, ok2 := ev[1].(string)
+			data, ok3 := ev[2].(string)
+			if !ok1 || !ok2 || !ok3 {
+				return 0, nil, errors.New("telnet: malformed asciicast event")
+			}
+			if typ == "o" {
+				return time.Duration(at * float64(time.Second)), []byte(data), nil
+			}
+			// Input and other events are not replayed.
+		}
+	}, nil
+}
+
+// ttyrecFrames returns a function reading the frames of a ttyrec recording,
+// timed from the first.
+func (p *Player) ttyrecFrames() func() (time.Duration, []byte, error) {
+	var start time.Time
+	return func() (time.Duration, []byte, error) {
+		var hdr [12]byte
+		if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+			return 0, nil, err
+		}
+		at := time.Unix(int64(binary.LittleEndian.Uint32(hdr[0:])), int64(binary.LittleEndian.Uint32(hdr[4:]))*1000)
+		if start.IsZero() {
+			start = at
+		}
+		size := binary.LittleEndian.Uint32(hdr[8:])
+		if size > maxTtyrecFrame {
+			return 0, nil, errors.New("telnet: ttyrec frame too large")
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(p.r, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+		return at.Sub(start), data, nil
+	}
+}
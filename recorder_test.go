@@ -0,0 +1,78 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestRecorder(t *testing.T) {
+	for _, format := range []telnet.RecordingFormat{telnet.Asciicast, telnet.Ttyrec} {
+		var rec bytes.Buffer
+		r, err := telnet.NewRecorder(&rec, format, 80, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, server := net.Pipe()
+		conn := telnet.NewConnection(server, nil)
+		conn.Trace = r.Trace()
+		go func() {
+			conn.Write([]byte("hello\n"))
+			time.Sleep(20 * time.Millisecond)
+			conn.Write([]byte("world\n"))
+			conn.Close()
+		}()
+		ioutil.ReadAll(client)
+		if format == telnet.Asciicast && !strings.HasPrefix(rec.String(), `{"version":2,"width":80,"height":24,`) {
+			t.Errorf("Expected an asciicast header, got %q", rec.String())
+		}
+
+		var out bytes.Buffer
+		p := telnet.NewPlayer(&rec, format)
+		p.Speed = 2
+		start := time.Now()
+		if err := p.Play(&out); err != nil {
+			t.Error(err)
+		}
+		if d := time.Since(start); d < 10*time.Millisecond {
+			t.Errorf("Expected playback to pause, took %v", d)
+		}
+		if out.String() != "hello\nworld\n" {
+			t.Errorf("Expected %q, got %q", "hello\nworld\n", out.String())
+		}
+	}
+}
+
+func TestPlayer_TtyrecFrameTooLarge(t *testing.T) {
+	// A frame header claiming 4 GiB of data.
+	rec := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+	p := telnet.NewPlayer(bytes.NewReader(rec), telnet.Ttyrec)
+	if err := p.Play(ioutil.Discard); err == nil {
+		t.Error("Expected an error for an oversized frame")
+	}
+}
+
+func TestRecorder_Clock(t *testing.T) {
+	clock := telnettest.NewFakeClock(time.Unix(1700000000, 0))
+	var rec bytes.Buffer
+	r, err := telnet.NewRecorderClock(&rec, telnet.Asciicast, 80, 24, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("a"))
+	clock.Advance(1500 * time.Millisecond)
+	r.Write([]byte("b"))
+	want := `{"version":2,"width":80,"height":24,"timestamp":1700000000}
+[0,"o","a"]
+[1.5,"o","b"]
+`
+	if rec.String() != want {
+		t.Errorf("Expected %q, got %q", want, rec.String())
+	}
+}
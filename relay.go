@@ -0,0 +1,80 @@
+package telnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+// Relay shuttles a session between a and b until either side ends it or ctx
+// is done, then closes both - the building block for gateways and bridges,
+// which a pair of io.Copy calls gets wrong, copying commands as data and
+// leaving one side open when the other closes.
+//
+// If b is a *Connection, the session is telnet throughout: data, commands and
+// subnegotiations are relayed as by a Proxy, with which Relay relays them;
+// make one with NewProxy to set how each option is treated.
+// Otherwise b is taken to carry plain data, such as a raw TCP service or a
+// serial port: what is read from a is written to b with commands removed and
+// IAC unescaped, and what is read from b is written to a escaped, while a
+// negotiates options with its own handlers. Newlines are translated as a's
+// RawNewlines says.
+//
+// It returns the error that ended the session, nil if either side closed it,
+// or ctx's error if it was done first.
+func Relay(ctx context.Context, a *Connection, b io.ReadWriteCloser) error {
+	if bc, ok := b.(*Connection); ok {
+		return NewProxy(a, bc).RunContext(ctx)
+	}
+	return runContext(ctx, a, b, func() error { return relayRaw(a, b) })
+}
+
+// runContext runs a session between a and b, closing both once ctx is done.
+func runContext(ctx context.Context, a, b io.Closer, run func() error) error {
+	stop := context.AfterFunc(ctx, func() {
+		a.Close()
+		b.Close()
+	})
+	err := run()
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+// relayRaw relays between a Connection and a stream of plain data until
+// either ends, then closes both.
+func relayRaw(a *Connection, b io.ReadWriteCloser) error {
+	errs := make(chan error, 2)
+	go func() { errs <- relayCopy(b, a) }()
+	go func() { errs <- relayCopy(a, b) }()
+	err := <-errs
+	a.Close()
+	b.Close()
+	<-errs
+	if err == io.EOF || errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	return err
+}
+
+// relayCopy copies from src to dst until reading or writing fails. A
+// subnegotiation too large to be handled does not end it.
+func relayCopy(dst io.Writer, src io.Reader) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if _, ok := err.(*SubnegotiationTooLargeError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package telnet_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestRelay_Raw(t *testing.T) {
+	c, pc := telnettest.Pipe()
+	client := &telnettest.Peer{Conn: c}
+	backend, service := net.Pipe()
+	conn := telnet.NewConnection(pc, nil)
+	done := make(chan error)
+	go func() { done <- telnet.Relay(context.Background(), conn, backend) }()
+
+	// Commands stay on the telnet side, and IAC is unescaped and escaped.
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.DO, 200, 'h', 'i', telnet.IAC, telnet.IAC))
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(service, buf); err != nil || string(buf) != "hi\xff" {
+		t.Errorf("Expected %q, got %q, %v", "hi\xff", buf, err)
+	}
+	client.Run(t, telnettest.Expect(telnet.IAC, telnet.WONT, 200))
+	service.Write([]byte("ok\xff"))
+	client.Run(t, telnettest.Expect('o', 'k', telnet.IAC, telnet.IAC))
+
+	// The service hanging up closes the telnet side.
+	service.Close()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	<-conn.Closed()
+}
+
+func TestRelay_Connections(t *testing.T) {
+	c, pc := telnettest.Pipe()
+	ps, s := telnettest.Pipe()
+	client, server := &telnettest.Peer{Conn: c}, &telnettest.Peer{Conn: s}
+	a, b := telnet.NewConnection(pc, nil), telnet.NewConnection(ps, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- telnet.Relay(ctx, a, b) }()
+
+	client.Run(t, telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+	server.Run(t, telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptECHO))
+	server.Run(t, telnettest.Send('h', 'i', telnet.IAC, telnet.IAC))
+	client.Run(t, telnettest.Expect('h', 'i', telnet.IAC, telnet.IAC))
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	<-a.Closed()
+	<-b.Closed()
+}
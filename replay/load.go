@@ -0,0 +1,254 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// LoadTest replays sessions against a server, many at once.
+type LoadTest struct {
+	// Addr is the server's address, dialed over TCP unless Dial is set.
+	Addr string
+	// Dial, if set, connects to the server, for example over TLS.
+	Dial func(ctx context.Context) (net.Conn, error)
+
+	// Sessions are replayed in turn, each client taking the next.
+	Sessions []*Session
+	// Concurrency is how many clients run at once; at least one.
+	Concurrency int
+	// Count is how many sessions are run in all. If zero, each of Sessions
+	// is run once.
+	Count int
+	// Speed scales the timing of the sessions; 2 replays them twice as fast.
+	// If zero, they are replayed at their original speed.
+	Speed float64
+	// Linger is how long a client stays connected after sending the last of
+	// its session, reading the server's response.
+	Linger time.Duration
+}
+
+// Report is the outcome of a LoadTest.
+type Report struct {
+	// Sessions is how many sessions were run, and Failed how many of them
+	// failed, with Errors counting the failures by error message.
+	Sessions, Failed int
+	Errors           map[string]int
+
+	// Connect is the time taken to connect, for each session that did.
+	Connect Latencies
+	// Negotiation is the time from connecting to the server's first
+	// command, for each session in which the server sent one.
+	Negotiation Latencies
+
+	// BytesSent and BytesReceived are totals of the raw telnet streams.
+	BytesSent, BytesReceived int64
+	// Duration is how long the test took.
+	Duration time.Duration
+}
+
+// String formats the report as a table.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sessions: %d, failed: %d, duration: %v\n", r.Sessions, r.Failed, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "sent: %d bytes, received: %d bytes\n", r.BytesSent, r.BytesReceived)
+	fmt.Fprintf(&b, "%-12s %8s %10s %10s %10s %10s\n", "latency", "count", "p50", "p90", "p99", "max")
+	for _, l := range []struct {
+		name string
+		l    Latencies
+	}{{"connect", r.Connect}, {"negotiation", r.Negotiation}} {
+		fmt.Fprintf(&b, "%-12s %8d %10v %10v %10v %10v\n", l.name, len(l.l),
+			l.l.Percentile(50), l.l.Percentile(90), l.l.Percentile(99), l.l.Percentile(100))
+	}
+	msgs := make([]string, 0, len(r.Errors))
+	for msg := range r.Errors {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "error: %s (%d)\n", msg, r.Errors[msg])
+	}
+	return b.String()
+}
+
+// Latencies are latency measurements, sorted.
+type Latencies []time.Duration
+
+// Percentile returns the latency below which p percent of the measurements
+// fall, using the nearest rank, or zero if there are none.
+func (l Latencies) Percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(l))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(l) {
+		rank = len(l) - 1
+	}
+	return l[rank]
+}
+
+// result is the outcome of one session.
+type result struct {
+	connect, negotiation time.Duration
+	negotiated           bool
+	sent, received       int64
+	err                  error
+}
+
+// Run runs the test until all the sessions have run or ctx is done, returning
+// the report of the sessions run. It only fails if there are no sessions.
+func (lt *LoadTest) Run(ctx context.Context) (*Report, error) {
+	if len(lt.Sessions) == 0 {
+		return nil, fmt.Errorf("replay: no sessions")
+	}
+	count := lt.Count
+	if count == 0 {
+		count = len(lt.Sessions)
+	}
+	concurrency := lt.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	start := time.Now()
+	jobs := make(chan *Session)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				results <- lt.replay(ctx, s)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < count; i++ {
+			select {
+			case jobs <- lt.Sessions[i%len(lt.Sessions)]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	r := &Report{Errors: make(map[string]int)}
+	for res := range results {
+		r.Sessions++
+		r.BytesSent += res.sent
+		r.BytesReceived += res.received
+		if res.connect > 0 {
+			r.Connect = append(r.Connect, res.connect)
+		}
+		if res.negotiated {
+			r.Negotiation = append(r.Negotiation, res.negotiation)
+		}
+		if res.err != nil {
+			r.Failed++
+			r.Errors[res.err.Error()]++
+		}
+	}
+	sort.Slice(r.Connect, func(i, j int) bool { return r.Connect[i] < r.Connect[j] })
+	sort.Slice(r.Negotiation, func(i, j int) bool { return r.Negotiation[i] < r.Negotiation[j] })
+	r.Duration = time.Since(start)
+	return r, nil
+}
+
+// replay runs one session.
+func (lt *LoadTest) replay(ctx context.Context, s *Session) (res result) {
+	begin := time.Now()
+	var c net.Conn
+	var err error
+	if lt.Dial != nil {
+		c, err = lt.Dial(ctx)
+	} else {
+		var d net.Dialer
+		c, err = d.DialContext(ctx, "tcp", lt.Addr)
+	}
+	if err != nil {
+		res.err = err
+		return
+	}
+	connected := time.Now()
+	res.connect = connected.Sub(begin)
+
+	// These are set by the reader goroutine, and read once it has finished.
+	var received int64
+	var negotiated bool
+	var negotiation time.Duration
+	tap := telnet.NewTap(c)
+	tap.Trace = &telnet.ConnectionTrace{
+		CommandReceived: func(cmd, option byte) {
+			if !negotiated {
+				negotiated, negotiation = true, time.Since(connected)
+			}
+		},
+	}
+	readDone := make(chan error, 1)
+	go func() {
+		var err error
+		received, err = io.Copy(io.Discard, tap)
+		readDone <- err
+	}()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	speed := lt.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	hungUp := false
+	for _, f := range s.Frames {
+		wait := time.Until(connected.Add(time.Duration(float64(f.At) / speed)))
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			case <-readDone:
+				hungUp = true
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err != nil || ctx.Err() != nil {
+			break
+		}
+		n, werr := tap.Write(f.Data)
+		res.sent += int64(n)
+		if werr != nil {
+			err = werr
+			break
+		}
+	}
+	if err == nil && ctx.Err() == nil && lt.Linger > 0 {
+		select {
+		case <-time.After(lt.Linger):
+		case <-readDone:
+			hungUp = true
+		case <-ctx.Done():
+		}
+	}
+	c.Close()
+	if !hungUp {
+		<-readDone
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	res.received, res.negotiated, res.negotiation, res.err = received, negotiated, negotiation, err
+	return res
+}
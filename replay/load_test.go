@@ -0,0 +1,68 @@
+package replay_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/replay"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestLoadTest(t *testing.T) {
+	srv := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		io.Copy(io.Discard, c)
+	}), options.NAWSOption)
+	defer srv.Close()
+
+	s := &replay.Session{Frames: []replay.Frame{
+		{At: 0, Data: []byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS}},
+		{At: 20 * time.Millisecond, Data: []byte("look\r\n")},
+	}}
+	lt := &replay.LoadTest{
+		Addr:        srv.Addr,
+		Sessions:    []*replay.Session{s},
+		Concurrency: 4,
+		Count:       10,
+		Speed:       2,
+		Linger:      10 * time.Millisecond,
+	}
+	r, err := lt.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Sessions != 10 || r.Failed != 0 {
+		t.Errorf("Expected 10 sessions to succeed, got %d with %d failed: %v", r.Sessions, r.Failed, r.Errors)
+	}
+	if len(r.Connect) != 10 || len(r.Negotiation) != 10 {
+		t.Errorf("Expected 10 latencies of each kind, got %d and %d", len(r.Connect), len(r.Negotiation))
+	}
+	if r.BytesSent != 90 || r.BytesReceived != 30 {
+		t.Errorf("Expected 90 bytes sent and 30 received, got %d and %d", r.BytesSent, r.BytesReceived)
+	}
+	if !strings.Contains(r.String(), "negotiation ") {
+		t.Errorf("Expected the report to show negotiation latency, got %q", r.String())
+	}
+}
+
+func TestLatencies_Percentile(t *testing.T) {
+	var l replay.Latencies
+	if p := l.Percentile(50); p != 0 {
+		t.Errorf("Expected 0 with no latencies, got %v", p)
+	}
+	for i := 1; i <= 100; i++ {
+		l = append(l, time.Duration(i))
+	}
+	for _, test := range []struct {
+		p        float64
+		expected time.Duration
+	}{{50, 50}, {90, 90}, {99, 99}, {100, 100}, {0, 1}} {
+		if got := l.Percentile(test.p); got != test.expected {
+			t.Errorf("Expected p%v of %v, got %v", test.p, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package replay replays recorded telnet client sessions against a server, as
+// a load generator. A session is the raw stream a client sent, with the time
+// each part was sent; LoadTest runs many at once, and reports the latency of
+// connecting and of the server's negotiation as percentiles.
+//
+// Sessions can be loaded from a pcapng capture, such as those cmd/telnet-proxy
+// records with telnet.PcapNG, or from a ttyrec recording of the client's
+// stream:
+//
+//	s, err := replay.LoadFile("session-1-client.pcapng")
+//	...
+//	lt := &replay.LoadTest{Addr: "localhost:2323", Sessions: []*replay.Session{s}, Concurrency: 50, Count: 1000}
+//	report, err := lt.Run(ctx)
+//	fmt.Print(report)
+package replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrMalformed is returned when a recording cannot be parsed.
+var ErrMalformed = errors.New("replay: malformed recording")
+
+// Frame is data the client sent, at a time measured from the start of the
+// session.
+type Frame struct {
+	At   time.Duration
+	Data []byte
+}
+
+// Session is a recorded client session.
+type Session struct {
+	// Name identifies the session in reports, such as the file it was
+	// loaded from.
+	Name   string
+	Frames []Frame
+}
+
+// Duration returns the time from the start of the session to its last frame.
+func (s *Session) Duration() time.Duration {
+	if len(s.Frames) == 0 {
+		return 0
+	}
+	return s.Frames[len(s.Frames)-1].At
+}
+
+// LoadFile loads a session from a recording, as a pcapng capture if the file
+// name ends in .pcapng, or a ttyrec recording otherwise.
+func LoadFile(name string) (*Session, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var s *Session
+	if strings.HasSuffix(name, ".pcapng") {
+		s, err = ReadPcapNG(f)
+	} else {
+		s, err = ReadTtyrec(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	s.Name = filepath.Base(name)
+	return s, nil
+}
+
+// ReadTtyrec reads a session from a ttyrec recording whose frames are the
+// client's stream, such as one made by a telnet.Recorder writing what a
+// Connection receives from the wire.
+func ReadTtyrec(r io.Reader) (*Session, error) {
+	s := &Session{}
+	var start time.Time
+	for {
+		var hdr [12]byte
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return s, nil
+		} else if err != nil {
+			return nil, ErrMalformed
+		}
+		at := time.Unix(int64(binary.LittleEndian.Uint32(hdr[0:])), int64(binary.LittleEndian.Uint32(hdr[4:]))*1000)
+		if start.IsZero() {
+			start = at
+		}
+		size := binary.LittleEndian.Uint32(hdr[8:])
+		if size > 1<<24 {
+			return nil, ErrMalformed
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, ErrMalformed
+		}
+		s.Frames = append(s.Frames, Frame{At: at.Sub(start), Data: data})
+	}
+}
+
+// pcapng block types and link types.
+const (
+	pcapngSectionHeader       = 0x0a0d0d0a
+	pcapngInterfaceDescriptor = 0x00000001
+	pcapngEnhancedPacket      = 0x00000006
+	linkTypeEthernet          = 1
+	linkTypeRaw               = 101
+)
+
+// ReadPcapNG reads a session from a pcapng capture of a single TCP connection
+// with raw IP or Ethernet framing. The client is the end that sent the first
+// SYN, or the first data if the handshake was not captured; its TCP payloads
+// are the session, timed from the first packet. Timestamps are taken to be in
+// microseconds, the pcapng default.
+func ReadPcapNG(r io.Reader) (*Session, error) {
+	s := &Session{}
+	var (
+		order    binary.ByteOrder = binary.LittleEndian
+		linkType uint16
+		client   string
+		start    uint64
+		started  bool
+	)
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			return s, nil
+		} else if err != nil {
+			return nil, ErrMalformed
+		}
+		typ := binary.LittleEndian.Uint32(hdr[0:])
+		if typ == pcapngSectionHeader {
+			// The byte order magic follows the length, which it governs.
+			var magic [4]byte
+			if _, err := io.ReadFull(r, magic[:]); err != nil {
+				return nil, ErrMalformed
+			}
+			order = binary.LittleEndian
+			if binary.BigEndian.Uint32(magic[:]) == 0x1a2b3c4d {
+				order = binary.BigEndian
+			}
+			if _, err := readBlockBody(r, order.Uint32(hdr[4:]), 4); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		typ = order.Uint32(hdr[0:])
+		body, err := readBlockBody(r, order.Uint32(hdr[4:]), 0)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case pcapngInterfaceDescriptor:
+			if len(body) < 2 {
+				return nil, ErrMalformed
+			}
+			linkType = order.Uint16(body)
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return nil, ErrMalformed
+			}
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			captured := order.Uint32(body[12:])
+			if int(captured) > len(body)-20 {
+				return nil, ErrMalformed
+			}
+			pkt := body[20 : 20+captured]
+			if linkType == linkTypeEthernet {
+				if len(pkt) < 14 {
+					continue
+				}
+				pkt = pkt[14:]
+			} else if linkType != linkTypeRaw {
+				return nil, fmt.Errorf("replay: unsupported link type %d", linkType)
+			}
+			src, flags, payload, ok := tcpPayload(pkt)
+			if !ok {
+				continue
+			}
+			if !started {
+				start, started = ts, true
+			}
+			if client == "" && (flags&tcpSYN != 0 && flags&tcpACK == 0 || len(payload) > 0) {
+				client = src
+			}
+			if src == client && len(payload) > 0 {
+				at := time.Duration(ts-start) * time.Microsecond
+				s.Frames = append(s.Frames, Frame{At: at, Data: append([]byte(nil), payload...)})
+			}
+		}
+	}
+}
+
+// readBlockBody reads the rest of a block of the given total length, of which
+// the 8 byte header and read more bytes have been read, returning its body
+// without the trailing length.
+func readBlockBody(r io.Reader, length uint32, read int) ([]byte, error) {
+	if length < 12+uint32(read) || length%4 != 0 || length > 1<<24 {
+		return nil, ErrMalformed
+	}
+	body := make([]byte, int(length)-8-read)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, ErrMalformed
+	}
+	return body[:len(body)-4], nil
+}
+
+// TCP flags
+const (
+	tcpSYN = 0x02
+	tcpACK = 0x10
+)
+
+// tcpPayload returns the source address, flags and payload of a TCP segment in
+// an IPv4 or IPv6 packet.
+func tcpPayload(pkt []byte) (src string, flags byte, payload []byte, ok bool) {
+	if len(pkt) < 1 {
+		return "", 0, nil, false
+	}
+	var ip net.IP
+	var seg []byte
+	switch pkt[0] >> 4 {
+	case 4:
+		ihl := int(pkt[0]&0x0f) * 4
+		if len(pkt) < ihl || ihl < 20 || pkt[9] != 6 {
+			return "", 0, nil, false
+		}
+		total := int(binary.BigEndian.Uint16(pkt[2:]))
+		if total < ihl || total > len(pkt) {
+			total = len(pkt)
+		}
+		ip, seg = net.IP(pkt[12:16]), pkt[ihl:total]
+	case 6:
+		if len(pkt) < 40 || pkt[6] != 6 {
+			return "", 0, nil, false
+		}
+		ip, seg = net.IP(pkt[8:24]), pkt[40:]
+	default:
+		return "", 0, nil, false
+	}
+	if len(seg) < 20 {
+		return "", 0, nil, false
+	}
+	off := int(seg[12]>>4) * 4
+	if off < 20 || off > len(seg) {
+		return "", 0, nil, false
+	}
+	port := binary.BigEndian.Uint16(seg[0:])
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port)), seg[13], seg[off:], true
+}
@@ -0,0 +1,59 @@
+package replay_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/replay"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestReadTtyrec(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := telnet.NewRecorder(&buf, telnet.Ttyrec, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("ab"))
+	r.Write([]byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS})
+	s, err := replay.ReadTtyrec(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Frames) != 2 || string(s.Frames[0].Data) != "ab" || s.Frames[0].At != 0 ||
+		!bytes.Equal(s.Frames[1].Data, []byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS}) {
+		t.Errorf("Unexpected frames %v", s.Frames)
+	}
+
+	if _, err := replay.ReadTtyrec(bytes.NewReader([]byte{1, 2, 3})); err != replay.ErrMalformed {
+		t.Errorf("Expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestReadPcapNG(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	var capture bytes.Buffer
+	conn.Trace = telnet.PcapNG(&capture, conn)
+
+	// The capture is taken on the server's side, so the client is the
+	// remote end, and what the server sends is left out.
+	b.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	io.ReadFull(conn, buf)
+	conn.Write([]byte("welcome"))
+	b.Write([]byte{telnet.IAC, telnet.DO, telnet.TeloptECHO, 'x'})
+	conn.Read(buf)
+
+	s, err := replay.ReadPcapNG(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Frames) != 2 || string(s.Frames[0].Data) != "hello" ||
+		!bytes.Equal(s.Frames[1].Data, []byte{telnet.IAC, telnet.DO, telnet.TeloptECHO, 'x'}) {
+		t.Errorf("Unexpected frames %q", s.Frames)
+	}
+}
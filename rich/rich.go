@@ -0,0 +1,215 @@
+// Package rich renders styled text - spans with colors, bold, underline and
+// links - in the best form a telnet client supports: MXP markup for MUD
+// clients that have agreed to MXP, ANSI colors with OSC 8 hyperlinks for
+// modern terminal emulators, ANSI colors with links written out for other
+// color terminals, or plain text.
+//
+//	rich.Write(conn, rich.Text{
+//		{Text: "Welcome! ", Bold: true},
+//		{Text: "Read the rules", Color: rich.Yellow, Link: "https://example.com/rules"},
+//		{Text: " before playing.\n"},
+//	})
+//
+// A TemplateWriter executes text/template templates for a Connection, with
+// functions styling text in the same way.
+package rich
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tester2024/telnet"
+)
+
+// Color is one of the eight ANSI colors, or the terminal's default.
+type Color uint8
+
+// Colors
+const (
+	Default Color = iota
+	Black
+	Red
+	Green
+	Yellow
+	Blue
+	Magenta
+	Cyan
+	White
+)
+
+// colorNames holds the MXP names of the colors from Black.
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// Span is a run of text in one style. Link, if set, is a URL the text links
+// to.
+type Span struct {
+	Text      string
+	Color     Color
+	Bold      bool
+	Underline bool
+	Link      string
+}
+
+// styled reports whether the span has any style besides its link.
+func (s Span) styled() bool {
+	return s.Color != Default || s.Bold || s.Underline
+}
+
+// Text is styled text, as a sequence of spans.
+type Text []Span
+
+// Format is a form text can be rendered in.
+type Format int
+
+// Formats
+const (
+	// Plain is plain text, with links written after their text.
+	Plain Format = iota
+	// ANSI is text with ANSI colors, with links written after their text.
+	ANSI
+	// Hyperlinks is text with ANSI colors and OSC 8 hyperlinks.
+	Hyperlinks
+	// MXP is MXP markup, sent in secure line mode.
+	MXP
+)
+
+// FormatFor returns the best Format for the client of c: MXP if it has agreed
+// to MXP, otherwise as its TerminalCapabilities suggest.
+func FormatFor(c *telnet.Connection) Format {
+	if c.LocalEnabled(telnet.TeloptMXP) {
+		return MXP
+	}
+	tc := c.TerminalCapabilities()
+	switch {
+	case tc.SupportsHyperlinks():
+		return Hyperlinks
+	case tc.SupportsColor():
+		return ANSI
+	}
+	return Plain
+}
+
+// Write writes t to c in the Format FormatFor chooses.
+func Write(c *telnet.Connection, t Text) error {
+	_, err := c.Write(t.Render(FormatFor(c)))
+	return err
+}
+
+// String returns the text without its styles or links.
+func (t Text) String() string {
+	var b strings.Builder
+	for _, s := range t {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+// Render renders the text in the given Format. Each line of a span is styled
+// separately, so that styles never carry over a newline.
+func (t Text) Render(f Format) []byte {
+	var b []byte
+	secure := false // MXP secure line mode is set for the current line
+	for _, s := range t {
+		for i, line := range strings.Split(s.Text, "\n") {
+			if i > 0 {
+				b = append(b, '\n')
+				secure = false
+			}
+			if line == "" {
+				continue
+			}
+			if f == MXP && !secure && (s.styled() || s.Link != "") {
+				b = append(b, "\033[1z"...)
+				secure = true
+			}
+			b = renderLine(b, f, s, line)
+		}
+	}
+	return b
+}
+
+// renderLine appends a line of span s, in the given Format.
+func renderLine(b []byte, f Format, s Span, line string) []byte {
+	switch f {
+	case MXP:
+		return renderMXP(b, s, line)
+	case Plain:
+		return appendLink(append(b, line...), s.Link, line)
+	}
+	if s.styled() {
+		b = append(b, sgr(s)...)
+	}
+	if f == Hyperlinks && s.Link != "" {
+		link := sanitize(s.Link)
+		b = append(b, "\033]8;;"+link+"\033\\"+line+"\033]8;;\033\\"...)
+	} else {
+		b = appendLink(append(b, line...), s.Link, line)
+	}
+	if s.styled() {
+		b = append(b, telnet.Reset...)
+	}
+	return b
+}
+
+// sgr returns the ANSI sequence setting the style of s.
+func sgr(s Span) string {
+	var codes []string
+	if s.Bold {
+		codes = append(codes, "1")
+	}
+	if s.Underline {
+		codes = append(codes, "4")
+	}
+	if s.Color != Default {
+		codes = append(codes, strconv.Itoa(30+int(s.Color-Black)))
+	}
+	return "\033[" + strings.Join(codes, ";") + "m"
+}
+
+// appendLink appends link in parentheses after text, unless it is the text.
+func appendLink(b []byte, link, text string) []byte {
+	if link == "" || link == text {
+		return b
+	}
+	return append(b, " ("+sanitize(link)+")"...)
+}
+
+// mxpEscaper escapes text for MXP.
+var mxpEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// renderMXP appends a line of span s as MXP.
+func renderMXP(b []byte, s Span, line string) []byte {
+	var closing []string
+	open := func(tag, name string) {
+		b = append(b, tag...)
+		closing = append(closing, "</"+name+">")
+	}
+	if s.Link != "" {
+		open(`<A href="`+mxpEscaper.Replace(sanitize(s.Link))+`">`, "A")
+	}
+	if s.Color != Default {
+		open("<COLOR fore="+colorNames[s.Color-Black]+">", "COLOR")
+	}
+	if s.Bold {
+		open("<B>", "B")
+	}
+	if s.Underline {
+		open("<U>", "U")
+	}
+	b = append(b, mxpEscaper.Replace(line)...)
+	for i := len(closing) - 1; i >= 0; i-- {
+		b = append(b, closing[i]...)
+	}
+	return b
+}
+
+// sanitize removes control characters from a link, so that it cannot end
+// the sequence it is written in.
+func sanitize(link string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f && r < 0xa0 {
+			return -1
+		}
+		return r
+	}, link)
+}
@@ -0,0 +1,59 @@
+package rich_test
+
+import (
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/rich"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+var text = rich.Text{
+	{Text: "Hi "},
+	{Text: "there", Color: rich.Red, Bold: true},
+	{Text: ", see "},
+	{Text: "the <rules>", Link: "https://example.com/rules\a"},
+	{Text: "\nbye\n", Underline: true},
+}
+
+func TestText_Render(t *testing.T) {
+	for _, tc := range []struct {
+		format   rich.Format
+		expected string
+	}{
+		{rich.Plain, "Hi there, see the <rules> (https://example.com/rules)\nbye\n"},
+		{rich.ANSI, "Hi \033[1;31mthere\033[0m, see the <rules> (https://example.com/rules)\n\033[4mbye\033[0m\n"},
+		{rich.Hyperlinks, "Hi \033[1;31mthere\033[0m, see \033]8;;https://example.com/rules\033\\the <rules>\033]8;;\033\\\n\033[4mbye\033[0m\n"},
+		{rich.MXP, "Hi \033[1z<COLOR fore=red><B>there</B></COLOR>, see <A href=\"https://example.com/rules\">the &lt;rules&gt;</A>\n\033[1z<U>bye</U>\n"},
+	} {
+		if got := string(text.Render(tc.format)); got != tc.expected {
+			t.Errorf("%d: expected %q, got %q", tc.format, tc.expected, got)
+		}
+	}
+	if s := text.String(); s != "Hi there, see the <rules>\nbye\n" {
+		t.Errorf("Expected the plain text, got %q", s)
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	for _, tc := range []struct {
+		caps     telnet.TerminalCapabilities
+		mxp      bool
+		expected rich.Format
+	}{
+		{telnet.TerminalCapabilities{}, false, rich.ANSI},
+		{telnet.TerminalCapabilities{Types: []string{"dumb"}}, false, rich.Plain},
+		{telnet.TerminalCapabilities{Types: []string{"xterm-kitty"}}, false, rich.Hyperlinks},
+		{telnet.TerminalCapabilities{Types: []string{"MUDLET", "ANSI", "MTTS 9"}, MTTS: 9}, false, rich.ANSI},
+		{telnet.TerminalCapabilities{Types: []string{"MUDLET", "ANSI", "MTTS 9"}, MTTS: 9}, true, rich.MXP},
+	} {
+		conn.SetTerminalCapabilities(tc.caps)
+		conn.SetLocalEnabled(telnet.TeloptMXP, tc.mxp)
+		if f := rich.FormatFor(conn); f != tc.expected {
+			t.Errorf("%v, MXP %v: expected %d, got %d", tc.caps, tc.mxp, tc.expected, f)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package rich
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/tester2024/telnet"
+)
+
+// TemplateData is the data a TemplateWriter executes templates with.
+type TemplateData struct {
+	// Width and Height are the size of the client's window, or zero if it
+	// is not known.
+	Width, Height int
+	// Format is the Format styled text is rendered in.
+	Format Format
+	// Terminal is what is known of the client's terminal.
+	Terminal telnet.TerminalCapabilities
+	// Conn is the Connection being written to.
+	Conn *telnet.Connection
+	// Data is the data passed to Execute.
+	Data any
+}
+
+// Funcs returns the functions templates executed by a TemplateWriter may
+// call, to be added to them with Funcs before they are parsed:
+//
+//	color NAME TEXT  TEXT in a color, such as "red"
+//	bold TEXT        TEXT in bold
+//	underline TEXT   TEXT underlined
+//	link URL TEXT    TEXT linking to URL
+//	value KEY        the value stored on the Connection under the string KEY
+//	                 with SetValue, such as the user who logged in
+//
+// Styled text is rendered in the client's Format, so that templates need not
+// know what the client supports.
+func Funcs() template.FuncMap {
+	return funcs(nil, Plain)
+}
+
+// funcs returns the template functions rendering for c in Format f.
+func funcs(c *telnet.Connection, f Format) template.FuncMap {
+	render := func(s Span) string { return string(Text{s}.Render(f)) }
+	return template.FuncMap{
+		"color": func(name, text string) (string, error) {
+			for i, n := range colorNames {
+				if n == name {
+					return render(Span{Text: text, Color: Black + Color(i)}), nil
+				}
+			}
+			return "", fmt.Errorf("rich: unknown color %q", name)
+		},
+		"bold":      func(text string) string { return render(Span{Text: text, Bold: true}) },
+		"underline": func(text string) string { return render(Span{Text: text, Underline: true}) },
+		"link":      func(url, text string) string { return render(Span{Text: text, Link: url}) },
+		"value": func(key string) any {
+			if c == nil {
+				return nil
+			}
+			return c.Value(key)
+		},
+	}
+}
+
+// TemplateWriter executes templates and writes the output to a Connection,
+// with the Connection's window size, capabilities and values available to
+// them, keeping presentation out of handlers:
+//
+//	t := template.Must(template.New("").Funcs(rich.Funcs()).ParseGlob("screens/*.tmpl"))
+//	...
+//	w := rich.NewTemplateWriter(conn, t)
+//	err := w.Execute("welcome.tmpl", player)
+//
+// with a template such as:
+//
+//	Welcome, {{color "green" (value "user")}}!
+//	{{if ge .Width 80}}{{template "banner.tmpl"}}{{end}}
+type TemplateWriter struct {
+	conn *telnet.Connection
+	tmpl *template.Template
+}
+
+// NewTemplateWriter returns a TemplateWriter writing to c the templates of t,
+// which must have been parsed with Funcs.
+func NewTemplateWriter(c *telnet.Connection, t *template.Template) *TemplateWriter {
+	return &TemplateWriter{conn: c, tmpl: t}
+}
+
+// Execute executes the named template with a TemplateData holding data, and
+// writes the output to the Connection once the template has been executed
+// successfully.
+func (w *TemplateWriter) Execute(name string, data any) error {
+	f := FormatFor(w.conn)
+	t, err := w.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	t.Funcs(funcs(w.conn, f))
+	width, height := w.conn.WindowSize()
+	var buf bytes.Buffer
+	err = t.ExecuteTemplate(&buf, name, TemplateData{
+		Width:    width,
+		Height:   height,
+		Format:   f,
+		Terminal: w.conn.TerminalCapabilities(),
+		Conn:     w.conn,
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,42 @@
+package rich_test
+
+import (
+	"io"
+	"testing"
+	"text/template"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/rich"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestTemplateWriter(t *testing.T) {
+	tmpl := template.Must(template.New("welcome").Funcs(rich.Funcs()).Parse(
+		`Welcome, {{color "green" (value "user")}}! {{.Width}}x{{.Height}} {{.Data}}` +
+			`{{if ge .Width 80}} wide{{end}}`))
+	template.Must(tmpl.New("bad").Parse(`{{color "mauve" "x"}}`))
+
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	conn.SetValue("user", "alice")
+	conn.SetWindowSize(80, 24)
+	w := rich.NewTemplateWriter(conn, tmpl)
+	if err := w.Execute("welcome", 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Execute("bad", nil); err == nil {
+		t.Error("Expected an error for an unknown color")
+	}
+	conn.SetTerminalCapabilities(telnet.TerminalCapabilities{Types: []string{"dumb"}})
+	conn.SetWindowSize(40, 24)
+	if err := w.Execute("welcome", 7); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	got, _ := io.ReadAll(b)
+	want := "Welcome, \033[32malice\033[0m! 80x24 42 wide" + "Welcome, alice! 40x24 7"
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
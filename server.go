@@ -1,7 +1,15 @@
 package telnet
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Option functions add handling of a telnet option to a Server. The Option
@@ -28,11 +36,75 @@ func (f HandleFunc) HandleTelnet(conn *Connection) {
 // Server listens for telnet connections.
 type Server struct {
 	// Address is the addres the Server listens on.
-	Address  string
-	handler  Handler
-	options  []Option
+	Address string
+
+	// Network is the network ListenAndServe listens on, as for net.Listen:
+	// "tcp" if empty, or for example "unix" with the path of a Unix socket as
+	// the Address. Serve accepts connections from any net.Listener.
+	Network string
+
+	// TLSConfig, if set, is the TLS configuration used by ListenAndServeTLS.
+	TLSConfig *tls.Config
+
+	// Logger, if set, receives records of connections being accepted, and is
+	// given to each Connection the Server creates.
+	Logger *slog.Logger
+
+	// CertificateIdentity, if set, maps the client certificate verified on
+	// a connection served over TLS to the identity it authenticates, which
+	// is set as the Connection's Principal before the Handler runs, giving
+	// passwordless logins. If it returns an error, the connection is
+	// closed; if it returns "", the connection is left unauthenticated.
+	// TLSConfig must ask for client certificates, and ClientCAs to verify
+	// them with. CommonNameIdentity maps certificates to their common name.
+	CertificateIdentity func(cert *x509.Certificate) (string, error)
+
+	// Authenticator, if set, authenticates each connection not already
+	// authenticated by CertificateIdentity, setting the Connection's
+	// Principal before the Handler runs. If it fails, the connection is
+	// closed without running the Handler.
+	Authenticator Authenticator
+
+	// Auditor, if set, receives an AuditConnect event for each connection
+	// accepted, and is given to each Connection the Server creates.
+	Auditor Auditor
+
+	// BanStore, if set, is consulted for each connection accepted, refusing
+	// those from banned hosts by closing them at once, and records the
+	// offenses of the others: failing to authenticate, as recorded with
+	// Audit, and being closed for flooding or exceeding a limit.
+	BanStore BanStore
+
+	// Protocols, if not nil, has the Server identify the protocol spoken on
+	// each connection accepted with DetectProtocol, waiting up to
+	// DetectTimeout, since a public port gets clients of all kinds. A
+	// connection is passed to the function for its Protocol, if there is
+	// one, which runs on a goroutine of its own and is responsible for
+	// closing it. Otherwise a TLS connection is
+	// served as telnet over TLS with TLSConfig, plain text is served as
+	// telnet, and anything else is closed. Telnet connections are always
+	// served as telnet.
+	Protocols     map[Protocol]func(c net.Conn)
+	DetectTimeout time.Duration
+
+	// Config, if set, configures each Connection the Server creates, as for
+	// NewConnectionConfig. The Options given to NewServer come before its
+	// own, its Role is RoleServer, and the Server's Logger and Auditor, if
+	// set, are used in place of its own.
+	Config *Config
+
+	handler Handler
+	options []Option
+
+	// The listener being served, and the connections being handled with the
+	// time each was accepted
+	mu       sync.Mutex
 	listener net.Listener
 	quitting bool
+	ctx      context.Context // canceled by Stop
+	cancel   context.CancelFunc
+	conns    map[*Connection]time.Time
+	accepted atomic.Uint64
 }
 
 // NewServer constructs a new telnet server.
@@ -43,28 +115,103 @@ func NewServer(addr string, handler Handler, options ...Option) *Server {
 // Serve runs the telnet server. This function does not return and
 // should probably be run in a goroutine.
 func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
 	s.listener = l
-	s.Address = s.listener.Addr().String()
+	quitting := s.quitting
+	s.mu.Unlock()
+	if quitting {
+		l.Close()
+		return nil
+	}
+	s.Address = l.Addr().String()
 	for {
-		c, err := s.listener.Accept()
+		c, err := l.Accept()
 		if err != nil {
-			if s.quitting {
+			s.mu.Lock()
+			quitting := s.quitting
+			s.mu.Unlock()
+			if quitting {
 				return nil
 			}
+			s.log(slog.LevelError, "telnet: accept failed", "error", err)
 			return err
 		}
-		conn := NewConnection(c, s.options)
-		go func() {
+		if s.BanStore != nil {
+			if host := remoteHost(c.RemoteAddr()); host != "" && s.BanStore.Banned(host) {
+				s.log(slog.LevelInfo, "telnet: connection from banned host refused", "remote", c.RemoteAddr().String())
+				c.Close()
+				continue
+			}
+		}
+		if s.Protocols != nil {
+			go s.detect(c)
+			continue
+		}
+		s.serve(c)
+	}
+}
+
+// serve starts serving telnet on a connection accepted.
+func (s *Server) serve(c net.Conn) {
+	conn := NewConnectionConfig(c, s.connConfig())
+	conn.Audit(AuditEvent{Type: AuditConnect})
+	s.log(slog.LevelInfo, "telnet: connection accepted",
+		"conn", conn.ID(), "remote", c.RemoteAddr().String())
+	s.accepted.Add(1)
+	s.track(conn, true)
+	stop := context.AfterFunc(s.baseContext(), conn.cancel)
+	go func() {
+		if s.authenticate(conn) {
 			s.handler.HandleTelnet(conn)
-			conn.Conn.Close()
-		}()
+		}
+		stop()
+		conn.Close()
+		s.track(conn, false)
+	}()
+}
+
+// connConfig returns the Config of a Connection the Server creates.
+func (s *Server) connConfig() *Config {
+	cfg := Config{}
+	if s.Config != nil {
+		cfg = *s.Config
+	}
+	cfg.Options = append(append([]Option(nil), s.options...), cfg.Options...)
+	cfg.Role = RoleServer
+	if s.Logger != nil {
+		cfg.Logger = s.Logger
+	}
+	if s.Auditor != nil {
+		cfg.Auditor = s.Auditor
 	}
+	cfg.banStore = s.BanStore
+	return &cfg
+}
+
+// authenticate authenticates conn with the Server's CertificateIdentity and
+// Authenticator, reporting whether the Handler may run.
+func (s *Server) authenticate(conn *Connection) bool {
+	if s.CertificateIdentity != nil && !conn.authenticateCertificate(s.CertificateIdentity) {
+		return false
+	}
+	if s.Authenticator == nil || conn.Principal() != nil {
+		return true
+	}
+	p, err := s.Authenticator.Authenticate(conn)
+	if err != nil {
+		if errors.Is(err, ErrAuthFailed) {
+			conn.CloseWithReason(err)
+		}
+		return false
+	}
+	conn.SetPrincipal(p)
+	return true
 }
 
 // ListenAndServe runs the telnet server by creating a new Listener using the
-// current Server.Address, and then calling Serve().
+// current Server.Network and Server.Address, and then calling Serve().
 func (s *Server) ListenAndServe() error {
-	l, err := net.Listen("tcp", s.Address)
+	l, err := s.listen()
 	if err != nil {
 		return err
 	}
@@ -72,12 +219,68 @@ func (s *Server) ListenAndServe() error {
 	return s.Serve(l)
 }
 
-// Stop the telnet server. This stops listening for new connections, but does
-// not affect any active connections already opened.
+// ListenAndServeTLS is like ListenAndServe, but serves telnet over TLS, as
+// telnets does on port 992. The certificate and key are loaded from certFile
+// and keyFile unless both are empty, in which case TLSConfig must provide
+// them.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = append([]tls.Certificate{cert}, config.Certificates...)
+	}
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// listen returns a Listener on the Server's Network and Address.
+func (s *Server) listen() (net.Listener, error) {
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	return net.Listen(network, s.Address)
+}
+
+// track adds or removes a connection from those being handled.
+func (s *Server) track(conn *Connection, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, conn)
+		return
+	}
+	if s.conns == nil {
+		s.conns = make(map[*Connection]time.Time)
+	}
+	s.conns[conn] = conn.now()
+}
+
+// Stop the telnet server. This stops listening for new connections, and
+// cancels the contexts of the active connections already opened, but does not
+// close them, leaving their handlers to finish. It is safe to call
+// concurrently with Serve, and more than once.
 func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.quitting {
 		return
 	}
 	s.quitting = true
-	s.listener.Close()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
 }
@@ -1,6 +1,18 @@
 package telnet_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -42,3 +54,123 @@ func TestServer_ListenAndServe(t *testing.T) {
 	s.Stop()
 	wg.Wait()
 }
+
+// serveUnix starts s listening on a Unix socket, returning its path.
+func serveUnix(t *testing.T, s *telnet.Server, serve func() error) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "telnet.sock")
+	s.Network, s.Address = "unix", path
+	go serve()
+	t.Cleanup(s.Stop)
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return path
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the server to listen")
+	return ""
+}
+
+func echo(c *telnet.Connection) { io.Copy(c, c) }
+
+// expectEcho checks that conn is connected to an echo handler.
+func expectEcho(t *testing.T, conn *telnet.Connection) {
+	t.Helper()
+	conn.Write([]byte("hello"))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hello" {
+		t.Errorf("Expected %q, got %q, %v", "hello", b, err)
+	}
+}
+
+func TestServer_Unix(t *testing.T) {
+	s := telnet.NewServer("", telnet.HandleFunc(echo))
+	path := serveUnix(t, s, s.ListenAndServe)
+	conn, err := telnet.DialNetwork("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectEcho(t, conn)
+}
+
+// selfSigned returns a self-signed certificate for localhost.
+func selfSigned(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServer_ListenAndServeTLS(t *testing.T) {
+	cert := selfSigned(t)
+	s := telnet.NewServer("", telnet.HandleFunc(echo))
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	path := serveUnix(t, s, func() error { return s.ListenAndServeTLS("", "") })
+
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	roots.AddCert(leaf)
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := telnet.NewConnection(tls.Client(c, &tls.Config{ServerName: "localhost", RootCAs: roots}), nil)
+	defer conn.Close()
+	expectEcho(t, conn)
+}
+
+func TestServer_PublishExpvar(t *testing.T) {
+	handling, release := make(chan struct{}), make(chan struct{})
+	s := telnet.NewServer("127.0.0.1:0", telnet.HandleFunc(func(c *telnet.Connection) {
+		c.SetLocalEnabled(telnet.TeloptECHO, true)
+		c.Write([]byte("hi"))
+		handling <- struct{}{}
+		<-release
+	}))
+	// expvar names can't be reused, so make them unique to this run.
+	prefix := fmt.Sprintf("telnet_%p", s)
+	s.PublishExpvar(prefix)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	client, err := telnet.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-handling
+
+	if v := expvar.Get(prefix + ".accepted").String(); v != "1" {
+		t.Errorf("Expected 1 accepted, got %s", v)
+	}
+	if v := expvar.Get(prefix + ".active").String(); v != "1" {
+		t.Errorf("Expected 1 active, got %s", v)
+	}
+	var conns []map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get(prefix+".connections").String()), &conns); err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 1 || conns[0]["bytes_written"] != 2.0 || fmt.Sprint(conns[0]["local_options"]) != "[ECHO]" {
+		t.Errorf("Expected a summary of the connection, got %v", conns)
+	}
+
+	close(release)
+	client.Close()
+	s.Stop()
+}
@@ -0,0 +1,180 @@
+//go:build unix
+
+// Package shell runs commands on local pseudo-terminals for telnet
+// Connections, as the building block of a telnetd.
+//
+// The terminal is kept in step with the telnet session: the window size
+// reported with NAWS is set on the pseudo-terminal, its echo is turned off
+// unless the Connection has ECHO enabled locally without the client doing
+// LINEMODE editing, IP and BRK interrupt the foreground process group, and
+// EC, EL and AYT are answered as a terminal would.
+package shell
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/tester2024/telnet"
+	"golang.org/x/sys/unix"
+)
+
+// drainTimeout is how long Attach waits for the last of a command's output
+// once it has exited.
+const drainTimeout = time.Second
+
+// Handler returns a telnet.Handler that runs the named command, with the given
+// arguments, on a new pseudo-terminal for each connection, as with Attach.
+func Handler(name string, args ...string) telnet.Handler {
+	return telnet.HandleFunc(func(c *telnet.Connection) {
+		Attach(c, exec.Command(name, args...))
+	})
+}
+
+// Attach starts cmd on a new pseudo-terminal, which becomes its controlling
+// terminal and standard input and output, and relays between it and conn until
+// the command exits, returning the error from cmd.Wait. If conn closes first,
+// the pseudo-terminal is closed, hanging up the command.
+//
+// Attach must be called before conn is first read, since it sets the
+// Connection's OnCommand hook and adds to its Trace.
+func Attach(conn *telnet.Connection, cmd *exec.Cmd) error {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	t := &terminal{conn: conn, pty: ptmx, fd: int(ptmx.Fd())}
+	defer t.close()
+	t.setModes()
+	conn.OnCommand = t.command
+	conn.Trace = telnet.MultiTrace(conn.Trace, &telnet.ConnectionTrace{
+		SubnegotiationReceived: t.subnegotiation,
+		OptionChanged: func(option byte, local, enabled bool) {
+			if option == telnet.TeloptECHO || option == telnet.TeloptLINEMODE {
+				t.setModes()
+			}
+		},
+	})
+
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		io.Copy(conn, ptmx)
+	}()
+	go func() {
+		// A terminal sends CR for Enter, which the Connection reads as a
+		// newline.
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if _, err := ptmx.Write([]byte(strings.ReplaceAll(string(buf[:n]), "\n", "\r"))); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				t.close()
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	select {
+	case <-output:
+	case <-time.After(drainTimeout):
+	}
+	return err
+}
+
+// terminal keeps a pseudo-terminal in step with a telnet session.
+type terminal struct {
+	conn *telnet.Connection
+	pty  *os.File
+	fd   int
+
+	// mu serializes use of fd, which is not used once closed is set, since
+	// the hooks calling the methods below may outlive Attach.
+	mu     sync.Mutex
+	closed bool
+}
+
+// close closes the pseudo-terminal.
+func (t *terminal) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.pty.Close()
+}
+
+// setModes sets the pseudo-terminal's echo from the negotiated options.
+func (t *terminal) setModes() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	tios, err := unix.IoctlGetTermios(t.fd, ioctlGetTermios)
+	if err != nil {
+		return
+	}
+	if t.conn.LocalEnabled(telnet.TeloptECHO) && !t.conn.RemoteEnabled(telnet.TeloptLINEMODE) {
+		tios.Lflag |= unix.ECHO
+	} else {
+		tios.Lflag &^= unix.ECHO
+	}
+	unix.IoctlSetTermios(t.fd, ioctlSetTermios, tios)
+}
+
+// subnegotiation sets the window size reported with NAWS.
+func (t *terminal) subnegotiation(option byte, body []byte) {
+	if option != telnet.TeloptNAWS || len(body) != 4 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	unix.IoctlSetWinsize(t.fd, unix.TIOCSWINSZ, &unix.Winsize{
+		Col: binary.BigEndian.Uint16(body[0:]),
+		Row: binary.BigEndian.Uint16(body[2:]),
+	})
+}
+
+// command handles commands such as IP that act on the terminal.
+func (t *terminal) command(cmd byte) {
+	if cmd == telnet.AYT {
+		t.conn.Write([]byte("\n[Yes]\n"))
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	switch cmd {
+	case telnet.IP, telnet.BRK:
+		if pgrp, err := unix.IoctlGetInt(t.fd, unix.TIOCGPGRP); err == nil {
+			unix.Kill(-pgrp, unix.SIGINT)
+		}
+	case telnet.EC, telnet.EL:
+		tios, err := unix.IoctlGetTermios(t.fd, ioctlGetTermios)
+		if err != nil {
+			return
+		}
+		ch := tios.Cc[unix.VERASE]
+		if cmd == telnet.EL {
+			ch = tios.Cc[unix.VKILL]
+		}
+		t.pty.Write([]byte{ch})
+	}
+}
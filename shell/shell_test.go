@@ -0,0 +1,54 @@
+//go:build unix
+
+package shell_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/shell"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestAttach(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	// The window size arrives before the line the command waits for.
+	b.Write([]byte{telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 100, 0, 30, telnet.IAC, telnet.SE})
+	b.Write([]byte("hello\r\n"))
+	err := shell.Attach(conn, exec.Command("sh", "-c", "read x; stty size; echo got-$x"))
+	if err != nil {
+		t.Error(err)
+	}
+	conn.Close()
+	out, _ := ioutil.ReadAll(b)
+	// Without ECHO enabled, the client echoes its own input.
+	if expected := "30 100\r\ngot-hello\r\n"; string(out) != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestAttach_Interrupt(t *testing.T) {
+	a, b := telnettest.Pipe()
+	defer b.Close()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		b.Write([]byte{telnet.IAC, telnet.IP})
+	}()
+	start := time.Now()
+	err := shell.Attach(conn, exec.Command("sleep", "10"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.Contains(exitErr.Error(), "interrupt") {
+		t.Errorf("Expected the command to be interrupted, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected IP to end the command early")
+	}
+}
@@ -0,0 +1,304 @@
+// Package sshgate serves telnet Handlers over SSH, so that one server can
+// accept both telnet and SSH users.
+//
+// Each SSH session with a shell is presented to the Handler as a
+// telnet.Connection whose peer is a virtual telnet client standing in for
+// the SSH user's terminal. The client agrees to ECHO and SGA, and reports the
+// terminal type from the session's pty-req through TTYPE, and its size
+// through NAWS, including each window-change, so options such as
+// options.NAWSOption work as they do for telnet users.
+package sshgate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/tester2024/telnet"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server serves a telnet Handler to SSH clients.
+type Server struct {
+	// Addr is the address to listen on for ListenAndServe.
+	Addr string
+
+	// Config is the SSH server configuration, which must include a host key
+	// and the means of authenticating users.
+	Config *ssh.ServerConfig
+
+	// Handler handles each session.
+	Handler telnet.Handler
+
+	// Options are the option handlers for each session's Connection, as for
+	// a telnet.Server.
+	Options []telnet.Option
+}
+
+// ListenAndServe listens on the Server's Addr, and serves SSH connections
+// made to it.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections from l and serves them until l is closed, when it
+// returns the error from Accept.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+// serveConn performs the SSH handshake on c and serves its sessions.
+func (s *Server) serveConn(c net.Conn) {
+	sc, chans, reqs, err := ssh.NewServerConn(c, s.Config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(sc, ch, reqs)
+	}
+}
+
+// ptyRequest is the payload of a pty-req request - RFC 4254, section 6.2.
+type ptyRequest struct {
+	Term                      string
+	Columns, Rows             uint32
+	WidthPixels, HeightPixels uint32
+	Modes                     string
+}
+
+// windowChange is the payload of a window-change request - RFC 4254, section
+// 6.7.
+type windowChange struct {
+	Columns, Rows             uint32
+	WidthPixels, HeightPixels uint32
+}
+
+// serveSession answers the requests on a session channel, starting the
+// Handler when a shell is requested.
+func (s *Server) serveSession(sc *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	term := &terminal{}
+	started := false
+	for req := range reqs {
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var p ptyRequest
+			if ok = ssh.Unmarshal(req.Payload, &p) == nil; ok {
+				term.setType(p.Term)
+				term.resize(p.Columns, p.Rows)
+			}
+		case "window-change":
+			var w windowChange
+			if ok = ssh.Unmarshal(req.Payload, &w) == nil; ok {
+				term.resize(w.Columns, w.Rows)
+			}
+		case "env":
+			ok = true
+		case "shell":
+			if ok = !started; ok {
+				started = true
+				go s.runShell(sc, ch, term)
+			}
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+	ch.Close()
+}
+
+// runShell runs the Handler on a Connection whose peer is a virtual telnet
+// client relaying to the SSH channel.
+func (s *Server) runShell(sc *ssh.ServerConn, ch ssh.Channel, term *terminal) {
+	defer ch.Close()
+	a, b := net.Pipe()
+	client := telnet.NewConnection(a, []telnet.Option{term.naws, term.ttype, accept(telnet.TeloptECHO), accept(telnet.TeloptSGA)})
+	term.setConn(client)
+	defer client.Close()
+
+	// The client must be reading before the server's Offers are written.
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := client.Read(buf)
+			if n > 0 {
+				ch.Write(bytes.ReplaceAll(buf[:n], []byte("\n"), []byte("\r\n")))
+			}
+			if err != nil {
+				ch.CloseWrite()
+				return
+			}
+		}
+	}()
+	go func() {
+		// Terminals send CR for Enter, which a telnet client sends as a
+		// newline.
+		buf := make([]byte, 4096)
+		for {
+			n, err := ch.Read(buf)
+			if n > 0 {
+				in := bytes.ReplaceAll(buf[:n], []byte("\r\n"), []byte("\n"))
+				client.Write(bytes.ReplaceAll(in, []byte("\r"), []byte("\n")))
+			}
+			if err != nil {
+				client.Close()
+				return
+			}
+		}
+	}()
+
+	conn := telnet.NewConnection(&sessionConn{Conn: b, local: sc.LocalAddr(), remote: sc.RemoteAddr()}, s.Options)
+	s.Handler.HandleTelnet(conn)
+	conn.Close()
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+}
+
+// sessionConn is the server's end of the pipe to the virtual telnet client,
+// addressed as the SSH connection is.
+type sessionConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *sessionConn) LocalAddr() net.Addr  { return c.local }
+func (c *sessionConn) RemoteAddr() net.Addr { return c.remote }
+
+// terminal holds the details of an SSH user's terminal, and reports them to
+// the server as a telnet client would.
+type terminal struct {
+	mu            sync.Mutex
+	term          string
+	width, height uint16
+	conn          *telnet.Connection // the virtual client, once started
+}
+
+func (t *terminal) setType(term string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.term = term
+}
+
+func (t *terminal) setConn(c *telnet.Connection) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn = c
+}
+
+// resize records a new window size, and reports it if NAWS is enabled.
+func (t *terminal) resize(columns, rows uint32) {
+	t.mu.Lock()
+	t.width, t.height = clampSize(columns), clampSize(rows)
+	c := t.conn
+	t.mu.Unlock()
+	if c != nil && c.LocalEnabled(telnet.TeloptNAWS) {
+		t.writeSize(c)
+	}
+}
+
+func clampSize(n uint32) uint16 {
+	if n > 0xffff {
+		return 0xffff
+	}
+	return uint16(n)
+}
+
+func (t *terminal) writeSize(c *telnet.Connection) {
+	t.mu.Lock()
+	body := make([]byte, 4)
+	binary.BigEndian.PutUint16(body[0:], t.width)
+	binary.BigEndian.PutUint16(body[2:], t.height)
+	t.mu.Unlock()
+	c.WriteSubnegotiation(telnet.TeloptNAWS, body)
+}
+
+// naws returns the virtual client's NAWS handler.
+func (t *terminal) naws(c *telnet.Connection) telnet.Negotiator {
+	return &clientOption{code: telnet.TeloptNAWS, enabled: t.writeSize}
+}
+
+// ttype returns the virtual client's TTYPE handler.
+func (t *terminal) ttype(c *telnet.Connection) telnet.Negotiator {
+	return &clientOption{code: telnet.TeloptTTYPE, sb: func(c *telnet.Connection, body []byte) {
+		if len(body) == 0 || body[0] != telnet.TelQualSEND {
+			return
+		}
+		t.mu.Lock()
+		term := t.term
+		t.mu.Unlock()
+		c.WriteSubnegotiation(telnet.TeloptTTYPE, append([]byte{telnet.TelQualIS}, term...))
+	}}
+}
+
+// accept returns a handler for the virtual client that lets the server
+// enable an option.
+func accept(code byte) telnet.Option {
+	return func(c *telnet.Connection) telnet.Negotiator {
+		return &clientOption{code: code, remote: true}
+	}
+}
+
+// clientOption is an option handler for the virtual client. It enables the
+// option locally when the server asks with DO, or remotely if remote is set
+// when the server offers it with WILL.
+type clientOption struct {
+	code    byte
+	remote  bool
+	enabled func(c *telnet.Connection)              // called once enabled locally
+	sb      func(c *telnet.Connection, body []byte) // handles subnegotiations
+}
+
+func (o *clientOption) OptionCode() byte           { return o.code }
+func (o *clientOption) Offer(c *telnet.Connection) {}
+
+func (o *clientOption) HandleDo(c *telnet.Connection) {
+	if o.remote {
+		c.WriteCommand(telnet.WONT, o.code)
+		return
+	}
+	if !c.LocalEnabled(o.code) {
+		c.WriteCommand(telnet.WILL, o.code)
+		c.SetLocalEnabled(o.code, true)
+	}
+	if o.enabled != nil {
+		o.enabled(c)
+	}
+}
+
+func (o *clientOption) HandleWill(c *telnet.Connection) {
+	if !o.remote {
+		c.WriteCommand(telnet.DONT, o.code)
+		return
+	}
+	if !c.RemoteEnabled(o.code) {
+		c.WriteCommand(telnet.DO, o.code)
+		c.SetRemoteEnabled(o.code, true)
+	}
+}
+
+func (o *clientOption) HandleSB(c *telnet.Connection, body []byte) {
+	if o.sb != nil {
+		o.sb(c, body)
+	}
+}
@@ -0,0 +1,125 @@
+package sshgate_test
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/sshgate"
+	"golang.org/x/crypto/ssh"
+)
+
+// recorder asks the client for an option, and sends what it reports with
+// subnegotiations to reports.
+type recorder struct {
+	code    byte
+	reports chan string
+}
+
+func (r *recorder) OptionCode() byte              { return r.code }
+func (r *recorder) Offer(c *telnet.Connection)    { c.WriteCommand(telnet.DO, r.code) }
+func (r *recorder) HandleDo(c *telnet.Connection) {}
+
+func (r *recorder) HandleWill(c *telnet.Connection) {
+	if r.code == telnet.TeloptTTYPE {
+		c.WriteSubnegotiation(telnet.TeloptTTYPE, []byte{telnet.TelQualSEND})
+	}
+}
+
+func (r *recorder) HandleSB(c *telnet.Connection, body []byte) {
+	if r.code == telnet.TeloptNAWS && len(body) == 4 {
+		r.reports <- fmt.Sprintf("%dx%d", binary.BigEndian.Uint16(body[0:]), binary.BigEndian.Uint16(body[2:]))
+	} else if len(body) > 0 && body[0] == telnet.TelQualIS {
+		r.reports <- string(body[1:])
+	}
+}
+
+func (r *recorder) option(c *telnet.Connection) telnet.Negotiator { return r }
+
+func TestServer(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	ttype := &recorder{code: telnet.TeloptTTYPE, reports: make(chan string, 4)}
+	naws := &recorder{code: telnet.TeloptNAWS, reports: make(chan string, 4)}
+	s := &sshgate.Server{
+		Config: config,
+		Handler: telnet.HandleFunc(func(c *telnet.Connection) {
+			// Negotiation is handled while the Connection is read.
+			lines := make(chan string)
+			go func() {
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					lines <- line
+				}
+			}()
+			fmt.Fprintf(c, "%s %s\n", <-ttype.reports, <-naws.reports)
+			fmt.Fprintf(c, "%s\n", <-naws.reports)
+			fmt.Fprintf(c, "hello %q\n", <-lines)
+		}),
+		Options: []telnet.Option{naws.option, ttype.option},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.RequestPty("vt100", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(stdout)
+	expect := func(expected string) {
+		t.Helper()
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	}
+
+	expect("vt100 80x24\r\n")
+	session.WindowChange(50, 132)
+	expect("132x50\r\n")
+	// Enter is sent as a telnet client would, and read as a newline.
+	stdin.Write([]byte("bob\r"))
+	expect("hello \"bob\\n\"\r\n")
+	if err := session.Wait(); err != nil {
+		t.Error(err)
+	}
+}
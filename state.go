@@ -0,0 +1,123 @@
+package telnet
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrStateUnavailable is returned by State when the Connection is in the
+// middle of something that cannot be captured: a transform is installed, or a
+// subnegotiation is being streamed to a handler or discarded.
+var ErrStateUnavailable = errors.New("telnet: connection state cannot be captured")
+
+// StatefulNegotiator is an optional interface for a Negotiator with state of
+// its own to carry over when a Connection is restored with RestoreConnection.
+type StatefulNegotiator interface {
+	Negotiator
+	// MarshalState returns the handler's state.
+	MarshalState() ([]byte, error)
+	// UnmarshalState restores state returned by MarshalState, in place of
+	// a call to Offer.
+	UnmarshalState(state []byte) error
+}
+
+// ConnectionState is a snapshot of a Connection's negotiation, from which
+// RestoreConnection makes an equivalent Connection on the same underlying
+// connection - for example, in a new process taking over the socket during a
+// restart. It may be serialized with encoding/json or encoding/gob.
+type ConnectionState struct {
+	// Local and Remote are the options enabled on our side and the peer's.
+	Local, Remote []byte
+	// ClientWont and ClientDont are the options the peer has refused.
+	ClientWont, ClientDont []byte
+	// Unread is the data received from the peer but not yet read, from
+	// the start of any incomplete command.
+	Unread []byte
+	// Handlers holds the state of option handlers implementing
+	// StatefulNegotiator, by option code.
+	Handlers map[byte][]byte
+}
+
+// State returns the Connection's negotiation state, once the negotiation
+// received so far has been handled. The Connection must not be read or
+// written meanwhile, nor afterwards if the state is to be restored elsewhere.
+func (c *Connection) State() (ConnectionState, error) {
+	c.drainNegotiation()
+	if len(c.dataReaders) > 0 || len(c.streamReaders) > 0 || len(c.streamWriters) > 0 ||
+		c.sbStream != nil || c.state == stateSBData && c.sb.discard {
+		return ConnectionState{}, ErrStateUnavailable
+	}
+	s := ConnectionState{
+		Local:      c.local.codes(),
+		Remote:     c.remote.codes(),
+		ClientWont: c.clientWont.codes(),
+		ClientDont: c.clientDont.codes(),
+	}
+
+	// Undo the parsing of anything incomplete, so it is parsed again.
+	var unread []byte
+	if c.rcr {
+		unread = append(unread, '\r')
+	}
+	switch c.state {
+	case stateIAC:
+		unread = append(unread, IAC)
+	case stateCommand:
+		unread = append(unread, IAC, c.cmd)
+	case stateSB:
+		unread = append(unread, IAC, SB)
+	case stateSBData:
+		unread = appendEscaped(append(unread, IAC, SB, c.option), c.sb.body)
+		if c.sb.iac {
+			unread = append(unread, IAC)
+		}
+	}
+	s.Unread = append(unread, c.buf[c.r:c.w]...)
+
+	for code, h := range c.OptionHandlers {
+		if sh, ok := h.(StatefulNegotiator); ok {
+			b, err := sh.MarshalState()
+			if err != nil {
+				return ConnectionState{}, err
+			}
+			if s.Handlers == nil {
+				s.Handlers = make(map[byte][]byte)
+			}
+			s.Handlers[code] = b
+		}
+	}
+	return s, nil
+}
+
+// RestoreConnection returns a Connection on c continuing the session captured
+// by state, with handlers from the given options, which should be those the
+// original Connection had. Options are not offered again; handlers
+// implementing StatefulNegotiator have their state restored instead.
+func RestoreConnection(c net.Conn, options []Option, state ConnectionState) (*Connection, error) {
+	conn := newConnection(c, &Config{Options: options}, false)
+	for _, o := range state.Local {
+		conn.local.set(o, true)
+	}
+	for _, o := range state.Remote {
+		conn.remote.set(o, true)
+	}
+	for _, o := range state.ClientWont {
+		conn.clientWont.set(o, true)
+	}
+	for _, o := range state.ClientDont {
+		conn.clientDont.set(o, true)
+	}
+	if len(state.Unread) > len(conn.buf) {
+		conn.buf = make([]byte, len(state.Unread))
+	}
+	conn.w = copy(conn.buf, state.Unread)
+	for code, b := range state.Handlers {
+		if sh, ok := conn.OptionHandlers[code].(StatefulNegotiator); ok {
+			if err := sh.UnmarshalState(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	go conn.negotiate()
+	return conn, nil
+}
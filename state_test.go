@@ -0,0 +1,62 @@
+package telnet_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestRestoreConnection(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, []telnet.Option{options.NAWSOption})
+	b.Write([]byte{telnet.IAC, telnet.WILL, telnet.TeloptNAWS,
+		telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, 0, 24, telnet.IAC, telnet.SE,
+		'a', 'b', telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0})
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "ab" {
+		t.Fatalf("Expected %q, got %q, %v", "ab", buf[:n], err)
+	}
+	state, err := conn.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := telnet.RestoreConnection(a, []telnet.Option{options.NAWSOption}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	// The rest of the subnegotiation completes the part read before. The
+	// refused DO 200 shows when the negotiation before it has been handled.
+	b.Write([]byte{100, 0, 50, telnet.IAC, telnet.SE, 'c', 'd', telnet.IAC, telnet.DO, 200})
+	if n, err = restored.Read(buf); err != nil || string(buf[:n]) != "cd" {
+		t.Fatalf("Expected %q, got %q, %v", "cd", buf[:n], err)
+	}
+	// Only the original Connection offers NAWS.
+	expected := []byte{telnet.IAC, telnet.DO, telnet.TeloptNAWS, telnet.IAC, telnet.WONT, 200}
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(b, got); err != nil || !bytes.Equal(got, expected) {
+		t.Fatalf("Expected %v, got %v, %v", expected, got, err)
+	}
+	naws := restored.OptionHandlers[telnet.TeloptNAWS].(*options.NAWSHandler)
+	if naws.Width != 100 || naws.Height != 50 {
+		t.Errorf("Expected 100x50, got %dx%d", naws.Width, naws.Height)
+	}
+}
+
+func TestConnection_StateUnavailable(t *testing.T) {
+	a, _ := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	if err := conn.AddTransform(telnet.StageCharset, &xorTransform{key: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.State(); err != telnet.ErrStateUnavailable {
+		t.Errorf("Expected ErrStateUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+)
+
+// sbStatus is the result of decoding part of a subnegotiation body.
+type sbStatus int
+
+const (
+	sbMore  sbStatus = iota // the body continues
+	sbEnd                   // `IAC SE` ended the body
+	sbAbort                 // IAC was followed by a byte other than SE or IAC
+)
+
+// sbDecoder decodes the body of a subnegotiation from the bytes following
+// `IAC SB <option>`. Each IAC IAC is unescaped exactly once, and only an
+// unpaired IAC followed by SE ends the body, so an escaped IAC followed by a
+// literal SE byte is body data.
+type sbDecoder struct {
+	option  byte
+	body    []byte // unescaped body decoded so far
+	limit   int    // maximum body length, or 0 for no limit
+	iac     bool   // last byte was an unpaired IAC
+	discard bool   // body exceeded limit and is being dropped
+}
+
+// reset prepares the decoder for a new body.
+func (d *sbDecoder) reset(option byte, limit int) {
+	d.option = option
+	d.body = d.body[:0]
+	d.limit = limit
+	d.iac = false
+	d.discard = false
+}
+
+// decode consumes bytes from p until the body ends or p is exhausted,
+// returning the number of bytes consumed. On sbAbort, the IAC has been
+// consumed but the byte following it has not. The first time the body
+// exceeds the limit, decode stops and returns a *SubnegotiationTooLargeError;
+// the rest of the body is discarded by later calls.
+func (d *sbDecoder) decode(p []byte) (n int, status sbStatus, err error) {
+	for n < len(p) {
+		if d.iac {
+			switch p[n] {
+			case SE:
+				d.iac = false
+				return n + 1, sbEnd, nil
+			case IAC:
+				d.iac = false
+				n++
+				if err = d.append(p[n-1 : n]); err != nil {
+					return
+				}
+				continue
+			default:
+				d.iac = false
+				return n, sbAbort, nil
+			}
+		}
+		chunk := p[n:]
+		if i := bytes.IndexByte(chunk, IAC); i >= 0 {
+			chunk = chunk[:i]
+			d.iac = true
+			n++
+		}
+		n += len(chunk)
+		if err = d.append(chunk); err != nil {
+			return
+		}
+	}
+	return n, sbMore, nil
+}
+
+// append adds unescaped bytes to the body, enforcing the limit.
+func (d *sbDecoder) append(b []byte) error {
+	if d.discard {
+		return nil
+	}
+	if d.limit > 0 && len(d.body)+len(b) > d.limit {
+		d.discard = true
+		d.body = d.body[:0]
+		return &SubnegotiationTooLargeError{Option: d.option, Limit: d.limit}
+	}
+	d.body = append(d.body, b...)
+	return nil
+}
+
+// startSB begins a subnegotiation body for c.option.
+func (c *Connection) startSB() {
+	h, ok := c.OptionHandlers[c.option].(StreamNegotiator)
+	if !ok {
+		limit := c.MaxSubnegotiationSize
+		if limit == 0 {
+			limit = DefaultMaxSubnegotiationSize
+		}
+		c.sb.reset(c.option, limit)
+		return
+	}
+	c.sb.reset(c.option, 0)
+	pr, pw := io.Pipe()
+	c.sbStream = pw
+	go func() {
+		h.HandleSBStream(c, pr)
+		// Unblock the parser if the handler stopped reading early.
+		pr.Close()
+	}()
+}
+
+// flushSB hands any decoded body bytes to a streaming handler.
+func (c *Connection) flushSB() {
+	if c.sbStream != nil && len(c.sb.body) > 0 {
+		// An error means the handler has returned; the rest of the body
+		// is dropped.
+		c.sbStream.Write(c.sb.body)
+		c.sb.body = c.sb.body[:0]
+	}
+}
+
+// endSB completes the current subnegotiation body on `IAC SE`.
+func (c *Connection) endSB() {
+	if c.sbStream != nil {
+		c.flushSB()
+		c.sbStream.Close()
+		c.sbStream = nil
+		return
+	}
+	if c.sb.discard {
+		return
+	}
+	c.log(slog.LevelDebug, "telnet: subnegotiation received", "option", c.option, "len", len(c.sb.body))
+	c.transcribeSubnegotiation(true, c.option, c.sb.body)
+	c.Trace.subnegotiationReceived(c.option, c.sb.body)
+	h, ok := c.OptionHandlers[c.option]
+	if ih, inline := h.(InlineNegotiator); inline {
+		ih.HandleSBInline(c, c.sb.body)
+	} else if ok || c.relay != nil || c.OnSubnegotiation != nil || c.subscribed() || c.observed(c.option) {
+		body := append([]byte(nil), c.sb.body...)
+		c.queueNegotiation(negotiation{cmd: SB, option: c.option, body: body})
+	}
+}
+
+// abortSB discards the current subnegotiation body.
+func (c *Connection) abortSB() {
+	c.sb.reset(c.option, 0)
+	if c.sbStream != nil {
+		c.sbStream.CloseWithError(io.ErrUnexpectedEOF)
+		c.sbStream = nil
+	}
+}
@@ -0,0 +1,175 @@
+package telnet
+
+import "net"
+
+// Tap wraps a connection carrying a telnet stream without interpreting it:
+// every byte read or written passes through unchanged, so it can serve as a
+// transparent TCP relay. The stream in each direction is also parsed, so Trace
+// observes the commands and subnegotiations exchanged, and LocalEnabled and
+// RemoteEnabled report the options the two ends have agreed on. Nothing is
+// ever sent in reply, so options are only enabled when the other end of the
+// relay agrees to them.
+//
+// Read and Write may be called concurrently with each other, as by a pair of
+// io.Copy goroutines.
+type Tap struct {
+	// The underlying network connection.
+	net.Conn
+
+	// Trace, if set, is called as commands, subnegotiations and option
+	// changes are seen, from the goroutine calling Read for those received
+	// and Write for those sent. DataRead and DataWritten are not called, and
+	// WireRead and WireWritten are called with the bytes read and written.
+	Trace *ConnectionTrace
+
+	in, out tapParser
+
+	// Options requested or agreed to by each end; an option is enabled on
+	// a side once it has offered it with WILL and the other side has
+	// agreed with DO, in either order.
+	localWill, localDo   optionSet
+	remoteWill, remoteDo optionSet
+	local, remote        optionSet
+}
+
+// NewTap returns a Tap passing the telnet stream on c through unchanged.
+func NewTap(c net.Conn) *Tap {
+	return &Tap{Conn: c}
+}
+
+// Read reads raw bytes from the underlying connection, observing the commands
+// received.
+func (t *Tap) Read(b []byte) (n int, err error) {
+	n, err = t.Conn.Read(b)
+	if n > 0 {
+		t.Trace.wireRead(b[:n])
+		t.in.parse(b[:n], t.received, t.Trace.subnegotiationReceived, t.Trace.negotiationFailed)
+	}
+	return
+}
+
+// Write writes raw bytes to the underlying connection, observing the commands
+// sent.
+func (t *Tap) Write(b []byte) (n int, err error) {
+	n, err = t.Conn.Write(b)
+	if n > 0 {
+		t.Trace.wireWritten(b[:n])
+		t.out.parse(b[:n], t.sent, t.Trace.subnegotiationSent, t.Trace.negotiationFailed)
+	}
+	return
+}
+
+// LocalEnabled reports whether the option has been agreed on for this end of
+// the connection: it has sent WILL, and received DO.
+func (t *Tap) LocalEnabled(option byte) bool {
+	return t.local.has(option)
+}
+
+// RemoteEnabled reports whether the option has been agreed on for the peer: it
+// has sent WILL, and been sent DO.
+func (t *Tap) RemoteEnabled(option byte) bool {
+	return t.remote.has(option)
+}
+
+// received records a command read from the peer.
+func (t *Tap) received(cmd, option byte) {
+	t.Trace.commandReceived(cmd, option)
+	switch cmd {
+	case WILL, WONT:
+		t.offer(&t.remoteWill, &t.localDo, &t.remote, false, cmd == WILL, option)
+	case DO, DONT:
+		t.offer(&t.remoteDo, &t.localWill, &t.local, true, cmd == DO, option)
+	}
+	t.agree(option)
+}
+
+// sent records a command written to the peer.
+func (t *Tap) sent(cmd, option byte) {
+	t.Trace.commandSent(cmd, option)
+	switch cmd {
+	case WILL, WONT:
+		t.offer(&t.localWill, &t.remoteDo, &t.local, true, cmd == WILL, option)
+	case DO, DONT:
+		t.offer(&t.localDo, &t.remoteWill, &t.remote, false, cmd == DO, option)
+	}
+	t.agree(option)
+}
+
+// offer records one side's half of the agreement on an option, which is
+// enabled once both halves are set. Refusing by either side clears both.
+func (t *Tap) offer(half, other, enabled *optionSet, local, on bool, option byte) {
+	half.set(option, on)
+	if !on {
+		other.set(option, false)
+		if enabled.set(option, false) {
+			t.Trace.optionChanged(option, local, false)
+		}
+	}
+}
+
+// agree enables an option on a side once both halves of its agreement are set.
+func (t *Tap) agree(option byte) {
+	if t.localWill.has(option) && t.remoteDo.has(option) && t.local.set(option, true) {
+		t.Trace.optionChanged(option, true, true)
+	}
+	if t.remoteWill.has(option) && t.localDo.has(option) && t.remote.set(option, true) {
+		t.Trace.optionChanged(option, false, true)
+	}
+}
+
+// tapParser finds the commands and subnegotiations in one direction of a
+// telnet stream, keeping its state between calls so sequences may be split
+// across reads.
+type tapParser struct {
+	state int // one of the state* constants
+	cmd   byte
+	sb    sbDecoder
+}
+
+// parse scans b, calling command for each `IAC <cmd> <option>` and sb for each
+// complete subnegotiation no longer than DefaultMaxSubnegotiationSize, and
+// failed for each longer one.
+func (p *tapParser) parse(b []byte, command func(cmd, option byte), sb func(option byte, body []byte), failed func(err error)) {
+	for i := 0; i < len(b); {
+		if p.state == stateSBData {
+			n, status, err := p.sb.decode(b[i:])
+			i += n
+			switch status {
+			case sbEnd:
+				p.state = stateData
+				if !p.sb.discard {
+					sb(p.sb.option, p.sb.body)
+				}
+			case sbAbort:
+				p.state = stateIAC
+			}
+			if err != nil {
+				failed(err)
+			}
+			continue
+		}
+		ch := b[i]
+		i++
+		switch p.state {
+		case stateData:
+			if ch == IAC {
+				p.state = stateIAC
+			}
+		case stateIAC:
+			p.state = stateData
+			switch ch {
+			case WILL, WONT, DO, DONT:
+				p.cmd = ch
+				p.state = stateCommand
+			case SB:
+				p.state = stateSB
+			}
+		case stateCommand:
+			p.state = stateData
+			command(p.cmd, ch)
+		case stateSB:
+			p.state = stateSBData
+			p.sb.reset(ch, DefaultMaxSubnegotiationSize)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package telnet_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestTap(t *testing.T) {
+	a, b := telnettest.Pipe()
+	tap := telnet.NewTap(a)
+	var events []string
+	tap.Trace = &telnet.ConnectionTrace{
+		CommandReceived: func(cmd, option byte) { events = append(events, fmt.Sprintf("recv %d %d", cmd, option)) },
+		CommandSent:     func(cmd, option byte) { events = append(events, fmt.Sprintf("sent %d %d", cmd, option)) },
+		SubnegotiationReceived: func(option byte, body []byte) {
+			events = append(events, fmt.Sprintf("recv sb %d %q", option, body))
+		},
+		OptionChanged: func(option byte, local, enabled bool) {
+			events = append(events, fmt.Sprintf("option %d %v %v", option, local, enabled))
+		},
+	}
+
+	// Split so that the parser must resume mid-sequence.
+	in := []byte{'h', telnet.IAC, telnet.WILL, telnet.TeloptECHO, 'i', telnet.IAC, telnet.IAC,
+		telnet.IAC, telnet.SB, telnet.TeloptTTYPE, telnet.TelQualSEND, telnet.IAC, telnet.SE, '\r', 0}
+	for _, chunk := range [][]byte{in[:2], in[2:11], in[11:]} {
+		b.Write(chunk)
+		buf := make([]byte, len(chunk))
+		if _, err := io.ReadFull(tap, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, chunk) {
+			t.Fatalf("Expected % x to pass through, got % x", chunk, buf)
+		}
+	}
+	if tap.RemoteEnabled(telnet.TeloptECHO) {
+		t.Error("Expected ECHO not to be enabled before it is agreed to")
+	}
+
+	out := []byte{telnet.IAC, telnet.DO, telnet.TeloptECHO, telnet.IAC, telnet.DONT, telnet.TeloptSGA}
+	if _, err := tap.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(out))
+	if _, err := io.ReadFull(b, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, out) {
+		t.Errorf("Expected % x to pass through, got % x", out, buf)
+	}
+	if !tap.RemoteEnabled(telnet.TeloptECHO) || tap.LocalEnabled(telnet.TeloptECHO) {
+		t.Error("Expected ECHO to be enabled remotely only")
+	}
+
+	expected := []string{
+		fmt.Sprintf("recv %d %d", telnet.WILL, telnet.TeloptECHO),
+		fmt.Sprintf("recv sb %d %q", telnet.TeloptTTYPE, []byte{telnet.TelQualSEND}),
+		fmt.Sprintf("sent %d %d", telnet.DO, telnet.TeloptECHO),
+		fmt.Sprintf("option %d false true", telnet.TeloptECHO),
+		fmt.Sprintf("sent %d %d", telnet.DONT, telnet.TeloptSGA),
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Expected %q, got %q", expected, events)
+	}
+
+	// The peer withdrawing the option disables it.
+	b.Write([]byte{telnet.IAC, telnet.WONT, telnet.TeloptECHO})
+	io.ReadFull(tap, make([]byte, 3))
+	if tap.RemoteEnabled(telnet.TeloptECHO) {
+		t.Error("Expected WONT to disable ECHO")
+	}
+}
@@ -0,0 +1,86 @@
+package telnettest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// FakeClock is a telnet.Clock whose time only moves when Advance is called, so
+// tests of timeouts run instantly and deterministically. Its zero value is
+// not usable; create one with NewFakeClock.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{} // closed and replaced when a waiter is added
+}
+
+// fakeWaiter is a pending call to After.
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+var _ telnet.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t, added: make(chan struct{})}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the clock's time once it has been
+// advanced by d. If d is not positive, the channel is ready immediately.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	close(c.added)
+	c.added = make(chan struct{})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the channels of any calls to
+// After that are then due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+// BlockUntil waits until at least n calls to After are waiting for the clock
+// to be advanced. Use it to make sure the code under test has started waiting
+// before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		waiting, added := len(c.waiters), c.added
+		c.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		<-added
+	}
+}
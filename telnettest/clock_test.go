@@ -0,0 +1,62 @@
+package telnettest_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := telnettest.NewFakeClock(start)
+	soon, later := clock.After(time.Second), clock.After(time.Minute)
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("Expected After(0) to be ready immediately")
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case at := <-soon:
+		if !at.Equal(start.Add(time.Second)) {
+			t.Errorf("Expected %v, got %v", start.Add(time.Second), at)
+		}
+	default:
+		t.Error("Expected After(1s) to fire after advancing 1s")
+	}
+	select {
+	case <-later:
+		t.Error("Expected After(1m) not to fire after advancing 1s")
+	default:
+	}
+	clock.Advance(time.Minute)
+	<-later
+	if got := clock.Now(); !got.Equal(start.Add(time.Minute + time.Second)) {
+		t.Errorf("Expected %v, got %v", start.Add(time.Minute+time.Second), got)
+	}
+}
+
+func TestClockPipe(t *testing.T) {
+	clock := telnettest.NewFakeClock(time.Now())
+	a, b := telnettest.ClockPipe(clock)
+	defer b.Close()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+
+	conn.SetReadDeadline(clock.Now().Add(time.Hour))
+	done := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	if err := <-done; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", os.ErrDeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,140 @@
+package telnettest
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// FaultConn wraps a net.Conn to inject the faults a real network produces, so
+// tests can check that a Connection copes with sequences split across reads,
+// slow peers and failures part way through a stream. For example, to deliver
+// `IAC SB` in separate reads:
+//
+//	a, b := telnettest.Pipe()
+//	conn := telnet.NewConnection(&telnettest.FaultConn{Conn: a, SplitReads: []int64{1}}, nil)
+//	b.Write([]byte{telnet.IAC, telnet.SB, ...})
+//
+// Offsets count the bytes read or written through the FaultConn since it was
+// created. Its fields must not be changed once it is in use.
+type FaultConn struct {
+	net.Conn
+
+	// MaxRead, if positive, is the most bytes returned by each Read.
+	MaxRead int
+
+	// SplitReads are offsets in the stream read that no single Read returns
+	// bytes either side of.
+	SplitReads []int64
+
+	// SplitWrites are offsets in the stream written at which a Write is split
+	// into separate writes to the underlying connection.
+	SplitWrites []int64
+
+	// Latency is a delay before each read from and write to the underlying
+	// connection.
+	Latency time.Duration
+
+	// Clock, if set, is used instead of the system clock to time the Latency.
+	Clock telnet.Clock
+
+	// ReadErr, if non-nil, is returned by Read once ReadErrAfter bytes have
+	// been read.
+	ReadErr      error
+	ReadErrAfter int64
+
+	// WriteErr, if non-nil, is returned by Write once WriteErrAfter bytes have
+	// been written.
+	WriteErr      error
+	WriteErrAfter int64
+
+	mu      sync.Mutex
+	read    int64
+	written int64
+}
+
+// Read reads from the underlying connection, returning no more than the
+// faults allow.
+func (f *FaultConn) Read(b []byte) (int, error) {
+	f.delay()
+	f.mu.Lock()
+	off := f.read
+	f.mu.Unlock()
+	if f.ReadErr != nil && off >= f.ReadErrAfter {
+		return 0, f.ReadErr
+	}
+
+	limit := int64(len(b))
+	if f.MaxRead > 0 && limit > int64(f.MaxRead) {
+		limit = int64(f.MaxRead)
+	}
+	if f.ReadErr != nil {
+		limit = clamp(limit, off, f.ReadErrAfter)
+	}
+	for _, split := range f.SplitReads {
+		limit = clamp(limit, off, split)
+	}
+
+	n, err := f.Conn.Read(b[:limit])
+	f.mu.Lock()
+	f.read += int64(n)
+	f.mu.Unlock()
+	return n, err
+}
+
+// Write writes b to the underlying connection, in several writes if it spans
+// any of the SplitWrites.
+func (f *FaultConn) Write(b []byte) (int, error) {
+	var total int
+	for first := true; first || len(b) > 0; first = false {
+		f.delay()
+		f.mu.Lock()
+		off := f.written
+		f.mu.Unlock()
+		if f.WriteErr != nil && off >= f.WriteErrAfter {
+			return total, f.WriteErr
+		}
+
+		limit := int64(len(b))
+		if f.WriteErr != nil {
+			limit = clamp(limit, off, f.WriteErrAfter)
+		}
+		for _, split := range f.SplitWrites {
+			limit = clamp(limit, off, split)
+		}
+
+		n, err := f.Conn.Write(b[:limit])
+		f.mu.Lock()
+		f.written += int64(n)
+		f.mu.Unlock()
+		total += n
+		b = b[n:]
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// delay waits for the Latency.
+func (f *FaultConn) delay() {
+	if f.Latency <= 0 {
+		return
+	}
+	clock := f.Clock
+	if clock == nil {
+		clock = telnet.SystemClock
+	}
+	<-clock.After(f.Latency)
+}
+
+// clamp returns limit reduced so that a transfer of that many bytes starting
+// at offset off stops at offset at, if at lies within it.
+func clamp(limit, off, at int64) int64 {
+	if at > off && at-off < limit {
+		return at - off
+	}
+	return limit
+}
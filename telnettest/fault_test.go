@@ -0,0 +1,68 @@
+package telnettest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestFaultConn_Reads(t *testing.T) {
+	const code = 200
+	stream := []byte{'a', telnet.IAC, telnet.SB, code, 1, telnet.IAC, telnet.IAC, 2, telnet.IAC, telnet.SE, 'b', telnet.IAC, telnet.NOP, 'c'}
+	// Split the stream at every offset in turn, and byte by byte.
+	for split := int64(1); split <= int64(len(stream)); split++ {
+		for _, maxRead := range []int{0, 1} {
+			m := &telnettest.MockNegotiator{Code: code}
+			a, b := telnettest.Pipe()
+			conn := telnet.NewConnection(&telnettest.FaultConn{Conn: a, MaxRead: maxRead, SplitReads: []int64{split}}, []telnet.Option{m.Option()})
+			b.Write(stream)
+			b.Close()
+			data, err := ioutil.ReadAll(conn)
+			conn.Close()
+			if err != nil {
+				t.Fatalf("split %d, max %d: %v", split, maxRead, err)
+			}
+			if string(data) != "abc" {
+				t.Errorf("split %d, max %d: expected %q, got %q", split, maxRead, "abc", data)
+			}
+			expected := []telnettest.Call{{Method: "Offer"}, {Method: "HandleSB", Body: []byte{1, telnet.IAC, 2}}}
+			if fmt.Sprintf("%q", m.Calls()) != fmt.Sprintf("%q", expected) {
+				t.Errorf("split %d, max %d: expected %q, got %q", split, maxRead, expected, m.Calls())
+			}
+		}
+	}
+}
+
+func TestFaultConn_Errors(t *testing.T) {
+	errReset := errors.New("connection reset")
+	// net.Pipe delivers each write to a separate read.
+	a, b := net.Pipe()
+	defer b.Close()
+	f := &telnettest.FaultConn{Conn: a, SplitWrites: []int64{2}, WriteErr: errReset, WriteErrAfter: 4, ReadErr: errReset, ReadErrAfter: 3}
+
+	go func() {
+		n, err := f.Write([]byte("hello"))
+		if n != 4 || err != errReset {
+			t.Errorf("Expected 4, %v, got %d, %v", errReset, n, err)
+		}
+		b.Write([]byte("world"))
+	}()
+	buf := make([]byte, 4)
+	for _, expected := range []string{"he", "ll"} {
+		if n, _ := b.Read(buf); string(buf[:n]) != expected {
+			t.Errorf("Expected %q, got %q", expected, buf[:n])
+		}
+	}
+
+	if n, err := f.Read(buf); n != 3 || err != nil {
+		t.Errorf("Expected 3, nil, got %d, %v", n, err)
+	}
+	if _, err := f.Read(buf); err != errReset {
+		t.Errorf("Expected %v, got %v", errReset, err)
+	}
+}
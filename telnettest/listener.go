@@ -0,0 +1,64 @@
+package telnettest
+
+import (
+	"net"
+	"sync"
+
+	"github.com/tester2024/telnet"
+)
+
+// Listener is an in-memory net.Listener, whose connections are Pipes made by
+// Dial. It lets a telnet.Server be exercised without a network.
+type Listener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewListener returns a Listener ready to accept connections.
+func NewListener() *Listener {
+	return &Listener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// Accept waits for a connection made by Dial.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the Listener accepting connections. Connections already made are
+// unaffected.
+func (l *Listener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the Listener's address.
+func (l *Listener) Addr() net.Addr {
+	return pipeAddr("telnettest.listener")
+}
+
+// DialConn makes a connection to the Listener, returning the client's end once
+// it has been accepted.
+func (l *Listener) DialConn() (net.Conn, error) {
+	client, server := Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Dial connects to the Listener as a client, with the given options.
+func (l *Listener) Dial(options ...telnet.Option) (*telnet.Connection, error) {
+	c, err := l.DialConn()
+	if err != nil {
+		return nil, err
+	}
+	return telnet.NewConnection(c, options), nil
+}
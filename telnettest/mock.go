@@ -0,0 +1,114 @@
+package telnettest
+
+import (
+	"sync"
+
+	"github.com/tester2024/telnet"
+)
+
+// Call is a call made to a MockNegotiator.
+type Call struct {
+	// Method is the name of the method called: "Offer", "HandleDo",
+	// "HandleWill", "HandleSB" or "HandleRefused".
+	Method string
+	// Body is a copy of the subnegotiation body passed to HandleSB.
+	Body []byte
+}
+
+// MockNegotiator is a telnet.Negotiator that records the calls made to it, and
+// makes canned responses. Calls are made on the Connection's negotiation
+// goroutine, so close the Connection, which waits for negotiation to finish,
+// before checking them.
+type MockNegotiator struct {
+	// Code is the option code it handles.
+	Code byte
+
+	// OfferCommand, if non-zero, is written with the option from Offer - for
+	// example, telnet.WILL to offer the option.
+	OfferCommand byte
+
+	// DoReply, if non-zero, is written with the option in reply to IAC DO.
+	// If it is telnet.WILL, the option is recorded as enabled locally.
+	DoReply byte
+
+	// WillReply, if non-zero, is written with the option in reply to IAC
+	// WILL. If it is telnet.DO, the option is recorded as enabled remotely.
+	WillReply byte
+
+	// SBReply, if non-nil, is written as a subnegotiation in reply to each
+	// one received.
+	SBReply []byte
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Option returns a telnet.Option registering m with a Connection.
+func (m *MockNegotiator) Option() telnet.Option {
+	return func(*telnet.Connection) telnet.Negotiator { return m }
+}
+
+// Calls returns the calls made so far, in order.
+func (m *MockNegotiator) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Reset forgets the calls made so far.
+func (m *MockNegotiator) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+func (m *MockNegotiator) record(method string, body []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Body: body})
+}
+
+// OptionCode returns Code.
+func (m *MockNegotiator) OptionCode() byte {
+	return m.Code
+}
+
+// Offer records the call, and writes OfferCommand if it is set.
+func (m *MockNegotiator) Offer(c *telnet.Connection) {
+	m.record("Offer", nil)
+	if m.OfferCommand != 0 {
+		c.WriteCommand(m.OfferCommand, m.Code)
+	}
+}
+
+// HandleDo records the call, and writes DoReply if it is set.
+func (m *MockNegotiator) HandleDo(c *telnet.Connection) {
+	m.record("HandleDo", nil)
+	if m.DoReply != 0 {
+		c.WriteCommand(m.DoReply, m.Code)
+		c.SetLocalEnabled(m.Code, m.DoReply == telnet.WILL)
+	}
+}
+
+// HandleWill records the call, and writes WillReply if it is set.
+func (m *MockNegotiator) HandleWill(c *telnet.Connection) {
+	m.record("HandleWill", nil)
+	if m.WillReply != 0 {
+		c.WriteCommand(m.WillReply, m.Code)
+		c.SetRemoteEnabled(m.Code, m.WillReply == telnet.DO)
+	}
+}
+
+// HandleRefused records the call.
+func (m *MockNegotiator) HandleRefused(c *telnet.Connection, local bool) {
+	m.record("HandleRefused", nil)
+}
+
+// HandleSB records the call with a copy of body, and writes SBReply if it is
+// set.
+func (m *MockNegotiator) HandleSB(c *telnet.Connection, body []byte) {
+	m.record("HandleSB", append([]byte{}, body...))
+	if m.SBReply != nil {
+		c.WriteSubnegotiation(m.Code, m.SBReply)
+	}
+}
@@ -0,0 +1,48 @@
+package telnettest_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestMockNegotiator(t *testing.T) {
+	const code = 200
+	m := &telnettest.MockNegotiator{
+		Code:         code,
+		OfferCommand: telnet.DO,
+		DoReply:      telnet.WONT,
+		WillReply:    telnet.DO,
+		SBReply:      []byte("ok"),
+	}
+	peer, conn := telnettest.NewPeer(m.Option())
+	go io.Copy(ioutil.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.DO, code),
+		telnettest.Send(telnet.IAC, telnet.WILL, code),
+		telnettest.Expect(telnet.IAC, telnet.DO, code),
+		telnettest.Send(telnet.IAC, telnet.DO, code),
+		telnettest.Expect(telnet.IAC, telnet.WONT, code),
+		telnettest.Send(telnet.IAC, telnet.SB, code, 'h', 'i', telnet.IAC, telnet.SE),
+		telnettest.Expect(telnet.IAC, telnet.SB, code, 'o', 'k', telnet.IAC, telnet.SE),
+	)
+	peer.Close()
+	conn.Close()
+
+	expected := []telnettest.Call{
+		{Method: "Offer"},
+		{Method: "HandleWill"},
+		{Method: "HandleDo"},
+		{Method: "HandleSB", Body: []byte("hi")},
+	}
+	if fmt.Sprintf("%q", m.Calls()) != fmt.Sprintf("%q", expected) {
+		t.Errorf("Expected %q, got %q", expected, m.Calls())
+	}
+	if !conn.RemoteEnabled(code) || conn.LocalEnabled(code) {
+		t.Error("Expected the option to be enabled remotely only")
+	}
+}
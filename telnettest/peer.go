@@ -0,0 +1,135 @@
+package telnettest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// DefaultTimeout is how long a Peer waits for expected bytes when its Timeout
+// is zero.
+const DefaultTimeout = time.Second
+
+// Step is a step of a script played by a Peer: bytes to send, or bytes
+// expected next from the Connection under test.
+type Step struct {
+	send   []byte
+	expect []byte
+}
+
+// Send returns a Step sending raw bytes to the Connection.
+func Send(b ...byte) Step {
+	return Step{send: b}
+}
+
+// Expect returns a Step checking that the Connection writes exactly these
+// bytes next.
+func Expect(b ...byte) Step {
+	return Step{expect: b}
+}
+
+// Peer is the far end of a Connection under test, which plays scripts of raw
+// bytes against it - for example, to check how a Negotiator responds to a
+// client:
+//
+//	peer, conn := telnettest.NewPeer(options.EchoOption)
+//	go handler.HandleTelnet(conn)
+//	peer.Run(t,
+//		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptECHO),
+//		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptECHO),
+//		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+//		telnettest.Expect(telnet.IAC, telnet.WONT, telnet.TeloptNAWS),
+//	)
+//
+// Commands sent by the Peer are only handled while the Connection is being
+// read, so something - usually the handler under test - must read from it.
+type Peer struct {
+	net.Conn
+
+	// Timeout is how long each Expect step waits for the bytes it expects.
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// NewPeer returns a Peer, and a Connection with the given options joined to it
+// by a Pipe. The caller should Close both when finished with them.
+func NewPeer(options ...telnet.Option) (*Peer, *telnet.Connection) {
+	a, b := Pipe()
+	return &Peer{Conn: a}, telnet.NewConnection(b, options)
+}
+
+// Run plays the steps in order, stopping the test with a description of both
+// sides if the Connection writes something other than expected.
+func (p *Peer) Run(t testing.TB, steps ...Step) {
+	t.Helper()
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	for i, s := range steps {
+		if s.send != nil {
+			if _, err := p.Write(s.send); err != nil {
+				t.Fatalf("step %d: sending %s: %v", i+1, Describe(s.send), err)
+			}
+			continue
+		}
+		got := make([]byte, len(s.expect))
+		p.SetReadDeadline(time.Now().Add(timeout))
+		n, err := io.ReadFull(p, got)
+		p.SetReadDeadline(time.Time{})
+		got = got[:n]
+		if !bytes.Equal(got, s.expect) {
+			msg := fmt.Sprintf("step %d: expected %s\n\t      got %s", i+1, Describe(s.expect), Describe(got))
+			if err != nil {
+				msg += fmt.Sprintf(" (%v)", err)
+			}
+			t.Fatal(msg)
+		}
+	}
+}
+
+// Describe returns a readable description of raw telnet bytes, naming the
+// commands and options in IAC sequences and quoting text, followed by the
+// bytes in hex. For example, "IAC DO NAWS" "hi" [ff fd 1f 68 69].
+func Describe(b []byte) string {
+	if len(b) == 0 {
+		return "nothing"
+	}
+	var parts []string
+	var text []byte
+	flush := func() {
+		if len(text) > 0 {
+			parts = append(parts, strconv.Quote(string(text)))
+			text = nil
+		}
+	}
+	for i := 0; i < len(b); i++ {
+		if b[i] != telnet.IAC || i+1 == len(b) || b[i+1] == telnet.IAC {
+			text = append(text, b[i])
+			if b[i] == telnet.IAC && i+1 < len(b) {
+				i++
+			}
+			continue
+		}
+		flush()
+		seq := "IAC " + telnet.Command(b[i+1]).String()
+		switch b[i+1] {
+		case telnet.WILL, telnet.WONT, telnet.DO, telnet.DONT, telnet.SB:
+			if i+2 < len(b) {
+				seq += " " + telnet.OptionCode(b[i+2]).String()
+				i++
+			}
+		}
+		parts = append(parts, seq)
+		i++
+	}
+	flush()
+	return fmt.Sprintf("%s [% x]", strings.Join(parts, " "), b)
+}
@@ -0,0 +1,64 @@
+package telnettest_test
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestPeer_Run(t *testing.T) {
+	peer, conn := telnettest.NewPeer(options.EchoOption)
+	go io.Copy(ioutil.Discard, conn)
+	peer.Run(t,
+		telnettest.Expect(telnet.IAC, telnet.WILL, telnet.TeloptECHO),
+		telnettest.Send(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		telnettest.Expect(telnet.IAC, telnet.WONT, telnet.TeloptNAWS),
+	)
+	peer.Close()
+	conn.Close()
+}
+
+// fatalRecorder records the failure of a test.
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatal(args ...interface{}) {
+	r.msg = args[0].(string)
+	panic(r)
+}
+
+func TestPeer_RunMismatch(t *testing.T) {
+	peer, conn := telnettest.NewPeer()
+	go io.Copy(ioutil.Discard, conn)
+	rec := &fatalRecorder{TB: t}
+	func() {
+		defer func() { recover() }()
+		peer.Run(rec,
+			telnettest.Send(telnet.IAC, telnet.WILL, telnet.TeloptNAWS),
+			telnettest.Expect(telnet.IAC, telnet.DO, telnet.TeloptNAWS),
+		)
+	}()
+	peer.Close()
+	conn.Close()
+	expected := "step 2: expected IAC DO NAWS [ff fd 1f]\n\t      got IAC DONT NAWS [ff fe 1f]"
+	if !strings.HasPrefix(rec.msg, expected) {
+		t.Errorf("Expected %q, got %q", expected, rec.msg)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	b := []byte{'h', 'i', telnet.IAC, telnet.IAC, telnet.IAC, telnet.SB, telnet.TeloptNAWS, 0, 80, telnet.IAC, telnet.SE}
+	expected := `"hi\xff" IAC SB NAWS "\x00P" IAC SE [68 69 ff ff ff fa 1f 00 50 ff f0]`
+	if got := telnettest.Describe(b); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
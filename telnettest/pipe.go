@@ -0,0 +1,171 @@
+package telnettest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// Pipe returns two ends of an in-memory, full duplex network connection, like
+// net.Pipe. Unlike net.Pipe, writes are buffered and never block, so both
+// ends can write - as Offer does from NewConnection - without waiting for the
+// other to read. Deadlines are supported.
+func Pipe() (net.Conn, net.Conn) {
+	return ClockPipe(telnet.SystemClock)
+}
+
+// ClockPipe is like Pipe, but its deadlines are measured by the given clock,
+// so with a FakeClock they pass only when the clock is advanced.
+func ClockPipe(clock telnet.Clock) (net.Conn, net.Conn) {
+	ab, ba := newPipeBuffer(clock), newPipeBuffer(clock)
+	a := &pipeConn{r: ba, w: ab, clock: clock, local: pipeAddr("telnettest.a"), remote: pipeAddr("telnettest.b")}
+	b := &pipeConn{r: ab, w: ba, clock: clock, local: pipeAddr("telnettest.b"), remote: pipeAddr("telnettest.a")}
+	return a, b
+}
+
+// pipeAddr is the address of an end of a Pipe.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeBuffer carries data in one direction of a Pipe.
+type pipeBuffer struct {
+	clock    telnet.Clock
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	eof      bool          // the writing end has closed
+	closed   bool          // the reading end has closed
+	deadline time.Time     // read deadline
+	changed  chan struct{} // closed and replaced when any of the above change
+}
+
+func newPipeBuffer(clock telnet.Clock) *pipeBuffer {
+	return &pipeBuffer{clock: clock, changed: make(chan struct{})}
+}
+
+// notify wakes any blocked reader. The caller must hold p.mu.
+func (p *pipeBuffer) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *pipeBuffer) read(b []byte) (int, error) {
+	for {
+		p.mu.Lock()
+		switch {
+		case p.closed:
+			p.mu.Unlock()
+			return 0, net.ErrClosed
+		case !p.deadline.IsZero() && !p.clock.Now().Before(p.deadline):
+			p.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		case p.buf.Len() > 0 || len(b) == 0:
+			n, _ := p.buf.Read(b)
+			p.mu.Unlock()
+			return n, nil
+		case p.eof:
+			p.mu.Unlock()
+			return 0, io.EOF
+		}
+		changed, deadline := p.changed, p.deadline
+		p.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-changed
+			continue
+		}
+		select {
+		case <-changed:
+		case <-p.clock.After(deadline.Sub(p.clock.Now())):
+		}
+	}
+}
+
+func (p *pipeBuffer) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.buf.Write(b)
+	p.notify()
+	return len(b), nil
+}
+
+func (p *pipeBuffer) setDeadline(t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadline = t
+	p.notify()
+}
+
+// pipeConn is an end of a Pipe.
+type pipeConn struct {
+	r, w          *pipeBuffer
+	clock         telnet.Clock
+	local, remote net.Addr
+
+	mu            sync.Mutex
+	closed        bool
+	writeDeadline time.Time
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	return c.r.read(b)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	closed, deadline := c.closed, c.writeDeadline
+	c.mu.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+	if !deadline.IsZero() && !c.clock.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.w.write(b)
+}
+
+// Close closes both directions: the other end reads io.EOF once it has read
+// the data already written, and its writes fail.
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.w.mu.Lock()
+	c.w.eof = true
+	c.w.notify()
+	c.w.mu.Unlock()
+	c.r.mu.Lock()
+	c.r.closed = true
+	c.r.notify()
+	c.r.mu.Unlock()
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,58 @@
+// Package telnettest provides utilities for testing telnet Handlers and
+// Negotiators, in the manner of net/http/httptest.
+package telnettest
+
+import (
+	"net"
+
+	"github.com/tester2024/telnet"
+)
+
+// Server is a telnet server listening on a loopback address, for testing.
+type Server struct {
+	// Addr is the address the server is listening on, in host:port form.
+	Addr string
+
+	// Listener is the server's listener.
+	Listener net.Listener
+
+	server *telnet.Server
+}
+
+// NewServer starts and returns a Server handling connections with handler and
+// the given options. The caller should call Close when finished with it.
+func NewServer(handler telnet.Handler, options ...telnet.Option) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic("telnettest: failed to listen on a port: " + err.Error())
+		}
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Listener: l,
+		server:   telnet.NewServer(l.Addr().String(), handler, options...),
+	}
+	go s.server.Serve(l)
+	return s
+}
+
+// Dial connects to the Server as a client, with the given options.
+func (s *Server) Dial(options ...telnet.Option) (*telnet.Connection, error) {
+	return telnet.Dial(s.Addr, options...)
+}
+
+// Close stops the Server listening. Connections already accepted are not
+// closed.
+func (s *Server) Close() {
+	s.server.Stop()
+}
+
+// NewPair returns two Connections joined by a Pipe, with the given options
+// registered on each. Both Offer their options as they are created; the
+// commands are buffered until the other Connection reads them. The caller
+// should Close both when finished with them.
+func NewPair(aOptions, bOptions []telnet.Option) (a, b *telnet.Connection) {
+	ca, cb := Pipe()
+	return telnet.NewConnection(ca, aOptions), telnet.NewConnection(cb, bOptions)
+}
@@ -0,0 +1,94 @@
+package telnettest_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/options"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestNewServer(t *testing.T) {
+	s := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		io.Copy(c, c)
+	}))
+	defer s.Close()
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Error(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", b)
+	}
+	conn.Close()
+}
+
+func TestListener(t *testing.T) {
+	l := telnettest.NewListener()
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		io.Copy(c, c)
+	}))
+	go s.Serve(l)
+	defer s.Stop()
+	conn, err := l.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Error(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", b)
+	}
+}
+
+func TestNewPair(t *testing.T) {
+	// The server offers WILL ECHO without blocking, though the client isn't
+	// reading yet.
+	client, server := telnettest.NewPair(nil, []telnet.Option{options.EchoOption})
+	server.Write([]byte("hi"))
+	server.Close()
+	b, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "hi" {
+		t.Errorf("Expected %q, got %q", "hi", b)
+	}
+	client.Close()
+}
+
+func TestPipe(t *testing.T) {
+	a, b := telnettest.Pipe()
+	if _, err := a.Write([]byte("buffered")); err != nil {
+		t.Fatal(err)
+	}
+	b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "buffered" {
+		t.Errorf("Expected %q, got %q, %v", "buffered", buf, err)
+	}
+	if _, err := b.Read(buf); !os.IsTimeout(err) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	b.SetReadDeadline(time.Time{})
+	a.Close()
+	if _, err := b.Read(buf); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if _, err := b.Write(buf); err == nil {
+		t.Error("Expected writing to a closed pipe to fail")
+	}
+}
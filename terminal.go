@@ -0,0 +1,196 @@
+package telnet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned when the client's terminal is known not to
+// support what was asked of it.
+var ErrUnsupported = errors.New("telnet: not supported by the client's terminal")
+
+// MTTS flags, which MUD clients report as a terminal type of "MTTS <flags>"
+// (MUD Terminal Type Standard).
+const (
+	MTTSANSI            = 1    // ANSI colors
+	MTTSVT100           = 2    // VT100 control sequences
+	MTTSUTF8            = 4    // UTF-8 character encoding
+	MTTS256Colors       = 8    // xterm 256 colors
+	MTTSMouseTracking   = 16   // xterm mouse tracking
+	MTTSOSCColorPalette = 32   // OSC color palette
+	MTTSScreenReader    = 64   // a screen reader is in use
+	MTTSProxy           = 128  // the client is a proxy
+	MTTSTrueColor       = 256  // 24-bit color
+	MTTSMNES            = 512  // MUD New-Environ Standard
+	MTTSMSLP            = 1024 // MUD Server Link Protocol
+	MTTSSSL             = 2048 // the connection is encrypted
+)
+
+// TerminalCapabilities is what is known of the client's terminal from the
+// terminal types it reported with TTYPE.
+type TerminalCapabilities struct {
+	// Types are the terminal types reported, in order. Clients following
+	// MTTS report their name, then their terminal type, then "MTTS <flags>".
+	Types []string
+	// MTTS holds the MTTS flags reported, if any.
+	MTTS int
+}
+
+// titleTerminals are prefixes of the terminal types of emulators that set
+// their window title from the xterm OSC sequence.
+var titleTerminals = []string{"xterm", "rxvt", "screen", "tmux", "putty",
+	"konsole", "gnome", "vte", "alacritty", "kitty", "iterm", "wezterm",
+	"foot", "mintty", "cygwin", "contour", "ghostty"}
+
+// SupportsTitle reports whether the terminal is likely to support setting its
+// window title: if one of its types is that of an emulator known to, if it
+// reported the MTTS VT100 flag, or if nothing is known of it.
+func (tc TerminalCapabilities) SupportsTitle() bool {
+	for _, t := range tc.Types {
+		t = strings.ToLower(t)
+		for _, prefix := range titleTerminals {
+			if strings.HasPrefix(t, prefix) {
+				return true
+			}
+		}
+	}
+	if tc.MTTS != 0 {
+		return tc.MTTS&MTTSVT100 != 0
+	}
+	return len(tc.Types) == 0
+}
+
+// colorTerminals are prefixes of the terminal types of terminals with ANSI
+// colors, besides those supporting titles.
+var colorTerminals = []string{"ansi", "linux", "vt340", "cons25", "pcansi"}
+
+// hyperlinkTerminals are names found in the terminal types of emulators that
+// support OSC 8 hyperlinks.
+var hyperlinkTerminals = []string{"kitty", "wezterm", "iterm", "vte", "gnome",
+	"foot", "alacritty", "konsole", "mintty", "contour", "ghostty"}
+
+// SupportsColor reports whether the terminal is likely to support ANSI colors:
+// if one of its types is that of a terminal known to, if it reported the MTTS
+// ANSI flag, or if nothing is known of it.
+func (tc TerminalCapabilities) SupportsColor() bool {
+	if tc.MTTS&MTTSANSI != 0 || len(tc.Types) == 0 && tc.MTTS == 0 {
+		return true
+	}
+	for _, t := range tc.Types {
+		t = strings.ToLower(t)
+		if strings.Contains(t, "color") {
+			return true
+		}
+		for _, prefix := range append(colorTerminals, titleTerminals...) {
+			if strings.HasPrefix(t, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SupportsHyperlinks reports whether the terminal is likely to support OSC 8
+// hyperlinks, which only some emulators do; nothing is assumed of a terminal
+// that has not reported its type.
+func (tc TerminalCapabilities) SupportsHyperlinks() bool {
+	for _, t := range tc.Types {
+		t = strings.ToLower(t)
+		for _, name := range hyperlinkTerminals {
+			if strings.Contains(t, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// terminalCapabilitiesKey is the key of the TerminalCapabilities stored with
+// SetValue.
+type terminalCapabilitiesKey struct{}
+
+// TerminalCapabilities returns what is known of the client's terminal, as
+// recorded by SetTerminalCapabilities; the zero value if nothing is.
+func (c *Connection) TerminalCapabilities() TerminalCapabilities {
+	tc, _ := c.Value(terminalCapabilitiesKey{}).(TerminalCapabilities)
+	return tc
+}
+
+// SetTerminalCapabilities records what is known of the client's terminal. The
+// TTYPE handler of the options package calls it as the client reports its
+// terminal types.
+func (c *Connection) SetTerminalCapabilities(tc TerminalCapabilities) {
+	c.SetValue(terminalCapabilitiesKey{}, tc)
+	c.emit(TerminalTypeEvent{tc})
+}
+
+// TerminalTypeRefresher is an optional interface for the TTYPE Negotiator of
+// a Connection, able to ask the client for its terminal types again.
+type TerminalTypeRefresher interface {
+	Negotiator
+	// RefreshTerminalType asks the client for its terminal types again,
+	// for Connection.RefreshTerminalType, recording them with
+	// SetTerminalCapabilities once the client has reported them all.
+	RefreshTerminalType(conn *Connection) error
+}
+
+// RefreshTerminalType asks the client for its terminal types again, for
+// clients that can change their emulation during a session. The answers
+// arrive as the Connection is read, and once the client has reported them
+// all, TerminalCapabilities returns them and a TerminalTypeEvent is
+// delivered; until then, it returns what was known before. It returns
+// ErrUnsupported if the client has not agreed to report its terminal type, or
+// the Connection's TTYPE handler is not a TerminalTypeRefresher, as the one
+// of the options package is.
+func (c *Connection) RefreshTerminalType() error {
+	h, ok := c.OptionHandlers[TeloptTTYPE].(TerminalTypeRefresher)
+	if !ok || !c.RemoteEnabled(TeloptTTYPE) {
+		return ErrUnsupported
+	}
+	return h.RefreshTerminalType(c)
+}
+
+// windowSizeKey is the key of the window size stored with SetValue.
+type windowSizeKey struct{}
+
+// windowSize is a window size stored with SetValue.
+type windowSize struct{ width, height int }
+
+// WindowSize returns the size of the client's window in characters, as
+// recorded by SetWindowSize, or zeros if it is not known.
+func (c *Connection) WindowSize() (width, height int) {
+	ws, _ := c.Value(windowSizeKey{}).(windowSize)
+	return ws.width, ws.height
+}
+
+// SetWindowSize records the size of the client's window in characters. The
+// NAWS handler of the options package calls it as the client reports its size.
+func (c *Connection) SetWindowSize(width, height int) {
+	c.SetValue(windowSizeKey{}, windowSize{width, height})
+	c.emit(WindowSizeEvent{Width: width, Height: height})
+}
+
+// SetWindowTitle sets the client's window title with the xterm OSC sequence.
+// Control characters are removed from the title, so that it cannot end the
+// sequence early and inject others. If the client's terminal is known not to
+// support titles, as reported by TerminalCapabilities, nothing is written and
+// ErrUnsupported is returned.
+func (c *Connection) SetWindowTitle(title string) error {
+	if !c.TerminalCapabilities().SupportsTitle() {
+		return ErrUnsupported
+	}
+	_, err := fmt.Fprintf(c, TitleBarFmt, sanitizeTitle(title))
+	return err
+}
+
+// sanitizeTitle removes C0 and C1 control characters from title, including
+// ESC, BEL and the single-byte string terminator.
+func sanitizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f && r < 0xa0 {
+			return -1
+		}
+		return r
+	}, title)
+}
@@ -0,0 +1,43 @@
+package telnet_test
+
+import (
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+)
+
+func TestTerminalCapabilities_SupportsTitle(t *testing.T) {
+	for _, tc := range []struct {
+		caps     telnet.TerminalCapabilities
+		expected bool
+	}{
+		{telnet.TerminalCapabilities{}, true},
+		{telnet.TerminalCapabilities{Types: []string{"XTERM-256COLOR"}}, true},
+		{telnet.TerminalCapabilities{Types: []string{"dumb"}}, false},
+		{telnet.TerminalCapabilities{Types: []string{"MUDLET", "ANSI", "MTTS 9"}, MTTS: 9}, false},
+		{telnet.TerminalCapabilities{Types: []string{"TINTIN++", "ANSI", "MTTS 11"}, MTTS: 11}, true},
+	} {
+		if got := tc.caps.SupportsTitle(); got != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.caps, tc.expected, got)
+		}
+	}
+}
+
+func TestConnection_SetWindowTitle(t *testing.T) {
+	a, b := telnettest.Pipe()
+	conn := telnet.NewConnection(a, nil)
+	if err := conn.SetWindowTitle("hi\033]0;evil\a\u009c!"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetTerminalCapabilities(telnet.TerminalCapabilities{Types: []string{"dumb"}})
+	if err := conn.SetWindowTitle("ignored"); err != telnet.ErrUnsupported {
+		t.Errorf("Expected %v, got %v", telnet.ErrUnsupported, err)
+	}
+	conn.Close()
+	got := make([]byte, 64)
+	n, _ := b.Read(got)
+	if want := "\033]0;hi]0;evil!\a"; string(got[:n]) != want {
+		t.Errorf("Expected %q, got %q", want, got[:n])
+	}
+}
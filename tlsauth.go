@@ -0,0 +1,66 @@
+package telnet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// tlsConn is a connection running TLS, such as a *tls.Conn.
+type tlsConn interface {
+	ConnectionState() tls.ConnectionState
+	Handshake() error
+}
+
+// TLSConnectionState returns the state of the TLS session the Connection runs
+// over, as for telnets, completing the handshake first if it has yet to be.
+// It reports false if the Connection does not run over TLS.
+func (c *Connection) TLSConnectionState() (tls.ConnectionState, bool) {
+	tc, ok := c.Conn.(tlsConn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	tc.Handshake()
+	return tc.ConnectionState(), true
+}
+
+// PeerCertificate returns the certificate the peer presented over TLS, if it
+// was verified against the ClientCAs of the tls.Config, or nil. A server
+// verifies client certificates when its tls.Config's ClientAuth is
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert.
+func (c *Connection) PeerCertificate() *x509.Certificate {
+	state, ok := c.TLSConnectionState()
+	if !ok || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// CommonNameIdentity maps a client certificate to its subject's common name,
+// for a Server's CertificateIdentity.
+func CommonNameIdentity(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName == "" {
+		return "", errors.New("telnet: certificate has no common name")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// authenticateCertificate sets the Connection's Principal from its verified
+// client certificate with identity, reporting false if the certificate was
+// refused and the Connection closed.
+func (c *Connection) authenticateCertificate(identity func(*x509.Certificate) (string, error)) bool {
+	cert := c.PeerCertificate()
+	if cert == nil {
+		return true
+	}
+	name, err := identity(cert)
+	if err != nil {
+		c.Audit(AuditEvent{Type: AuditAuthFailure, User: cert.Subject.CommonName, Err: err})
+		c.CloseWithReason(err)
+		return false
+	}
+	if name != "" {
+		c.SetPrincipal(&Principal{Name: name, Method: "certificate"})
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package telnet_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tester2024/telnet"
+)
+
+// clientCertificate returns a self-signed client certificate for name.
+func clientCertificate(t *testing.T, name string) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, leaf
+}
+
+// dialTLS serves s over TLS with a client certificate for name, and returns
+// what the handler writes.
+func dialTLS(t *testing.T, s *telnet.Server, name string) string {
+	t.Helper()
+	serverCert := selfSigned(t)
+	clientCert, clientLeaf := clientCertificate(t, name)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientLeaf)
+	roots := x509.NewCertPool()
+	serverLeaf, _ := x509.ParseCertificate(serverCert.Certificate[0])
+	roots.AddCert(serverLeaf)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	}))
+	t.Cleanup(s.Stop)
+	conn, err := telnet.DialTLS(l.Addr().String(), &tls.Config{
+		ServerName:   "localhost",
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, _ := io.ReadAll(conn)
+	return string(got)
+}
+
+func TestServer_CertificateIdentity(t *testing.T) {
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		if p := c.Principal(); p != nil && c.PeerCertificate() != nil {
+			c.Write([]byte(p.Method + ":" + p.Name))
+		}
+	}))
+	s.CertificateIdentity = telnet.CommonNameIdentity
+	if got := dialTLS(t, s, "alice"); got != "certificate:alice" {
+		t.Errorf("Expected %q, got %q", "certificate:alice", got)
+	}
+}
+
+func TestServer_CertificateIdentityRefused(t *testing.T) {
+	called := make(chan struct{}, 1)
+	s := telnet.NewServer("", telnet.HandleFunc(func(c *telnet.Connection) {
+		called <- struct{}{}
+	}))
+	s.CertificateIdentity = func(cert *x509.Certificate) (string, error) {
+		return "", errors.New("unknown user")
+	}
+	dialTLS(t, s, "mallory")
+	select {
+	case <-called:
+		t.Error("Expected the handler not to run")
+	default:
+	}
+}
+
+func TestConnection_TLSConnectionState(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	conn := telnet.NewConnection(a, nil)
+	defer conn.Close()
+	if _, ok := conn.TLSConnectionState(); ok {
+		t.Error("Expected no TLS state on a plain connection")
+	}
+	if conn.PeerCertificate() != nil {
+		t.Error("Expected no peer certificate on a plain connection")
+	}
+}
@@ -0,0 +1,147 @@
+package telnet
+
+import "reflect"
+
+// ConnectionTrace is a set of hooks for observing the telnet protocol on a
+// Connection, in the manner of net/http/httptrace.ClientTrace. Any hook may
+// be nil. Hooks may be called concurrently from the goroutines reading,
+// writing and handling negotiation, and must not retain byte slices passed to
+// them after returning.
+type ConnectionTrace struct {
+	// CommandReceived is called from Read when `IAC <cmd> <option>` is
+	// received, before it is handed to the option handler.
+	CommandReceived func(cmd, option byte)
+
+	// CommandSent is called after `IAC <cmd> <option>` has been written,
+	// including automatic replies made while reading.
+	CommandSent func(cmd, option byte)
+
+	// SubnegotiationReceived is called from Read when a complete
+	// subnegotiation is received, with its unescaped body. It is not called
+	// for options handled by a StreamNegotiator, nor for bodies that exceed
+	// the MaxSubnegotiationSize.
+	SubnegotiationReceived func(option byte, body []byte)
+
+	// SubnegotiationSent is called after a subnegotiation has been written
+	// with WriteSubnegotiation, with its unescaped body.
+	SubnegotiationSent func(option byte, body []byte)
+
+	// DataRead is called with the application data returned by each Read.
+	DataRead func(b []byte)
+
+	// DataWritten is called with the data passed to each successful Write or
+	// RawWrite.
+	DataWritten func(b []byte)
+
+	// WireRead is called with each chunk of the telnet stream received, before
+	// it is decoded but after any StageCompression and StageEncryption
+	// transforms.
+	WireRead func(b []byte)
+
+	// WireWritten is called with each chunk of the telnet stream written,
+	// before any StageCompression and StageEncryption transforms. It is
+	// called while other writes to the Connection are blocked, so it must not
+	// write to the Connection itself.
+	WireWritten func(b []byte)
+
+	// OptionChanged is called when an option is enabled or disabled, on our
+	// side of the connection if local is set or the peer's side otherwise.
+	OptionChanged func(option byte, local, enabled bool)
+
+	// NegotiationFailed is called with a *ProtocolError when malformed
+	// protocol is received, a *SubnegotiationTooLargeError when a
+	// subnegotiation is discarded, or a *NegotiationTimeoutError when an
+	// automatic reply times out.
+	NegotiationFailed func(err error)
+}
+
+// MultiTrace returns a ConnectionTrace that calls the hooks of each of the
+// given traces in turn, skipping any that are nil.
+func MultiTrace(traces ...*ConnectionTrace) *ConnectionTrace {
+	var m ConnectionTrace
+	mv := reflect.ValueOf(&m).Elem()
+	for i := 0; i < mv.NumField(); i++ {
+		var hooks []reflect.Value
+		for _, t := range traces {
+			if t == nil {
+				continue
+			}
+			if h := reflect.ValueOf(t).Elem().Field(i); !h.IsNil() {
+				hooks = append(hooks, h)
+			}
+		}
+		switch len(hooks) {
+		case 0:
+		case 1:
+			mv.Field(i).Set(hooks[0])
+		default:
+			mv.Field(i).Set(reflect.MakeFunc(mv.Field(i).Type(), func(args []reflect.Value) []reflect.Value {
+				for _, h := range hooks {
+					h.Call(args)
+				}
+				return nil
+			}))
+		}
+	}
+	return &m
+}
+
+func (t *ConnectionTrace) commandReceived(cmd, option byte) {
+	if t != nil && t.CommandReceived != nil {
+		t.CommandReceived(cmd, option)
+	}
+}
+
+func (t *ConnectionTrace) commandSent(cmd, option byte) {
+	if t != nil && t.CommandSent != nil {
+		t.CommandSent(cmd, option)
+	}
+}
+
+func (t *ConnectionTrace) subnegotiationReceived(option byte, body []byte) {
+	if t != nil && t.SubnegotiationReceived != nil {
+		t.SubnegotiationReceived(option, body)
+	}
+}
+
+func (t *ConnectionTrace) subnegotiationSent(option byte, body []byte) {
+	if t != nil && t.SubnegotiationSent != nil {
+		t.SubnegotiationSent(option, body)
+	}
+}
+
+func (t *ConnectionTrace) dataRead(b []byte) {
+	if t != nil && t.DataRead != nil && len(b) > 0 {
+		t.DataRead(b)
+	}
+}
+
+func (t *ConnectionTrace) dataWritten(b []byte) {
+	if t != nil && t.DataWritten != nil {
+		t.DataWritten(b)
+	}
+}
+
+func (t *ConnectionTrace) wireRead(b []byte) {
+	if t != nil && t.WireRead != nil && len(b) > 0 {
+		t.WireRead(b)
+	}
+}
+
+func (t *ConnectionTrace) wireWritten(b []byte) {
+	if t != nil && t.WireWritten != nil {
+		t.WireWritten(b)
+	}
+}
+
+func (t *ConnectionTrace) optionChanged(option byte, local, enabled bool) {
+	if t != nil && t.OptionChanged != nil {
+		t.OptionChanged(option, local, enabled)
+	}
+}
+
+func (t *ConnectionTrace) negotiationFailed(err error) {
+	if t != nil && t.NegotiationFailed != nil {
+		t.NegotiationFailed(err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package tracing instruments telnet connections with OpenTelemetry spans.
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tester2024/telnet"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package to a TracerProvider.
+const instrumentationName = "github.com/tester2024/telnet/tracing"
+
+// Tracer creates a span for each telnet connection it instruments. The span
+// records the peer's address, an event for each command and subnegotiation
+// exchanged, and, when it ends, the options enabled on each side. A child
+// span covers the negotiation phase, from the start of the connection until
+// application data is first read or written.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer creating spans with tp, or with the global
+// TracerProvider if tp is nil.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Handler returns a Handler that traces each connection while h handles it.
+// Handlers that need the connection's span, for example to propagate it to
+// backend calls, should call Start themselves instead.
+func (t *Tracer) Handler(h telnet.Handler) telnet.Handler {
+	return telnet.HandleFunc(func(conn *telnet.Connection) {
+		_, end := t.Start(context.Background(), conn)
+		defer end()
+		h.HandleTelnet(conn)
+	})
+}
+
+// Start starts a span for conn as a child of any span in ctx, and adds a trace
+// to conn, alongside any it already has, recording events on it. It returns a
+// context holding the span, and a function to end it that must be called once
+// the connection is finished with. Closing conn first ensures replies to
+// negotiation still pending are recorded.
+func (t *Tracer) Start(ctx context.Context, conn *telnet.Connection) (context.Context, func()) {
+	ctx, span := t.tracer.Start(ctx, "telnet.connection",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("network.peer.address", conn.RemoteAddr().String()),
+			attribute.Int64("telnet.connection.id", int64(conn.ID())),
+		))
+	_, negSpan := t.tracer.Start(ctx, "telnet.negotiation")
+	var negOnce sync.Once
+	endNegotiation := func() { negOnce.Do(func() { negSpan.End() }) }
+
+	conn.Trace = telnet.MultiTrace(conn.Trace, &telnet.ConnectionTrace{
+		CommandReceived: func(cmd, option byte) {
+			span.AddEvent("command received", trace.WithAttributes(commandAttrs(cmd, option)...))
+		},
+		CommandSent: func(cmd, option byte) {
+			span.AddEvent("command sent", trace.WithAttributes(commandAttrs(cmd, option)...))
+		},
+		SubnegotiationReceived: func(option byte, body []byte) {
+			span.AddEvent("subnegotiation received", trace.WithAttributes(
+				attribute.String("telnet.option", telnet.OptionCode(option).String()),
+				attribute.Int("telnet.subnegotiation.length", len(body))))
+		},
+		SubnegotiationSent: func(option byte, body []byte) {
+			span.AddEvent("subnegotiation sent", trace.WithAttributes(
+				attribute.String("telnet.option", telnet.OptionCode(option).String()),
+				attribute.Int("telnet.subnegotiation.length", len(body))))
+		},
+		OptionChanged: func(option byte, local, enabled bool) {
+			span.AddEvent("option changed", trace.WithAttributes(
+				attribute.String("telnet.option", telnet.OptionCode(option).String()),
+				attribute.Bool("telnet.option.local", local),
+				attribute.Bool("telnet.option.enabled", enabled)))
+		},
+		NegotiationFailed: func(err error) {
+			span.RecordError(err)
+		},
+		DataRead:    func([]byte) { endNegotiation() },
+		DataWritten: func([]byte) { endNegotiation() },
+	})
+
+	return ctx, func() {
+		endNegotiation()
+		var local, remote []string
+		for o := 0; o < 256; o++ {
+			if conn.LocalEnabled(byte(o)) {
+				local = append(local, telnet.OptionCode(o).String())
+			}
+			if conn.RemoteEnabled(byte(o)) {
+				remote = append(remote, telnet.OptionCode(o).String())
+			}
+		}
+		span.SetAttributes(
+			attribute.StringSlice("telnet.options.local", local),
+			attribute.StringSlice("telnet.options.remote", remote))
+		span.End()
+	}
+}
+
+// commandAttrs returns the attributes describing a command.
+func commandAttrs(cmd, option byte) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("telnet.command", telnet.Command(cmd).String()),
+		attribute.String("telnet.option", telnet.OptionCode(option).String()),
+	}
+}
@@ -0,0 +1,58 @@
+package tracing_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tr := tracing.NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	client, server := net.Pipe()
+	conn := telnet.NewConnection(server, nil)
+	done := make(chan struct{})
+	go func() {
+		tr.Handler(telnet.HandleFunc(func(conn *telnet.Connection) {
+			conn.SetLocalEnabled(telnet.TeloptECHO, true)
+			ioutil.ReadAll(conn)
+			conn.Close()
+		})).HandleTelnet(conn)
+		close(done)
+	}()
+	client.Write([]byte{telnet.IAC, telnet.DO, telnet.TeloptNAWS})
+	io.ReadFull(client, make([]byte, 3))
+	client.Write([]byte("hi"))
+	client.Close()
+	<-done
+
+	spans := rec.Ended()
+	if len(spans) != 2 || spans[0].Name() != "telnet.negotiation" || spans[1].Name() != "telnet.connection" {
+		t.Fatalf("Expected negotiation and connection spans, got %v", spans)
+	}
+	span := spans[1]
+	var events []string
+	for _, e := range span.Events() {
+		events = append(events, e.Name)
+	}
+	expected := []string{"option changed", "command received", "command sent"}
+	if len(events) != len(expected) {
+		t.Errorf("Expected events %q, got %q", expected, events)
+	}
+	found := false
+	for _, a := range span.Attributes() {
+		if a.Key == "telnet.options.local" {
+			found = len(a.Value.AsStringSlice()) == 1 && a.Value.AsStringSlice()[0] == "ECHO"
+		}
+	}
+	if !found {
+		t.Errorf("Expected telnet.options.local to be [ECHO], got %v", span.Attributes())
+	}
+}
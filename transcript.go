@@ -0,0 +1,102 @@
+package telnet
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultNegotiationLogSize is the number of lines kept for NegotiationLog
+// when Connection.NegotiationLogSize is zero.
+const DefaultNegotiationLogSize = 100
+
+// maxTranscriptBody is the number of subnegotiation body bytes shown on a
+// transcript line.
+const maxTranscriptBody = 32
+
+// transcript is a ring buffer of the most recent lines of a negotiation
+// transcript.
+type transcript struct {
+	mu    sync.Mutex
+	lines []string
+	next  int // index of the oldest line once lines is full
+}
+
+// add appends a line, discarding the oldest if size lines are already held.
+func (t *transcript) add(line string, size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.lines) < size {
+		t.lines = append(t.lines, line)
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+}
+
+// NegotiationLog returns the most recent lines of a transcript of the
+// negotiation on the connection, oldest first, for example:
+//
+//	>> IAC DO NAWS
+//	<< IAC WILL NAWS
+//	<< SB NAWS 0 120 0 40
+//
+// Lines starting ">>" were sent and "<<" received; lines starting "!!" record
+// negotiation failures. It is safe to call from any goroutine.
+func (c *Connection) NegotiationLog() []string {
+	c.transcript.mu.Lock()
+	defer c.transcript.mu.Unlock()
+	lines := make([]string, 0, len(c.transcript.lines))
+	lines = append(lines, c.transcript.lines[c.transcript.next:]...)
+	return append(lines, c.transcript.lines[:c.transcript.next]...)
+}
+
+// transcribe adds a line to the negotiation transcript, and writes it to the
+// NegotiationLogOutput if there is one.
+func (c *Connection) transcribe(line string) {
+	size := c.NegotiationLogSize
+	if size == 0 {
+		size = DefaultNegotiationLogSize
+	}
+	if size > 0 {
+		c.transcript.add(line, size)
+	}
+	if c.NegotiationLogOutput != nil {
+		c.transcript.mu.Lock()
+		io.WriteString(c.NegotiationLogOutput, line+"\n")
+		c.transcript.mu.Unlock()
+	}
+}
+
+// transcribeCommand adds `IAC <cmd> <option>` to the transcript.
+func (c *Connection) transcribeCommand(received bool, cmd, option byte) {
+	c.transcribe(direction(received) + "IAC " + commandName(cmd) + " " + optionName(option))
+}
+
+// transcribeSubnegotiation adds a subnegotiation to the transcript, showing
+// the start of its body in decimal.
+func (c *Connection) transcribeSubnegotiation(received bool, option byte, body []byte) {
+	var sb strings.Builder
+	sb.WriteString(direction(received) + "SB " + optionName(option))
+	for i, b := range body {
+		if i == maxTranscriptBody {
+			sb.WriteString(" ... (" + strconv.Itoa(len(body)) + " bytes)")
+			break
+		}
+		sb.WriteString(" " + strconv.Itoa(int(b)))
+	}
+	c.transcribe(sb.String())
+}
+
+// transcribeFailure adds a negotiation failure to the transcript.
+func (c *Connection) transcribeFailure(err error) {
+	c.transcribe("!! " + err.Error())
+}
+
+func direction(received bool) string {
+	if received {
+		return "<< "
+	}
+	return ">> "
+}
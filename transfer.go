@@ -0,0 +1,56 @@
+package telnet
+
+import (
+	"bytes"
+	"log/slog"
+)
+
+// TransferProtocol is a file transfer protocol run over a Connection.
+type TransferProtocol int
+
+const (
+	// ZMODEM transfers start with a ZRQINIT or ZRINIT header, which Read
+	// detects to call OnTransfer.
+	ZMODEM TransferProtocol = iota + 1
+	// XMODEM transfers have no start sequence that can be told apart from
+	// typing, so are started by the application with Transfer.
+	XMODEM
+)
+
+func (p TransferProtocol) String() string {
+	switch p {
+	case ZMODEM:
+		return "ZMODEM"
+	case XMODEM:
+		return "XMODEM"
+	}
+	return "unknown"
+}
+
+// zmodemStart begins the hex header a ZMODEM sender or receiver sends first:
+// ZPAD ZPAD ZDLE 'B', then the frame type of ZRQINIT (00) or ZRINIT (01).
+var zmodemStart = []byte("**\x18B0")
+
+// Transfer runs fn with the Connection in transfer mode, in which newline
+// translation is suspended in both directions, so data read and written is
+// 8-bit clean while IAC is still escaped and commands are still handled. It
+// returns the error from fn. Read calls it for the OnTransfer hook when a
+// transfer is detected; call it directly to run one started by the
+// application, such as an XMODEM download the user has been asked to begin.
+func (c *Connection) Transfer(proto TransferProtocol, fn func(c *Connection, proto TransferProtocol) error) error {
+	c.log(slog.LevelInfo, "telnet: file transfer started", "protocol", proto.String())
+	c.transferring.Store(true)
+	err := fn(c, proto)
+	c.transferring.Store(false)
+	c.log(slog.LevelInfo, "telnet: file transfer ended", "protocol", proto.String(), "error", err)
+	return err
+}
+
+// detectTransfer returns the index in b of the start of a transfer that
+// OnTransfer should be called for, or -1.
+func (c *Connection) detectTransfer(b []byte) int {
+	if c.OnTransfer == nil || len(c.dataReaders) > 0 || c.transferring.Load() {
+		return -1
+	}
+	return bytes.Index(b, zmodemStart)
+}
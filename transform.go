@@ -0,0 +1,259 @@
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Stage identifies the position of a Transform in a Connection's pipeline.
+// Data written by the application passes through the StageCharset
+// transforms, then telnet framing (IAC escaping and NVT newlines), then the
+// StageCompression and StageEncryption transforms before reaching the
+// network; data read passes through the same stages in reverse.
+type Stage int
+
+const (
+	// StageCharset transforms application data, such as for CHARSET.
+	StageCharset Stage = iota
+	// StageCompression transforms the framed telnet stream, such as for MCCP.
+	StageCompression
+	// StageEncryption transforms the stream next to the network, such as for
+	// ENCRYPT.
+	StageEncryption
+)
+
+// Transform is a stage of a Connection's pipeline, such as compression or
+// character set conversion. Either method may return its argument unchanged
+// to leave that direction alone. If a writer returned by NewWriter has a
+// Flush method, it is called after each write to the Connection; if it has a
+// Close method, it is called when the Transform is removed.
+type Transform interface {
+	// NewReader returns a reader that decodes data read from r.
+	NewReader(r io.Reader) io.Reader
+	// NewWriter returns a writer that encodes data written to it onto w.
+	NewWriter(w io.Writer) io.Writer
+}
+
+var (
+	// ErrTransformOrder is returned by AddTransform when a transform would be
+	// placed beneath one that is already active: compression and encryption
+	// must be added from the network inwards.
+	ErrTransformOrder = errors.New("telnet: transform added beneath an active transform")
+
+	// ErrTransformNotInnermost is returned by RemoveTransform when the
+	// transform is not the most recently added one active at its stage.
+	ErrTransformNotInnermost = errors.New("telnet: transform is not the innermost active transform")
+)
+
+// transformStage is an active Transform.
+type transformStage struct {
+	stage Stage
+	t     Transform
+	r     io.Reader
+	w     io.Writer
+	below io.Writer // writer w was built on
+
+	// For stages below framing, the source of r, whose unread data is
+	// decoded directly once the stage is removed
+	in      *bufio.Reader
+	pending *bytes.Reader
+}
+
+// AddTransform adds t to the pipeline at the given stage, inside any
+// transforms already active there. The reading side takes effect from the
+// next byte the parser has yet to decode, so an InlineNegotiator may start a
+// transform immediately after the subnegotiation that announces it. Because
+// the read pipeline is owned by the reading goroutine, AddTransform must be
+// called from an InlineNegotiator or from the goroutine calling Read.
+func (c *Connection) AddTransform(stage Stage, t Transform) error {
+	ts := &transformStage{stage: stage, t: t}
+	if stage == StageCharset {
+		ts.r = t.NewReader(c.dataReader())
+		c.dataReaders = append(c.dataReaders, ts)
+		c.wmu.Lock()
+		ts.below = c.dataWriter()
+		ts.w = t.NewWriter(ts.below)
+		c.dataWriters = append(c.dataWriters, ts)
+		c.wmu.Unlock()
+		return nil
+	}
+
+	if n := len(c.streamReaders); n > 0 && c.streamReaders[n-1].stage < stage {
+		return ErrTransformOrder
+	}
+	// Bytes already read from the network but not yet decoded belong to the
+	// new stage. A bufio.Reader keeps anything the transform leaves unread,
+	// and gives decompressors an io.ByteReader so they don't read ahead.
+	ts.pending = bytes.NewReader(append([]byte(nil), c.buf[c.r:c.w]...))
+	c.w = c.r
+	ts.in = bufio.NewReader(io.MultiReader(ts.pending, c.wireReader()))
+	ts.r = t.NewReader(ts.in)
+	c.streamReaders = append(c.streamReaders, ts)
+
+	c.wmu.Lock()
+	ts.below = c.wireWriter()
+	ts.w = t.NewWriter(ts.below)
+	c.streamWriters = append(c.streamWriters, ts)
+	c.wmu.Unlock()
+	return nil
+}
+
+// AddWriteTransform adds t to the writing side of the pipeline only, at the
+// given stage, inside any transforms already active there, for encodings the
+// peer applies to one direction alone, such as MCCP2, where only the server's
+// output is compressed. t's NewReader is not called. Data written after
+// AddWriteTransform returns passes through t; as no other write to the
+// Connection can come in between, a writer may announce itself to the peer by
+// writing to the stage beneath it before its first encoded output. Unlike
+// AddTransform, AddWriteTransform may be called from any goroutine, such as
+// from a Negotiator's HandleDo.
+func (c *Connection) AddWriteTransform(stage Stage, t Transform) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	ts := &transformStage{stage: stage, t: t}
+	if stage == StageCharset {
+		ts.below = c.dataWriter()
+		ts.w = t.NewWriter(ts.below)
+		c.dataWriters = append(c.dataWriters, ts)
+		return nil
+	}
+	if n := len(c.streamWriters); n > 0 && c.streamWriters[n-1].stage < stage {
+		return ErrTransformOrder
+	}
+	ts.below = c.wireWriter()
+	ts.w = t.NewWriter(ts.below)
+	c.streamWriters = append(c.streamWriters, ts)
+	return nil
+}
+
+// RemoveTransform removes t from the pipeline, closing its writer if it has a
+// Close method. Reading resumes from the data t's reader left unread; data it
+// had already consumed from the stages beneath it is not recovered, so reads
+// switch over exactly only for self-delimiting encodings such as zlib streams.
+// A stage whose reader returns io.EOF is removed from the reading side
+// automatically, which suits encodings such as MCCP that the peer ends in-band.
+// t must be the innermost transform at its stage, and like AddTransform,
+// RemoveTransform must be called from an InlineNegotiator or the goroutine
+// calling Read, unless t was added with AddWriteTransform.
+func (c *Connection) RemoveTransform(t Transform) error {
+	readers, writers := &c.streamReaders, &c.streamWriters
+	if hasTransform(c.dataReaders, t) {
+		readers, writers = &c.dataReaders, &c.dataWriters
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	inReaders, inWriters := hasTransform(*readers, t), hasTransform(*writers, t)
+	if !inReaders && !inWriters ||
+		inReaders && (*readers)[len(*readers)-1].t != t ||
+		inWriters && (*writers)[len(*writers)-1].t != t {
+		return ErrTransformNotInnermost
+	}
+	if inReaders {
+		if readers == &c.streamReaders {
+			c.popStreamReader()
+		} else {
+			*readers = (*readers)[:len(*readers)-1]
+		}
+	}
+	if inWriters {
+		ts := (*writers)[len(*writers)-1]
+		*writers = (*writers)[:len(*writers)-1]
+		if cl, ok := ts.w.(io.Closer); ok && ts.w != ts.below {
+			return cl.Close()
+		}
+	}
+	return nil
+}
+
+// popStreamReader removes the innermost stage from the reading side below
+// framing, arranging for the data it left unread to be decoded next.
+func (c *Connection) popStreamReader() {
+	n := len(c.streamReaders)
+	ts := c.streamReaders[n-1]
+	c.streamReaders = c.streamReaders[:n-1]
+	unread, _ := ts.in.Peek(ts.in.Buffered())
+	rest := make([]byte, ts.pending.Len())
+	ts.pending.Read(rest)
+	c.buf = append(append(c.buf[:c.w], unread...), rest...)
+	c.w = len(c.buf)
+	c.buf = c.buf[:cap(c.buf)]
+}
+
+// hasTransform reports whether t is one of the stages.
+func hasTransform(stages []*transformStage, t Transform) bool {
+	for _, ts := range stages {
+		if ts.t == t {
+			return true
+		}
+	}
+	return false
+}
+
+// wireReader returns the reader the parser fills its buffer from.
+func (c *Connection) wireReader() io.Reader {
+	if n := len(c.streamReaders); n > 0 {
+		return c.streamReaders[n-1].r
+	}
+	return rawIO{c}
+}
+
+// wireWriter returns the writer framed data is written to. The caller must
+// hold c.wmu.
+func (c *Connection) wireWriter() io.Writer {
+	if n := len(c.streamWriters); n > 0 {
+		return c.streamWriters[n-1].w
+	}
+	return rawIO{c}
+}
+
+// dataReader returns the reader beneath the innermost StageCharset transform.
+func (c *Connection) dataReader() io.Reader {
+	if n := len(c.dataReaders); n > 0 {
+		return c.dataReaders[n-1].r
+	}
+	return dataIO{c}
+}
+
+// dataWriter returns the writer beneath the innermost StageCharset transform.
+// The caller must hold c.wmu.
+func (c *Connection) dataWriter() io.Writer {
+	if n := len(c.dataWriters); n > 0 {
+		return c.dataWriters[n-1].w
+	}
+	return dataIO{c}
+}
+
+// writeWire writes framed data, after any held by WriteCoalescing. The caller
+// must hold c.wmu.
+func (c *Connection) writeWire(b []byte) (int, error) {
+	if held := len(c.wheld); held > 0 {
+		c.wheld = append(c.wheld, b...)
+		n, err := c.writeStream(c.wheld)
+		c.wheld = c.wheld[:0]
+		return max(n-held, 0), err
+	}
+	return c.writeStream(b)
+}
+
+// writeStream writes framed data through the compression and encryption
+// stages, flushing each stage that buffers. The caller must hold c.wmu.
+func (c *Connection) writeStream(b []byte) (int, error) {
+	c.Trace.wireWritten(b)
+	n, err := c.wireWriter().Write(b)
+	c.counts.streamWritten.Add(uint64(n))
+	for i := len(c.streamWriters) - 1; i >= 0 && err == nil; i-- {
+		if f, ok := c.streamWriters[i].w.(interface{ Flush() error }); ok {
+			err = f.Flush()
+		}
+	}
+	return n, c.opError("write", err)
+}
+
+// dataIO reads and writes application data beneath any StageCharset
+// transforms.
+type dataIO struct{ c *Connection }
+
+func (d dataIO) Read(b []byte) (int, error)  { return d.c.readData(b) }
+func (d dataIO) Write(b []byte) (int, error) { return d.c.writeData(b) }
@@ -0,0 +1,67 @@
+package telnet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Translator returns a filter converting between the protocols spoken by the
+// two sides of a Proxy - for example, relaying a server's MSDP to a client as
+// GMCP, or stripping MXP markup for a client that does not support it. It is
+// called once for each Proxy, so the filter may keep state for that session.
+//
+// Translators are registered by name with RegisterTranslator, typically from
+// the init function of the package implementing them, and installed on a Proxy
+// with Translate.
+type Translator func(p *Proxy) *ProxyFilter
+
+var (
+	translatorsMu sync.RWMutex
+	translators   = make(map[string]Translator)
+)
+
+// RegisterTranslator makes a Translator available by name to Proxy.Translate.
+// It panics if t is nil or a Translator is already registered with the name.
+func RegisterTranslator(name string, t Translator) {
+	translatorsMu.Lock()
+	defer translatorsMu.Unlock()
+	if t == nil {
+		panic("telnet: RegisterTranslator translator is nil")
+	}
+	if _, dup := translators[name]; dup {
+		panic("telnet: RegisterTranslator called twice for translator " + name)
+	}
+	translators[name] = t
+}
+
+// Translators returns the names of the registered Translators, sorted.
+func Translators() []string {
+	translatorsMu.RLock()
+	defer translatorsMu.RUnlock()
+	names := make([]string, 0, len(translators))
+	for name := range translators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Translate appends the filters of the named Translators to the Proxy's
+// Filters, in the order given. It must be called before Run. It returns an
+// error, and installs none of them, if any name is not registered.
+func (p *Proxy) Translate(names ...string) error {
+	translatorsMu.RLock()
+	ts := make([]Translator, len(names))
+	for i, name := range names {
+		if ts[i] = translators[name]; ts[i] == nil {
+			translatorsMu.RUnlock()
+			return fmt.Errorf("telnet: unknown translator %q", name)
+		}
+	}
+	translatorsMu.RUnlock()
+	for _, t := range ts {
+		p.Filters = append(p.Filters, t(p))
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+// Package vt models the display of a VT100-compatible terminal, so that bots
+// and tests can examine what a telnet server's output would show on screen
+// rather than the raw bytes that produce it:
+//
+//	s := vt.NewScreen(80, 24)
+//	conn.Trace = s.Trace()
+//	...
+//	if strings.Contains(s.Line(0), "Welcome") {
+//
+// The common VT100 and ANSI sequences for cursor movement, erasing, scrolling
+// and character attributes are interpreted, along with xterm's 256-colour
+// attributes and window title. Other sequences are consumed and ignored.
+package vt
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tester2024/telnet"
+)
+
+// Color is a character's foreground or background colour: DefaultColor, or an
+// index into the xterm 256-colour palette, whose first 16 entries are the
+// standard and bright ANSI colours.
+type Color int16
+
+// DefaultColor is the terminal's default foreground or background colour.
+const DefaultColor Color = -1
+
+// Attr holds the display attributes of a character.
+type Attr struct {
+	FG, BG    Color
+	Bold      bool
+	Underline bool
+	Blink     bool
+	Reverse   bool
+}
+
+// defaultAttr is the attributes of text written after a reset.
+var defaultAttr = Attr{FG: DefaultColor, BG: DefaultColor}
+
+// Cell is a character position on the screen.
+type Cell struct {
+	Rune rune // zero if nothing has been written there
+	Attr Attr
+}
+
+// Parser states.
+const (
+	stateGround  = iota
+	stateEsc     // received ESC
+	stateCSI     // received ESC [, collecting parameters
+	stateOSC     // received ESC ], collecting the string
+	stateOSCEsc  // received ESC within an OSC string
+	stateCharset // received ESC ( or ESC ), awaiting the designator
+)
+
+// Screen is a model of a terminal's display, updated by writing the output
+// of a session to it. It is safe for concurrent use.
+type Screen struct {
+	mu            sync.Mutex
+	width, height int
+	cells         [][]Cell
+	x, y          int  // cursor position
+	wrap          bool // cursor is past the last column, wrapping on the next character
+	attr          Attr
+	savedX        int
+	savedY        int
+	savedAttr     Attr
+	top, bottom   int // scrolling region, inclusive
+	title         string
+
+	state   int
+	params  []byte // CSI parameters or OSC string
+	partial []byte // incomplete UTF-8 sequence
+}
+
+// NewScreen returns a blank Screen of the given size.
+func NewScreen(width, height int) *Screen {
+	s := &Screen{}
+	s.resize(width, height)
+	s.attr = defaultAttr
+	s.savedAttr = defaultAttr
+	return s
+}
+
+// Trace returns a ConnectionTrace that writes the data read from a Connection
+// to the Screen.
+func (s *Screen) Trace() *telnet.ConnectionTrace {
+	return &telnet.ConnectionTrace{DataRead: func(b []byte) { s.Write(b) }}
+}
+
+// Size returns the width and height of the Screen.
+func (s *Screen) Size() (width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.width, s.height
+}
+
+// Resize changes the size of the Screen, keeping the text at the top left and
+// clamping the cursor to the new size. The scrolling region is reset.
+func (s *Screen) Resize(width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resize(width, height)
+}
+
+func (s *Screen) resize(width, height int) {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	cells := make([][]Cell, height)
+	for y := range cells {
+		cells[y] = make([]Cell, width)
+		if y < len(s.cells) {
+			copy(cells[y], s.cells[y])
+		}
+	}
+	s.cells, s.width, s.height = cells, width, height
+	s.top, s.bottom = 0, height-1
+	s.x, s.y = clamp(s.x, 0, width-1), clamp(s.y, 0, height-1)
+	s.wrap = false
+}
+
+// Cursor returns the position of the cursor, counted from zero at the top left.
+func (s *Screen) Cursor() (x, y int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.x, s.y
+}
+
+// Cell returns the cell at the given position, or a zero Cell if it is off
+// the screen.
+func (s *Screen) Cell(x, y int) Cell {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if x < 0 || x >= s.width || y < 0 || y >= s.height {
+		return Cell{}
+	}
+	return s.cells[y][x]
+}
+
+// Line returns the text of line y, with trailing blanks removed.
+func (s *Screen) Line(y int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if y < 0 || y >= s.height {
+		return ""
+	}
+	return s.line(y)
+}
+
+func (s *Screen) line(y int) string {
+	var b strings.Builder
+	for _, c := range s.cells[y] {
+		if c.Rune == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteRune(c.Rune)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// String returns the text of the Screen, one line per row with trailing blanks
+// removed, and trailing blank lines omitted.
+func (s *Screen) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := make([]string, s.height)
+	for y := range lines {
+		lines[y] = s.line(y)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// Title returns the window title last set with an xterm OSC sequence.
+func (s *Screen) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.title
+}
+
+// Write interprets b as terminal output, updating the Screen. Sequences may
+// be split between calls. It always returns len(b), nil.
+func (s *Screen) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range b {
+		s.byte(ch)
+	}
+	return len(b), nil
+}
+
+// byte advances the parser by one byte.
+func (s *Screen) byte(ch byte) {
+	switch s.state {
+	case stateEsc:
+		s.escape(ch)
+		return
+	case stateCSI:
+		switch {
+		case ch >= 0x40 && ch <= 0x7e:
+			s.state = stateGround
+			s.csi(ch)
+		case ch == 0x1b:
+			s.state = stateEsc
+		case ch >= 0x20:
+			s.params = append(s.params, ch)
+		default:
+			s.control(ch)
+		}
+		return
+	case stateOSC:
+		switch ch {
+		case 0x07:
+			s.state = stateGround
+			s.osc()
+		case 0x1b:
+			s.state = stateOSCEsc
+		default:
+			s.params = append(s.params, ch)
+		}
+		return
+	case stateOSCEsc:
+		// ESC \ terminates the string; anything else starts a new sequence.
+		s.osc()
+		s.state = stateGround
+		if ch != '\\' {
+			s.state = stateEsc
+			s.escape(ch)
+		}
+		return
+	case stateCharset:
+		s.state = stateGround
+		return
+	}
+
+	if ch < 0x20 || ch == 0x7f {
+		s.partial = s.partial[:0]
+		s.control(ch)
+		return
+	}
+	s.partial = append(s.partial, ch)
+	if !utf8.FullRune(s.partial) {
+		return
+	}
+	r, _ := utf8.DecodeRune(s.partial)
+	s.partial = s.partial[:0]
+	s.put(r)
+}
+
+// control handles a C0 control character.
+func (s *Screen) control(ch byte) {
+	switch ch {
+	case 0x1b:
+		s.state = stateEsc
+	case '\r':
+		s.x, s.wrap = 0, false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrap = false
+	case '\t':
+		s.x = clamp((s.x/8+1)*8, 0, s.width-1)
+		s.wrap = false
+	}
+}
+
+// escape handles the byte following ESC.
+func (s *Screen) escape(ch byte) {
+	s.state = stateGround
+	switch ch {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+	case ']':
+		s.state = stateOSC
+		s.params = s.params[:0]
+	case '(', ')':
+		s.state = stateCharset
+	case '7':
+		s.savedX, s.savedY, s.savedAttr = s.x, s.y, s.attr
+	case '8':
+		s.x, s.y, s.attr, s.wrap = s.savedX, s.savedY, s.savedAttr, false
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		if s.y == s.top {
+			s.scrollDown(1)
+		} else if s.y > 0 {
+			s.y--
+		}
+		s.wrap = false
+	case 'c':
+		s.attr, s.savedAttr = defaultAttr, defaultAttr
+		s.x, s.y, s.savedX, s.savedY = 0, 0, 0, 0
+		s.title = ""
+		for y := range s.cells {
+			s.erase(s.cells[y])
+		}
+		s.resize(s.width, s.height)
+	}
+}
+
+// osc handles a complete OSC string.
+func (s *Screen) osc() {
+	p := string(s.params)
+	if strings.HasPrefix(p, "0;") || strings.HasPrefix(p, "2;") {
+		s.title = p[2:]
+	}
+}
+
+// put writes a character at the cursor and advances it.
+func (s *Screen) put(r rune) {
+	if s.wrap {
+		s.x = 0
+		s.lineFeed()
+	}
+	s.cells[s.y][s.x] = Cell{Rune: r, Attr: s.attr}
+	if s.x == s.width-1 {
+		s.wrap = true
+	} else {
+		s.x++
+	}
+}
+
+// lineFeed moves the cursor down a line, scrolling at the bottom of the
+// scrolling region.
+func (s *Screen) lineFeed() {
+	s.wrap = false
+	if s.y == s.bottom {
+		s.scrollUp(1)
+	} else if s.y < s.height-1 {
+		s.y++
+	}
+}
+
+// scrollUp scrolls the scrolling region up by n lines.
+func (s *Screen) scrollUp(n int) {
+	region := s.cells[s.top : s.bottom+1]
+	n = clamp(n, 0, len(region))
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = s.blankLine()
+	}
+}
+
+// scrollDown scrolls the scrolling region down by n lines.
+func (s *Screen) scrollDown(n int) {
+	region := s.cells[s.top : s.bottom+1]
+	n = clamp(n, 0, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = s.blankLine()
+	}
+}
+
+// blankLine returns a line erased with the current background.
+func (s *Screen) blankLine() []Cell {
+	line := make([]Cell, s.width)
+	s.erase(line)
+	return line
+}
+
+// erase blanks cells with the current background.
+func (s *Screen) erase(cells []Cell) {
+	blank := Cell{Attr: Attr{FG: DefaultColor, BG: s.attr.BG}}
+	for i := range cells {
+		cells[i] = blank
+	}
+}
+
+// csi handles a complete CSI sequence with the given final byte.
+func (s *Screen) csi(final byte) {
+	if len(s.params) > 0 && (s.params[0] < '0' || s.params[0] > ';') {
+		// Private sequences, such as DEC modes, are not modelled.
+		return
+	}
+	p := parseParams(s.params)
+	arg := func(i, def int) int {
+		if i < len(p) && p[i] > 0 {
+			return p[i]
+		}
+		return def
+	}
+	s.wrap = false
+	switch final {
+	case 'A':
+		s.y = clamp(s.y-arg(0, 1), 0, s.height-1)
+	case 'B':
+		s.y = clamp(s.y+arg(0, 1), 0, s.height-1)
+	case 'C':
+		s.x = clamp(s.x+arg(0, 1), 0, s.width-1)
+	case 'D':
+		s.x = clamp(s.x-arg(0, 1), 0, s.width-1)
+	case 'E':
+		s.x, s.y = 0, clamp(s.y+arg(0, 1), 0, s.height-1)
+	case 'F':
+		s.x, s.y = 0, clamp(s.y-arg(0, 1), 0, s.height-1)
+	case 'G', '`':
+		s.x = clamp(arg(0, 1)-1, 0, s.width-1)
+	case 'd':
+		s.y = clamp(arg(0, 1)-1, 0, s.height-1)
+	case 'H', 'f':
+		s.x, s.y = clamp(arg(1, 1)-1, 0, s.width-1), clamp(arg(0, 1)-1, 0, s.height-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cells[s.y][s.x:])
+			for y := s.y + 1; y < s.height; y++ {
+				s.erase(s.cells[y])
+			}
+		case 1:
+			s.erase(s.cells[s.y][:s.x+1])
+			for y := 0; y < s.y; y++ {
+				s.erase(s.cells[y])
+			}
+		case 2, 3:
+			for y := range s.cells {
+				s.erase(s.cells[y])
+			}
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cells[s.y][s.x:])
+		case 1:
+			s.erase(s.cells[s.y][:s.x+1])
+		case 2:
+			s.erase(s.cells[s.y])
+		}
+	case 'X':
+		s.erase(s.cells[s.y][s.x:clamp(s.x+arg(0, 1), 0, s.width)])
+	case 'P':
+		line := s.cells[s.y]
+		n := clamp(arg(0, 1), 0, s.width-s.x)
+		copy(line[s.x:], line[s.x+n:])
+		s.erase(line[s.width-n:])
+	case '@':
+		line := s.cells[s.y]
+		n := clamp(arg(0, 1), 0, s.width-s.x)
+		copy(line[s.x+n:], line[s.x:])
+		s.erase(line[s.x : s.x+n])
+	case 'L', 'M':
+		if s.y < s.top || s.y > s.bottom {
+			return
+		}
+		top := s.top
+		s.top = s.y
+		if final == 'L' {
+			s.scrollDown(arg(0, 1))
+		} else {
+			s.scrollUp(arg(0, 1))
+		}
+		s.top = top
+		s.x = 0
+	case 'S':
+		s.scrollUp(arg(0, 1))
+	case 'T':
+		s.scrollDown(arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.height)-1
+		if top < bottom && bottom < s.height {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.x, s.y = s.savedX, s.savedY
+	case 'm':
+		s.sgr(p)
+	}
+}
+
+// sgr applies a Select Graphic Rendition sequence.
+func (s *Screen) sgr(p []int) {
+	if len(p) == 0 {
+		p = []int{0}
+	}
+	for i := 0; i < len(p); i++ {
+		switch n := p[i]; {
+		case n == 0:
+			s.attr = defaultAttr
+		case n == 1:
+			s.attr.Bold = true
+		case n == 4:
+			s.attr.Underline = true
+		case n == 5:
+			s.attr.Blink = true
+		case n == 7:
+			s.attr.Reverse = true
+		case n == 22:
+			s.attr.Bold = false
+		case n == 24:
+			s.attr.Underline = false
+		case n == 25:
+			s.attr.Blink = false
+		case n == 27:
+			s.attr.Reverse = false
+		case n >= 30 && n <= 37:
+			s.attr.FG = Color(n - 30)
+		case n == 39:
+			s.attr.FG = DefaultColor
+		case n >= 40 && n <= 47:
+			s.attr.BG = Color(n - 40)
+		case n == 49:
+			s.attr.BG = DefaultColor
+		case n >= 90 && n <= 97:
+			s.attr.FG = Color(n - 90 + 8)
+		case n >= 100 && n <= 107:
+			s.attr.BG = Color(n - 100 + 8)
+		case n == 38 || n == 48:
+			// 38;5;n selects from the palette; 38;2;r;g;b is true colour,
+			// which is not modelled.
+			c := DefaultColor
+			if i+2 < len(p) && p[i+1] == 5 {
+				c = Color(clamp(p[i+2], 0, 255))
+				i += 2
+			} else if i+1 < len(p) && p[i+1] == 2 {
+				i += 4
+			}
+			if n == 38 {
+				s.attr.FG = c
+			} else {
+				s.attr.BG = c
+			}
+		}
+	}
+}
+
+// parseParams parses semicolon-separated CSI parameters. Missing parameters
+// are zero.
+func parseParams(b []byte) []int {
+	if len(b) == 0 {
+		return nil
+	}
+	p := []int{0}
+	for _, ch := range b {
+		switch {
+		case ch == ';':
+			p = append(p, 0)
+		case ch >= '0' && ch <= '9':
+			if n := &p[len(p)-1]; *n < 10000 {
+				*n = *n*10 + int(ch-'0')
+			}
+		}
+	}
+	return p
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
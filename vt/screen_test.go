@@ -0,0 +1,76 @@
+package vt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tester2024/telnet/telnettest"
+	"github.com/tester2024/telnet/vt"
+)
+
+func TestScreen(t *testing.T) {
+	s := vt.NewScreen(10, 4)
+	s.Write([]byte("hello\r\nwor"))
+	s.Write([]byte("ld\x1b[1;3"))
+	s.Write([]byte("1mX\x1b[0m\x1b]0;Title\x07"))
+	if got, want := s.String(), "hello\nworldX"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if c := s.Cell(5, 1); c.Rune != 'X' || !c.Attr.Bold || c.Attr.FG != 1 {
+		t.Errorf("Expected a bold red X, got %+v", c)
+	}
+	if c := s.Cell(0, 1); c.Attr.Bold || c.Attr.FG != vt.DefaultColor {
+		t.Errorf("Expected plain text, got %+v", c)
+	}
+	if x, y := s.Cursor(); x != 6 || y != 1 {
+		t.Errorf("Expected the cursor at 6,1, got %d,%d", x, y)
+	}
+	if s.Title() != "Title" {
+		t.Errorf("Expected title %q, got %q", "Title", s.Title())
+	}
+
+	// Position, erase and insert.
+	s.Write([]byte("\x1b[1;2H\x1b[K\x1b[2;1H\x1b[2@ab\x1b[4;10Hé"))
+	if got, want := s.String(), "h\nabworldX\n\n         é"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// Wrapping at the last column, then scrolling at the bottom.
+	s.Write([]byte("xyz"))
+	if got, want := s.String(), "abworldX\n\n         é\nxyz"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	s.Write([]byte("\x1b[2J\x1b[H\x1b[38;5;200mhi"))
+	if got := s.String(); got != "hi" {
+		t.Errorf("Expected %q after clearing, got %q", "hi", got)
+	}
+	if c := s.Cell(0, 0); c.Attr.FG != 200 {
+		t.Errorf("Expected colour 200, got %d", c.Attr.FG)
+	}
+}
+
+func TestScreen_ScrollRegion(t *testing.T) {
+	s := vt.NewScreen(5, 4)
+	s.Write([]byte("1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[3;1H\nx"))
+	if got, want := s.String(), "1\n3\nx\n4"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestScreen_Trace(t *testing.T) {
+	peer, conn := telnettest.NewPeer()
+	defer conn.Close()
+	s := vt.NewScreen(20, 2)
+	conn.Trace = s.Trace()
+	peer.Write([]byte("\x1b[2;3Hready"))
+	buf := make([]byte, 64)
+	for !strings.Contains(s.Line(1), "ready") {
+		if _, err := conn.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Line(1); got != "  ready" {
+		t.Errorf("Expected %q, got %q", "  ready", got)
+	}
+}
@@ -0,0 +1,117 @@
+// Package wsbridge relays WebSocket connections to telnet servers, so that
+// browser-based terminals such as xterm.js can connect to them.
+package wsbridge
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/tester2024/telnet"
+)
+
+// Bridge is an http.Handler that accepts WebSocket connections and relays each
+// to a telnet server over a new Connection. The WebSocket client deals only in
+// terminal data: what it sends, in binary or text messages, is written to the
+// telnet server with IAC escaped and newlines translated, and the data read
+// from the server is sent back with telnet commands removed. Negotiation with
+// the server is left to the Options.
+type Bridge struct {
+	// Addr is the address of the telnet server, in host:port form.
+	Addr string
+
+	// Options are the option handlers for each Connection to the server.
+	Options []telnet.Option
+
+	// Text, if set, sends data to the WebSocket client in text messages rather
+	// than binary ones. The data is sent as received, holding back a
+	// character split between reads until it is complete, so the server's
+	// output should be UTF-8.
+	Text bool
+
+	// Upgrader upgrades requests to WebSocket connections. Set its
+	// CheckOrigin to accept cross-origin requests; by default only requests
+	// from the same host are accepted.
+	Upgrader websocket.Upgrader
+
+	// Dial, if set, is used instead of telnet.Dial to connect to the server.
+	Dial func(addr string, options ...telnet.Option) (*telnet.Connection, error)
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection, connects to the
+// telnet server and relays between them until either side closes. If the
+// server cannot be reached, the WebSocket is closed with an error status.
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := b.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has replied with an HTTP error.
+		return
+	}
+	defer ws.Close()
+	dial := b.Dial
+	if dial == nil {
+		dial = telnet.Dial
+	}
+	conn, err := dial(b.Addr, b.Options...)
+	if err != nil {
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "telnet server unavailable"))
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		// Closing the Connection ends the relay to the WebSocket below.
+		defer conn.Close()
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err := conn.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	typ := websocket.BinaryMessage
+	if b.Text {
+		typ = websocket.TextMessage
+	}
+	buf := make([]byte, 4096)
+	held := 0 // the start of a character, at the start of buf
+	for {
+		n, err := conn.Read(buf[held:])
+		n += held
+		if b.Text {
+			held = incompleteRune(buf[:n])
+		}
+		if n > held {
+			if err := ws.WriteMessage(typ, buf[:n-held]); err != nil {
+				return
+			}
+			copy(buf, buf[n-held:n])
+		}
+		if _, ok := err.(*telnet.SubnegotiationTooLargeError); ok {
+			// The subnegotiation is discarded, but the session goes on.
+			continue
+		}
+		if err != nil {
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// incompleteRune returns the length of the incomplete UTF-8 character at the
+// end of b, or 0 if b does not end with one.
+func incompleteRune(b []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if utf8.FullRune(b[len(b)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package wsbridge_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/tester2024/telnet"
+	"github.com/tester2024/telnet/telnettest"
+	"github.com/tester2024/telnet/wsbridge"
+)
+
+func TestBridge(t *testing.T) {
+	upstream := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		io.Copy(c, c)
+	}))
+	defer upstream.Close()
+	for _, text := range []bool{false, true} {
+		s := httptest.NewServer(&wsbridge.Bridge{Addr: upstream.Addr, Text: text})
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// An IAC in the data survives the trip through the telnet server.
+		sent := "hello \xff"
+		typ := websocket.BinaryMessage
+		if text {
+			sent, typ = "hello", websocket.TextMessage
+		}
+		ws.WriteMessage(typ, []byte(sent))
+
+		var got []byte
+		for len(got) < len(sent) {
+			mt, msg, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mt != typ {
+				t.Errorf("Expected message type %d, got %d", typ, mt)
+			}
+			got = append(got, msg...)
+		}
+		if string(got) != sent {
+			t.Errorf("Expected %q, got %q", sent, got)
+		}
+		ws.Close()
+		s.Close()
+	}
+}
+
+func TestBridge_Text(t *testing.T) {
+	upstream := telnettest.NewServer(telnet.HandleFunc(func(c *telnet.Connection) {
+		// A subnegotiation too large for the bridge, then a character split
+		// between writes.
+		c.RawWrite([]byte("\xff\xfa\xc8" + strings.Repeat("x", 64) + "\xff\xf0caf\xc3"))
+		time.Sleep(50 * time.Millisecond)
+		c.Write([]byte("\xa9"))
+		io.Copy(io.Discard, c)
+	}))
+	defer upstream.Close()
+	s := httptest.NewServer(&wsbridge.Bridge{
+		Addr: upstream.Addr,
+		Text: true,
+		Dial: func(addr string, options ...telnet.Option) (*telnet.Connection, error) {
+			return telnet.DialConfig("tcp", addr, &telnet.Config{Options: options, MaxSubnegotiationSize: 16})
+		},
+	})
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	const want = "café"
+	var got []byte
+	for len(got) < len(want) {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.Valid(msg) {
+			t.Errorf("Expected valid UTF-8, got %q", msg)
+		}
+		got = append(got, msg...)
+	}
+	if string(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestBridge_Unavailable(t *testing.T) {
+	s := httptest.NewServer(&wsbridge.Bridge{Addr: "127.0.0.1:1"})
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected close status %d, got %v", websocket.CloseTryAgainLater, err)
+	}
+}